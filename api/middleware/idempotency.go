@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/eh"
+	jwt "github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// IdempotencyKeyHeader is the header clients use to make a request idempotent
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader is set on responses replayed from a previous request
+	IdempotentReplayHeader = "Idempotent-Replayed"
+	// IdempotencyKeyTTL is how long responses are stored for replay
+	IdempotencyKeyTTL = time.Hour * 24
+	// maxIdempotencyKeyLength is the longest idempotency key we accept
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize is the largest response body stored for replay.
+	// Larger responses come from downloads, which are safe to repeat, so
+	// their keys are released rather than holding the body in memory
+	maxIdempotentBodySize = 1 << 20
+)
+
+// IdempotencyRecord stores the response to a request made with an idempotency
+// key, so that it can be replayed when the request is retried
+type IdempotencyRecord struct {
+	ID       uint   `gorm:"primary_key"`
+	UserName string `gorm:"type:varchar(255);unique_index:idx_idempotency_user_key"`
+	Key      string `gorm:"type:varchar(255);unique_index:idx_idempotency_user_key"`
+	Method   string `gorm:"type:varchar(16)"`
+	Path     string `gorm:"type:text"`
+	// Completed is false while the original request is still being processed
+	Completed   bool
+	StatusCode  int
+	ContentType string `gorm:"type:varchar(255)"`
+	Body        []byte
+	CreatedAt   time.Time `gorm:"index"`
+}
+
+// TableName returns the table used to store idempotency records
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
+
+// Idempotency allows clients to safely retry mutating requests by providing an
+// Idempotency-Key header. The first successful response for a user and key is
+// stored for 24 hours, and replayed for any retries. Failed requests release
+// their key, so that they can be retried once the failure is resolved. Retries
+// made while the original request is still being processed are rejected with a
+// 409. It must be used after the jwt middleware, as keys are scoped to the
+// authenticated user.
+func Idempotency(db *gorm.DB, l *zap.SugaredLogger) gin.HandlerFunc {
+	l = l.Named("idempotency-middleware")
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isMutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithMessage(c, http.StatusBadRequest, "idempotency key is too long")
+			return
+		}
+		username, ok := jwt.ExtractClaims(c)["id"].(string)
+		if !ok || username == "" {
+			c.Next()
+			return
+		}
+		record := &IdempotencyRecord{
+			UserName: username,
+			Key:      key,
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+		}
+		claimed, err := claimIdempotencyKey(db, record)
+		if err != nil {
+			l.Errorw("failed to claim idempotency key", "user", username, "error", err)
+			abortWithMessage(c, http.StatusInternalServerError, "failed to process idempotency key")
+			return
+		}
+		if !claimed {
+			replayIdempotentResponse(c, db, record)
+			return
+		}
+		// capture the response so that it can be stored
+		writer := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			// release the key if the request did not produce a usable response,
+			// so that the client is able to retry it. Failures are reported with
+			// a 4xx status as often as a 5xx, so only successes are stored
+			if r := recover(); r != nil {
+				db.Delete(record)
+				panic(r)
+			}
+			if writer.Status() < 200 || writer.Status() >= 300 || writer.overflow {
+				db.Delete(record)
+				return
+			}
+			if err := db.Model(record).Updates(map[string]interface{}{
+				"completed":    true,
+				"status_code":  writer.Status(),
+				"content_type": writer.Header().Get("Content-Type"),
+				"body":         writer.body.Bytes(),
+			}).Error; err != nil {
+				l.Errorw("failed to store idempotent response", "user", username, "error", err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// claimIdempotencyKey inserts the record unless a live record already exists for
+// the user and key, returning whether or not the record was inserted
+func claimIdempotencyKey(db *gorm.DB, record *IdempotencyRecord) (bool, error) {
+	// expired keys may be reused
+	if err := db.Where(
+		"user_name = ? AND key = ? AND created_at < ?",
+		record.UserName, record.Key, time.Now().Add(-IdempotencyKeyTTL),
+	).Delete(IdempotencyRecord{}).Error; err != nil {
+		return false, err
+	}
+	result := db.Set("gorm:insert_option", "ON CONFLICT DO NOTHING").Create(record)
+	switch result.Error {
+	case nil:
+		return result.RowsAffected == 1, nil
+	case sql.ErrNoRows:
+		// nothing was inserted, so no id was returned
+		return false, nil
+	default:
+		return false, result.Error
+	}
+}
+
+// replayIdempotentResponse responds with the stored response for a key
+func replayIdempotentResponse(c *gin.Context, db *gorm.DB, record *IdempotencyRecord) {
+	var existing IdempotencyRecord
+	if err := db.Where(
+		"user_name = ? AND key = ?", record.UserName, record.Key,
+	).First(&existing).Error; err != nil {
+		// the original request failed and released the key in the meantime
+		abortWithMessage(c, http.StatusConflict, "request with this idempotency key is being processed, please retry")
+		return
+	}
+	switch {
+	case existing.Method != record.Method || existing.Path != record.Path:
+		abortWithMessage(c, http.StatusUnprocessableEntity, "idempotency key has already been used for a different request")
+	case !existing.Completed:
+		abortWithMessage(c, http.StatusConflict, "request with this idempotency key is already being processed")
+	default:
+		c.Header(IdempotentReplayHeader, "true")
+		c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+		c.Abort()
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func abortWithMessage(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"code":     status,
+		"response": message,
+		"error":    eh.New(message, status),
+	})
+}
+
+// responseRecorder is a gin.ResponseWriter that keeps a copy of the response
+// body, until it grows larger than maxIdempotentBodySize
+type responseRecorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.record(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.record([]byte(s))
+	return r.ResponseWriter.WriteString(s)
+}
+
+func (r *responseRecorder) record(b []byte) {
+	if r.overflow {
+		return
+	}
+	if r.body.Len()+len(b) > maxIdempotentBodySize {
+		r.overflow = true
+		r.body = bytes.Buffer{}
+		return
+	}
+	r.body.Write(b)
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"time"
 
+	"github.com/RTradeLtd/Temporal/eh"
 	"github.com/RTradeLtd/database/v2/models"
 	jwt "github.com/appleboy/gin-jwt"
 	"github.com/gin-gonic/gin"
@@ -69,6 +70,7 @@ func JwtConfigGenerate(jwtKey, realmName string, db *gorm.DB, l *zap.SugaredLogg
 			c.JSON(code, gin.H{
 				"code":    code,
 				"message": message,
+				"error":   eh.New(message, code),
 			})
 		},
 
@@ -4,30 +4,65 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	"go.uber.org/zap/zaptest"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	jwtgo "gopkg.in/dgrijalva/jwt-go.v3"
 
+	"github.com/RTradeLtd/Temporal/log"
 	"github.com/RTradeLtd/config/v2"
 	"github.com/RTradeLtd/database/v2"
 )
 
 func TestRequestIDMiddleware(t *testing.T) {
-	testRecorder := httptest.NewRecorder()
-	_, engine := gin.CreateTestContext(testRecorder)
-	engine.Use(RequestID())
-	req, err := http.NewRequest("GET", "/foo", nil)
-	if err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name   string
+		header string
+		// wantHeader is the expected request id, or empty if one should be generated
+		wantHeader string
+	}{
+		{"Generated", "", ""},
+		{"Provided", "support-ticket-1234", "support-ticket-1234"},
+		{"Invalid", "bad id\n", ""},
+		{"TooLong", strings.Repeat("a", maxRequestIDLength+1), ""},
 	}
-	engine.GET("/foo", func(c *gin.Context) {
-		c.String(200, "hello")
-	})
-	engine.ServeHTTP(testRecorder, req)
-	if testRecorder.Result().Header.Get("X-Request-ID") == "" {
-		t.Fatal("failed to set a request header")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRecorder := httptest.NewRecorder()
+			_, engine := gin.CreateTestContext(testRecorder)
+			engine.Use(RequestID())
+			req, err := http.NewRequest("GET", "/foo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			var fromGin, fromContext string
+			engine.GET("/foo", func(c *gin.Context) {
+				fromGin = GetRequestID(c)
+				fromContext = log.RequestID(c.Request.Context())
+				c.String(200, "hello")
+			})
+			engine.ServeHTTP(testRecorder, req)
+			id := testRecorder.Result().Header.Get("X-Request-ID")
+			if id == "" {
+				t.Fatal("failed to set a request header")
+			}
+			if tt.wantHeader != "" && id != tt.wantHeader {
+				t.Fatalf("expected request id %s, got %s", tt.wantHeader, id)
+			}
+			if tt.wantHeader == "" && id == tt.header {
+				t.Fatal("invalid request id should have been replaced")
+			}
+			if fromGin != id || fromContext != id {
+				t.Fatalf("expected %s in contexts, got %s and %s", id, fromGin, fromContext)
+			}
+		})
 	}
 }
 
@@ -97,6 +132,144 @@ func TestSecMiddleware(t *testing.T) {
 	}
 }
 
+func TestSkipPaths(t *testing.T) {
+	_, engine := gin.CreateTestContext(httptest.NewRecorder())
+	engine.Use(SkipPaths(func(c *gin.Context) {
+		c.Header("X-Skipped", "false")
+		c.Next()
+	}, "/skip"))
+	engine.GET("/skip", func(c *gin.Context) { c.Status(http.StatusOK) })
+	engine.GET("/run", func(c *gin.Context) { c.Status(http.StatusOK) })
+	tests := []struct {
+		path    string
+		wantRun bool
+	}{
+		{"/skip", false},
+		{"/run", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest("GET", tt.path, nil))
+			if ran := recorder.Header().Get("X-Skipped") != ""; ran != tt.wantRun {
+				t.Fatalf("expected middleware run to be %v", tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.AutoMigrate(&IdempotencyRecord{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	key := uuid.New().String()
+	defer db.DB.Where("key = ?", key).Delete(IdempotencyRecord{})
+	var (
+		calls   int
+		release = make(chan struct{})
+		started = make(chan struct{})
+	)
+	_, engine := gin.CreateTestContext(httptest.NewRecorder())
+	engine.Use(func(c *gin.Context) {
+		// simulate the jwt middleware
+		c.Set("JWT_PAYLOAD", jwtgo.MapClaims{"id": "testuser"})
+	}, Idempotency(db.DB, zaptest.NewLogger(t).Sugar()))
+	engine.POST("/charge", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"response": calls})
+	})
+	var failures int
+	engine.POST("/flaky", func(c *gin.Context) {
+		failures++
+		if failures == 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"response": "failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": "done"})
+	})
+	var downloads int
+	engine.POST("/download", func(c *gin.Context) {
+		downloads++
+		c.Data(http.StatusOK, "application/octet-stream", make([]byte, maxIdempotentBodySize+1))
+	})
+	engine.POST("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"response": "done"})
+	})
+	send := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		return recorder
+	}
+	// the first request is processed
+	first := send("/charge", key)
+	if first.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("unexpected response %v, calls %v", first.Code, calls)
+	}
+	// retries are replayed
+	retry := send("/charge", key)
+	if retry.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("unexpected response %v, calls %v", retry.Code, calls)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected %s, got %s", first.Body.String(), retry.Body.String())
+	}
+	if retry.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Fatal("replayed response should be marked as such")
+	}
+	// requests without a key are always processed
+	if send("/charge", ""); calls != 2 {
+		t.Fatalf("expected 2 calls, got %v", calls)
+	}
+	// keys can not be reused for other requests
+	if resp := send("/slow", key); resp.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %v", resp.Code)
+	}
+	// failed requests release their key, so that they can be retried
+	flakyKey := uuid.New().String()
+	defer db.DB.Where("key = ?", flakyKey).Delete(IdempotencyRecord{})
+	if resp := send("/flaky", flakyKey); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %v", resp.Code)
+	}
+	if resp := send("/flaky", flakyKey); resp.Code != http.StatusOK || failures != 2 {
+		t.Fatalf("expected retry to be processed, got %v after %v calls", resp.Code, failures)
+	}
+	// responses too large to store are not replayed
+	downloadKey := uuid.New().String()
+	defer db.DB.Where("key = ?", downloadKey).Delete(IdempotencyRecord{})
+	for i := 1; i <= 2; i++ {
+		if resp := send("/download", downloadKey); resp.Code != http.StatusOK || resp.Body.Len() != maxIdempotentBodySize+1 || downloads != i {
+			t.Fatalf("unexpected download %v of %v bytes after %v calls", resp.Code, resp.Body.Len(), downloads)
+		}
+	}
+	// concurrent duplicates are rejected
+	slowKey := uuid.New().String()
+	defer db.DB.Where("key = ?", slowKey).Delete(IdempotencyRecord{})
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send("/slow", slowKey) }()
+	<-started
+	if resp := send("/slow", slowKey); resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %v", resp.Code)
+	}
+	close(release)
+	if resp := <-done; resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %v", resp.Code)
+	}
+}
+
 func loadDatabase(cfg *config.TemporalConfig) (*database.Manager, error) {
 	return database.New(cfg, database.Options{
 		SSLModeDisable: true,
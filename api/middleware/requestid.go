@@ -1,15 +1,54 @@
 package middleware
 
 import (
+	"github.com/RTradeLtd/Temporal/log"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-// RequestID is used to insert a randomly generated
-// uuid as a value to a X-Request-ID header
+const (
+	// RequestIDHeader is the header the request id is read from, and returned in
+	RequestIDHeader = "X-Request-Id"
+	// RequestIDKey is the gin context key the request id is stored under
+	RequestIDKey = "request_id"
+	// maxRequestIDLength is the longest request id we accept from clients
+	maxRequestIDLength = 64
+)
+
+// RequestID is used to identify each request. The id given in the
+// X-Request-ID header is used if valid, otherwise a random uuid is generated.
+// The id is returned in the X-Request-ID header, and stored in both the gin
+// and request contexts so it can be attached to logs and queue messages
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("X-Request-Id", uuid.New().String())
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		c.Set(RequestIDKey, id)
+		c.Request = c.Request.WithContext(log.WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
 		c.Next()
 	}
 }
+
+// GetRequestID returns the id of the request, as set by the RequestID middleware
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(RequestIDKey)
+}
+
+// validRequestID checks that a client provided request id is safe to log,
+// and to send along with queue messages
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
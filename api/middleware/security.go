@@ -9,6 +9,6 @@ import (
 func NewSecWare(devMode bool) gin.HandlerFunc {
 	config := secure.DefaultConfig()
 	config.IsDevelopment = devMode
-	config.ContentSecurityPolicy = "default-src 'self' https://checkout.stripe.com; connect-src https://checkout.stripe.com; frame-src https://checkout.stripe.com; script-src https://checkout.stripe.com; img-src https://*.stripe.com; object-src 'none'"
+	config.ContentSecurityPolicy = "default-src 'self' https://checkout.stripe.com; connect-src https://checkout.stripe.com https://api.stripe.com; frame-src https://checkout.stripe.com https://js.stripe.com https://hooks.stripe.com; script-src https://checkout.stripe.com https://js.stripe.com; img-src https://*.stripe.com; object-src 'none'"
 	return secure.New(config)
 }
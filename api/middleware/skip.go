@@ -0,0 +1,19 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// SkipPaths wraps a middleware so that it is not run
+// for requests to any of the given paths
+func SkipPaths(handler gin.HandlerFunc, paths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		skip[path] = true
+	}
+	return func(c *gin.Context) {
+		if skip[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		handler(c)
+	}
+}
@@ -7,11 +7,21 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/RTradeLtd/ChainRider-Go/dash"
+	"github.com/RTradeLtd/Temporal/audit"
+	"github.com/RTradeLtd/Temporal/beams"
+	"github.com/RTradeLtd/Temporal/billing"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/payments"
+	"github.com/RTradeLtd/Temporal/pins"
+	"github.com/RTradeLtd/Temporal/pricing"
 	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/Temporal/refunds"
 	"github.com/RTradeLtd/Temporal/rtfscluster"
+	"github.com/RTradeLtd/Temporal/subscription"
 	pbLens "github.com/RTradeLtd/grpc/lensv2"
 	pbOrch "github.com/RTradeLtd/grpc/nexus"
 	pbSigner "github.com/RTradeLtd/grpc/pay"
@@ -20,7 +30,6 @@ import (
 	"github.com/RTradeLtd/swampi"
 	recaptcha "github.com/ezzarghili/recaptcha-go"
 	pbBchWallet "github.com/gcash/bchwallet/rpc/walletrpc"
-	"github.com/streadway/amqp"
 	"github.com/ulule/limiter/v3"
 	mgin "github.com/ulule/limiter/v3/drivers/middleware/gin"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
@@ -38,29 +47,43 @@ import (
 
 // API is our API service
 type API struct {
-	ipfs           rtfs.Manager
-	ipfsCluster    *rtfscluster.ClusterManager
-	keys           keys
-	r              *gin.Engine
-	cfg            *config.TemporalConfig
-	dbm            *database.Manager
-	um             *models.UserManager
-	im             *models.IpnsManager
-	pm             *models.PaymentManager
-	ue             *models.EncryptedUploadManager
-	upm            *models.UploadManager
-	zm             *models.ZoneManager
-	rm             *models.RecordManager
-	nm             *models.HostedNetworkManager
-	usage          *models.UsageManager
-	orgs           *models.OrgManager
-	l              *zap.SugaredLogger
-	signer         pbSigner.SignerClient
-	orch           pbOrch.ServiceClient
-	lens           pbLens.LensV2Client
-	bchWallet      pbBchWallet.WalletServiceClient
-	dc             *dash.Client
+	ipfs          rtfs.Manager
+	ipfsCluster   *rtfscluster.ClusterManager
+	keys          keys
+	r             *gin.Engine
+	cfg           *config.TemporalConfig
+	dbm           *database.Manager
+	um            *models.UserManager
+	im            *models.IpnsManager
+	pm            *models.PaymentManager
+	ue            *models.EncryptedUploadManager
+	upm           *models.UploadManager
+	zm            *models.ZoneManager
+	rm            *models.RecordManager
+	nm            *models.HostedNetworkManager
+	usage         *models.UsageManager
+	orgs          *models.OrgManager
+	l             *zap.SugaredLogger
+	signer        pbSigner.SignerClient
+	orch          pbOrch.ServiceClient
+	lens          pbLens.LensV2Client
+	bchWallet     pbBchWallet.WalletServiceClient
+	dc            *dash.Client
+	ledger        *ledger.Manager
+	billing       *billing.Stripe
+	subscriptions *subscription.Manager
+	payments      *payments.Watcher
+	prices        *pricing.Oracle
+	refunds       *refunds.Manager
+	audit         *audit.Log
+	pins          *pins.Manager
+	beams         *beams.Manager
+	// delegates are the multiaddrs returned to pinning service api clients
+	delegates      []string
+	openAPI        *openAPIDocument
+	openAPIOnce    sync.Once
 	queues         queues
+	outbox         *queue.Relay
 	service        string
 	version        string
 	swarmEndpoints []*swampi.Swampi
@@ -107,7 +130,7 @@ func Initialize(
 	}
 
 	// set up API struct
-	api, err := new(cfg, router, l, clients, im, imCluster, opts.DebugLogging)
+	api, err := new(cfg, router, l, clients, im, imCluster, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -130,17 +153,17 @@ func Initialize(
 	return api, nil
 }
 
-func new(cfg *config.TemporalConfig, router *gin.Engine, l *zap.SugaredLogger, clients Clients, ipfs rtfs.Manager, ipfsCluster *rtfscluster.ClusterManager, debug bool) (*API, error) {
+func new(cfg *config.TemporalConfig, router *gin.Engine, l *zap.SugaredLogger, clients Clients, ipfs rtfs.Manager, ipfsCluster *rtfscluster.ClusterManager, opts Options) (*API, error) {
 	var (
 		dbm *database.Manager
 		err error
 	)
 	// set up database manager
-	dbm, err = database.New(cfg, database.Options{LogMode: debug})
+	dbm, err = database.New(cfg, database.Options{LogMode: opts.DebugLogging})
 	if err != nil {
 		l.Warnw("failed to connect to database with secure connection - attempting insecure", "error", err.Error())
 		dbm, err = database.New(cfg, database.Options{
-			LogMode:        debug,
+			LogMode:        opts.DebugLogging,
 			SSLModeDisable: true,
 		})
 		if err != nil {
@@ -171,42 +194,32 @@ func new(cfg *config.TemporalConfig, router *gin.Engine, l *zap.SugaredLogger, c
 	if err != nil {
 		return nil, err
 	}
-	// setup our queues
-	qmIpns, err := queue.New(queue.IpnsEntryQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("ipns"))
-	if err != nil {
-		return nil, err
-	}
-	qmPin, err := queue.New(queue.IpfsPinQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("pin"))
-	if err != nil {
-		return nil, err
-	}
-	qmCluster, err := queue.New(queue.IpfsClusterPinQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("cluster"))
-	if err != nil {
-		return nil, err
-	}
-	qmEmail, err := queue.New(queue.EmailSendQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("email"))
-	if err != nil {
-		return nil, err
-	}
-	qmKey, err := queue.New(queue.IpfsKeyCreationQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("key"))
-	if err != nil {
-		return nil, err
-	}
-	qmDash, err := queue.New(queue.DashPaymentConfirmationQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("dash"))
-	if err != nil {
-		return nil, err
-	}
-	qmEth, err := queue.New(queue.EthPaymentConfirmationQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("eth"))
-	if err != nil {
-		return nil, err
-	}
-	qmBch, err := queue.New(queue.BitcoinCashPaymentConfirmationQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("bch"))
-	if err != nil {
-		return nil, err
-	}
-	qmENS, err := queue.New(queue.ENSRequestQueue, cfg.RabbitMQ.URL, true, dev, cfg, l.Named("ens"))
-	if err != nil {
-		return nil, err
+	// setup our queue publishers, which reconnect
+	// to rabbitmq automatically should the connection drop
+	var (
+		qs     = make(map[queue.Queue]*queue.Publisher)
+		qNames = map[queue.Queue]string{
+			queue.IpnsEntryQueue:                      "ipns",
+			queue.IpfsPinQueue:                        "pin",
+			queue.IpfsClusterPinQueue:                 "cluster",
+			queue.IpfsBeamQueue:                       "beam",
+			queue.EmailSendQueue:                      "email",
+			queue.IpfsKeyCreationQueue:                "key",
+			queue.DashPaymentConfirmationQueue:        "dash",
+			queue.EthPaymentConfirmationQueue:         "eth",
+			queue.BitcoinCashPaymentConfirmationQueue: "bch",
+			queue.ENSRequestQueue:                     "ens",
+		}
+	)
+	for q, name := range qNames {
+		qp, err := queue.NewPublisher(q, cfg.RabbitMQ.URL, cfg, l.Named(name), queue.PublisherOptions{DevMode: dev})
+		if err != nil {
+			for _, opened := range qs {
+				opened.Close()
+			}
+			return nil, err
+		}
+		qs[q] = qp
 	}
 	if cfg.Stripe.SecretKey == "" {
 		stripeSecretKey := os.Getenv("STRIPE_SECRET_KEY")
@@ -216,8 +229,20 @@ func new(cfg *config.TemporalConfig, router *gin.Engine, l *zap.SugaredLogger, c
 		stripePublishableKey := os.Getenv("STRIPE_PUBLISHABLE_KEY")
 		cfg.Stripe.PublishableKey = stripePublishableKey
 	}
-	// return
-	return &API{
+	if opts.Stripe.WebhookSecret == "" {
+		opts.Stripe.WebhookSecret = os.Getenv("STRIPE_WEBHOOK_SECRET")
+	}
+	if opts.Stripe.APIURL == "" {
+		opts.Stripe.APIURL = os.Getenv("STRIPE_API_URL")
+	}
+	stripePayments := billing.NewStripe(dbm.DB, l, billing.StripeConfig{
+		SecretKey:     cfg.Stripe.SecretKey,
+		WebhookSecret: opts.Stripe.WebhookSecret,
+		APIURL:        opts.Stripe.APIURL,
+	})
+	// subscriptions are renewed from credits, topped up with saved cards
+	subscriptions := subscription.NewManager(dbm.DB, l, stripePayments, subscription.Options{})
+	api := &API{
 		ipfs:        ipfs,
 		ipfsCluster: ipfsCluster,
 		keys:        keys{kb1: kb1, kb2: kb2},
@@ -232,6 +257,12 @@ func new(cfg *config.TemporalConfig, router *gin.Engine, l *zap.SugaredLogger, c
 		ue:          models.NewEncryptedUploadManager(dbm.DB),
 		upm:         models.NewUploadManager(dbm.DB),
 		usage:       models.NewUsageManager(dbm.DB),
+		ledger:      ledger.NewManager(dbm.DB),
+		audit:       audit.New(dbm.DB, l),
+		pins:        pins.NewManager(dbm.DB),
+		beams:       beams.NewManager(dbm.DB),
+		delegates:   opts.Pinning.Delegates,
+		billing:     stripePayments,
 		orgs:        models.NewOrgManager(dbm.DB),
 		lens:        clients.Lens,
 		signer:      clients.Signer,
@@ -239,40 +270,53 @@ func new(cfg *config.TemporalConfig, router *gin.Engine, l *zap.SugaredLogger, c
 		bchWallet:   clients.BchWallet,
 		dc:          dc,
 		queues: queues{
-			pin:     qmPin,
-			cluster: qmCluster,
-			email:   qmEmail,
-			ipns:    qmIpns,
-			key:     qmKey,
-			dash:    qmDash,
-			eth:     qmEth,
-			bch:     qmBch,
-			ens:     qmENS,
+			pin:     qs[queue.IpfsPinQueue],
+			cluster: qs[queue.IpfsClusterPinQueue],
+			beam:    qs[queue.IpfsBeamQueue],
+			email:   qs[queue.EmailSendQueue],
+			ipns:    qs[queue.IpnsEntryQueue],
+			key:     qs[queue.IpfsKeyCreationQueue],
+			dash:    qs[queue.DashPaymentConfirmationQueue],
+			eth:     qs[queue.EthPaymentConfirmationQueue],
+			bch:     qs[queue.BitcoinCashPaymentConfirmationQueue],
+			ens:     qs[queue.ENSRequestQueue],
 		},
+		outbox:         queue.NewRelay(dbm.DB, l, qs, queue.RelayOptions{}),
+		subscriptions:  subscriptions,
 		swarmEndpoints: getSwarmEndpoints(cfg.Ethereum),
 		zm:             models.NewZoneManager(dbm.DB),
 		rm:             models.NewRecordManager(dbm.DB),
 		nm:             models.NewHostedNetworkManager(dbm.DB),
-	}, nil
+	}
+	api.prices = api.newPriceOracle(opts.Pricing)
+	chains := clients.Chains
+	if chains == nil {
+		chains = api.newChains(opts.Payments)
+	}
+	// unpaid crypto payments are re-quoted at the current price
+	api.payments = payments.NewWatcher(dbm.DB, l, chains, api.quotePrice, payments.Options{})
+	api.refunds = refunds.NewManager(dbm.DB, l, stripePayments, api.quotePrice)
+	return api, nil
 }
 
 // Close releases API resources
 func (api *API) Close() {
 	// close queue resources
-	if err := api.queues.cluster.Close(); err != nil {
-		api.l.Error(err, "failed to properly close cluster queue connection")
-	}
-	if err := api.queues.email.Close(); err != nil {
-		api.l.Error(err, "failed to properly close email queue connection")
-	}
-	if err := api.queues.ipns.Close(); err != nil {
-		api.l.Error(err, "failed to properly close ipns queue connection")
-	}
-	if err := api.queues.key.Close(); err != nil {
-		api.l.Error(err, "failed to properly close key queue connection")
-	}
-	if err := api.queues.pin.Close(); err != nil {
-		api.l.Error(err, "failed to properly close pin queue connection")
+	for name, qp := range map[string]*queue.Publisher{
+		"pin":     api.queues.pin,
+		"cluster": api.queues.cluster,
+		"beam":    api.queues.beam,
+		"email":   api.queues.email,
+		"ipns":    api.queues.ipns,
+		"key":     api.queues.key,
+		"dash":    api.queues.dash,
+		"eth":     api.queues.eth,
+		"bch":     api.queues.bch,
+		"ens":     api.queues.ens,
+	} {
+		if err := qp.Close(); err != nil {
+			api.l.Errorw("failed to properly close queue connection", "queue", name, "error", err)
+		}
 	}
 }
 
@@ -289,6 +333,14 @@ func (api *API) ListenAndServe(ctx context.Context, addr string, tlsConfig *TLSC
 		Handler: api.r,
 	}
 	errChan := make(chan error, 1)
+	// publish messages written to the outbox
+	go api.outbox.Run(ctx)
+	// renew subscriptions as they become due
+	go api.subscriptions.Run(ctx)
+	// expire unpaid payments, and resubmit stuck confirmations
+	go api.payments.Run(ctx)
+	// send stripe refunds again which stripe did not confirm
+	go api.refunds.Run(ctx)
 	go func() {
 		if tlsConfig != nil {
 			// configure TLS to override defaults
@@ -317,61 +369,11 @@ func (api *API) ListenAndServe(ctx context.Context, addr string, tlsConfig *TLSC
 		}
 		errChan <- server.ListenAndServe()
 	}()
-	for {
-		select {
-		case err := <-errChan:
-			return err
-		case <-ctx.Done():
-			return server.Close()
-		case msg := <-api.queues.cluster.ErrCh:
-			qmCluster, err := api.handleQueueError(msg, api.cfg.RabbitMQ.URL, queue.IpfsClusterPinQueue, true)
-			if err != nil {
-				return server.Close()
-			}
-			api.queues.cluster = qmCluster
-		case msg := <-api.queues.dash.ErrCh:
-			qmDash, err := api.handleQueueError(msg, api.cfg.RabbitMQ.URL, queue.DashPaymentConfirmationQueue, true)
-			if err != nil {
-				return server.Close()
-			}
-			api.queues.dash = qmDash
-		case msg := <-api.queues.email.ErrCh:
-			qmEmail, err := api.handleQueueError(msg, api.cfg.RabbitMQ.URL, queue.EmailSendQueue, true)
-			if err != nil {
-				return server.Close()
-			}
-			api.queues.email = qmEmail
-		case msg := <-api.queues.ipns.ErrCh:
-			qmIpns, err := api.handleQueueError(msg, api.cfg.RabbitMQ.URL, queue.IpnsEntryQueue, true)
-			if err != nil {
-				return server.Close()
-			}
-			api.queues.ipns = qmIpns
-		case msg := <-api.queues.key.ErrCh:
-			qmKey, err := api.handleQueueError(msg, api.cfg.RabbitMQ.URL, queue.IpfsKeyCreationQueue, true)
-			if err != nil {
-				return server.Close()
-			}
-			api.queues.key = qmKey
-		case msg := <-api.queues.eth.ErrCh:
-			qmEth, err := api.handleQueueError(msg, api.cfg.RabbitMQ.URL, queue.EthPaymentConfirmationQueue, true)
-			if err != nil {
-				return server.Close()
-			}
-			api.queues.eth = qmEth
-		case msg := <-api.queues.pin.ErrCh:
-			qmPin, err := api.handleQueueError(msg, api.cfg.RabbitMQ.URL, queue.IpfsPinQueue, true)
-			if err != nil {
-				return server.Close()
-			}
-			api.queues.pin = qmPin
-		case msg := <-api.queues.bch.ErrCh:
-			qmBch, err := api.handleQueueError(msg, api.cfg.RabbitMQ.URL, queue.BitcoinCashPaymentConfirmationQueue, true)
-			if err != nil {
-				return server.Close()
-			}
-			api.queues.bch = qmBch
-		}
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		return server.Close()
 	}
 }
 
@@ -412,8 +414,9 @@ func (api *API) setupRoutes(debug bool) error {
 		// cors middleware
 		middleware.CORSMiddleware(dev, debug, allowedOrigins),
 		// allows for automatic xss removal
-		// greater than what can be configured with HTTP Headers
-		xssMdlwr.RemoveXss(),
+		// greater than what can be configured with HTTP Headers.
+		// stripe signs the raw webhook body, so it must be left as is
+		middleware.SkipPaths(xssMdlwr.RemoveXss(), stripeWebhookPath),
 		// rate limiting
 		mgin.NewMiddleware(limiter.New(memory.NewStore(), rate)),
 		// security middleware
@@ -425,11 +428,18 @@ func (api *API) setupRoutes(debug bool) error {
 
 	// set up middleware
 	ginjwt := middleware.JwtConfigGenerate(api.cfg.JWT.Key, api.cfg.JWT.Realm, api.dbm.DB, api.l)
-	authware := []gin.HandlerFunc{ginjwt.MiddlewareFunc()}
+	authware := []gin.HandlerFunc{
+		ginjwt.MiddlewareFunc(),
+		// allows clients to safely retry mutating requests
+		middleware.Idempotency(api.dbm.DB, api.l),
+	}
 
 	// V2 API
 	v2 := api.r.Group("/v2")
 
+	// openapi specification of the v2 api
+	api.r.GET(openAPIPath, api.getOpenAPI)
+
 	// system checks used to verify the integrity of our services
 	systemChecks := v2.Group("/systems")
 	{
@@ -485,8 +495,50 @@ func (api *API) setupRoutes(debug bool) error {
 		stripe := payments.Group("/stripe")
 		{
 			stripe.POST("/charge", api.stripeCharge)
+			stripe.POST("/intent", api.createStripePaymentIntent)
+			stripe.GET("/intent/:id", api.getStripePayment)
+			stripe.POST("/payment-method", api.setupStripePaymentMethod)
 		}
 		payments.GET("/status/:number", api.getPaymentStatus)
+		refund := payments.Group("/refunds")
+		{
+			refund.GET("", api.getRefunds)
+			refund.POST("/stripe", api.requestStripeRefund)
+			refund.POST("/crypto", api.requestCryptoRefund)
+		}
+	}
+
+	// administration
+	admin := v2.Group("/admin", authware...)
+	{
+		refund := admin.Group("/refunds")
+		{
+			refund.GET("", api.getRefundQueue)
+			refund.POST("/:id/approve", api.audited(audit.RefundReview, api.auditRefund("approve", "note")), api.approveRefund)
+			refund.POST("/:id/deny", api.audited(audit.RefundReview, api.auditRefund("deny", "note")), api.denyRefund)
+			refund.POST("/:id/paid", api.audited(audit.RefundReview, api.auditRefund("paid", "tx_hash")), api.refundPaid)
+		}
+		users := admin.Group("/users")
+		{
+			users.GET("", api.searchUsers)
+			users.GET("/:user", api.getUser)
+			users.POST("/:user/credits", api.audited(audit.CreditAdjust, auditUser("amount", "reason")), api.adjustCredits)
+			users.POST("/:user/tier", api.audited(audit.TierChange, auditUser("tier")), api.changeTier)
+			users.POST("/:user/disable", api.audited(audit.AccountDisable, auditUser()), api.disableUser)
+			users.POST("/:user/enable", api.audited(audit.AccountEnable, auditUser()), api.enableUser)
+			users.POST("/:user/verification", api.audited(audit.VerificationResend, auditUser()), api.resendVerification)
+			users.GET("/:user/uploads", api.getUserUploads)
+			users.GET("/:user/jobs/failed", api.getUserFailedJobs)
+		}
+		admin.GET("/audit", api.searchAuditLog)
+	}
+
+	// stripe webhook events are authenticated by their signature, so are
+	// not accepted unless there is a signing secret to verify them with
+	if api.billing.WebhookEnabled() {
+		api.r.POST(stripeWebhookPath, api.stripeWebhook)
+	} else {
+		api.l.Warn("stripe webhook signing secret not configured, stripe payments will not be credited")
 	}
 
 	// accounts
@@ -498,11 +550,11 @@ func (api *API) setupRoutes(debug bool) error {
 		}
 		password := account.Group("/password", authware...)
 		{
-			password.POST("/change", api.changeAccountPassword)
+			password.POST("/change", api.audited(audit.PasswordChange, auditOwnAccount), api.changeAccountPassword)
 		}
 		key := account.Group("/key", authware...)
 		{
-			key.GET("/export/:name", api.exportKey)
+			key.GET("/export/:name", api.audited(audit.KeyExport, auditKey), api.exportKey)
 			ipfs := key.Group("/ipfs")
 			{
 				ipfs.GET("/get", api.getIPFSKeyNamesForAuthUser)
@@ -512,6 +564,19 @@ func (api *API) setupRoutes(debug bool) error {
 		credits := account.Group("/credits", authware...)
 		{
 			credits.GET("/available", api.getCredits)
+			credits.GET("/history", api.getCreditHistory)
+		}
+		auditLog := account.Group("/audit", authware...)
+		{
+			auditLog.GET("", api.getAuditLog)
+		}
+		sub := account.Group("/subscription", authware...)
+		{
+			sub.GET("", api.getSubscription)
+			sub.GET("/plans", api.getSubscriptionPlans)
+			sub.POST("/subscribe", api.subscribe)
+			sub.POST("/change", api.changeSubscriptionPlan)
+			sub.POST("/cancel", api.cancelSubscription)
 		}
 		email := account.Group("/email")
 		{
@@ -551,6 +616,12 @@ func (api *API) setupRoutes(debug bool) error {
 			{
 				file.POST("/add", api.addFile)
 			}
+			// car routes
+			car := public.Group("/car")
+			{
+				car.POST("/import", api.importCar)
+				car.GET("/export/:cid", api.exportCar)
+			}
 			// pubsub routes
 			pubsub := public.Group("/pubsub")
 			{
@@ -570,18 +641,18 @@ func (api *API) setupRoutes(debug bool) error {
 			{
 				users := network.Group("/users")
 				{
-					users.DELETE("/remove", api.removeUsersFromNetwork)
-					users.POST("/add", api.addUsersToNetwork)
+					users.DELETE("/remove", api.audited(audit.NetworkUsersRemove, auditNetwork("users")), api.removeUsersFromNetwork)
+					users.POST("/add", api.audited(audit.NetworkUsersAdd, auditNetwork("users")), api.addUsersToNetwork)
 				}
 				owners := network.Group("/owners")
 				{
-					owners.POST("/add", api.addOwnersToNetwork)
+					owners.POST("/add", api.audited(audit.NetworkOwnersAdd, auditNetwork("owners")), api.addOwnersToNetwork)
 				}
 				network.GET("/:name", api.getIPFSPrivateNetworkByName)
 				network.POST("/new", api.createIPFSNetwork)
 				network.POST("/stop", api.stopIPFSPrivateNetwork)
 				network.POST("/start", api.startIPFSPrivateNetwork)
-				network.DELETE("/remove", api.removeIPFSPrivateNetwork)
+				network.DELETE("/remove", api.audited(audit.NetworkRemove, auditNetwork("")), api.removeIPFSPrivateNetwork)
 			}
 			// pinning routes
 			pin := private.Group("/pin")
@@ -609,10 +680,14 @@ func (api *API) setupRoutes(debug bool) error {
 		utils := ipfs.Group("/utils")
 		{
 			// generic download
+			utils.GET("/download/:hash", api.downloadContentHash)
 			utils.POST("/download/:hash", api.downloadContentHash)
 			laser := utils.Group("/laser")
 			{
 				laser.POST("/beam", api.beamContent)
+				laser.GET("/beams", api.getBeams)
+				laser.GET("/beams/:id", api.getBeam)
+				laser.DELETE("/beams/:id", api.cancelBeam)
 			}
 		}
 	}
@@ -633,6 +708,19 @@ func (api *API) setupRoutes(debug bool) error {
 		ipns.GET("/records", api.getIPNSRecordsPublishedByUser)
 	}
 
+	// gateway
+	gateway := v2.Group("/gateway", authware...)
+	{
+		gateway.GET("/ipfs/:cid", api.gatewayIPFS)
+		gateway.HEAD("/ipfs/:cid", api.gatewayIPFS)
+		gateway.GET("/ipfs/:cid/*path", api.gatewayIPFS)
+		gateway.HEAD("/ipfs/:cid/*path", api.gatewayIPFS)
+		gateway.GET("/ipns/:name", api.gatewayIPNS)
+		gateway.HEAD("/ipns/:name", api.gatewayIPNS)
+		gateway.GET("/ipns/:name/*path", api.gatewayIPNS)
+		gateway.HEAD("/ipns/:name/*path", api.gatewayIPNS)
+	}
+
 	// database
 	database := v2.Group("/database", authware...)
 	{
@@ -687,29 +775,25 @@ func (api *API) setupRoutes(debug bool) error {
 		swarm.POST("/upload", api.SwarmUpload)
 	}
 
+	// ipfs pinning service api, whose clients expect errors in the format
+	// of the specification, including those of the jwt middleware
+	pinningJWT := *ginjwt
+	pinningJWT.Unauthorized = func(c *gin.Context, code int, message string) {
+		failPin(c, code, message)
+	}
+	pinning := v2.Group("/pinning/pins", pinningJWT.MiddlewareFunc())
+	{
+		pinning.GET("", api.listPins)
+		pinning.POST("", api.addPin)
+		pinning.GET("/:requestid", api.getPin)
+		pinning.POST("/:requestid", api.replacePin)
+		pinning.DELETE("/:requestid", api.removePin)
+	}
+
 	api.l.Info("Routes initialized")
 	return nil
 }
 
-// HandleQueueError is used to handle queue connectivity issues requiring us to re-connect
-func (api *API) handleQueueError(amqpErr *amqp.Error, rabbitMQURL string, queueType queue.Queue, publish bool) (*queue.Manager, error) {
-	api.l.Errorw(
-		"a protocol connection error stopping rabbitmq was received",
-		"queue", queueType.String(),
-		"error", amqpErr.Error())
-	qManager, err := queue.New(queueType, rabbitMQURL, publish, dev, api.cfg, api.l)
-	if err != nil {
-		api.l.Errorw(
-			"failed to re-establish queue process, exiting",
-			"queue", queueType.String(),
-			"error", err.Error())
-		return nil, err
-	}
-	api.l.Warnw(
-		"successfully re-established queue connection", "queue", queueType.String())
-	return qManager, nil
-}
-
 // currently only supports 2 endpoints
 func getSwarmEndpoints(cfg config.Ethereum) []*swampi.Swampi {
 	var endpoints []*swampi.Swampi
@@ -18,6 +18,7 @@ import (
 	"github.com/RTradeLtd/Temporal/mocks"
 	"github.com/RTradeLtd/Temporal/queue"
 	"github.com/RTradeLtd/Temporal/rtfscluster"
+	"github.com/RTradeLtd/Temporal/settings"
 	"github.com/RTradeLtd/config/v2"
 	"github.com/RTradeLtd/database/v2"
 	"github.com/RTradeLtd/database/v2/models"
@@ -25,7 +26,6 @@ import (
 	"github.com/c2h5oh/datasize"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
-	"github.com/streadway/amqp"
 )
 
 const (
@@ -176,7 +176,9 @@ func setupAPI(t *testing.T, fakeLens *mocks.FakeLensV2Client, fakeOrch *mocks.Fa
 		Signer:    fakeSigner,
 		BchWallet: fakeBchWallet,
 	}
-	api, err := new(cfg, engine, logger, clients, im, imCluster, false)
+	api, err := new(cfg, engine, logger, clients, im, imCluster, Options{
+		Stripe: settings.Stripe{WebhookSecret: "whsec_test"},
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -400,15 +402,15 @@ func Test_Utils(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if _, err := api.getUSDValue(tt.args.paymentType); (err != nil) != tt.wantErr {
-				t.Errorf("getUSDValue() error = %v, wantErr %v", err, tt.wantErr)
+			if _, err := api.quotePrice(tt.args.paymentType); (err != nil) != tt.wantErr {
+				t.Errorf("quotePrice() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
-	if err := api.validateUserCredits(testUser, 1); err != nil {
+	if err := api.validateUserCredits(testUser, "test", 1); err != nil {
 		t.Fatal(err)
 	}
-	if err := api.validateUserCredits(testUser, tooManyCredits); err == nil {
+	if err := api.validateUserCredits(testUser, "test", tooManyCredits); err == nil {
 		t.Fatal("error expected")
 	}
 	if err := api.validateAdminRequest(testUser); err != nil {
@@ -434,13 +436,15 @@ func Test_Utils(t *testing.T) {
 	testCtx, _ := gin.CreateTestContext(recorder)
 	urlValues := url.Values{}
 	urlValues.Add("suchkey", "muchvalue")
-	testCtx.Request = &http.Request{PostForm: urlValues}
-	forms, missingField := api.extractPostForms(testCtx, "suchkey")
-	if missingField != "" {
-		t.Fatal("failed to extract post forms")
+	testCtx.Request = &http.Request{Method: "POST", PostForm: urlValues}
+	var req struct {
+		SuchKey string `form:"suchkey" binding:"required"`
 	}
-	if forms["suchkey"] != "muchvalue" {
-		t.Fatal("failed to extract proper postform")
+	if !api.bind(testCtx, &req) {
+		t.Fatal("failed to bind post forms")
+	}
+	if req.SuchKey != "muchvalue" {
+		t.Fatal("failed to bind proper postform")
 	}
 }
 
@@ -638,7 +642,7 @@ func Test_API_Initialize_ListenAndServe(t *testing.T) {
 	}
 }
 
-func TestAPI_HandleQueuError_Success(t *testing.T) {
+func TestAPI_QueuePublishers(t *testing.T) {
 	cfg, err := config.LoadConfig("../../testenv/config.json")
 	if err != nil {
 		t.Fatal(err)
@@ -657,59 +661,42 @@ func TestAPI_HandleQueuError_Success(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	go func() {
-		if err := api.ListenAndServe(context.Background(), "127.0.0.1:6799", &TLSConfig{"../../testenv/certs/api.cert", "../../testenv/certs/api.key"}); err != nil && err != http.ErrServerClosed {
-			t.Error(err)
-		}
-	}()
-	type args struct {
-		queueType queue.Queue
-	}
+	defer api.Close()
 	tests := []struct {
-		name string
-		args args
+		name      string
+		publisher *queue.Publisher
 	}{
-		{queue.IpfsClusterPinQueue.String(), args{queue.IpfsClusterPinQueue}},
-		{queue.EmailSendQueue.String(), args{queue.EmailSendQueue}},
-		{queue.IpnsEntryQueue.String(), args{queue.IpnsEntryQueue}},
-		{queue.IpfsPinQueue.String(), args{queue.IpfsPinQueue}},
-		{queue.IpfsKeyCreationQueue.String(), args{queue.IpfsKeyCreationQueue}},
-		{queue.DashPaymentConfirmationQueue.String(), args{queue.DashPaymentConfirmationQueue}},
-		{queue.EthPaymentConfirmationQueue.String(), args{queue.EthPaymentConfirmationQueue}},
-		{queue.BitcoinCashPaymentConfirmationQueue.String(), args{queue.BitcoinCashPaymentConfirmationQueue}},
-	}
-	// declare an error to use for testing
-	amqpErr := &amqp.Error{Code: 400, Reason: "test", Server: true, Recover: false}
+		{queue.IpfsClusterPinQueue.String(), api.queues.cluster},
+		{queue.EmailSendQueue.String(), api.queues.email},
+		{queue.IpnsEntryQueue.String(), api.queues.ipns},
+		{queue.IpfsPinQueue.String(), api.queues.pin},
+		{queue.IpfsKeyCreationQueue.String(), api.queues.key},
+		{queue.DashPaymentConfirmationQueue.String(), api.queues.dash},
+		{queue.EthPaymentConfirmationQueue.String(), api.queues.eth},
+		{queue.BitcoinCashPaymentConfirmationQueue.String(), api.queues.bch},
+		{queue.ENSRequestQueue.String(), api.queues.ens},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// test ListenAndServe queue function handling
-			switch tt.args.queueType {
-			case queue.IpfsClusterPinQueue:
-				api.queues.cluster.ErrCh <- amqpErr
-			case queue.EmailSendQueue:
-				api.queues.email.ErrCh <- amqpErr
-			case queue.IpnsEntryQueue:
-				api.queues.ipns.ErrCh <- amqpErr
-			case queue.IpfsPinQueue:
-				api.queues.pin.ErrCh <- amqpErr
-			case queue.IpfsKeyCreationQueue:
-				api.queues.key.ErrCh <- amqpErr
-			case queue.DashPaymentConfirmationQueue:
-				api.queues.dash.ErrCh <- amqpErr
-			case queue.EthPaymentConfirmationQueue:
-				api.queues.eth.ErrCh <- amqpErr
-			case queue.BitcoinCashPaymentConfirmationQueue:
-				api.queues.bch.ErrCh <- amqpErr
+			if !tt.publisher.Connected() {
+				t.Fatal("publisher should be connected")
 			}
-			// test handleQueueError function directly
-			if _, err := api.handleQueueError(amqpErr, api.cfg.RabbitMQ.URL, tt.args.queueType, true); err != nil {
+			// publish to a test queue, so that no consumer receives the message
+			test, err := queue.NewPublisher(queue.Queue("test-"+tt.name), cfg.RabbitMQ.URL, cfg, logger, queue.PublisherOptions{DevMode: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer test.Close()
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", "/", nil)
+			if err := api.publish(c, test, struct{}{}); err != nil {
 				t.Fatal(err)
 			}
 		})
 	}
 }
 
-func TestAPI_HandleQueuError_Failure(t *testing.T) {
+func TestAPI_QueuePublishers_Failure(t *testing.T) {
 	cfg, err := config.LoadConfig("../../testenv/config.json")
 	if err != nil {
 		t.Fatal(err)
@@ -724,38 +711,10 @@ func TestAPI_HandleQueuError_Failure(t *testing.T) {
 		Orch:   fakeOrch,
 		Signer: fakeSigner,
 	}
-	api, err := Initialize(context.Background(), cfg, "", Options{DevMode: true, DebugLogging: true}, clients, logger)
-	if err != nil {
-		t.Fatal(err)
-	}
-	type args struct {
-		queueType queue.Queue
-	}
-	tests := []struct {
-		name string
-		args args
-	}{
-		{queue.IpfsClusterPinQueue.String(), args{queue.IpfsClusterPinQueue}},
-		{queue.EmailSendQueue.String(), args{queue.EmailSendQueue}},
-		{queue.IpnsEntryQueue.String(), args{queue.IpnsEntryQueue}},
-		{queue.IpfsPinQueue.String(), args{queue.IpfsPinQueue}},
-		{queue.IpfsKeyCreationQueue.String(), args{queue.IpfsKeyCreationQueue}},
-		{queue.DashPaymentConfirmationQueue.String(), args{queue.DashPaymentConfirmationQueue}},
-		{queue.EthPaymentConfirmationQueue.String(), args{queue.EthPaymentConfirmationQueue}},
-		{queue.BitcoinCashPaymentConfirmationQueue.String(), args{queue.BitcoinCashPaymentConfirmationQueue}},
-	}
-	// setup a bad rabbitmq url for testing connectivity failures
-	api.cfg.RabbitMQ.URL = "notarealprotocol://notarealurl"
-	// declare an error to use for testing
-	amqpErr := &amqp.Error{Code: 400, Reason: "test", Server: true, Recover: false}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			//TODO: enable this kind of testing within ListenAndServe eventually
-			// test handleQueueError function directly
-			if _, err := api.handleQueueError(amqpErr, api.cfg.RabbitMQ.URL, tt.args.queueType, true); err == nil {
-				t.Fatal("error expected")
-			}
-		})
+	// setup a bad rabbitmq url, which should be caught on startup
+	cfg.RabbitMQ.URL = "notarealprotocol://notarealurl"
+	if _, err := Initialize(context.Background(), cfg, "", Options{DevMode: true, DebugLogging: true}, clients, logger); err == nil {
+		t.Fatal("error expected")
 	}
 }
 
@@ -0,0 +1,173 @@
+package v2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// boundRequestKey is the context key of the request bound by a handler
+const boundRequestKey = "boundRequest"
+
+func init() {
+	// name fields after the parameter clients send, rather than the go field
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(fieldName)
+	}
+}
+
+// bind is used to read a request body into req, which is decoded from json
+// when the content type is application/json, and from form encodings
+// otherwise. Invalid requests are failed, naming the invalid field
+func (api *API) bind(c *gin.Context, req interface{}) bool {
+	b := binding.Default(c.Request.Method, c.ContentType())
+	if c.ContentType() == binding.MIMEJSON {
+		// gin only decodes json bodies for methods other than GET
+		b = binding.JSON
+	}
+	if err := c.ShouldBindWith(req, b); err != nil {
+		failBinding(c, req, c.Request.Form, err)
+		return false
+	}
+	c.Set(boundRequestKey, req)
+	return true
+}
+
+// bindQuery is used to read query parameters into req, failing
+// the request if they are invalid
+func (api *API) bindQuery(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindQuery(req); err != nil {
+		failBinding(c, req, c.Request.URL.Query(), err)
+		return false
+	}
+	return true
+}
+
+// failBinding fails a request that could not be bound into req
+func failBinding(c *gin.Context, req interface{}, form url.Values, err error) {
+	var (
+		validationErrs validator.ValidationErrors
+		typeErr        *json.UnmarshalTypeError
+		syntaxErr      *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &validationErrs):
+		fe := validationErrs[0]
+		if fe.Tag() == "required" {
+			FailWithMissingField(c, fe.Field())
+			return
+		}
+		FailWithInvalidField(c, fe.Field(), validationMessage(fe))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		FailWithInvalidField(c, typeErr.Field, "must be of type "+typeErr.Type.String())
+	case errors.As(err, &syntaxErr), err == io.ErrUnexpectedEOF:
+		Fail(c, fmt.Errorf("request body is not valid json: %s", err), http.StatusBadRequest)
+	default:
+		// form decoding errors do not name the field, so find the first
+		// value which can not be parsed into its field
+		if field, kind := invalidFormField(reflect.TypeOf(req), form); field != "" {
+			FailWithInvalidField(c, field, "must be of type "+kind)
+			return
+		}
+		Fail(c, err, http.StatusBadRequest)
+	}
+}
+
+// validationMessage describes why a field failed validation
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte", "min":
+		return "must be at least " + fe.Param()
+	case "lte", "max":
+		return "must be at most " + fe.Param()
+	default:
+		return "failed " + fe.Tag() + " validation"
+	}
+}
+
+// invalidFormField returns the first form value which can not be parsed
+// into the field of t it is bound to, along with the kind of the field
+func invalidFormField(t reflect.Type, form url.Values) (string, string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return "", ""
+	}
+	for _, field := range requestFields(t, "form") {
+		kind := field.Type.Kind()
+		if kind == reflect.Slice {
+			kind = field.Type.Elem().Kind()
+		}
+		for _, value := range form[field.name] {
+			if value == "" {
+				continue
+			}
+			var err error
+			switch kind {
+			case reflect.Bool:
+				_, err = strconv.ParseBool(value)
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				_, err = strconv.ParseInt(value, 10, 64)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				_, err = strconv.ParseUint(value, 10, 64)
+			case reflect.Float32, reflect.Float64:
+				_, err = strconv.ParseFloat(value, 64)
+			}
+			if err != nil {
+				return field.name, kind.String()
+			}
+		}
+	}
+	return "", ""
+}
+
+// boundValues returns the values of the named field of the request bound by
+// the handler, which lets middleware read requests of either encoding. Form
+// values are returned when the handler did not bind a request
+func boundValues(c *gin.Context, name string) []string {
+	req, ok := c.Get(boundRequestKey)
+	if !ok {
+		return c.PostFormArray(name)
+	}
+	v := reflect.Indirect(reflect.ValueOf(req))
+	for _, field := range requestFields(v.Type(), "form") {
+		if field.name != name {
+			continue
+		}
+		value := v.FieldByIndex(field.Index)
+		if value.Kind() != reflect.Slice {
+			return []string{fmt.Sprint(value.Interface())}
+		}
+		values := make([]string, value.Len())
+		for i := range values {
+			values[i] = fmt.Sprint(value.Index(i).Interface())
+		}
+		return values
+	}
+	return nil
+}
+
+// fieldName returns the name clients use for a field
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"form", "json"} {
+		if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
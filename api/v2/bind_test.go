@@ -0,0 +1,119 @@
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_bind(t *testing.T) {
+	type response struct {
+		Code     int       `json:"code"`
+		Response string    `json:"response"`
+		Error    *eh.Error `json:"error"`
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		req         interface{}
+		wantOK      bool
+		wantCode    eh.Code
+		wantMessage string
+	}{
+		{"Form", "application/x-www-form-urlencoded", "hold_time=5&file_name=foo",
+			&pinRequest{}, true, "", ""},
+		{"JSON", "application/json", `{"hold_time":5,"file_name":"foo"}`,
+			&pinRequest{}, true, "", ""},
+		{"FormMissingField", "application/x-www-form-urlencoded", "file_name=foo",
+			&pinRequest{}, false, eh.MissingField, "hold_time not present"},
+		{"JSONMissingField", "application/json", `{"file_name":"foo"}`,
+			&pinRequest{}, false, eh.MissingField, "hold_time not present"},
+		{"FormInvalidType", "application/x-www-form-urlencoded", "hold_time=five",
+			&pinRequest{}, false, eh.InvalidField, "hold_time must be of type int64"},
+		{"JSONInvalidType", "application/json", `{"hold_time":"five"}`,
+			&pinRequest{}, false, eh.InvalidField, "hold_time must be of type int64"},
+		{"JSONSyntax", "application/json", `{"hold_time":}`,
+			&pinRequest{}, false, eh.BadRequest, ""},
+		{"JSONTruncated", "application/json", `{"hold_time":`,
+			&pinRequest{}, false, eh.BadRequest, ""},
+		{"OneOf", "application/x-www-form-urlencoded", "key_type=dsa&key_bits=2048&key_name=foo",
+			&createKeyRequest{}, false, eh.InvalidField, "key_type must be one of rsa, ed25519"},
+		{"GreaterThan", "application/json", `{"credit_value":-1}`,
+			&creditValueRequest{}, false, eh.InvalidField, "credit_value must be greater than 0"},
+	}
+	api := &API{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			if ok := api.bind(c, tt.req); ok != tt.wantOK {
+				t.Fatalf("bind() = %v, want %v", ok, tt.wantOK)
+			}
+			if tt.wantOK {
+				if req := tt.req.(*pinRequest); req.HoldTime != 5 || req.FileName != "foo" {
+					t.Fatalf("unexpected request %+v", req)
+				}
+				return
+			}
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %v, want %v", recorder.Code, http.StatusBadRequest)
+			}
+			var resp response
+			if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error == nil || resp.Error.Code != tt.wantCode {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+			if tt.wantMessage != "" && resp.Response != tt.wantMessage {
+				t.Fatalf("response = %v, want %v", resp.Response, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func Test_bindQuery(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("GET", "/?page=2&limit=abc", nil)
+	var query pageQuery
+	if (&API{}).bindQuery(c, &query) {
+		t.Fatal("expected invalid limit to fail")
+	}
+	if !strings.Contains(recorder.Body.String(), "limit must be of type int") {
+		t.Fatalf("unexpected response %s", recorder.Body.String())
+	}
+}
+
+func Test_boundValues(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("POST", "/", strings.NewReader(
+		`{"network_name":"myspace","users":["alice","bob"]}`,
+	))
+	c.Request.Header.Set("Content-Type", "application/json")
+	// values are read from the form until a request is bound
+	c.Request.PostForm = url.Values{"network_name": {"formspace"}}
+	if got := boundValues(c, "network_name"); len(got) != 1 || got[0] != "formspace" {
+		t.Fatalf("unexpected form values %v", got)
+	}
+	var req networkUsersRequest
+	if !(&API{}).bind(c, &req) {
+		t.Fatal("failed to bind request")
+	}
+	if got := boundValues(c, "network_name"); len(got) != 1 || got[0] != "myspace" {
+		t.Fatalf("unexpected network name %v", got)
+	}
+	if got := boundValues(c, "users"); strings.Join(got, ",") != "alice,bob" {
+		t.Fatalf("unexpected users %v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package v2
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/client"
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+)
+
+func Test_API_Client(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.usage.UpdateTier("testuser", models.Paid); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api.r)
+	defer server.Close()
+
+	ctx := context.Background()
+	c, err := client.New(server.URL, client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// requests fail until logged in
+	if _, err := c.Credits(ctx); err != client.ErrNotAuthenticated {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := c.Login(ctx, "testuser", "wrongpassword"); err == nil {
+		t.Fatal("expected login with the wrong password to fail")
+	}
+	if err := c.Login(ctx, "testuser", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if token, expire := c.Token(); token == "" || expire.IsZero() {
+		t.Fatal("token was not refreshed")
+	}
+
+	// a client given a token logs in again once it is rejected
+	stale, err := client.New(server.URL, client.Options{
+		Username: "testuser",
+		Password: "admin",
+		Token:    "notavalidtoken",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stale.Credits(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// uploads and pins
+	fh, err := os.Open("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	hash, err := c.Upload(ctx, fh, "config.json", client.UploadOptions{HoldTime: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "" {
+		t.Fatal("no hash returned")
+	}
+	if err := c.Pin(ctx, testPIN2, client.PinOptions{HoldTime: 5}); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Pin(ctx, "notarealhash", client.PinOptions{HoldTime: 5})
+	if e, ok := err.(*client.Error); !ok || e.StatusCode != 400 || e.RequestID == "" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var uploads []models.Upload
+	if err := c.Uploads(1).All(ctx, &uploads); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) == 0 {
+		t.Fatal("no uploads returned")
+	}
+
+	// account
+	if _, err := c.Credits(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Networks(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,26 +6,27 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/RTradeLtd/Temporal/eh"
 	jwt "github.com/appleboy/gin-jwt"
 	"github.com/gin-gonic/gin"
 )
 
 // Fail fails context with given error and optional status code. Defaults to
-// http.StatusInternalServerError
+// the status of the error in the catalog, or http.StatusBadRequest
 func Fail(c *gin.Context, err error, code ...int) {
-	c.JSON(status(code), gin.H{
-		"code":     status(code),
-		"response": err.Error(),
-	})
+	fail(c, err.Error(), nil, code)
 }
 
 // FailWithMessage fails context with given message and optional status code.
-// Defaults to http.StatusInternalServerError
+// Defaults to the status of the message in the catalog, or http.StatusBadRequest
 func FailWithMessage(c *gin.Context, message string, code ...int) {
-	c.JSON(status(code), gin.H{
-		"code":     status(code),
-		"response": message,
-	})
+	fail(c, message, nil, code)
+}
+
+// FailWithDetails fails context with given message, optional status code, and
+// details about the error which are returned to the client
+func FailWithDetails(c *gin.Context, message string, details interface{}, code ...int) {
+	fail(c, message, details, code)
 }
 
 // FailWithBadRequest fails context with a bad request error and given message
@@ -35,14 +36,50 @@ func FailWithBadRequest(c *gin.Context, message string) {
 
 // FailWithMissingField is a failure used when a post form does not exist
 func FailWithMissingField(c *gin.Context, field string) {
-	FailWithBadRequest(c, fmt.Sprintf("%s not present", field))
+	e := &eh.Error{
+		Code:    eh.MissingField,
+		Message: fmt.Sprintf("%s not present", field),
+		Details: gin.H{"field": field},
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"code":     http.StatusBadRequest,
+		"response": e.Message,
+		"error":    e,
+	})
+}
+
+// FailWithInvalidField is a failure used when a field is present, but invalid
+func FailWithInvalidField(c *gin.Context, field, reason string) {
+	e := &eh.Error{
+		Code:    eh.InvalidField,
+		Message: fmt.Sprintf("%s %s", field, reason),
+		Details: gin.H{"field": field},
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"code":     http.StatusBadRequest,
+		"response": e.Message,
+		"error":    e,
+	})
 }
 
 // FailNotAuthorized is a failure used when a user is unauthorized for an action
 func FailNotAuthorized(c *gin.Context, message string) {
-	c.JSON(http.StatusForbidden, gin.H{
-		"code":     http.StatusForbidden,
+	FailWithMessage(c, message, http.StatusForbidden)
+}
+
+// fail writes an error response. The message is kept in "response" for
+// existing clients, while "error" carries its code from the error catalog
+func fail(c *gin.Context, message string, details interface{}, code []int) {
+	if def, ok := eh.Lookup(message); ok && len(code) == 0 {
+		code = []int{def.Status}
+	}
+	s := status(code)
+	e := eh.New(message, s)
+	e.Details = details
+	c.JSON(s, gin.H{
+		"code":     s,
 		"response": message,
+		"error":    e,
 	})
 }
 
@@ -1,8 +1,14 @@
 package v2
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/gin-gonic/gin"
 )
 
 func Test_status(t *testing.T) {
@@ -26,3 +32,67 @@ func Test_status(t *testing.T) {
 		})
 	}
 }
+
+func Test_fail(t *testing.T) {
+	type response struct {
+		Code     int       `json:"code"`
+		Response string    `json:"response"`
+		Error    *eh.Error `json:"error"`
+	}
+	tests := []struct {
+		name          string
+		fail          func(c *gin.Context)
+		wantStatus    int
+		wantCode      eh.Code
+		wantRetryable bool
+		wantDetails   bool
+	}{
+		{"Catalog", func(c *gin.Context) {
+			FailWithMessage(c, eh.IPFSConnectionError)
+		}, http.StatusBadRequest, "ipfs_connection", true, false},
+		{"CatalogStatus", func(c *gin.Context) {
+			Fail(c, errors.New(eh.NoKeyError))
+		}, http.StatusNotFound, "no_key", false, false},
+		{"ExplicitStatus", func(c *gin.Context) {
+			Fail(c, errors.New(eh.NoKeyError), http.StatusBadRequest)
+		}, http.StatusBadRequest, "no_key", false, false},
+		{"Generic", func(c *gin.Context) {
+			Fail(c, errors.New("something broke"), http.StatusServiceUnavailable)
+		}, http.StatusServiceUnavailable, eh.Unavailable, true, false},
+		{"NotAuthorized", func(c *gin.Context) {
+			FailNotAuthorized(c, eh.UnAuthorizedAdminAccess)
+		}, http.StatusForbidden, "unauthorized_admin_access", false, false},
+		{"MissingField", func(c *gin.Context) {
+			FailWithMissingField(c, "hash")
+		}, http.StatusBadRequest, eh.MissingField, false, true},
+		{"InvalidField", func(c *gin.Context) {
+			FailWithInvalidField(c, "hold_time", "must be of type int64")
+		}, http.StatusBadRequest, eh.InvalidField, false, true},
+		{"Details", func(c *gin.Context) {
+			FailWithDetails(c, "invalid hold time", gin.H{"max": 24}, http.StatusBadRequest)
+		}, http.StatusBadRequest, eh.BadRequest, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			tt.fail(c)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", recorder.Code, tt.wantStatus)
+			}
+			var resp response
+			if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != tt.wantStatus || resp.Error == nil || resp.Error.Message != resp.Response {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+			if resp.Error.Code != tt.wantCode || resp.Error.Retryable != tt.wantRetryable {
+				t.Fatalf("unexpected error %+v", resp.Error)
+			}
+			if (resp.Error.Details != nil) != tt.wantDetails {
+				t.Fatalf("unexpected details %+v", resp.Error.Details)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api"
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+// ipfsStat describes the content at an ipfs path
+type ipfsStat struct {
+	Hash string
+	// Size is the size of file data, and zero for directories
+	Size int64
+	// Type is either file or directory
+	Type string
+}
+
+// ipfsLink is an entry of an ipfs directory
+type ipfsLink struct {
+	Name string
+	Hash string
+	Size uint64
+	// Type is the unixfs type of the entry, see unixfsDirectory
+	Type int
+}
+
+// unixfsDirectory is the unixfs type of directories
+const unixfsDirectory = 1
+
+// ipfsRequest sends a request to the api of the node manager is connected to
+func ipfsRequest(ctx context.Context, manager rtfs.Manager, command string, opts map[string]string, args ...string) (*ipfsapi.Response, error) {
+	resp, err := manager.CustomRequest(ctx, manager.NodeAddress(), command, opts, args...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		resp.Close()
+		return nil, resp.Error
+	}
+	return resp, nil
+}
+
+// statIPFSPath returns the stat of the content at an ipfs path, such as
+// /ipfs/<cid>/some/file
+func statIPFSPath(ctx context.Context, manager rtfs.Manager, ipfsPath string) (*ipfsStat, error) {
+	resp, err := ipfsRequest(ctx, manager, "files/stat", nil, ipfsPath)
+	if err != nil {
+		return nil, err
+	}
+	var stat ipfsStat
+	if err := resp.Decode(&stat); err != nil {
+		return nil, err
+	}
+	return &stat, nil
+}
+
+// listIPFSPath returns the entries of the directory at an ipfs path
+func listIPFSPath(ctx context.Context, manager rtfs.Manager, ipfsPath string) ([]ipfsLink, error) {
+	resp, err := ipfsRequest(ctx, manager, "ls", nil, ipfsPath)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Objects []struct {
+			Links []ipfsLink
+		}
+	}
+	if err := resp.Decode(&out); err != nil {
+		return nil, err
+	}
+	if len(out.Objects) == 0 {
+		return nil, errors.New("no directory returned for " + ipfsPath)
+	}
+	return out.Objects[0].Links, nil
+}
+
+// ipfsFile streams a file from ipfs without holding it in memory. It
+// implements io.ReadSeeker so that it can be served with http.ServeContent,
+// which takes care of range and conditional requests. Reads stream from the
+// cat api starting at the current offset, and seeking restarts the stream
+type ipfsFile struct {
+	ctx     context.Context
+	manager rtfs.Manager
+	path    string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+// newIPFSFile returns a file streaming the content at an ipfs path, whose
+// size must be known ahead of time, as returned by statIPFSPath
+func newIPFSFile(ctx context.Context, manager rtfs.Manager, ipfsPath string, size int64) *ipfsFile {
+	return &ipfsFile{ctx: ctx, manager: manager, path: ipfsPath, size: size}
+}
+
+// Read reads from the current offset, opening a stream if there is none
+func (f *ipfsFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		resp, err := ipfsRequest(f.ctx, f.manager, "cat", map[string]string{
+			"offset": strconv.FormatInt(f.offset, 10),
+		}, f.path)
+		if err != nil {
+			return 0, err
+		}
+		f.body = resp.Output
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	if err == io.EOF && f.offset < f.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next read, closing the current stream if it moves
+func (f *ipfsFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != f.offset {
+		f.Close()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+// Close closes the current stream, if any
+func (f *ipfsFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
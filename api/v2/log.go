@@ -1,6 +1,7 @@
 package v2
 
 import (
+	"github.com/RTradeLtd/Temporal/api/middleware"
 	"github.com/gin-gonic/gin"
 )
 
@@ -14,9 +15,7 @@ import (
 // with the given request to make it easier to debug user-submitted erros.
 func (api *API) LogError(c *gin.Context, err error, message string, fields ...interface{}) func(code ...int) {
 	// create base entry with the associated request id
-	// for some reason this is being set as `X-Request-Id` despite initially
-	// setting the header to `X-Request-ID`
-	var logger = api.l.With("request-id", c.GetHeader("X-Request-Id"))
+	var logger = api.l.With("request-id", middleware.GetRequestID(c))
 
 	// write log
 	if fields != nil && len(fields)%2 == 0 {
@@ -0,0 +1,514 @@
+package v2
+
+import (
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/gin-gonic/gin"
+)
+
+// openAPIPath is where the openapi specification is served
+const openAPIPath = "/v2/openapi.json"
+
+// operation documents a route in the openapi specification. Operations are
+// keyed by method and path in the operations table
+type operation struct {
+	Summary     string
+	Description string
+	Tag         string
+	// Public routes do not require a jwt
+	Public bool
+	// Request is the type of the request body. Fields are named after their
+	// form and json tags, and marked required by a binding tag containing "required"
+	Request interface{}
+	// Query is the type of the query parameters, using the same tags as Request
+	Query interface{}
+	// Response is the type of the "response" field of successful responses
+	Response interface{}
+	// Paged routes take page and limit parameters, and respond with a page of Response
+	Paged bool
+	// Raw routes respond with Response as the entire body
+	Raw bool
+	// Produces is the content type of raw responses, defaulting to json
+	Produces string
+	// Status is the status code of successful responses, defaulting to 200
+	Status int
+	// JSON routes only accept json request bodies
+	JSON bool
+	// Deprecated routes are kept for existing clients, and should not be used
+	Deprecated bool
+}
+
+// openAPIDocument is an OpenAPI 3 document
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*schema          `json:"schemas"`
+	Responses       map[string]*openAPIResponse `json:"responses"`
+	SecuritySchemes map[string]interface{}      `json:"securitySchemes"`
+}
+
+// openAPIOperation is an OpenAPI 3 operation object
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]openAPIMedia `json:"content"`
+}
+
+type openAPIResponse struct {
+	Ref         string                  `json:"$ref,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	Content     map[string]openAPIMedia `json:"content,omitempty"`
+}
+
+type openAPIMedia struct {
+	Schema *schema `json:"schema"`
+}
+
+// schema is an OpenAPI 3 schema object
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AllOf                []*schema          `json:"allOf,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+}
+
+// pathParameters describe the parameters used in route paths
+var pathParameters = map[string]string{
+	"cid":         "ipfs content hash",
+	"hash":        "ipfs content hash",
+	"hold_time":   "number of months to pin the content for",
+	"id":          "identifier of the object",
+	"name":        "name of the object",
+	"networkName": "name of the private ipfs network",
+	"number":      "payment number",
+	"path":        "path within the content",
+	"requestid":   "id of the pin request",
+	"token":       "email verification token",
+	"topic":       "pubsub topic",
+	"user":        "name of the user",
+}
+
+// errorResponse is the body of failed requests
+type errorResponse struct {
+	Code     int       `json:"code"`
+	Response string    `json:"response" doc:"the error message"`
+	Error    *eh.Error `json:"error"`
+}
+
+// pagedResponse is the response of paged routes
+type pagedResponse struct {
+	TotalRecord int         `json:"total_record"`
+	TotalPage   int         `json:"total_page"`
+	Records     interface{} `json:"records"`
+	Offset      int         `json:"offset"`
+	Limit       int         `json:"limit"`
+	Page        int         `json:"page"`
+	PrevPage    int         `json:"prev_page"`
+	NextPage    int         `json:"next_page"`
+}
+
+var (
+	fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// getOpenAPI serves the openapi specification of the registered routes
+func (api *API) getOpenAPI(c *gin.Context) {
+	api.openAPIOnce.Do(func() {
+		api.openAPI = newOpenAPIDocument(api.version, api.r.Routes())
+	})
+	c.JSON(http.StatusOK, api.openAPI)
+}
+
+// newOpenAPIDocument generates the openapi specification of the given routes.
+// Routes without an entry in the operations table are left out
+func newOpenAPIDocument(version string, routes gin.RoutesInfo) *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "Temporal API",
+			Description: "Temporal's V2 http API. Error codes are documented in docs/errors.md",
+			Version:     version,
+		},
+		Paths: make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: make(map[string]*schema),
+			SecuritySchemes: map[string]interface{}{
+				"bearerAuth": map[string]string{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+	g := &schemaGenerator{schemas: doc.Components.Schemas, types: make(map[string]reflect.Type)}
+	doc.Components.Responses = map[string]*openAPIResponse{
+		"Error": {
+			Description: "the request failed",
+			Content:     map[string]openAPIMedia{"application/json": {Schema: g.schemaOf(reflect.TypeOf(errorResponse{}))}},
+		},
+	}
+	// sort routes so generated schema names are stable
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Path+routes[i].Method < routes[j].Path+routes[j].Method
+	})
+	for _, route := range routes {
+		op, ok := operations[routeKey(route.Method, route.Path)]
+		if !ok {
+			continue
+		}
+		path := openAPIPathOf(route.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = g.operation(route, op)
+	}
+	return doc
+}
+
+// routeKey returns the key of a route in the operations table
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// openAPIPathOf converts gin path parameters to openapi ones
+func openAPIPathOf(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// operationID returns the name of the handler of a route
+func operationID(route gin.RouteInfo) string {
+	name := strings.TrimSuffix(route.Handler, "-fm")
+	name = name[strings.LastIndex(name, ".")+1:]
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+// schemaGenerator generates schemas from go types, storing named
+// struct types as components so they can be referenced
+type schemaGenerator struct {
+	schemas map[string]*schema
+	types   map[string]reflect.Type
+}
+
+func (g *schemaGenerator) operation(route gin.RouteInfo, op operation) *openAPIOperation {
+	out := &openAPIOperation{
+		OperationID: operationID(route),
+		Summary:     op.Summary,
+		Description: op.Description,
+		Deprecated:  op.Deprecated,
+		Responses:   make(map[string]*openAPIResponse),
+		Security:    []map[string][]string{{"bearerAuth": {}}},
+	}
+	if op.Tag != "" {
+		out.Tags = []string{op.Tag}
+	}
+	if op.Public {
+		out.Security = []map[string][]string{}
+	}
+	for _, part := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			out.Parameters = append(out.Parameters, openAPIParameter{
+				Name:        part[1:],
+				In:          "path",
+				Description: pathParameters[part[1:]],
+				Required:    true,
+				Schema:      &schema{Type: "string"},
+			})
+		}
+	}
+	if op.Query != nil {
+		out.Parameters = append(out.Parameters, g.parameters(reflect.TypeOf(op.Query))...)
+	}
+	if op.Paged {
+		out.Parameters = append(out.Parameters, g.parameters(reflect.TypeOf(pageQuery{}))...)
+	}
+	if op.Request != nil {
+		out.RequestBody = g.requestBody(reflect.TypeOf(op.Request))
+		if op.JSON {
+			delete(out.RequestBody.Content, "application/x-www-form-urlencoded")
+			out.RequestBody.Required = len(out.RequestBody.Content["application/json"].Schema.Required) > 0
+		}
+	}
+
+	// document the successful response
+	var response *schema
+	if op.Response != nil {
+		response = g.schemaOf(reflect.TypeOf(op.Response))
+	} else {
+		response = &schema{}
+	}
+	if op.Paged {
+		response = g.object(reflect.TypeOf(pagedResponse{}))
+		response.Properties["records"] = &schema{Type: "array", Items: g.schemaOf(reflect.TypeOf(op.Response))}
+	}
+	media := "application/json"
+	if op.Produces != "" {
+		media = op.Produces
+	}
+	if !op.Raw {
+		response = &schema{
+			Type: "object",
+			Properties: map[string]*schema{
+				"code":     {Type: "integer"},
+				"response": response,
+			},
+		}
+	} else if op.Response == nil {
+		response = &schema{Type: "string", Format: "binary"}
+	}
+	status := http.StatusOK
+	if op.Status != 0 {
+		status = op.Status
+	}
+	out.Responses[strconv.Itoa(status)] = &openAPIResponse{
+		Description: "the request succeeded",
+		Content:     map[string]openAPIMedia{media: {Schema: response}},
+	}
+	out.Responses["default"] = &openAPIResponse{Ref: "#/components/responses/Error"}
+	return out
+}
+
+// parameters returns the query parameters described by t
+func (g *schemaGenerator) parameters(t reflect.Type) []openAPIParameter {
+	var params []openAPIParameter
+	for _, field := range requestFields(t, "form") {
+		params = append(params, openAPIParameter{
+			Name:        field.name,
+			In:          "query",
+			Description: field.Tag.Get("doc"),
+			Required:    field.required,
+			Schema:      g.schemaOf(field.Type),
+		})
+	}
+	return params
+}
+
+// requestBody returns the request body described by t. Bodies with files
+// are sent as multipart forms, all others as url encoded forms or json
+func (g *schemaGenerator) requestBody(t reflect.Type) *openAPIRequestBody {
+	form, multipart := g.body(t, "form")
+	body := &openAPIRequestBody{Required: len(form.Required) > 0}
+	if multipart {
+		body.Content = map[string]openAPIMedia{"multipart/form-data": {Schema: form}}
+		return body
+	}
+	json, _ := g.body(t, "json")
+	body.Content = map[string]openAPIMedia{
+		"application/x-www-form-urlencoded": {Schema: form},
+		"application/json":                  {Schema: json},
+	}
+	return body
+}
+
+// body returns the schema of a request body, with properties named after
+// the given tag, and whether the body contains files
+func (g *schemaGenerator) body(t reflect.Type, tag string) (*schema, bool) {
+	var (
+		body  = &schema{Type: "object", Properties: make(map[string]*schema)}
+		files bool
+	)
+	for _, field := range requestFields(t, tag) {
+		property := g.schemaOf(field.Type)
+		if field.Type == fileHeaderType || field.Type == reflect.PtrTo(fileHeaderType) {
+			files = true
+		}
+		if doc := field.Tag.Get("doc"); doc != "" {
+			property = withDescription(property, doc)
+		}
+		body.Properties[field.name] = property
+		if field.required {
+			body.Required = append(body.Required, field.name)
+		}
+	}
+	return body, files
+}
+
+type requestField struct {
+	reflect.StructField
+	name     string
+	required bool
+}
+
+// requestFields returns the fields of a request type, named after the given tag
+func requestFields(t reflect.Type, tag string) []requestField {
+	var fields []requestField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, requestField{
+			StructField: field,
+			name:        name,
+			required:    strings.Contains(field.Tag.Get("binding"), "required"),
+		})
+	}
+	return fields
+}
+
+// schemaOf returns the schema of t
+func (g *schemaGenerator) schemaOf(t reflect.Type) *schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t == fileHeaderType:
+		return &schema{Type: "string", Format: "binary"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int:
+		return &schema{Type: "integer"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var min float64
+		return &schema{Type: "integer", Minimum: &min}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := g.name(t)
+		if _, ok := g.schemas[name]; !ok {
+			// register before generating to support recursive types
+			g.schemas[name] = &schema{}
+			*g.schemas[name] = *g.object(t)
+		}
+		return &schema{Ref: "#/components/schemas/" + name}
+	default:
+		// interfaces may hold any value
+		return &schema{}
+	}
+}
+
+// object returns the schema of a struct, with properties named after
+// their json tags. Fields of embedded structs are promoted
+func (g *schemaGenerator) object(t reflect.Type) *schema {
+	out := &schema{Type: "object", Properties: make(map[string]*schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if field.Anonymous && tag[0] == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for name, property := range g.object(embedded).Properties {
+					out.Properties[name] = property
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+		property := g.schemaOf(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			property = withDescription(property, doc)
+		}
+		out.Properties[name] = property
+	}
+	return out
+}
+
+// name returns the component name of a struct type, qualifying it
+// with its package if another type already uses the name
+func (g *schemaGenerator) name(t reflect.Type) string {
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	name := string(r)
+	if existing, ok := g.types[name]; ok && existing != t {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.Title(pkg) + name
+	}
+	g.types[name] = t
+	return name
+}
+
+// withDescription adds a description to a schema. References
+// can not have siblings, so they are wrapped in allOf
+func withDescription(s *schema, description string) *schema {
+	if s.Ref != "" {
+		return &schema{Description: description, AllOf: []*schema{s}}
+	}
+	s.Description = description
+	return s
+}
@@ -0,0 +1,91 @@
+package v2
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/config/v2"
+)
+
+func Test_API_OpenAPI(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every registered route must be documented
+	for _, route := range api.r.Routes() {
+		if _, ok := operations[routeKey(route.Method, route.Path)]; !ok {
+			t.Errorf("%s %s has no entry in the openapi operations", route.Method, route.Path)
+		}
+	}
+
+	// /v2/openapi.json
+	var doc openAPIDocument
+	if err := sendRequest(
+		api, "GET", openAPIPath, 200, nil, nil, &doc,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Fatalf("unexpected openapi version %s", doc.OpenAPI)
+	}
+	for _, route := range api.r.Routes() {
+		if doc.Paths[openAPIPathOf(route.Path)] == nil {
+			t.Errorf("%s missing from the specification", route.Path)
+		}
+	}
+	pin := doc.Paths["/v2/ipfs/public/pin/{hash}"]["post"]
+	if pin == nil || pin.OperationID != "pinHashLocally" || len(pin.Parameters) != 1 || pin.Parameters[0].In != "path" {
+		t.Fatalf("unexpected pin operation %+v", pin)
+	}
+	form := pin.RequestBody.Content["application/x-www-form-urlencoded"].Schema
+	if form == nil || !reflect.DeepEqual(form.Required, []string{"hold_time"}) || form.Properties["hold_time"].Type != "integer" {
+		t.Fatalf("unexpected pin request body %+v", pin.RequestBody)
+	}
+	if body := pin.RequestBody.Content["application/json"].Schema; body == nil || body.Properties["hold_time"] == nil {
+		t.Fatalf("unexpected pin json body %+v", pin.RequestBody)
+	}
+	upload := doc.Paths["/v2/ipfs/public/file/add"]["post"]
+	if upload == nil || upload.RequestBody.Content["multipart/form-data"].Schema == nil {
+		t.Fatalf("unexpected upload operation %+v", upload)
+	}
+	if doc.Components.Schemas["Upload"] == nil {
+		t.Fatal("upload schema not generated")
+	}
+}
+
+func Test_openAPIPathOf(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v2/systems/check", "/v2/systems/check"},
+		{"/v2/ipfs/public/pin/:hash", "/v2/ipfs/public/pin/{hash}"},
+		{"/v2/ipfs/private/dag/:hash/:networkName", "/v2/ipfs/private/dag/{hash}/{networkName}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := openAPIPathOf(tt.path); got != tt.want {
+				t.Errorf("openAPIPathOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
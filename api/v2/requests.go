@@ -0,0 +1,304 @@
+package v2
+
+import (
+	"mime/multipart"
+	"time"
+)
+
+// request types describe the parameters accepted by api routes. Field names
+// follow their form tag, binding tags mark required and validated fields,
+// and doc tags describe the field in the openapi specification
+
+type emailRequest struct {
+	EmailAddress string `form:"email_address" json:"email_address" binding:"required" doc:"email address of the account"`
+}
+
+type registerRequest struct {
+	Username     string `form:"username" json:"username" binding:"required" doc:"name of the account, which can not contain an @ sign"`
+	Password     string `form:"password" json:"password" binding:"required"`
+	EmailAddress string `form:"email_address" json:"email_address" binding:"required"`
+}
+
+type registerOrgUserRequest struct {
+	Username         string `form:"username" json:"username" binding:"required" doc:"name of the account, which can not contain an @ sign"`
+	Password         string `form:"password" json:"password" binding:"required"`
+	EmailAddress     string `form:"email_address" json:"email_address" binding:"required"`
+	OrganizationName string `form:"organization_name" json:"organization_name" binding:"required" doc:"organization to register the user with"`
+}
+
+type changePasswordRequest struct {
+	OldPassword string `form:"old_password" json:"old_password" binding:"required"`
+	NewPassword string `form:"new_password" json:"new_password" binding:"required"`
+}
+
+type createKeyRequest struct {
+	KeyType string `form:"key_type" json:"key_type" binding:"required,oneof=rsa ed25519" doc:"rsa or ed25519"`
+	KeyBits int    `form:"key_bits" json:"key_bits" binding:"required" doc:"size of the key in bits"`
+	KeyName string `form:"key_name" json:"key_name" binding:"required"`
+}
+
+type formatQuery struct {
+	Format string `form:"format" json:"format" doc:"csv or jsonl to export every record instead of a page"`
+}
+
+type auditSearchQuery struct {
+	Actor   string `form:"actor" json:"actor" doc:"user who performed the action"`
+	Action  string `form:"action" json:"action" doc:"action to search for"`
+	Account string `form:"account" json:"account" doc:"account the action affected"`
+	Format  string `form:"format" json:"format" doc:"jsonl to export every event instead of a page"`
+}
+
+type planRequest struct {
+	Plan string `form:"plan" json:"plan" binding:"required" doc:"name of the subscription plan"`
+}
+
+type creditValueRequest struct {
+	CreditValue float64 `form:"credit_value" json:"credit_value" binding:"required,gt=0" doc:"value of credits to purchase in usd"`
+}
+
+type signedPaymentRequest struct {
+	PaymentType   string  `form:"payment_type" json:"payment_type" binding:"required,oneof=0 1" doc:"0 to pay with rtc, 1 to pay with eth"`
+	SenderAddress string  `form:"sender_address" json:"sender_address" binding:"required" doc:"address the payment will be sent from"`
+	CreditValue   float64 `form:"credit_value" json:"credit_value" binding:"required,gt=0" doc:"value of credits to purchase in usd"`
+}
+
+type confirmPaymentRequest struct {
+	PaymentNumber int64  `form:"payment_number" json:"payment_number" binding:"required"`
+	TxHash        string `form:"tx_hash" json:"tx_hash" binding:"required" doc:"hash of the payment transaction"`
+}
+
+type stripeIntentRequest struct {
+	StripeEmail  string `form:"stripe_email" json:"stripe_email" binding:"required" doc:"email address stripe sends receipts to"`
+	ValueInCents int64  `form:"value_in_cents" json:"value_in_cents" binding:"required,gt=0"`
+}
+
+type stripeChargeRequest struct {
+	StripeToken  string `form:"stripe_token" json:"stripe_token" binding:"required" doc:"tokenized card to charge"`
+	StripeEmail  string `form:"stripe_email" json:"stripe_email" binding:"required" doc:"email address stripe sends receipts to"`
+	ValueInCents int64  `form:"value_in_cents" json:"value_in_cents" binding:"required,gt=0"`
+}
+
+type stripeRefundRequest struct {
+	PaymentIntentID string  `form:"payment_intent_id" json:"payment_intent_id" binding:"required"`
+	Amount          float64 `form:"amount" json:"amount" binding:"required,gt=0" doc:"value of credits to refund"`
+	Reason          string  `form:"reason" json:"reason"`
+}
+
+type cryptoRefundRequest struct {
+	PaymentNumber int64   `form:"payment_number" json:"payment_number" binding:"required"`
+	Address       string  `form:"address" json:"address" binding:"required" doc:"address the refund is paid out to"`
+	Amount        float64 `form:"amount" json:"amount" binding:"required,gt=0" doc:"value of credits to refund"`
+	Reason        string  `form:"reason" json:"reason"`
+}
+
+type refundNoteRequest struct {
+	Note string `form:"note" json:"note" doc:"note recorded with the review"`
+}
+
+type refundDenyRequest struct {
+	Note string `form:"note" json:"note" binding:"required" doc:"reason the refund was denied"`
+}
+
+type refundPaidRequest struct {
+	TxHash string `form:"tx_hash" json:"tx_hash" binding:"required" doc:"hash of the payout transaction"`
+}
+
+type userSearchQuery struct {
+	Search string `form:"search" json:"search" doc:"part of a user name or email address"`
+}
+
+type adjustCreditsRequest struct {
+	Amount float64 `form:"amount" json:"amount" binding:"required" doc:"credits to grant, or revoke when negative"`
+	Reason string  `form:"reason" json:"reason" binding:"required" doc:"reason recorded in the ledger"`
+}
+
+type tierRequest struct {
+	Tier string `form:"tier" json:"tier" binding:"required" doc:"name of the data usage tier"`
+}
+
+type pinRequest struct {
+	HoldTime int64  `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin the content for"`
+	FileName string `form:"file_name" json:"file_name" doc:"name to record the upload under"`
+}
+
+type holdTimeRequest struct {
+	HoldTime int64 `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin the content for"`
+}
+
+type addFileRequest struct {
+	File       *multipart.FileHeader `form:"file" json:"-" binding:"required"`
+	HoldTime   int64                 `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin the content for"`
+	HashType   string                `form:"hash_type" json:"hash_type" doc:"multihash type, defaults to sha2-256"`
+	Passphrase string                `form:"passphrase" json:"passphrase" doc:"encrypts the file before it is added when given"`
+}
+
+type carImportRequest struct {
+	File     *multipart.FileHeader `form:"file" json:"-" binding:"required" doc:"car file, of version 1 or 2"`
+	HoldTime int64                 `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin each root for"`
+	FileName string                `form:"file_name" json:"file_name" doc:"name to record the uploads of the roots under, defaults to the name of the file"`
+}
+
+type pubSubRequest struct {
+	Message string `form:"message" json:"message" binding:"required"`
+}
+
+type networkRequest struct {
+	NetworkName string `form:"network_name" json:"network_name" binding:"required"`
+}
+
+type createNetworkRequest struct {
+	NetworkName    string   `form:"network_name" json:"network_name" binding:"required"`
+	SwarmKey       string   `form:"swarm_key" json:"swarm_key"`
+	BootstrapPeers []string `form:"bootstrap_peers" json:"bootstrap_peers"`
+	Users          []string `form:"users" json:"users" doc:"users allowed to access the network"`
+}
+
+type networkUsersRequest struct {
+	NetworkName string   `form:"network_name" json:"network_name" binding:"required"`
+	Users       []string `form:"users" json:"users" binding:"required"`
+}
+
+type networkOwnersRequest struct {
+	NetworkName string   `form:"network_name" json:"network_name" binding:"required"`
+	Owners      []string `form:"owners" json:"owners" binding:"required"`
+}
+
+type networkStatsQuery struct {
+	Stats bool `form:"stats" json:"stats" doc:"include statistics from the orchestrator"`
+}
+
+type privatePinRequest struct {
+	NetworkName string `form:"network_name" json:"network_name" binding:"required"`
+	HoldTime    int64  `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin the content for"`
+	FileName    string `form:"file_name" json:"file_name" doc:"name to record the upload under"`
+}
+
+type privateAddFileRequest struct {
+	File        *multipart.FileHeader `form:"file" json:"-" binding:"required"`
+	NetworkName string                `form:"network_name" json:"network_name" binding:"required"`
+	HoldTime    int64                 `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin the content for"`
+	Passphrase  string                `form:"passphrase" json:"passphrase" doc:"encrypts the file before it is added when given"`
+}
+
+type privatePubSubRequest struct {
+	NetworkName string `form:"network_name" json:"network_name" binding:"required"`
+	Message     string `form:"message" json:"message" binding:"required"`
+}
+
+type downloadRequest struct {
+	NetworkName  string   `form:"network_name" json:"network_name" doc:"private network to download from, defaults to public"`
+	ContentType  string   `form:"content_type" json:"content_type" doc:"content type of the response, defaults to application/octet-stream"`
+	DecryptKey   string   `form:"decrypt_key" json:"decrypt_key" doc:"decrypts content encrypted by temporal"`
+	ExtraHeaders []string `form:"extra_headers" json:"-" doc:"header names and values to add to the response, in pairs"`
+	// Headers are the extra headers of json requests, which are sent as an object
+	Headers map[string]string `form:"-" json:"extra_headers"`
+}
+
+type gatewayQuery struct {
+	NetworkName string `form:"network_name" json:"network_name" doc:"private network to serve content from, defaults to public"`
+}
+
+type beamRequest struct {
+	SourceNetwork      string `form:"source_network" json:"source_network" binding:"required" doc:"network to beam from, or public"`
+	DestinationNetwork string `form:"destination_network" json:"destination_network" binding:"required" doc:"network to beam to, or public"`
+	ContentHash        string `form:"content_hash" json:"content_hash" binding:"required"`
+	Passphrase         string `form:"passphrase" json:"passphrase" doc:"encrypts the content before it is beamed when given"`
+	Decrypt            bool   `form:"decrypt" json:"decrypt" doc:"decrypts content encrypted by temporal with the passphrase, rather than encrypting it"`
+	FileName           string `form:"file_name" json:"file_name" doc:"name the encrypted copy is recorded under, defaults to the content hash"`
+	HoldTime           int64  `form:"hold_time" json:"hold_time" doc:"months to store the content on the destination network for, defaults to 1"`
+}
+
+type ipnsPublishRequest struct {
+	Hash     string `form:"hash" json:"hash" binding:"required" doc:"content hash the record points to"`
+	LifeTime string `form:"life_time" json:"life_time" binding:"required" doc:"duration the record is valid for, such as 24h"`
+	TTL      string `form:"ttl" json:"ttl" binding:"required" doc:"duration the record may be cached for, such as 1h"`
+	Key      string `form:"key" json:"key" binding:"required" doc:"name of the key to publish with"`
+	Resolve  bool   `form:"resolve" json:"resolve" doc:"resolve the hash before publishing"`
+}
+
+type ipnsPinRequest struct {
+	HoldTime int64  `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin the content for"`
+	IPNSPath string `form:"ipns_path" json:"ipns_path" binding:"required" doc:"ipns path to resolve, such as /ipns/<name>"`
+}
+
+type pageQuery struct {
+	Page  int `form:"page" json:"page" binding:"gte=0" doc:"page to return, starting at 1"`
+	Limit int `form:"limit" json:"limit" binding:"gte=0" doc:"number of records per page, defaults to 10"`
+}
+
+type pagedQuery struct {
+	Paged bool `form:"paged" json:"paged" doc:"return a page of results instead of every result"`
+}
+
+type searchUploadsRequest struct {
+	SearchQuery string `form:"search_query" json:"search_query" binding:"required" doc:"part of a file name"`
+}
+
+type fileCostRequest struct {
+	File     *multipart.FileHeader `form:"file" json:"-" binding:"required"`
+	HoldTime int64                 `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin the content for"`
+}
+
+type orgRequest struct {
+	Name string `form:"name" json:"name" binding:"required" doc:"name of the organization"`
+}
+
+type billingReportRequest struct {
+	Name         string `form:"name" json:"name" binding:"required" doc:"name of the organization"`
+	NumberOfDays int    `form:"number_of_days" json:"number_of_days" binding:"required" doc:"number of days the report covers"`
+}
+
+type orgUserUploadsRequest struct {
+	Name  string `form:"name" json:"name" binding:"required" doc:"name of the organization"`
+	User  string `form:"user" json:"user" binding:"required" doc:"organization user to list uploads of"`
+	AsCSV bool   `form:"as_csv" json:"as_csv" doc:"return every upload as a csv file"`
+	Page  int    `form:"page" json:"page" doc:"page to return, starting at 1"`
+	Limit int    `form:"limit" json:"limit" doc:"number of uploads per page, defaults to 10"`
+}
+
+type contentHashRequest struct {
+	ContentHash string `form:"content_hash" json:"content_hash" binding:"required" doc:"content hash the ens name resolves to"`
+}
+
+type lensIndexRequest struct {
+	ObjectType       string `form:"object_type" json:"object_type" binding:"required,oneof=ipld" doc:"type of the object, currently only ipld"`
+	ObjectIdentifier string `form:"object_identifier" json:"object_identifier" binding:"required" doc:"content hash of the object"`
+	Reindex          bool   `form:"reindex" json:"reindex"`
+}
+
+type lensSearchRequest struct {
+	Query      string   `form:"query" json:"query" binding:"required"`
+	Tags       []string `form:"tags" json:"tags"`
+	Categories []string `form:"categories" json:"categories"`
+	MimeTypes  []string `form:"mime_types" json:"mime_types"`
+	Hashes     []string `form:"hashes" json:"hashes"`
+	Required   []string `form:"required" json:"required"`
+}
+
+type captchaRequest struct {
+	Response string `form:"g-recaptcha-response" json:"g-recaptcha-response" binding:"required" doc:"token returned by recaptcha"`
+}
+
+type swarmUploadRequest struct {
+	File     *multipart.FileHeader `form:"file" json:"-" binding:"required"`
+	HoldTime int64                 `form:"hold_time" json:"hold_time" binding:"required" doc:"number of months to pin the content for"`
+	IsTar    bool                  `form:"is_tar" json:"is_tar" doc:"upload the file as a tar archive"`
+}
+
+type pinningServicePin struct {
+	CID     string            `json:"cid" binding:"required" doc:"content to pin"`
+	Name    string            `json:"name,omitempty" binding:"max=255" doc:"optional name of the pin"`
+	Origins []string          `json:"origins,omitempty" binding:"max=20" doc:"multiaddrs of peers known to provide the content"`
+	Meta    map[string]string `json:"meta,omitempty" binding:"max=1000" doc:"optional metadata, where hold_time sets the number of months to pin the content for"`
+}
+
+type pinningServiceQuery struct {
+	CID    string    `form:"cid" doc:"comma separated cids to list pins of, up to 10"`
+	Name   string    `form:"name" binding:"max=255" doc:"name of the pins to list"`
+	Match  string    `form:"match" binding:"omitempty,oneof=exact iexact partial ipartial" doc:"how names are matched, defaulting to exact"`
+	Status string    `form:"status" doc:"comma separated statuses of the pins to list, any of queued, pinning, pinned or failed, defaulting to pinned"`
+	Before time.Time `form:"before" time_format:"2006-01-02T15:04:05Z07:00" doc:"list pins created before this time"`
+	After  time.Time `form:"after" time_format:"2006-01-02T15:04:05Z07:00" doc:"list pins created after this time"`
+	Limit  int       `form:"limit" binding:"omitempty,min=1,max=1000" doc:"maximum number of pins to list, defaulting to 10"`
+	Meta   string    `form:"meta" doc:"json object of metadata the listed pins must have"`
+}
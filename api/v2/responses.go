@@ -0,0 +1,143 @@
+package v2
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/Temporal/pins"
+	"github.com/RTradeLtd/database/v2/models"
+	pbOrch "github.com/RTradeLtd/grpc/nexus"
+)
+
+// response types describe the bodies of responses which are built from
+// gin.H maps, for use in the openapi specification
+
+type systemsCheckResponse struct {
+	Code     int    `json:"code"`
+	Response string `json:"response"`
+	Version  string `json:"version" doc:"version of the api"`
+}
+
+type statsResponse struct {
+	Code     int         `json:"code"`
+	Response interface{} `json:"response" doc:"request statistics"`
+	Version  string      `json:"version" doc:"version of the api"`
+}
+
+type tokenResponse struct {
+	Code   int       `json:"code"`
+	Token  string    `json:"token" doc:"jwt used in the Authorization header as a bearer token"`
+	Expire time.Time `json:"expire"`
+}
+
+type registerResponse struct {
+	*models.User
+	Status string `doc:"terms of service the user agreed to"`
+}
+
+type keyNamesResponse struct {
+	KeyNames []string `json:"key_names"`
+	KeyIDs   []string `json:"key_ids"`
+}
+
+type adminUserResponse struct {
+	User  *adminUser    `json:"user"`
+	Usage *models.Usage `json:"usage"`
+}
+
+type signedPaymentResponse struct {
+	ChargeAmountBig string    `json:"charge_amount_big" doc:"amount to pay in wei"`
+	Method          uint8     `json:"method" doc:"0 for rtc, 1 for eth"`
+	PaymentNumber   int64     `json:"payment_number"`
+	Prefixed        bool      `json:"prefixed"`
+	V               uint8     `json:"v"`
+	ExpiresAt       time.Time `json:"expires_at" doc:"time the quoted price expires"`
+	Formatted       struct {
+		H string `json:"h"`
+		R string `json:"r"`
+		S string `json:"s"`
+	} `json:"formatted" doc:"signature to submit to the payment contract"`
+}
+
+type bchPaymentResponse struct {
+	DepositAddress string    `json:"deposit_address"`
+	ChargeAmount   float64   `json:"charge_amount" doc:"amount to pay in bch"`
+	PaymentNumber  int64     `json:"payment_number"`
+	ExpiresAt      time.Time `json:"expires_at" doc:"time the quoted price expires"`
+}
+
+type dashPaymentResponse struct {
+	PaymentNumber    int64
+	ChargeAmount     float64 `doc:"amount to pay in dash, including the forwarding fee"`
+	Blockchain       string
+	Status           string
+	Network          string
+	DepositAddress   string
+	PaymentForwardID string
+}
+
+type stripeIntentResponse struct {
+	PaymentIntent  string `json:"payment_intent"`
+	ClientSecret   string `json:"client_secret"`
+	PublishableKey string `json:"publishable_key"`
+}
+
+type stripeSetupResponse struct {
+	SetupIntent    string `json:"setup_intent"`
+	ClientSecret   string `json:"client_secret"`
+	PublishableKey string `json:"publishable_key"`
+}
+
+type pubSubResponse struct {
+	Topic   string `json:"topic"`
+	Message string `json:"message"`
+}
+
+type networkCreatedResponse struct {
+	ID          uint     `json:"id"`
+	PeerID      string   `json:"peer_id"`
+	NetworkName string   `json:"network_name"`
+	SwarmKey    string   `json:"swarm_key"`
+	Users       []string `json:"users"`
+}
+
+type networkStateResponse struct {
+	NetworkName string `json:"network_name"`
+	State       string `json:"state" doc:"started, stopped or removed"`
+}
+
+type networkResponse struct {
+	Database     *models.HostedNetwork        `json:"database"`
+	NetworkStats *pbOrch.NetworkStatusReponse `json:"network_stats,omitempty"`
+}
+
+type carImportResponse struct {
+	Blocks int             `json:"blocks" doc:"number of blocks imported"`
+	Roots  []carImportRoot `json:"roots"`
+}
+
+type carImportRoot struct {
+	CID    string  `json:"cid"`
+	Cost   float64 `json:"cost" doc:"credits charged to pin the root"`
+	Notice string  `json:"notice,omitempty" doc:"why the root was not pinned again"`
+}
+
+type pinningServiceStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    pins.Status       `json:"status" doc:"queued, pinning, pinned or failed"`
+	Created   time.Time         `json:"created"`
+	Pin       pinningServicePin `json:"pin"`
+	Delegates []string          `json:"delegates" doc:"multiaddrs of the nodes the content is pinned to"`
+	Info      map[string]string `json:"info"`
+}
+
+type pinningServiceResults struct {
+	Count   int                    `json:"count" doc:"total number of pins matching the query"`
+	Results []pinningServiceStatus `json:"results"`
+}
+
+type pinningServiceError struct {
+	Error struct {
+		Reason  string `json:"reason" doc:"type of the error, ie NOT_FOUND"`
+		Details string `json:"details,omitempty"`
+	} `json:"error"`
+}
@@ -1,14 +1,17 @@
 package v2
 
 import (
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"html"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
 	"github.com/RTradeLtd/Temporal/queue"
 	"github.com/RTradeLtd/database/v2/models"
 	"github.com/gin-gonic/gin"
@@ -48,18 +51,16 @@ func (api *API) changeAccountPassword(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "old_password", "new_password")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req changePasswordRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// parse html encoded strings
-	forms["old_password"] = html.UnescapeString(forms["old_password"])
-	forms["new_password"] = html.UnescapeString(forms["new_password"])
+	req.OldPassword = html.UnescapeString(req.OldPassword)
+	req.NewPassword = html.UnescapeString(req.NewPassword)
 	api.l.With("user", username).Info("password change requested")
 	// change password
-	if ok, err := api.um.ChangePassword(username, forms["old_password"], forms["new_password"]); err != nil {
+	if ok, err := api.um.ChangePassword(username, req.OldPassword, req.NewPassword); err != nil {
 		api.LogError(c, err, eh.PasswordChangeError)(http.StatusBadRequest)
 		return
 	} else if !ok {
@@ -75,36 +76,33 @@ func (api *API) changeAccountPassword(c *gin.Context) {
 
 // RegisterUserAccount is used to sign up with temporal
 func (api *API) registerUserAccount(c *gin.Context) {
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "username", "password", "email_address")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req registerRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// parse emails to prevent exploit of catch-all routing
 	// where people sign up with an email like myuser+test@example.org
 	// by having the +test they are effectively signing up under a new email
 	// granting them another free account.
-	if strings.ContainsRune(forms["email_address"], '+') {
+	if strings.ContainsRune(req.EmailAddress, '+') {
 		Fail(c, errors.New("emails must not contain + signs, this is to prevent abuse of catch all routing"))
 		return
 	}
 	// prevent people from registering usernames that contain an `@` sign
 	// this prevents griefing by prevent user sign-ins by using a username
 	// that is based off an email address
-	if strings.ContainsRune(forms["username"], '@') {
+	if strings.ContainsRune(req.Username, '@') {
 		Fail(c, errors.New("usernames cant contain @ sign"))
 		return
 	}
-	// parse html encoded strings
-	forms["password"] = html.UnescapeString(forms["password"])
 	// create user model
 	_, err := api.um.NewUserAccount(
-		forms["username"],
-		forms["password"],
-		forms["email_address"],
+		req.Username,
+		// parse html encoded strings
+		html.UnescapeString(req.Password),
+		req.EmailAddress,
 	)
-	api.handleUserCreate(c, forms, err)
+	api.handleUserCreate(c, req.Username, req.EmailAddress, "", err)
 }
 
 // CreateIPFSKey is used to create an IPFS key
@@ -114,20 +112,9 @@ func (api *API) createIPFSKey(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract forms
-	forms, missingField := api.extractPostForms(c, "key_type", "key_bits", "key_name")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
-		return
-	}
-	// validate key type
-	switch forms["key_type"] {
-	case "rsa", "ed25519":
-		break
-	default:
-		// user error, do not log
-		err := fmt.Errorf("%s is invalid key type must be rsa, or ed25519", forms["key_type"])
-		Fail(c, err, http.StatusBadRequest)
+	// key types are validated when binding
+	var req createKeyRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// get a list of users current keys
@@ -138,7 +125,7 @@ func (api *API) createIPFSKey(c *gin.Context) {
 	}
 	// format key name
 	// we prepend with the username to prevent key name collisions
-	keyName := fmt.Sprintf("%s-%s", username, forms["key_name"])
+	keyName := fmt.Sprintf("%s-%s", username, req.KeyName)
 	// parse through existing key names, and ensure one doesnt' already exist
 	for _, v := range keys["key_names"] {
 		if v == keyName {
@@ -147,12 +134,6 @@ func (api *API) createIPFSKey(c *gin.Context) {
 			return
 		}
 	}
-	// parse key bits
-	bitsInt, err := strconv.Atoi(forms["key_bits"])
-	if err != nil {
-		Fail(c, err)
-		return
-	}
 	// verify the user can create keys
 	if err := api.usage.CanCreateKey(username); err != nil {
 		api.LogError(c, err, err.Error())(http.StatusBadRequest)
@@ -167,12 +148,12 @@ func (api *API) createIPFSKey(c *gin.Context) {
 	key := queue.IPFSKeyCreation{
 		UserName:    username,
 		Name:        keyName,
-		Type:        forms["key_type"],
-		Size:        bitsInt,
+		Type:        req.KeyType,
+		Size:        req.KeyBits,
 		NetworkName: "public",
 	}
 	// send message for processing
-	if err = api.queues.key.PublishMessage(key); err != nil {
+	if err = api.publish(c, api.queues.key, key); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -222,6 +203,50 @@ func (api *API) getCredits(c *gin.Context) {
 	Respond(c, http.StatusOK, gin.H{"response": credits})
 }
 
+// getCreditHistory is used to retrieve the credit ledger of the authenticated user,
+// either as paginated json, or as a csv export of the entire ledger
+func (api *API) getCreditHistory(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	var query formatQuery
+	if !api.bindQuery(c, &query) {
+		return
+	}
+	if query.Format != "csv" {
+		api.pageIt(c, api.ledger.History(username), &[]ledger.Entry{})
+		return
+	}
+	var entries []ledger.Entry
+	if err := api.ledger.History(username).Order("created_at ASC").Find(&entries).Error; err != nil {
+		api.LogError(c, err, eh.CreditCheckError)(http.StatusBadRequest)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-credits.csv", username))
+	c.Header("Content-Type", "text/csv")
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "kind", "amount", "balance", "reason", "call_type", "cid", "job_id"})
+	for _, entry := range entries {
+		w.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			string(entry.Kind),
+			strconv.FormatFloat(entry.Amount, 'f', -1, 64),
+			strconv.FormatFloat(entry.Balance, 'f', -1, 64),
+			entry.Reason,
+			entry.CallType,
+			entry.CID,
+			entry.JobID,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		api.l.Errorw("failed to write credit history", "user", username, "error", err)
+	}
+}
+
 // ForgotEmail is used to retrieve an email if the user forgets it
 func (api *API) forgotEmail(c *gin.Context) {
 	username, err := GetAuthenticatedUserFromContext(c)
@@ -241,13 +266,12 @@ func (api *API) forgotEmail(c *gin.Context) {
 
 // ForgotUserName is used to send a username reminder to the email associated with the account
 func (api *API) forgotUserName(c *gin.Context) {
-	forms, missingField := api.extractPostForms(c, "email_address")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req emailRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// find email address associated with the user account
-	user, err := api.um.FindByEmail(forms["email_address"])
+	user, err := api.um.FindByEmail(req.EmailAddress)
 	if err != nil {
 		Fail(c, errors.New(eh.UserSearchError), http.StatusBadRequest)
 		return
@@ -266,7 +290,7 @@ func (api *API) forgotUserName(c *gin.Context) {
 		Emails:      []string{user.EmailAddress},
 	}
 	// send message for processing
-	if err = api.queues.email.PublishMessage(es); err != nil {
+	if err = api.publish(c, api.queues.email, es); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -276,13 +300,12 @@ func (api *API) forgotUserName(c *gin.Context) {
 
 // ResetPassword is used to reset the password associated with a user account
 func (api *API) resetPassword(c *gin.Context) {
-	forms, missingField := api.extractPostForms(c, "email_address")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req emailRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// find user account associated with the email
-	user, err := api.um.FindByEmail(forms["email_address"])
+	user, err := api.um.FindByEmail(req.EmailAddress)
 	if err != nil {
 		api.LogError(c, err, eh.UserSearchError)(http.StatusBadRequest)
 		return
@@ -307,7 +330,7 @@ func (api *API) resetPassword(c *gin.Context) {
 		Emails:      []string{user.EmailAddress},
 	}
 	// send message to queue system for processing
-	if err = api.queues.email.PublishMessage(es); err != nil {
+	if err = api.publish(c, api.queues.email, es); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -356,7 +379,7 @@ func (api *API) upgradeAccount(c *gin.Context) {
 		Emails:      []string{user.EmailAddress},
 	}
 	// send message to queue system for processing
-	if err = api.queues.email.PublishMessage(es); err != nil {
+	if err = api.publish(c, api.queues.email, es); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
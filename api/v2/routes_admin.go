@@ -0,0 +1,269 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// adminUser is the view of a user account given to administrators,
+// leaving out password hashes and verification tokens
+type adminUser struct {
+	ID             uint      `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UserName       string    `json:"user_name"`
+	EmailAddress   string    `json:"email_address"`
+	AccountEnabled bool      `json:"account_enabled"`
+	EmailEnabled   bool      `json:"email_enabled"`
+	AdminAccess    bool      `json:"admin_access"`
+	Credits        float64   `json:"credits"`
+}
+
+// TableName returns the table users are stored in
+func (adminUser) TableName() string {
+	return "users"
+}
+
+// adminUserColumns are the user columns selected into an adminUser
+const adminUserColumns = "id, created_at, user_name, email_address, account_enabled, email_enabled, admin_access, credits"
+
+// tiers are the data usage tiers an administrator can move a user to
+var tiers = map[string]models.DataUsageTier{
+	string(models.Unverified):   models.Unverified,
+	string(models.Free):         models.Free,
+	string(models.Paid):         models.Paid,
+	string(models.Partner):      models.Partner,
+	string(models.WhiteLabeled): models.WhiteLabeled,
+}
+
+// searchUsers is used by administrators to search users by user name or email address
+func (api *API) searchUsers(c *gin.Context) {
+	if _, ok := api.authorizeAdmin(c); !ok {
+		return
+	}
+	query := api.dbm.DB.Model(&adminUser{}).Select(adminUserColumns).Where("deleted_at IS NULL")
+	var req userSearchQuery
+	if !api.bindQuery(c, &req) {
+		return
+	}
+	if req.Search != "" {
+		pattern := "%" + req.Search + "%"
+		query = query.Where("user_name ILIKE ? OR email_address ILIKE ?", pattern, pattern)
+	}
+	api.pageIt(c, query, &[]adminUser{})
+}
+
+// getUser is used by administrators to view a user along with their usage and credits
+func (api *API) getUser(c *gin.Context) {
+	if _, ok := api.authorizeAdmin(c); !ok {
+		return
+	}
+	user, ok := api.findAdminUser(c)
+	if !ok {
+		return
+	}
+	usage, err := api.usage.FindByUserName(user.UserName)
+	if err != nil {
+		api.LogError(c, err, eh.UserSearchError)(http.StatusBadRequest)
+		return
+	}
+	Respond(c, http.StatusOK, gin.H{"response": gin.H{
+		"user":  user,
+		"usage": usage,
+	}})
+}
+
+// adjustCredits is used by administrators to grant, or with a negative amount
+// revoke, credits for a user. The reason is recorded in the ledger
+func (api *API) adjustCredits(c *gin.Context) {
+	admin, ok := api.authorizeAdmin(c)
+	if !ok {
+		return
+	}
+	var req adjustCreditsRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	username := c.Param("user")
+	entry, err := api.ledger.Adjust(username, req.Amount, ledger.Meta{
+		Reason: fmt.Sprintf("%s (by %s)", req.Reason, admin),
+	})
+	switch {
+	case err == nil:
+	case err == ledger.ErrInsufficientCredits:
+		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusBadRequest)
+		return
+	case err == ledger.ErrInvalidAmount:
+		Fail(c, err)
+		return
+	case gorm.IsRecordNotFoundError(err):
+		Fail(c, errors.New(eh.UserSearchError), http.StatusNotFound)
+		return
+	default:
+		api.LogError(c, err, eh.CreditAdjustError)(http.StatusBadRequest)
+		return
+	}
+	api.l.Infow("credits adjusted", "admin", admin, "user", username, "amount", req.Amount, "balance", entry.Balance)
+	Respond(c, http.StatusOK, gin.H{"response": entry})
+}
+
+// changeTier is used by administrators to move a user to a different data usage tier
+func (api *API) changeTier(c *gin.Context) {
+	admin, ok := api.authorizeAdmin(c)
+	if !ok {
+		return
+	}
+	var req tierRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	tier, ok := tiers[strings.ToLower(req.Tier)]
+	if !ok {
+		Fail(c, fmt.Errorf("%s is not a valid tier", req.Tier))
+		return
+	}
+	user, ok := api.findAdminUser(c)
+	if !ok {
+		return
+	}
+	if err := api.subscriptions.SetTier(user.UserName, tier); err != nil {
+		api.LogError(c, err, eh.TierUpgradeError)(http.StatusBadRequest)
+		return
+	}
+	api.l.Infow("tier changed", "admin", admin, "user", user.UserName, "tier", tier)
+	Respond(c, http.StatusOK, gin.H{"response": fmt.Sprintf("%s moved to the %s tier", user.UserName, tier)})
+}
+
+// disableUser is used by administrators to disable a user account, which
+// rejects any further requests authenticated as the user
+func (api *API) disableUser(c *gin.Context) {
+	api.setAccountEnabled(c, false)
+}
+
+// enableUser is used by administrators to re-enable a disabled user account
+func (api *API) enableUser(c *gin.Context) {
+	api.setAccountEnabled(c, true)
+}
+
+func (api *API) setAccountEnabled(c *gin.Context, enabled bool) {
+	admin, ok := api.authorizeAdmin(c)
+	if !ok {
+		return
+	}
+	user, ok := api.findAdminUser(c)
+	if !ok {
+		return
+	}
+	if !enabled && user.UserName == admin {
+		Fail(c, errors.New("administrators can not disable their own account"))
+		return
+	}
+	if err := api.dbm.DB.Model(user).Update("account_enabled", enabled).Error; err != nil {
+		api.LogError(c, err, eh.AccountUpdateError)(http.StatusBadRequest)
+		return
+	}
+	api.l.Infow("account updated", "admin", admin, "user", user.UserName, "enabled", enabled)
+	Respond(c, http.StatusOK, gin.H{"response": user})
+}
+
+// resendVerification is used by administrators to send a user a new email verification link
+func (api *API) resendVerification(c *gin.Context) {
+	admin, ok := api.authorizeAdmin(c)
+	if !ok {
+		return
+	}
+	username := c.Param("user")
+	found, err := api.um.FindByUserName(username)
+	if err != nil {
+		Fail(c, errors.New(eh.UserSearchError), http.StatusNotFound)
+		return
+	}
+	if found.EmailEnabled {
+		Fail(c, errors.New("user has already verified their email"))
+		return
+	}
+	// generate a new token, invalidating any previously sent links
+	user, err := api.um.GenerateEmailVerificationToken(username)
+	if err != nil {
+		api.LogError(c, err, eh.EmailTokenGenerationError)(http.StatusBadRequest)
+		return
+	}
+	url, err := api.emailVerificationURL(user)
+	if err != nil {
+		api.LogError(c, err, "failed to generate email verification jwt")(http.StatusInternalServerError)
+		return
+	}
+	es := queue.EmailSend{
+		Subject: "TEMPORAL Email Verification",
+		Content: fmt.Sprintf(
+			"To validate your email, just click the following <a href=\"%s\">link</a>\n", url,
+		),
+		ContentType: "text/html",
+		UserNames:   []string{user.UserName},
+		Emails:      []string{user.EmailAddress},
+	}
+	if err := api.publish(c, api.queues.email, es); err != nil {
+		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
+		return
+	}
+	api.l.Infow("verification email resent", "admin", admin, "user", user.UserName)
+	Respond(c, http.StatusOK, gin.H{"response": "verification email sent"})
+}
+
+// getUserUploads is used by administrators to list the uploads of a user
+func (api *API) getUserUploads(c *gin.Context) {
+	if _, ok := api.authorizeAdmin(c); !ok {
+		return
+	}
+	api.pageIt(c, api.upm.DB.Where("user_name = ?", c.Param("user")), &[]models.Upload{})
+}
+
+// getUserFailedJobs is used by administrators to list the jobs of a user
+// that failed processing, and had their credits refunded
+func (api *API) getUserFailedJobs(c *gin.Context) {
+	if _, ok := api.authorizeAdmin(c); !ok {
+		return
+	}
+	api.pageIt(c, api.ledger.History(c.Param("user")).Where(
+		"kind = ? AND call_type <> ''", ledger.Refund,
+	), &[]ledger.Entry{})
+}
+
+// findAdminUser returns the user in the url, failing the request if they do not exist
+func (api *API) findAdminUser(c *gin.Context) (*adminUser, bool) {
+	var user adminUser
+	if err := api.dbm.DB.Select(adminUserColumns).Where(
+		"user_name = ? AND deleted_at IS NULL", c.Param("user"),
+	).First(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			Fail(c, errors.New(eh.UserSearchError), http.StatusNotFound)
+		} else {
+			api.LogError(c, err, eh.UserSearchError)(http.StatusBadRequest)
+		}
+		return nil, false
+	}
+	return &user, true
+}
+
+// authorizeAdmin returns the authenticated user, failing the request unless they are an administrator
+func (api *API) authorizeAdmin(c *gin.Context) (string, bool) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return "", false
+	}
+	if err := api.validateAdminRequest(username); err != nil {
+		FailNotAuthorized(c, eh.UnAuthorizedAdminAccess)
+		return "", false
+	}
+	return username, true
+}
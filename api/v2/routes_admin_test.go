@@ -0,0 +1,100 @@
+package v2
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+)
+
+func Test_API_Routes_Admin(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := api.um.NewUserAccount("admintestuser", "password123", "admintestuser@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(user)
+	defer db.Unscoped().Where("user_name = ?", user.UserName).Delete(&models.Usage{})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		form       url.Values
+		wantStatus int
+	}{
+		{"Search", "GET", "/v2/admin/users?search=admintest", nil, 200},
+		{"User", "GET", "/v2/admin/users/admintestuser", nil, 200},
+		{"UserNotFound", "GET", "/v2/admin/users/notarealuser", nil, 404},
+		{"GrantCredits", "POST", "/v2/admin/users/admintestuser/credits", url.Values{
+			"amount": {"10"}, "reason": {"support ticket"},
+		}, 200},
+		{"RevokeCredits", "POST", "/v2/admin/users/admintestuser/credits", url.Values{
+			"amount": {"-5"}, "reason": {"support ticket"},
+		}, 200},
+		{"RevokeTooMany", "POST", "/v2/admin/users/admintestuser/credits", url.Values{
+			"amount": {"-1000"}, "reason": {"support ticket"},
+		}, 400},
+		{"CreditsMissingReason", "POST", "/v2/admin/users/admintestuser/credits", url.Values{
+			"amount": {"10"},
+		}, 400},
+		{"Tier", "POST", "/v2/admin/users/admintestuser/tier", url.Values{
+			"tier": {string(models.Paid)},
+		}, 200},
+		{"InvalidTier", "POST", "/v2/admin/users/admintestuser/tier", url.Values{
+			"tier": {"platinum"},
+		}, 400},
+		{"Disable", "POST", "/v2/admin/users/admintestuser/disable", nil, 200},
+		{"DisableSelf", "POST", "/v2/admin/users/testuser/disable", nil, 400},
+		{"Enable", "POST", "/v2/admin/users/admintestuser/enable", nil, 200},
+		{"Verification", "POST", "/v2/admin/users/admintestuser/verification", nil, 200},
+		{"Uploads", "GET", "/v2/admin/users/admintestuser/uploads", nil, 200},
+		{"FailedJobs", "GET", "/v2/admin/users/admintestuser/jobs/failed", nil, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := sendRequest(
+				api, tt.method, tt.path, tt.wantStatus, nil, tt.form, nil,
+			); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// credits and tier changes are applied to the user
+	credits, err := api.um.GetCreditsForUser(user.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credits != user.Credits+5 {
+		t.Fatalf("expected %v credits, got %v", user.Credits+5, credits)
+	}
+	usage, err := api.usage.FindByUserName(user.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Tier != models.Paid {
+		t.Fatalf("expected tier %s, got %s", models.Paid, usage.Tier)
+	}
+}
@@ -0,0 +1,146 @@
+package v2
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/RTradeLtd/Temporal/api/middleware"
+	"github.com/RTradeLtd/Temporal/audit"
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// auditTarget fills in what an audited request acted on
+type auditTarget func(c *gin.Context, event *audit.Event)
+
+// audited records the outcome of the request in the audit log once it has been
+// handled. It must be used after the jwt middleware, as the actor is the
+// authenticated user
+func (api *API) audited(action audit.Action, target auditTarget) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		actor, err := GetAuthenticatedUserFromContext(c)
+		if err != nil {
+			return
+		}
+		event := &audit.Event{
+			Actor:     actor,
+			Action:    action,
+			RequestID: middleware.GetRequestID(c),
+			IP:        c.ClientIP(),
+			Outcome:   audit.Success,
+			Status:    c.Writer.Status(),
+		}
+		if event.Status >= http.StatusBadRequest {
+			event.Outcome = audit.Failure
+		}
+		target(c, event)
+		if err := api.audit.Record(event); err != nil {
+			api.l.Errorw("failed to record audit event",
+				"actor", actor, "action", action, "request-id", event.RequestID, "error", err)
+		}
+	}
+}
+
+// auditOwnAccount is used for actions the actor performs on their own account
+func auditOwnAccount(c *gin.Context, event *audit.Event) {
+	event.Target = event.Actor
+	event.Account = event.Actor
+}
+
+// auditKey is used for actions on the key named in the url
+func auditKey(c *gin.Context, event *audit.Event) {
+	event.Target = c.Param("name")
+	event.Account = event.Actor
+}
+
+// auditNetwork returns an auditTarget for actions on the network in the
+// network_name field, recording the values of field as the detail
+func auditNetwork(field string) auditTarget {
+	return func(c *gin.Context, event *audit.Event) {
+		event.Target = strings.Join(boundValues(c, "network_name"), ",")
+		event.Account = event.Actor
+		if field != "" {
+			event.Detail = strings.Join(boundValues(c, field), ",")
+		}
+	}
+}
+
+// auditUser returns an auditTarget for administrator actions on the user in
+// the url, recording the values of fields as the detail
+func auditUser(fields ...string) auditTarget {
+	return func(c *gin.Context, event *audit.Event) {
+		event.Target = c.Param("user")
+		event.Account = c.Param("user")
+		var detail []string
+		for _, field := range fields {
+			detail = append(detail, fmt.Sprintf("%s=%s", field, strings.Join(boundValues(c, field), ",")))
+		}
+		event.Detail = strings.Join(detail, " ")
+	}
+}
+
+// auditRefund returns an auditTarget for administrator reviews of the refund
+// in the url, on the account of the user who requested it, recording the
+// review and the value of field as the detail
+func (api *API) auditRefund(review, field string) auditTarget {
+	return func(c *gin.Context, event *audit.Event) {
+		event.Target = "refund-" + c.Param("id")
+		if id, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+			if req, err := api.refunds.Find(uint(id)); err == nil {
+				event.Account = req.UserName
+			}
+		}
+		event.Detail = review
+		if value := strings.Join(boundValues(c, field), ","); value != "" {
+			event.Detail = fmt.Sprintf("%s %s=%s", review, field, value)
+		}
+	}
+}
+
+// getAuditLog is used to list the audited actions performed by, or
+// on the account of, the authenticated user
+func (api *API) getAuditLog(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	api.listAuditEvents(c, api.audit.History(username), username)
+}
+
+// searchAuditLog is used by administrators to list all audited actions
+func (api *API) searchAuditLog(c *gin.Context) {
+	if _, ok := api.authorizeAdmin(c); !ok {
+		return
+	}
+	var query auditSearchQuery
+	if !api.bindQuery(c, &query) {
+		return
+	}
+	api.listAuditEvents(c, api.audit.Search(
+		query.Actor, audit.Action(query.Action), query.Account,
+	), "audit")
+}
+
+// listAuditEvents pages through the events matched by query, or exports
+// them all as json lines when the jsonl format is requested
+func (api *API) listAuditEvents(c *gin.Context, query *gorm.DB, filename string) {
+	var format formatQuery
+	if !api.bindQuery(c, &format) {
+		return
+	}
+	if format.Format != "jsonl" {
+		api.pageIt(c, query, &[]audit.Event{})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-audit.jsonl", filename))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	if err := audit.Export(c.Writer, query); err != nil {
+		api.l.Errorw("failed to export audit log", "error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package v2
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/audit"
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/config/v2"
+)
+
+func Test_API_Routes_Audit(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// failed actions are audited too
+	// /v2/admin/refunds/:id/deny
+	if err := sendRequest(
+		api, "POST", "/v2/admin/refunds/0/deny", 404, nil, url.Values{"note": {"audit test"}}, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	var event audit.Event
+	if err := db.Where("actor = ? AND action = ?", "testuser", audit.RefundReview).
+		Order("id DESC").First(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+	if event.Target != "refund-0" || event.Outcome != audit.Failure || event.Status != 404 ||
+		event.Detail != "deny note=audit test" || event.RequestID == "" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"Account", "/v2/account/audit"},
+		{"AccountExport", "/v2/account/audit?format=jsonl"},
+		{"Admin", "/v2/admin/audit?action=admin.refund.review"},
+		{"AdminExport", "/v2/admin/audit?actor=testuser&format=jsonl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := sendRequest(
+				api, "GET", tt.path, 200, nil, nil, nil,
+			); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
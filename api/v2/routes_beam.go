@@ -0,0 +1,222 @@
+package v2
+
+import (
+	"html"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/beams"
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/Temporal/utils"
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/gin-gonic/gin"
+	gocid "github.com/ipfs/go-cid"
+	"github.com/jinzhu/gorm"
+)
+
+// defaultBeamHoldTime is the number of months beamed content is
+// stored on the destination network for, unless set with hold_time
+const defaultBeamHoldTime int64 = 1
+
+// beamContent is used to queue a job beaming content from one network to
+// another, charging for storage of the content on the destination network
+func (api *API) beamContent(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	var req beamRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	if _, err := gocid.Decode(req.ContentHash); err != nil {
+		FailWithInvalidField(c, "content_hash", err.Error())
+		return
+	}
+	holdTime := req.HoldTime
+	if holdTime == 0 {
+		holdTime = defaultBeamHoldTime
+	}
+	if err := api.validateHoldTime(username, holdTime); err != nil {
+		Fail(c, err)
+		return
+	}
+	// validate the networks to connect to
+	var source rtfs.Manager = api.ipfs
+	if req.SourceNetwork != "public" {
+		// if non public network, validate user has access
+		if err := CheckAccessForPrivateNetwork(username, req.SourceNetwork, api.dbm.DB); err != nil {
+			api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusBadRequest)
+			return
+		}
+		// connect to the actual network
+		source, err = rtfs.NewManager(api.GetIPFSEndpoint(req.SourceNetwork), GetAuthToken(c), time.Minute*60)
+		if err != nil {
+			api.LogError(c, err, eh.IPFSConnectionError)(http.StatusBadRequest)
+			return
+		}
+	}
+	if req.DestinationNetwork != "public" {
+		if err := CheckAccessForPrivateNetwork(username, req.DestinationNetwork, api.dbm.DB); err != nil {
+			api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Decrypt && req.Passphrase == "" {
+		FailWithMissingField(c, "passphrase")
+		return
+	}
+	// content encrypted with the passphrase is recorded as an encrypted
+	// upload on the destination network, named after the original content
+	fileName := req.FileName
+	if fileName == "" {
+		fileName = req.ContentHash
+	}
+	encrypted := req.Passphrase != "" && !req.Decrypt
+	// content is crypted by the beam queue, which holds it in memory
+	// to do so, so it is limited to the size of uploads
+	if req.Passphrase != "" {
+		stat, err := source.Stat(req.ContentHash)
+		if err != nil {
+			api.LogError(c, err, eh.IPFSObjectStatError)(http.StatusBadRequest)
+			return
+		}
+		if err := api.FileSizeCheck(int64(stat.CumulativeSize)); err != nil {
+			Fail(c, err)
+			return
+		}
+	}
+	// the size of the content is only known to the source network
+	cost, size, err := utils.CalculatePinCost(username, req.ContentHash, holdTime, source, api.usage)
+	if err != nil {
+		api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
+		return
+	}
+	// as with pins, storage on private networks is paid for by hosting the
+	// network, while only its size counts towards the data usage of the user
+	if req.DestinationNetwork != "public" {
+		cost = 0
+	} else {
+		cost = api.uncoveredCost(username, cost, holdTime)
+	}
+	job := &beams.Job{
+		JobID:              beams.NewJobID(),
+		UserName:           username,
+		CID:                req.ContentHash,
+		SourceNetwork:      req.SourceNetwork,
+		DestinationNetwork: req.DestinationNetwork,
+		HoldTime:           holdTime,
+		Size:               size,
+		CreditCost:         cost,
+	}
+	qb := queue.IPFSBeam{
+		JobID:              job.JobID,
+		CID:                req.ContentHash,
+		SourceNetwork:      req.SourceNetwork,
+		DestinationNetwork: req.DestinationNetwork,
+		UserName:           username,
+		HoldTimeInMonths:   holdTime,
+		Size:               size,
+		CreditCost:         cost,
+		Encrypted:          encrypted,
+		FileName:           fileName,
+		Crypted:            req.Passphrase != "",
+		Decrypt:            req.Decrypt,
+	}
+	// credentials are kept out of the message, which outlives the job
+	secret := &beams.Secret{
+		JobID: job.JobID,
+		JWT:   GetAuthToken(c),
+		// passphrases are html decoded, as they are for encrypted uploads
+		Passphrase: html.UnescapeString(req.Passphrase),
+	}
+	record := func(tx *gorm.DB) error {
+		bm := beams.NewManager(tx)
+		if err := bm.Create(job); err != nil {
+			return err
+		}
+		return bm.SetSecret(secret)
+	}
+	if err := api.charge(c, username, cost, uint64(size), ledger.Meta{CallType: "beam", CID: req.ContentHash}, queue.IpfsBeamQueue, qb, record); err != nil {
+		api.LogError(c, err.err, err.message)(err.status)
+		return
+	}
+	api.l.Infow("beam job sent to backend", "user", username, "job_id", job.JobID)
+	Respond(c, http.StatusAccepted, gin.H{"response": job})
+}
+
+// getBeams is used to list the beam jobs of the authenticated user
+func (api *API) getBeams(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	api.pageIt(c, api.beams.List(username), &[]beams.Job{})
+}
+
+// getBeam is used to get a beam job of the authenticated user,
+// including how much of the content has been transferred
+func (api *API) getBeam(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	job, err := api.beams.Find(username, c.Param("id"))
+	if err != nil {
+		api.failBeam(c, err)
+		return
+	}
+	Respond(c, http.StatusOK, gin.H{"response": job})
+}
+
+// cancelBeam is used to cancel a beam job which is queued or transferring,
+// refunding the credits charged for it
+func (api *API) cancelBeam(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	tx := api.dbm.DB.Begin()
+	if tx.Error != nil {
+		api.LogError(c, tx.Error, eh.DatabaseUpdateError)(http.StatusBadRequest)
+		return
+	}
+	defer tx.Rollback()
+	bm := beams.NewManager(tx)
+	job, err := bm.Cancel(username, c.Param("id"))
+	if err != nil {
+		api.failBeam(c, err)
+		return
+	}
+	// jobs are refunded here whatever they were doing when cancelled, as
+	// the beam queue only stops them. The job is only cancelled if the
+	// refund is recorded
+	if err := bm.Refund(job.JobID, "beam cancelled"); err != nil {
+		api.LogError(c, err, eh.CreditRefundError)(http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		api.LogError(c, err, eh.DatabaseUpdateError)(http.StatusBadRequest)
+		return
+	}
+	api.l.Infow("beam job cancelled", "user", username, "job_id", job.JobID, "status", job.Status)
+	job.Status, job.Refunded = beams.Cancelled, true
+	Respond(c, http.StatusOK, gin.H{"response": job})
+}
+
+func (api *API) failBeam(c *gin.Context, err error) {
+	switch err {
+	case beams.ErrNotFound:
+		Fail(c, err, http.StatusNotFound)
+	case beams.ErrNotCancellable:
+		Fail(c, err, http.StatusConflict)
+	default:
+		api.LogError(c, err, "failed to find beam job")(http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,109 @@
+package v2
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/beams"
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/config/v2"
+)
+
+func Test_API_Routes_Beam(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type jobResponse struct {
+		Code     int       `json:"code"`
+		Response beams.Job `json:"response"`
+	}
+	beam := func(hash string, wantStatus int, out interface{}, extra ...string) {
+		urlValues := url.Values{}
+		urlValues.Add("source_network", "public")
+		urlValues.Add("destination_network", "public")
+		urlValues.Add("content_hash", hash)
+		for i := 0; i+1 < len(extra); i += 2 {
+			urlValues.Add(extra[i], extra[i+1])
+		}
+		if err := sendRequest(
+			api, "POST", "/v2/ipfs/utils/laser/beam", wantStatus, nil, urlValues, out,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	beam("notarealhash", 400, nil)
+
+	// beams are queued as jobs, charged for up front
+	var queued jobResponse
+	beam(testPIN, 202, &queued)
+	job := queued.Response
+	defer db.Unscoped().Where("job_id = ?", job.JobID).Delete(&beams.Job{})
+	if job.JobID == "" || job.Status != beams.Queued || job.HoldTime != defaultBeamHoldTime || job.Size == 0 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	var found jobResponse
+	if err := sendRequest(
+		api, "GET", "/v2/ipfs/utils/laser/beams/"+job.JobID, 200, nil, nil, &found,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if found.Response.CID != testPIN || found.Response.SourceNetwork != "public" {
+		t.Fatalf("unexpected job %+v", found.Response)
+	}
+	if err := sendRequestPaged(
+		api, "GET", "/v2/ipfs/utils/laser/beams", 200, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// jobs can be cancelled once, while they are queued or transferring
+	var cancelled jobResponse
+	if err := sendRequest(
+		api, "DELETE", "/v2/ipfs/utils/laser/beams/"+job.JobID, 200, nil, nil, &cancelled,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Response.Status != beams.Cancelled {
+		t.Fatalf("unexpected status %s", cancelled.Response.Status)
+	}
+	if err := sendRequest(
+		api, "DELETE", "/v2/ipfs/utils/laser/beams/"+job.JobID, 409, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendRequest(
+		api, "GET", "/v2/ipfs/utils/laser/beams/notarealjob", 404, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// content is encrypted by the beam queue when given a passphrase, which
+	// replaces the cid of the job with that of the encrypted copy once beamed
+	var encrypted jobResponse
+	beam(testPIN, 202, &encrypted, "passphrase", "password123")
+	defer db.Unscoped().Where("job_id = ?", encrypted.Response.JobID).Delete(&beams.Job{})
+	if encrypted.Response.CID != testPIN || encrypted.Response.Status != beams.Queued {
+		t.Fatalf("unexpected job %+v", encrypted.Response)
+	}
+	// decrypting requires a passphrase
+	beam(testPIN, 400, nil, "decrypt", "true")
+}
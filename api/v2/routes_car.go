@@ -0,0 +1,187 @@
+package v2
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/RTradeLtd/Temporal/car"
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/queue"
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api"
+	"github.com/gin-gonic/gin"
+	gocid "github.com/ipfs/go-cid"
+)
+
+// carContentType is the media type of car files
+const carContentType = "application/vnd.ipld.car"
+
+// importCar is used to import the blocks of a car file to public ipfs, pinning
+// each of its roots. The archive is charged for by its size as with file uploads
+func (api *API) importCar(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	var req carImportRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	if err := api.validateHoldTime(username, req.HoldTime); err != nil {
+		Fail(c, err)
+		return
+	}
+	if err := api.FileSizeCheck(req.File.Size); err != nil {
+		Fail(c, err)
+		return
+	}
+	fileName := req.FileName
+	if fileName == "" {
+		fileName = req.File.Filename
+	}
+	file, err := req.File.Open()
+	if err != nil {
+		api.LogError(c, err, eh.FileOpenError)(http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	// blocks are written to ipfs as they are read, so that the file is never
+	// held in memory as a whole. Blocks are content addressed, so writing them
+	// is harmless, and nothing is charged for until every block is written
+	reader, err := car.NewReader(file)
+	if err != nil {
+		FailWithInvalidField(c, "file", err.Error())
+		return
+	}
+	shell := ipfsapi.NewShell(api.ipfs.NodeAddress())
+	var (
+		blocks int
+		size   int64
+		seen   = make(map[string]bool)
+	)
+	for {
+		block, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			FailWithInvalidField(c, "file", err.Error())
+			return
+		}
+		if err := car.PutBlock(shell, block); err != nil {
+			api.LogError(c, err, eh.IPFSAddError)(http.StatusBadRequest)
+			return
+		}
+		blocks++
+		if !seen[block.CID.KeyString()] {
+			seen[block.CID.KeyString()] = true
+			size += int64(len(block.Data))
+		}
+	}
+	// roots are stored together, so the blocks of the archive are split
+	// between the roots which have not been uploaded before
+	resp := carImportResponse{Blocks: blocks}
+	var roots []string
+	for _, root := range reader.Roots {
+		hash := root.String()
+		if upload, err := api.upm.FindUploadByHashAndUserAndNetwork(username, hash, "public"); err == nil || upload != nil {
+			resp.Roots = append(resp.Roots, carImportRoot{CID: hash, Notice: alreadyUploadedMessage})
+			continue
+		}
+		roots = append(roots, hash)
+	}
+	var charges []pendingCharge
+	for i, hash := range roots {
+		rootSize := size / int64(len(roots))
+		if i == 0 {
+			rootSize += size % int64(len(roots))
+		}
+		cost, err := api.fileCost(username, req.HoldTime, rootSize)
+		if err != nil {
+			api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
+			return
+		}
+		resp.Roots = append(resp.Roots, carImportRoot{CID: hash, Cost: cost})
+		charges = append(charges, pendingCharge{
+			cost: cost,
+			size: uint64(rootSize),
+			meta: ledger.Meta{CallType: "pin", CID: hash},
+			q:    queue.IpfsClusterPinQueue,
+			msg: queue.IPFSClusterPin{
+				CID:              hash,
+				NetworkName:      "public",
+				UserName:         username,
+				HoldTimeInMonths: req.HoldTime,
+				Size:             rootSize,
+				CreditCost:       cost,
+				FileName:         fileName,
+			},
+		})
+	}
+	// every root is charged for and enqueued at once, or not at all
+	if err := api.chargeAll(c, username, charges, nil); err != nil {
+		api.LogError(c, err.err, err.message)(err.status)
+		return
+	}
+	api.l.Infow("car imported", "user", username, "blocks", blocks, "roots", len(reader.Roots))
+	Respond(c, http.StatusOK, gin.H{"response": resp})
+}
+
+// exportCar is used to stream a car file of a dag the user has pinned to public ipfs
+func (api *API) exportCar(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	hash := c.Param("cid")
+	root, err := gocid.Decode(hash)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	if _, err := api.upm.FindUploadByHashAndUserAndNetwork(username, hash, "public"); err != nil {
+		api.LogError(c, err, eh.UploadSearchError)(http.StatusNotFound)
+		return
+	}
+	// list every block before responding, so that a dag
+	// which can not be found is reported as an error
+	refs, err := api.ipfs.Refs(hash, true, true)
+	if err != nil {
+		api.LogError(c, err, "failed to list the blocks of the dag")(http.StatusBadRequest)
+		return
+	}
+	c.Header("Content-Type", carContentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.car"`, hash))
+	c.Status(http.StatusOK)
+	w, err := car.NewWriter(c.Writer, []gocid.Cid{root})
+	if err == nil {
+		err = api.exportBlocks(c, w, append([]string{hash}, refs...))
+	}
+	// the response has already started, so failures can only be logged
+	if err != nil {
+		api.l.Errorw("failed to export car", "user", username, "cid", hash, "error", err)
+		return
+	}
+	api.l.Infow("car exported", "user", username, "cid", hash, "blocks", len(refs)+1)
+}
+
+// exportBlocks writes the blocks with the given cids to w
+func (api *API) exportBlocks(c *gin.Context, w *car.Writer, cids []string) error {
+	for _, ref := range cids {
+		id, err := gocid.Decode(ref)
+		if err != nil {
+			return err
+		}
+		block, err := car.GetBlock(c.Request.Context(), api.ipfs, id)
+		if err != nil {
+			return err
+		}
+		if err := w.Write(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
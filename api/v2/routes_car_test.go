@@ -0,0 +1,137 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/car"
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/google/uuid"
+	gocid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func Test_API_Routes_Car(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// use unique content so that it has not been uploaded before
+	data := []byte("car import " + uuid.New().String())
+	root, err := gocid.NewPrefixV1(gocid.Raw, multihash.SHA2_256).Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	w, err := car.NewWriter(&archive, []gocid.Cid{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&car.Block{CID: root, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	importCar := func(file []byte, wantStatus int, out interface{}) {
+		body := &bytes.Buffer{}
+		bodyWriter := multipart.NewWriter(body)
+		fileWriter, err := bodyWriter.CreateFormFile("file", "dag.car")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fileWriter.Write(file); err != nil {
+			t.Fatal(err)
+		}
+		if err := bodyWriter.WriteField("hold_time", "1"); err != nil {
+			t.Fatal(err)
+		}
+		bodyWriter.Close()
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v2/ipfs/public/car/import", body)
+		req.Header.Add("Authorization", authHeader)
+		req.Header.Add("Content-Type", bodyWriter.FormDataContentType())
+		api.r.ServeHTTP(recorder, req)
+		if recorder.Code != wantStatus {
+			t.Fatalf("expected status %v, got %v: %s", wantStatus, recorder.Code, recorder.Body.String())
+		}
+		if out != nil {
+			if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// POST /v2/ipfs/public/car/import
+	importCar([]byte("not a car file"), 400, nil)
+	var resp struct {
+		Response carImportResponse `json:"response"`
+	}
+	importCar(archive.Bytes(), 200, &resp)
+	if resp.Response.Blocks != 1 || len(resp.Response.Roots) != 1 || resp.Response.Roots[0].CID != root.String() {
+		t.Fatalf("unexpected response %+v", resp.Response)
+	}
+
+	// GET /v2/ipfs/public/car/export/:cid
+	if err := sendRequest(
+		api, "GET", "/v2/ipfs/public/car/export/notarealhash", 400, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	// only content the user has uploaded can be exported
+	if err := sendRequest(
+		api, "GET", "/v2/ipfs/public/car/export/"+root.String(), 404, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := api.upm.NewUpload(root.String(), "file", models.UploadOptions{
+		Username:         "testuser",
+		NetworkName:      "public",
+		HoldTimeInMonths: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.upm.DB.Unscoped().Delete(upload)
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v2/ipfs/public/car/export/"+root.String(), nil)
+	req.Header.Add("Authorization", authHeader)
+	api.r.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != carContentType {
+		t.Fatalf("unexpected response %v: %s", recorder.Code, recorder.Body.String())
+	}
+	r, err := car.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Roots) != 1 || !r.Roots[0].Equals(root) {
+		t.Fatalf("unexpected roots %v", r.Roots)
+	}
+	block, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !block.CID.Equals(root) || !bytes.Equal(block.Data, data) {
+		t.Fatalf("unexpected block %s", block.CID)
+	}
+}
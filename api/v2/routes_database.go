@@ -18,15 +18,17 @@ func (api *API) searchUploadsForUser(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	forms, missingField := api.extractPostForms(c, "search_query")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var (
+		req   searchUploadsRequest
+		query pagedQuery
+	)
+	if !api.bind(c, &req) || !api.bindQuery(c, &query) {
 		return
 	}
 	// escape string to prevent html encoded characters causing issues
-	forms["search_query"] = html.UnescapeString(forms["search_query"])
+	req.SearchQuery = html.UnescapeString(req.SearchQuery)
 	// force lower-case to make matching more likely s
-	lower := strings.ToLower(forms["search_query"])
+	lower := strings.ToLower(req.SearchQuery)
 	// just in case lets try and avoid any possible headaches
 	if strings.Contains(lower, "drop table") ||
 		strings.Contains(lower, "drop column") ||
@@ -37,7 +39,7 @@ func (api *API) searchUploadsForUser(c *gin.Context) {
 		Fail(c, errors.New("possible sql injection attack, goodbye"), http.StatusBadRequest)
 		return
 	}
-	if c.Query("paged") == "true" {
+	if query.Paged {
 		api.pageIt(
 			c,
 			api.upm.DB.Where(
@@ -63,7 +65,11 @@ func (api *API) getUploadsForUser(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	if c.Query("paged") == "true" {
+	var query pagedQuery
+	if !api.bindQuery(c, &query) {
+		return
+	}
+	if query.Paged {
 		api.pageIt(c, api.upm.DB.Where("user_name = ?", username), &[]models.Upload{})
 		return
 	}
@@ -92,7 +98,11 @@ func (api *API) getUploadsByNetworkName(c *gin.Context) {
 		api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusBadRequest)
 		return
 	}
-	if c.Query("paged") == "true" {
+	var query pagedQuery
+	if !api.bindQuery(c, &query) {
+		return
+	}
+	if query.Paged {
 		api.pageIt(c, api.upm.DB.Where(
 			"user_name = ? AND network_name = ?",
 			username, networkName,
@@ -5,10 +5,19 @@ import (
 	"net/http"
 
 	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
 	"github.com/RTradeLtd/Temporal/queue"
 	"github.com/RTradeLtd/database/v2/models"
 	"github.com/gin-gonic/gin"
 	gocid "github.com/ipfs/go-cid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// ensClaimCost is the credits charged to claim an ens subdomain
+	ensClaimCost = 0.45
+	// ensUpdateCost is the credits charged to update the content hash of an ens subdomain
+	ensUpdateCost = 0.15
 )
 
 // ClaimENSName is used to claim a username based ens subdomain
@@ -33,26 +42,15 @@ func (api *API) ClaimENSName(c *gin.Context) {
 		Fail(c, errors.New("user already claimed ens name"), http.StatusBadRequest)
 		return
 	}
-	if err := api.validateUserCredits(username, 0.45); err != nil {
-		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
-		return
+	// mark account as having claimed ens name, only if they are charged for it
+	record := func(tx *gorm.DB) error {
+		return models.NewUsageManager(tx).ClaimENSName(username)
 	}
-	// mark account as having claimed ens name
-	if err := api.usage.ClaimENSName(username); err != nil {
-		api.LogError(c, err, "failed to claim ens name")(http.StatusBadRequest)
-		api.refundUserCredits(username, "ens", 0.45)
-		return
-	}
-	if err := api.queues.ens.PublishMessage(queue.ENSRequest{
+	if err := api.charge(c, username, ensClaimCost, 0, ledger.Meta{CallType: "ens"}, queue.ENSRequestQueue, queue.ENSRequest{
 		Type:     queue.ENSRegisterSubName,
 		UserName: username,
-	}); err != nil {
-		// this fails, unclaim
-		if err := api.usage.UnclaimENSName(username); err != nil {
-			api.l.Errorw("failed to unclaim ens name", "user", username, "error", err)
-		}
-		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
-		api.refundUserCredits(username, "ens", 0.45)
+	}, record); err != nil {
+		api.LogError(c, err.err, err.message)(err.status)
 		return
 	}
 	api.l.Infow("ens name claim request sent to backend", "user", username)
@@ -83,28 +81,20 @@ func (api *API) UpdateContentHash(c *gin.Context) {
 		Fail(c, errors.New("user has not claimed ens name"), http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "content_hash")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req contentHashRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// validate the content is is valid
-	if _, err := gocid.Decode(forms["content_hash"]); err != nil {
+	if _, err := gocid.Decode(req.ContentHash); err != nil {
 		Fail(c, err)
 		return
 	}
-	if err := api.validateUserCredits(username, 0.15); err != nil {
-		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
-		return
-	}
-	if err := api.queues.ens.PublishMessage(queue.ENSRequest{
+	if !api.chargeAndEnqueue(c, username, ensUpdateCost, 0, ledger.Meta{CallType: "ens"}, queue.ENSRequestQueue, queue.ENSRequest{
 		Type:        queue.ENSUpdateContentHash,
 		UserName:    username,
-		ContentHash: forms["content_hash"],
-	}); err != nil {
-		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
-		api.refundUserCredits(username, "ens", 0.15)
+		ContentHash: req.ContentHash,
+	}) {
 		return
 	}
 	api.l.Infow("ens content hash update request sent to backend", "user", username)
@@ -7,7 +7,6 @@ import (
 	"github.com/jinzhu/gorm"
 
 	"github.com/RTradeLtd/Temporal/eh"
-	"github.com/RTradeLtd/Temporal/utils"
 	"github.com/RTradeLtd/database/v2/models"
 	"github.com/gin-gonic/gin"
 	gocid "github.com/ipfs/go-cid"
@@ -35,7 +34,7 @@ func (api *API) calculatePinCost(c *gin.Context) {
 		return
 	}
 	// calculate pin cost
-	totalCost, _, err := utils.CalculatePinCost(username, hash, holdTimeInt, api.ipfs, api.usage)
+	totalCost, _, err := api.pinCost(username, hash, holdTimeInt)
 	if err != nil {
 		api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
 		Fail(c, err)
@@ -53,32 +52,19 @@ func (api *API) calculateFileCost(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// retrieve file to upload
-	file, err := c.FormFile("file")
-	if err != nil {
-		Fail(c, err)
+	// retrieve the file to upload, and how many months to store it for
+	var req fileCostRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// validate the file size is within limits
-	if err := api.FileSizeCheck(file.Size); err != nil {
-		Fail(c, err)
-		return
-	}
-	// how many months to store file for
-	forms, missingField := api.extractPostForms(c, "hold_time")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
-		return
-	}
-	// parse hold time
-	holdTimeInt, err := strconv.ParseInt(forms["hold_time"], 10, 64)
-	if err != nil {
+	if err := api.FileSizeCheck(req.File.Size); err != nil {
 		Fail(c, err)
 		return
 	}
 	api.l.With("user", username).Info("file cost calculation requested")
 	// calculate cost
-	cost, err := utils.CalculateFileCost(username, holdTimeInt, file.Size, api.usage)
+	cost, err := api.fileCost(username, req.HoldTime, req.File.Size)
 	if err != nil {
 		api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
 		return
@@ -94,7 +80,11 @@ func (api *API) getEncryptedUploadsForUser(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	if c.Query("paged") == "true" {
+	var query pagedQuery
+	if !api.bindQuery(c, &query) {
+		return
+	}
+	if query.Paged {
 		api.pageIt(c, api.ue.DB.Where("user_name = ?", username), &[]models.EncryptedUpload{})
 		return
 	}
@@ -0,0 +1,248 @@
+package v2
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/crypto/v2"
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/gin-gonic/gin"
+	gocid "github.com/ipfs/go-cid"
+)
+
+// routes implementing an authenticated http gateway to ipfs content, on
+// the public network or a private network the user has access to
+
+const (
+	// decryptKeyHeader is the header holding the passphrase
+	// used to decrypt content encrypted by temporal
+	decryptKeyHeader = "X-Decrypt-Key"
+	// maxDecryptSize is the size of the largest encrypted file decrypted by
+	// the gateway. Files are decrypted in memory, so it is much smaller than
+	// the size of uploads
+	maxDecryptSize = 64 << 20
+	// ipfsCacheControl is the cache control of content served by cid,
+	// which never changes. Content is private to authenticated users
+	ipfsCacheControl = "private, max-age=29030400, immutable"
+	// ipnsCacheControl is the cache control of content served by ipns
+	// name, which changes whenever the name is published to
+	ipnsCacheControl = "private, max-age=60"
+	// contentSecurityPolicy is the policy of content served from ipfs. User
+	// content is served from the api origin, so it is sandboxed into an
+	// opaque origin without access to scripts, cookies or the api
+	contentSecurityPolicy = "sandbox"
+)
+
+// directoryTemplate renders the listing of directories without an index.html
+var directoryTemplate = template.Must(template.New("directory").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Path}}</title>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>CID</th></tr>
+<tr><td><a href="../{{.Query}}">..</a></td><td></td><td></td></tr>
+{{range .Links}}<tr><td><a href="{{.Href}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{.Hash}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// directoryLink is an entry of a rendered directory listing
+type directoryLink struct {
+	ipfsLink
+	Href string
+}
+
+// gatewayIPFS serves the content at a cid and optional path
+func (api *API) gatewayIPFS(c *gin.Context) {
+	hash := c.Param("cid")
+	if _, err := gocid.Decode(hash); err != nil {
+		Fail(c, err)
+		return
+	}
+	manager, ok := api.gatewayManager(c)
+	if !ok {
+		return
+	}
+	api.serveGateway(c, manager, path.Join("/ipfs", hash, c.Param("path")), ipfsCacheControl)
+}
+
+// gatewayIPNS serves the content an ipns name currently resolves to
+func (api *API) gatewayIPNS(c *gin.Context) {
+	manager, ok := api.gatewayManager(c)
+	if !ok {
+		return
+	}
+	resolved, err := manager.Resolve(c.Param("name"))
+	if err != nil {
+		api.LogError(c, err, eh.IpnsRecordSearchError)(http.StatusNotFound)
+		return
+	}
+	api.serveGateway(c, manager, path.Join(resolved, c.Param("path")), ipnsCacheControl)
+}
+
+// gatewayManager returns the ipfs manager of the network requested with the
+// network_name query parameter, defaulting to public. Access to private
+// networks is checked, failing the request if the user has none
+func (api *API) gatewayManager(c *gin.Context) (rtfs.Manager, bool) {
+	var query gatewayQuery
+	if !api.bindQuery(c, &query) {
+		return nil, false
+	}
+	if query.NetworkName == "" || query.NetworkName == "public" {
+		return api.ipfs, true
+	}
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return nil, false
+	}
+	if err := CheckAccessForPrivateNetwork(username, query.NetworkName, api.dbm.DB); err != nil {
+		api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusForbidden)
+		return nil, false
+	}
+	manager, err := rtfs.NewManager(api.GetIPFSEndpoint(query.NetworkName), GetAuthToken(c), time.Minute*60)
+	if err != nil {
+		api.LogError(c, err, eh.IPFSConnectionError)(http.StatusBadRequest)
+		return nil, false
+	}
+	return manager, true
+}
+
+// serveGateway serves the file or directory at an ipfs path. Directories are
+// served by their index.html, or listed when they have none. Files are
+// streamed, supporting range and conditional requests, and decrypted when a
+// key is given in the X-Decrypt-Key header
+func (api *API) serveGateway(c *gin.Context, manager rtfs.Manager, ipfsPath, cacheControl string) {
+	ctx := c.Request.Context()
+	stat, err := statIPFSPath(ctx, manager, ipfsPath)
+	if err != nil {
+		api.LogError(c, err, eh.IPFSObjectStatError)(http.StatusNotFound)
+		return
+	}
+	if stat.Type == "directory" {
+		// relative links of listings and index pages need a trailing slash
+		if !strings.HasSuffix(c.Request.URL.Path, "/") {
+			redirect := *c.Request.URL
+			redirect.Path += "/"
+			c.Redirect(http.StatusMovedPermanently, redirect.String())
+			return
+		}
+		links, err := listIPFSPath(ctx, manager, ipfsPath)
+		if err != nil {
+			api.LogError(c, err, eh.IPFSObjectStatError)(http.StatusBadRequest)
+			return
+		}
+		index := -1
+		for i, link := range links {
+			if link.Name == "index.html" && link.Type != unixfsDirectory {
+				index = i
+			}
+		}
+		if index < 0 {
+			api.serveDirectory(c, ipfsPath, stat.Hash, links, cacheControl)
+			return
+		}
+		ipfsPath = path.Join(ipfsPath, "index.html")
+		if stat, err = statIPFSPath(ctx, manager, ipfsPath); err != nil {
+			api.LogError(c, err, eh.IPFSObjectStatError)(http.StatusBadRequest)
+			return
+		}
+	}
+	// the content type is taken from the file extension, or sniffed from the content
+	api.serveIPFSFile(c, manager, ipfsPath, stat, c.GetHeader(decryptKeyHeader), map[string]string{
+		"Cache-Control": cacheControl,
+		"X-Ipfs-Path":   ipfsPath,
+	})
+}
+
+// serveIPFSFile streams the file at an ipfs path with the given headers, using
+// its cid as the etag, and decrypting it with key when given. Range and
+// conditional requests are handled by http.ServeContent, which also sniffs
+// the content type unless it is set. Content encrypted by temporal is
+// authenticated as a whole, so it is decrypted in memory before it is served,
+// which limits it to maxDecryptSize. Range requests for it are served the whole
+// file, as each range would need the whole file to be decrypted
+func (api *API) serveIPFSFile(c *gin.Context, manager rtfs.Manager, ipfsPath string, stat *ipfsStat, key string, headers map[string]string) {
+	if key != "" {
+		if stat.Size > maxDecryptSize {
+			Fail(c, errors.New("encrypted content is too large to be decrypted by the gateway"))
+			return
+		}
+		c.Request.Header.Del("Range")
+	}
+	file := newIPFSFile(c.Request.Context(), manager, ipfsPath, stat.Size)
+	defer file.Close()
+	var content io.ReadSeeker = file
+	etag := `"` + stat.Hash + `"`
+	if key != "" {
+		decrypted, err := crypto.NewEncryptManager(key).Decrypt(file)
+		if err != nil {
+			Fail(c, err)
+			return
+		}
+		content = bytes.NewReader(decrypted)
+		etag = `"` + stat.Hash + `-decrypted"`
+	}
+	for header, value := range headers {
+		c.Header(header, value)
+	}
+	sandbox(c)
+	c.Header("ETag", etag)
+	http.ServeContent(c.Writer, c.Request, path.Base(ipfsPath), time.Time{}, content)
+}
+
+// serveDirectory renders the listing of a directory
+func (api *API) serveDirectory(c *gin.Context, ipfsPath, hash string, links []ipfsLink, cacheControl string) {
+	etag := `"DirIndex-` + hash + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+	c.Header("X-Ipfs-Path", ipfsPath)
+	sandbox(c)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	// links keep the query, so that listings of private networks stay on the network
+	query := ""
+	if c.Request.URL.RawQuery != "" {
+		query = "?" + c.Request.URL.RawQuery
+	}
+	listing := struct {
+		Path  string
+		Query string
+		Links []directoryLink
+	}{Path: ipfsPath, Query: query}
+	for _, link := range links {
+		href := url.PathEscape(link.Name)
+		if link.Type == unixfsDirectory {
+			href += "/"
+		}
+		listing.Links = append(listing.Links, directoryLink{ipfsLink: link, Href: href + query})
+	}
+	var buf bytes.Buffer
+	if err := directoryTemplate.Execute(&buf, listing); err != nil {
+		api.LogError(c, err, "failed to render directory listing")(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// sandbox stops content served from ipfs from running in the api origin,
+// and browsers from sniffing a different content type than the one served
+func sandbox(c *gin.Context) {
+	c.Header("Content-Security-Policy", contentSecurityPolicy)
+	c.Header("X-Content-Type-Options", "nosniff")
+}
@@ -0,0 +1,295 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/crypto/v2"
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	jwt "gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func Test_API_Routes_Gateway(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// content encrypted by temporal is decrypted with the key header
+	encrypted, err := crypto.NewEncryptManager("password123").Encrypt(strings.NewReader("secret gateway content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedHash, err := api.ipfs.Add(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// testPIN is the directory of documents added by ipfs init
+	readme := "/v2/gateway/ipfs/" + testPIN + "/readme"
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		header     map[string]string
+		wantStatus int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{"InvalidCID", "GET", "/v2/gateway/ipfs/notarealhash", nil, 400, "", nil},
+		{"MissingPath", "GET", "/v2/gateway/ipfs/" + testPIN + "/notafile", nil, 404, "", nil},
+		{"NoNetworkAccess", "GET", readme + "?network_name=notarealnetwork", nil, 403, "", nil},
+		{"DirectoryRedirect", "GET", "/v2/gateway/ipfs/" + testPIN + "?network_name=public", nil, 301, "",
+			map[string]string{"Location": "/v2/gateway/ipfs/" + testPIN + "/?network_name=public"}},
+		{"DirectoryListing", "GET", "/v2/gateway/ipfs/" + testPIN + "/?network_name=public", nil, 200, `<a href="readme?network_name=public">readme</a>`,
+			map[string]string{"Content-Type": "text/html; charset=utf-8", "Content-Security-Policy": "sandbox"}},
+		{"File", "GET", readme, nil, 200, "Hello and Welcome to IPFS!",
+			map[string]string{"Content-Type": "text/plain; charset=utf-8", "Cache-Control": ipfsCacheControl, "X-Ipfs-Path": "/ipfs/" + testPIN + "/readme",
+				"Content-Security-Policy": "sandbox", "X-Content-Type-Options": "nosniff"}},
+		{"Head", "HEAD", readme, nil, 200, "", map[string]string{"Accept-Ranges": "bytes"}},
+		{"Range", "GET", readme, map[string]string{"Range": "bytes=6-8"}, 206, "and",
+			map[string]string{"Content-Length": "3"}},
+		{"Decrypt", "GET", "/v2/gateway/ipfs/" + encryptedHash, map[string]string{decryptKeyHeader: "password123"}, 200, "secret gateway content", nil},
+		{"DecryptWrongKey", "GET", "/v2/gateway/ipfs/" + encryptedHash, map[string]string{decryptKeyHeader: "wrongpassword"}, 400, "", nil},
+		// downloads are streamed in the same way
+		{"Download", "GET", "/v2/ipfs/utils/download/" + encryptedHash + "?content_type=text/plain", map[string]string{decryptKeyHeader: "password123"}, 200, "secret gateway content",
+			map[string]string{"Content-Type": "text/plain", "Content-Length": "22", "Content-Security-Policy": "sandbox"}},
+		// encrypted content is decrypted as a whole, so ranges of it are served in full
+		{"DownloadDecryptRange", "GET", "/v2/ipfs/utils/download/" + encryptedHash, map[string]string{decryptKeyHeader: "password123", "Range": "bytes=0-5"}, 200, "secret gateway content",
+			map[string]string{"Content-Length": "22"}},
+		{"DownloadDirectory", "GET", "/v2/ipfs/utils/download/" + testPIN, nil, 400, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req.Header.Add("Authorization", authHeader)
+			for k, v := range tt.header {
+				req.Header.Add(k, v)
+			}
+			api.r.ServeHTTP(recorder, req)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %v, got %v: %s", tt.wantStatus, recorder.Code, recorder.Body.String())
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Fatalf("expected body containing %q, got %q", tt.wantBody, recorder.Body.String())
+			}
+			for k, v := range tt.wantHeader {
+				if got := recorder.Header().Get(k); got != v {
+					t.Fatalf("expected %s header %q, got %q", k, v, got)
+				}
+			}
+		})
+	}
+
+	// conditional requests are answered without content
+	for _, url := range []string{readme, "/v2/ipfs/utils/download/" + encryptedHash} {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Add("Authorization", authHeader)
+		api.r.ServeHTTP(recorder, req)
+		etag := recorder.Header().Get("ETag")
+		if etag == "" {
+			t.Fatalf("no etag returned from %s", url)
+		}
+		recorder = httptest.NewRecorder()
+		req.Header.Set("If-None-Match", etag)
+		api.r.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 {
+			t.Fatalf("unexpected conditional response from %s %v: %s", url, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func Test_ipfsFile(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	manager := &mocks.FakeManager{}
+	manager.CustomRequestStub = func(ctx context.Context, url, command string, opts map[string]string, args ...string) (*ipfsapi.Response, error) {
+		offset, err := strconv.Atoi(opts["offset"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ipfsapi.Response{Output: ioutil.NopCloser(bytes.NewReader(content[offset:]))}, nil
+	}
+	file := newIPFSFile(context.Background(), manager, "/ipfs/hash", int64(len(content)))
+	defer file.Close()
+
+	// reads stream the whole file with one request
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) || manager.CustomRequestCallCount() != 1 {
+		t.Fatalf("unexpected read of %s with %v requests", data, manager.CustomRequestCallCount())
+	}
+
+	// seeking restarts the stream at the new offset
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		want   string
+	}{
+		{"Start", 10, io.SeekStart, "abcde"},
+		{"Current", 5, io.SeekCurrent, "klmno"},
+		{"End", -5, io.SeekEnd, "vwxyz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := file.Seek(tt.offset, tt.whence); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 5)
+			if _, err := io.ReadFull(file, buf); err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, buf)
+			}
+		})
+	}
+	if _, err := file.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("expected error seeking before the start")
+	}
+
+	// reads past the end of the file do not make requests
+	calls := manager.CustomRequestCallCount()
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := file.Read(make([]byte, 5)); n != 0 || err != io.EOF {
+		t.Fatalf("unexpected read of %v bytes, err %v", n, err)
+	}
+	if manager.CustomRequestCallCount() != calls {
+		t.Fatal("unexpected request past the end of the file")
+	}
+
+	// streams ending early are reported
+	short := newIPFSFile(context.Background(), manager, "/ipfs/hash", int64(len(content))+10)
+	defer short.Close()
+	if _, err := ioutil.ReadAll(short); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// Benchmark_downloadContentHash shows that downloads use the same amount
+// of memory whatever the size of the content, as it is streamed from ipfs,
+// while encrypted content is decrypted in memory, so is limited in size
+func Benchmark_downloadContentHash(b *testing.B) {
+	// serve returns a manager serving content of size, read from open
+	serve := func(size int64, open func(offset int64) io.Reader) *mocks.FakeManager {
+		manager := &mocks.FakeManager{}
+		manager.CustomRequestStub = func(ctx context.Context, url, command string, opts map[string]string, args ...string) (*ipfsapi.Response, error) {
+			if command == "files/stat" {
+				stat := fmt.Sprintf(`{"Hash":%q,"Size":%v,"Type":"file"}`, testPIN2, size)
+				return &ipfsapi.Response{Output: ioutil.NopCloser(strings.NewReader(stat))}, nil
+			}
+			offset, err := strconv.ParseInt(opts["offset"], 10, 64)
+			if err != nil {
+				b.Fatal(err)
+			}
+			return &ipfsapi.Response{Output: ioutil.NopCloser(open(offset))}, nil
+		}
+		return manager
+	}
+	download := func(b *testing.B, manager *mocks.FakeManager, key string, size int64) {
+		cfg := &config.TemporalConfig{}
+		cfg.API.SizeLimitInGigaBytes = "1"
+		api := &API{ipfs: manager, cfg: cfg, l: zap.NewNop().Sugar()}
+		b.SetBytes(size)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			w := &discardResponseWriter{header: make(http.Header)}
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("POST", "/v2/ipfs/utils/download/"+testPIN2, nil)
+			if key != "" {
+				c.Request.Header.Set(decryptKeyHeader, key)
+			}
+			c.Params = gin.Params{{Key: "hash", Value: testPIN2}}
+			c.Set("JWT_PAYLOAD", jwt.MapClaims{"id": "testuser"})
+			api.downloadContentHash(c)
+			if w.status != http.StatusOK || w.written != size {
+				b.Fatalf("unexpected response %v with %v bytes", w.status, w.written)
+			}
+		}
+	}
+	for _, size := range []int64{1 << 20, 1 << 26, 1 << 30} {
+		size := size
+		b.Run(strconv.FormatInt(size>>20, 10)+"MB", func(b *testing.B) {
+			download(b, serve(size, func(offset int64) io.Reader {
+				return io.LimitReader(zeroReader{}, size-offset)
+			}), "", size)
+		})
+	}
+	for _, size := range []int64{1 << 20, 1 << 26} {
+		size := size
+		b.Run("Encrypted"+strconv.FormatInt(size>>20, 10)+"MB", func(b *testing.B) {
+			encrypted, err := crypto.NewEncryptManager("password123").Encrypt(io.LimitReader(zeroReader{}, size))
+			if err != nil {
+				b.Fatal(err)
+			}
+			download(b, serve(int64(len(encrypted)), func(offset int64) io.Reader {
+				return bytes.NewReader(encrypted[offset:])
+			}), "password123", size)
+		})
+	}
+}
+
+// zeroReader reads an endless stream of zeros
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// discardResponseWriter counts and discards the body written to it, so
+// that benchmarks only measure the memory used to serve the body
+type discardResponseWriter struct {
+	header  http.Header
+	status  int
+	written int64
+}
+
+func (w *discardResponseWriter) Header() http.Header { return w.header }
+
+func (w *discardResponseWriter) WriteHeader(status int) { w.status = status }
+
+func (w *discardResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written += int64(len(p))
+	return len(p), nil
+}
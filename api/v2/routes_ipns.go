@@ -3,7 +3,6 @@ package v2
 import (
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -11,8 +10,8 @@ import (
 	path "github.com/ipfs/go-path"
 
 	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
 	"github.com/RTradeLtd/Temporal/queue"
-	"github.com/RTradeLtd/Temporal/utils"
 	"github.com/RTradeLtd/database/v2/models"
 	gocid "github.com/ipfs/go-cid"
 )
@@ -24,19 +23,17 @@ func (api *API) publishToIPNSDetails(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "hash", "life_time", "ttl", "key", "resolve")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req ipnsPublishRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// validate that the hash is an ipfs one
-	if _, err := gocid.Decode(forms["hash"]); err != nil {
+	if _, err := gocid.Decode(req.Hash); err != nil {
 		Fail(c, err)
 		return
 	}
 	// ensure user owns the key
-	if ownsKey, err := api.um.CheckIfKeyOwnedByUser(username, forms["key"]); err != nil {
+	if ownsKey, err := api.um.CheckIfKeyOwnedByUser(username, req.Key); err != nil {
 		api.LogError(c, err, eh.KeySearchError)(http.StatusBadRequest)
 		return
 	} else if !ownsKey {
@@ -44,22 +41,16 @@ func (api *API) publishToIPNSDetails(c *gin.Context) {
 		api.LogError(c, err, eh.KeyUseError)(http.StatusBadRequest)
 		return
 	}
-	// parse resolve into boolean type
-	resolve, err := strconv.ParseBool(forms["resolve"])
-	if err != nil {
-		Fail(c, err)
-		return
-	}
 	// parse lifetime into time.Duration
-	lifetime, err := time.ParseDuration(forms["life_time"])
+	lifetime, err := time.ParseDuration(req.LifeTime)
 	if err != nil {
-		Fail(c, err)
+		FailWithInvalidField(c, "life_time", err.Error())
 		return
 	}
 	// parse ttl into time.Duration
-	ttl, err := time.ParseDuration(forms["ttl"])
+	ttl, err := time.ParseDuration(req.TTL)
 	if err != nil {
-		Fail(c, err)
+		FailWithInvalidField(c, "ttl", err.Error())
 		return
 	}
 	if err := api.usage.CanPublishIPNS(username); err != nil {
@@ -72,16 +63,16 @@ func (api *API) publishToIPNSDetails(c *gin.Context) {
 	}
 	// create ipns entry creation message
 	ie := queue.IPNSEntry{
-		CID:         forms["hash"],
+		CID:         req.Hash,
 		LifeTime:    lifetime,
 		TTL:         ttl,
-		Resolve:     resolve,
-		Key:         forms["key"],
+		Resolve:     req.Resolve,
+		Key:         req.Key,
 		UserName:    username,
 		NetworkName: "public",
 	}
 	// send message for processing
-	if err = api.queues.ipns.PublishMessage(ie); err != nil {
+	if err = api.publish(c, api.queues.ipns, ie); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -97,7 +88,11 @@ func (api *API) getIPNSRecordsPublishedByUser(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	if c.Query("paged") == "true" {
+	var query pagedQuery
+	if !api.bindQuery(c, &query) {
+		return
+	}
+	if query.Paged {
 		api.pageIt(c, api.upm.DB.Where("user_name = ?", username), &[]models.IPNS{})
 		return
 	}
@@ -129,26 +124,23 @@ func (api *API) pinIPNSHash(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "hold_time", "ipns_path")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req ipnsPinRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// validate the provided path is legit
-	parsedPath := path.FromString(forms["ipns_path"])
+	parsedPath := path.FromString(req.IPNSPath)
 	if err := parsedPath.IsValid(); err != nil {
 		Fail(c, err, http.StatusBadRequest)
 		return
 	}
-	// parse hold time
-	holdTimeInt, err := api.validateHoldTime(username, forms["hold_time"])
-	if err != nil {
+	// validate hold time
+	if err := api.validateHoldTime(username, req.HoldTime); err != nil {
 		Fail(c, err)
 		return
 	}
 	// resolve the ipns path to get the hash
-	hashToPin, err := api.ipfs.Resolve(forms["ipns_path"])
+	hashToPin, err := api.ipfs.Resolve(req.IPNSPath)
 	if err != nil {
 		api.LogError(c, err, eh.IpnsRecordSearchError)(http.StatusBadRequest)
 		return
@@ -164,39 +156,26 @@ func (api *API) pinIPNSHash(c *gin.Context) {
 	// upload content matching this hash before, and we don't want to charge them
 	// so we should gracefully abort further processing
 	if err == nil || upload != nil {
-		Respond(c, http.StatusBadRequest, gin.H{"response": alreadyUploadedMessage})
+		FailWithMessage(c, alreadyUploadedMessage, http.StatusBadRequest)
 		return
 	}
 	// get the cost of this object
-	cost, size, err := utils.CalculatePinCost(username, hash, holdTimeInt, api.ipfs, api.usage)
+	cost, size, err := api.pinCost(username, hash, req.HoldTime)
 	if err != nil {
 		api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
 		return
 	}
-	// ensure they have enough credits
-	if err := api.validateUserCredits(username, cost); err != nil {
-		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
-		return
-	}
-	if err := api.usage.UpdateDataUsage(username, uint64(size)); err != nil {
-		api.LogError(c, err, eh.CantUploadError)(http.StatusBadRequest)
-		api.refundUserCredits(username, "pin", cost)
-		return
-	}
 	// create pin message
 	qp := queue.IPFSClusterPin{
 		CID:              hash,
 		NetworkName:      "public",
 		UserName:         username,
-		HoldTimeInMonths: holdTimeInt,
+		HoldTimeInMonths: req.HoldTime,
 		CreditCost:       cost,
 		Size:             int64(size),
 	}
-	// send message for processing
-	if err = api.queues.cluster.PublishMessage(qp); err != nil {
-		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
-		api.refundUserCredits(username, "pin", cost)
-		api.usage.ReduceDataUsage(username, uint64(size))
+	// charge the user and queue the message for processing
+	if !api.chargeAndEnqueue(c, username, cost, uint64(size), ledger.Meta{CallType: "pin", CID: hash}, queue.IpfsClusterPinQueue, qp) {
 		return
 	}
 	// log and return
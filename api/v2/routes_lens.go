@@ -1,7 +1,6 @@
 package v2
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/RTradeLtd/Temporal/eh"
@@ -11,32 +10,22 @@ import (
 )
 
 func (api *API) submitIndexRequest(c *gin.Context) {
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "object_type", "object_identifier")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	// object types are validated when binding, and ipld is the only one supported
+	var req lensIndexRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	var indexType pb.IndexReq_Type
-	// ensure the type being requested is supported
-	switch forms["object_type"] {
-	case "ipld":
-		// validate the object identifier
-		if _, err := gocid.Decode(forms["object_identifier"]); err != nil {
-			Fail(c, err)
-			return
-		}
-		indexType = pb.IndexReq_IPLD
-	default:
-		Fail(c, errors.New(eh.InvalidObjectTypeError))
+	// validate the object identifier
+	if _, err := gocid.Decode(req.ObjectIdentifier); err != nil {
+		Fail(c, err)
 		return
 	}
 
 	resp, err := api.lens.Index(c, &pb.IndexReq{
-		Type: indexType,
-		Hash: forms["object_identifier"],
+		Type: pb.IndexReq_IPLD,
+		Hash: req.ObjectIdentifier,
 		Options: &pb.IndexReq_Options{
-			Reindex: c.PostForm("reindex") == "true",
+			Reindex: req.Reindex,
 		},
 	})
 	if err != nil {
@@ -47,29 +36,21 @@ func (api *API) submitIndexRequest(c *gin.Context) {
 }
 
 func (api *API) submitSearchRequest(c *gin.Context) {
-	// query we will use to perform as the main search
-	query, exists := c.GetPostForm("query")
-	if !exists {
-		FailWithMissingField(c, "query")
+	// query is used to perform the main search, and the
+	// remaining fields narrow the results
+	var req lensSearchRequest
+	if !api.bind(c, &req) {
 		return
 	}
 
-	var (
-		tags, _       = c.GetPostFormArray("tags")
-		categories, _ = c.GetPostFormArray("categories")
-		mimeTypes, _  = c.GetPostFormArray("mime_types")
-		hashes, _     = c.GetPostFormArray("hashes")
-		required, _   = c.GetPostFormArray("required")
-	)
-
 	resp, err := api.lens.Search(c, &pb.SearchReq{
-		Query: query,
+		Query: req.Query,
 		Options: &pb.SearchReq_Options{
-			Tags:       tags,
-			Categories: categories,
-			MimeTypes:  mimeTypes,
-			Hashes:     hashes,
-			Required:   required,
+			Tags:       req.Tags,
+			Categories: req.Categories,
+			MimeTypes:  req.MimeTypes,
+			Hashes:     req.Hashes,
+			Required:   req.Required,
 		},
 	})
 
@@ -79,7 +60,7 @@ func (api *API) submitSearchRequest(c *gin.Context) {
 	}
 	// check to ensure some objects were found, otherwise log a warning
 	if len(resp.Results) == 0 {
-		Respond(c, http.StatusBadRequest, gin.H{"response": "no results found"})
+		FailWithMessage(c, "no results found", http.StatusBadRequest)
 		return
 	}
 	Respond(c, http.StatusOK, gin.H{"response": resp})
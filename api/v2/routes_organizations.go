@@ -5,7 +5,6 @@ import (
 	"errors"
 	"html"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -36,14 +35,13 @@ func (api *API) newOrganization(c *gin.Context) {
 		return
 	}
 	// get the organization name
-	forms, missingField := api.extractPostForms(c, "name")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req orgRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// create the organization
 	if _, err := api.orgs.NewOrganization(
-		forms["name"],
+		req.Name,
 		username,
 	); err != nil {
 		// creation failed, send an error message
@@ -55,7 +53,7 @@ func (api *API) newOrganization(c *gin.Context) {
 		return
 	}
 	api.l.Infow("organization created",
-		"name", forms["name"], "owner", username)
+		"name", req.Name, "owner", username)
 	Respond(c, http.StatusOK, gin.H{"response": "organization created"})
 }
 
@@ -68,12 +66,11 @@ func (api *API) getOrganization(c *gin.Context) {
 		return
 	}
 	// get the organization name
-	forms, missingField := api.extractPostForms(c, "name")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req orgRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	org, ok := api.validateOrgOwner(c, forms["name"], username)
+	org, ok := api.validateOrgOwner(c, req.Name, username)
 	if !ok {
 		return
 	}
@@ -86,29 +83,18 @@ func (api *API) getOrgBillingReport(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// get the organization name
-	forms, missingField := api.extractPostForms(c, "name", "number_of_days")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
-		return
-	}
-	// validate number_of_days parameter
-	numDays, err := strconv.Atoi(forms["number_of_days"])
-	if err != nil {
-		api.LogError(
-			c,
-			err,
-			"number_of_days is not an int",
-		)(http.StatusBadRequest)
+	// get the organization name and number of days to report on
+	var req billingReportRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	if _, ok := api.validateOrgOwner(c, forms["name"], username); !ok {
+	if _, ok := api.validateOrgOwner(c, req.Name, username); !ok {
 		return
 	}
 	// generate a billing report
 	report, err := api.orgs.GenerateBillingReport(
-		forms["name"],
-		time.Now().AddDate(0, 0, -numDays),
+		req.Name,
+		time.Now().AddDate(0, 0, -req.NumberOfDays),
 		time.Now(),
 	)
 	if err != nil {
@@ -131,39 +117,30 @@ func (api *API) registerOrgUser(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(
-		c,
-		"username",
-		"password",
-		"email_address",
-		"organization_name",
-	)
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req registerOrgUserRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// prevent people from registering usernames that contain an `@` sign
 	// this prevents griefing by prevent user sign-ins by using a username
 	// that is based off an email address
-	if strings.ContainsRune(forms["username"], '@') {
+	if strings.ContainsRune(req.Username, '@') {
 		Fail(c, errors.New("usernames cant contain @ sign"))
 		return
 	}
-	if _, ok := api.validateOrgOwner(c, forms["organization_name"], username); !ok {
+	if _, ok := api.validateOrgOwner(c, req.OrganizationName, username); !ok {
 		return
 	}
-	// parse html encoded strings
-	forms["password"] = html.UnescapeString(forms["password"])
 	// create the org user. this process is similar to regular
 	// user registration, so we handle the errors in the same way
 	_, err = api.orgs.RegisterOrgUser(
-		forms["organization_name"],
-		forms["username"],
-		forms["password"],
-		forms["email_address"],
+		req.OrganizationName,
+		req.Username,
+		// parse html encoded strings
+		html.UnescapeString(req.Password),
+		req.EmailAddress,
 	)
-	api.handleUserCreate(c, forms, err)
+	api.handleUserCreate(c, req.Username, req.EmailAddress, req.OrganizationName, err)
 }
 
 // getOrgUserUploads allows returning uploads for organization users
@@ -174,24 +151,22 @@ func (api *API) getOrgUserUploads(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	forms, missingField := api.extractPostForms(c, "name", "user")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	// as_csv allows optional returning the response as a generated csv file
+	var req orgUserUploadsRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	// allows optional returning the response as a generated csv file
-	asCSV := c.PostForm("as_csv") == "true"
 	// validate user is owner
-	if _, ok := api.validateOrgOwner(c, forms["name"], username); !ok {
+	if _, ok := api.validateOrgOwner(c, req.Name, username); !ok {
 		return
 	}
-	if asCSV {
-		uplds, err := api.getUploads(forms["name"], []string{forms["user"]})
+	if req.AsCSV {
+		uplds, err := api.getUploads(req.Name, []string{req.User})
 		if err != nil {
 			api.LogError(c, err, "failed to get user uploads"+err.Error())
 			return
 		}
-		csvBytes, err := csvutil.Marshal(uplds[forms["user"]])
+		csvBytes, err := csvutil.Marshal(uplds[req.User])
 		if err != nil {
 			api.LogError(c, err, "failed to generate csv file "+err.Error())
 			return
@@ -205,41 +180,29 @@ func (api *API) getOrgUserUploads(c *gin.Context) {
 		)
 		return
 	}
-	page := c.PostForm("page")
-	if page == "" {
-		page = "1"
-	}
-	limit := c.PostForm("limit")
-	if limit == "" {
-		limit = "10"
+	if req.Page == 0 {
+		req.Page = 1
 	}
-	pageInt, err := strconv.Atoi(page)
-	if err != nil {
-		Fail(c, err, http.StatusBadRequest)
-		return
-	}
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil {
-		Fail(c, err, http.StatusBadRequest)
-		return
+	if req.Limit == 0 {
+		req.Limit = 10
 	}
 	// validate that the user is part of the organization
 	// however dont fail on an error, simply continue
-	usr, err := api.um.FindByUserName(forms["user"])
+	usr, err := api.um.FindByUserName(req.User)
 	if err != nil {
 		api.LogError(c, err, eh.UserSearchError)
 		return
 	}
-	if usr.Organization != forms["name"] {
+	if usr.Organization != req.Name {
 		Fail(c, errors.New("user is not part of organization"))
 		return
 	}
 	var uploads []models.Upload
 	paged, err := gpaginator.Paging(
 		&gpaginator.Param{
-			DB:    api.upm.DB.Where("user_name = ?", forms["user"]),
-			Page:  pageInt,
-			Limit: limitInt,
+			DB:    api.upm.DB.Where("user_name = ?", req.User),
+			Page:  req.Page,
+			Limit: req.Limit,
 		},
 		&uploads,
 	)
@@ -4,18 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 
 	"github.com/gcash/bchutil"
 
-	"github.com/stripe/stripe-go/charge"
-
+	"github.com/RTradeLtd/Temporal/billing"
 	"github.com/RTradeLtd/Temporal/eh"
 	"github.com/jinzhu/gorm"
-	"github.com/stripe/stripe-go"
 
 	"github.com/RTradeLtd/ChainRider-Go/dash"
+	"github.com/RTradeLtd/Temporal/pricing"
 	"github.com/RTradeLtd/Temporal/queue"
 	"github.com/RTradeLtd/Temporal/utils"
 	greq "github.com/RTradeLtd/grpc/pay/request"
@@ -24,6 +25,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// stripeWebhookPath is the endpoint stripe sends payment events to
+	stripeWebhookPath = "/v2/payments/stripe/webhook"
+	// maxStripeWebhookSize is the largest webhook event we accept
+	maxStripeWebhookSize = 1 << 16
+)
+
 // ConfirmETHPayment is used to confirm an ethereum based payment
 func (api *API) ConfirmETHPayment(c *gin.Context) {
 	username, err := GetAuthenticatedUserFromContext(c)
@@ -31,20 +39,12 @@ func (api *API) ConfirmETHPayment(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "payment_number", "tx_hash")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
-		return
-	}
-	// parse payment number
-	paymentNumberInt, err := strconv.ParseInt(forms["payment_number"], 10, 64)
-	if err != nil {
-		Fail(c, err)
+	var req confirmPaymentRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// check to see if this payment is already registered
-	payment, err := api.pm.FindPaymentByNumber(username, paymentNumberInt)
+	payment, err := api.pm.FindPaymentByNumber(username, req.PaymentNumber)
 	if err != nil {
 		api.LogError(c, err, eh.PaymentSearchError)(http.StatusBadRequest)
 		return
@@ -57,21 +57,26 @@ func (api *API) ConfirmETHPayment(c *gin.Context) {
 	// this is used to prevent people from abusing the payment system, and getting
 	// a single payment to be processed multiple times without having to send additional funds
 	if payment.TxHash[0:2] == "0x" {
-		Fail(c, errors.New("payment is already being processed, if your payment hasn't been confirmed after 90 minutes please contact support@rtradetechnologies.com"))
+		Fail(c, errors.New("payment is already being processed, you will be emailed once it has been confirmed"))
+		return
+	}
+	// quotes are only honoured for payments sent before they expire
+	if err := api.payments.Submit(payment); err != nil {
+		Fail(c, err)
 		return
 	}
 	// update payment with the new tx hash
-	if _, err = api.pm.UpdatePaymentTxHash(username, forms["tx_hash"], paymentNumberInt); err != nil {
+	if _, err = api.pm.UpdatePaymentTxHash(username, req.TxHash, req.PaymentNumber); err != nil {
 		api.LogError(c, err, err.Error())(http.StatusBadRequest)
 		return
 	}
 	// create payment confirmation message
 	paymentConfirmation := queue.EthPaymentConfirmation{
 		UserName:      username,
-		PaymentNumber: paymentNumberInt,
+		PaymentNumber: req.PaymentNumber,
 	}
 	// send message for processing
-	if err = api.queues.eth.PublishMessage(paymentConfirmation); err != nil {
+	if err = api.publish(c, api.queues.eth, paymentConfirmation); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -87,30 +92,25 @@ func (api *API) RequestSignedPaymentMessage(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "payment_type", "sender_address", "credit_value")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	// payment types are validated when binding
+	var req signedPaymentRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	var (
 		paymentType string
 		method      uint64
 	)
-	// ensure it is a valid payment type
-	switch forms["payment_type"] {
+	switch req.PaymentType {
 	case "0":
 		paymentType = "rtc"
 		method = 0
 	case "1":
 		paymentType = "eth"
 		method = 1
-	default:
-		Fail(c, errors.New("payment_type must be '0 (rtc)' or '1 (eth)'"))
-		return
 	}
 	// get the current value of a single (ie, 1.0 eth) unit of currency of the given payment type
-	usdValueFloat, err := api.getUSDValue(paymentType)
+	price, err := api.quotePrice(paymentType)
 	if err != nil {
 		api.LogError(c, err, eh.CmcCheckError)(http.StatusBadRequest)
 		return
@@ -121,14 +121,8 @@ func (api *API) RequestSignedPaymentMessage(c *gin.Context) {
 		api.LogError(c, err, eh.PaymentSearchError)(http.StatusBadRequest)
 		return
 	}
-	// convert the credits the user wants to buy from string to float
-	creditValueFloat, err := strconv.ParseFloat(forms["credit_value"], 64)
-	if err != nil {
-		Fail(c, err)
-		return
-	}
 	// calculate how much of the given currency we  need to charge them
-	chargeAmountFloat := creditValueFloat / usdValueFloat
+	chargeAmountFloat := req.CreditValue / price.USD
 	// convert the float to a big int, as whenever we are processing uint256 in our smart contracts, this is the equivalent of a big.Int in golang
 	chargeAmountBig := utils.FloatToBigInt(chargeAmountFloat)
 	// format the big int, as a string
@@ -142,7 +136,7 @@ func (api *API) RequestSignedPaymentMessage(c *gin.Context) {
 	// on-chain, in a trustless manner ensuring transfer of payment and validation of payment within a single smart contract call.
 	signRequest := greq.SignRequest{
 		// the address that will be sending the transactoin
-		Address: forms["sender_address"],
+		Address: req.SenderAddress,
 		// the method of the payment
 		Method: methodString,
 		// the number of the current payment
@@ -159,19 +153,25 @@ func (api *API) RequestSignedPaymentMessage(c *gin.Context) {
 	}
 	// format a unique payment number to take the place of deposit address and tx hash temporarily
 	paymentNumberString := fmt.Sprintf("%s-%s", username, strconv.FormatInt(paymentNumber, 10))
-	if _, err = api.pm.NewPayment(
+	payment, err := api.pm.NewPayment(
 		paymentNumber,
 		paymentNumberString,
 		paymentNumberString,
-		creditValueFloat,
+		req.CreditValue,
 		chargeAmountFloat,
 		"ethereum",
 		paymentType,
 		username,
-	); err != nil {
+	)
+	if err != nil {
 		api.LogError(c, err, err.Error())(http.StatusBadRequest)
 		return
 	}
+	quote, err := api.payments.Track(payment, price, "")
+	if err != nil {
+		api.LogError(c, err, eh.PaymentCreationError)(http.StatusBadRequest)
+		return
+	}
 	// parse the v parameter into uint type
 	vUint, err := strconv.ParseUint(resp.GetV(), 10, 64)
 	if err != nil {
@@ -189,6 +189,7 @@ func (api *API) RequestSignedPaymentMessage(c *gin.Context) {
 		"payment_number":    paymentNumber,
 		"prefixed":          true,
 		"v":                 uint8(vUint),
+		"expires_at":        quote.ExpiresAt,
 		"formatted": gin.H{
 			"h": formattedH,
 			"r": formattedR,
@@ -205,22 +206,16 @@ func (api *API) createBchPayment(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	forms, missingField := api.extractPostForms(c, "credit_value")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
-		return
-	}
-	usdValueFloat, err := api.getUSDValue("bch")
-	if err != nil {
-		Fail(c, err)
+	var req creditValueRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	creditValueFloat, err := strconv.ParseFloat(forms["credit_value"], 64)
+	price, err := api.quotePrice("bch")
 	if err != nil {
 		Fail(c, err)
 		return
 	}
-	chargeAmountFloat := creditValueFloat / usdValueFloat
+	chargeAmountFloat := req.CreditValue / price.USD
 	paymentNumber, err := api.pm.GetLatestPaymentNumber(username)
 	if err != nil {
 		api.LogError(c, err, eh.PaymentSearchError)(http.StatusBadRequest)
@@ -250,26 +245,33 @@ func (api *API) createBchPayment(c *gin.Context) {
 	}
 	// format a unique payment number to take the place of deposit address and tx hash temporarily
 	paymentNumberString := fmt.Sprintf("%s-%s", username, strconv.FormatInt(paymentNumber, 10))
-	if _, err := api.pm.NewPayment(
+	payment, err := api.pm.NewPayment(
 		paymentNumber,
 		addrReq.GetAddress(),
 		// temporary fake tx hash
 		// will get updated when
 		// confirming the payment
 		paymentNumberString,
-		creditValueFloat,
+		req.CreditValue,
 		bchChargeAmount.ToBCH(),
 		"bitcoin-cash",
 		"bch",
 		username,
-	); err != nil {
+	)
+	if err != nil {
 		api.LogError(c, err, err.Error())(http.StatusBadRequest)
 		return
 	}
+	quote, err := api.payments.Track(payment, price, "")
+	if err != nil {
+		api.LogError(c, err, eh.PaymentCreationError)(http.StatusBadRequest)
+		return
+	}
 	response := gin.H{
 		"deposit_address": addrReq.GetAddress(),
 		"charge_amount":   bchChargeAmount.ToBCH(),
 		"payment_number":  paymentNumber,
+		"expires_at":      quote.ExpiresAt,
 	}
 	Respond(c, http.StatusOK, gin.H{"response": response})
 }
@@ -280,19 +282,12 @@ func (api *API) confirmBchPayment(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	forms, missingField := api.extractPostForms(c, "payment_number", "tx_hash")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
-		return
-	}
-	// parse payment number
-	paymentNumberInt, err := strconv.ParseInt(forms["payment_number"], 10, 64)
-	if err != nil {
-		Fail(c, err)
+	var req confirmPaymentRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// check to see if this payment is already registered
-	payment, err := api.pm.FindPaymentByNumber(username, paymentNumberInt)
+	payment, err := api.pm.FindPaymentByNumber(username, req.PaymentNumber)
 	if err != nil {
 		api.LogError(c, err, eh.PaymentSearchError)(http.StatusBadRequest)
 		return
@@ -314,15 +309,20 @@ func (api *API) confirmBchPayment(c *gin.Context) {
 		Fail(c, errors.New("payment is already being processed"))
 		return
 	}
-	if _, err := api.pm.UpdatePaymentTxHash(username, forms["tx_hash"], paymentNumberInt); err != nil {
+	// quotes are only honoured for payments sent before they expire
+	if err := api.payments.Submit(payment); err != nil {
+		Fail(c, err)
+		return
+	}
+	if _, err := api.pm.UpdatePaymentTxHash(username, req.TxHash, req.PaymentNumber); err != nil {
 		api.LogError(c, err, err.Error())(http.StatusBadRequest)
 		return
 	}
 	confirmation := queue.BchPaymentConfirmation{
 		UserName:      username,
-		PaymentNumber: paymentNumberInt,
+		PaymentNumber: req.PaymentNumber,
 	}
-	if err := api.queues.bch.PublishMessage(confirmation); err != nil {
+	if err := api.publish(c, api.queues.bch, confirmation); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -336,22 +336,16 @@ func (api *API) CreateDashPayment(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	forms, missingField := api.extractPostForms(c, "credit_value")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req creditValueRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	usdValueFloat, err := api.getUSDValue("dash")
+	price, err := api.quotePrice("dash")
 	if err != nil {
 		Fail(c, err)
 		return
 	}
-	creditValueFloat, err := strconv.ParseFloat(forms["credit_value"], 64)
-	if err != nil {
-		Fail(c, err)
-		return
-	}
-	chargeAmountFloat := creditValueFloat / usdValueFloat
+	chargeAmountFloat := req.CreditValue / price.USD
 	paymentNumber, err := api.pm.GetLatestPaymentNumber(username)
 	if err != nil {
 		api.LogError(c, err, eh.PaymentSearchError)(http.StatusBadRequest)
@@ -379,25 +373,35 @@ func (api *API) CreateDashPayment(c *gin.Context) {
 		api.LogError(c, errors.New(response.Error), eh.ChainRiderAPICallError, "wallet_address", api.cfg.Wallets.DASH)(http.StatusBadRequest)
 		return
 	}
-	if _, err = api.pm.NewPayment(
+	payment, err := api.pm.NewPayment(
 		paymentNumber,
 		response.PaymentAddress,
 		fakeTxHash,
-		creditValueFloat,
+		req.CreditValue,
 		chargeAmountFloat,
 		"dash",
 		"dash",
 		username,
-	); err != nil {
+	)
+	if err != nil {
 		api.LogError(c, err, err.Error())(http.StatusBadRequest)
 		return
 	}
+	// dash payments are confirmed through the payment forward, so are submitted immediately
+	if _, err := api.payments.Track(payment, price, response.PaymentForwardID); err != nil {
+		api.LogError(c, err, eh.PaymentCreationError)(http.StatusBadRequest)
+		return
+	}
+	if err := api.payments.Submit(payment); err != nil {
+		api.LogError(c, err, eh.PaymentCreationError)(http.StatusBadRequest)
+		return
+	}
 	confirmation := &queue.DashPaymenConfirmation{
 		UserName:         username,
 		PaymentForwardID: response.PaymentForwardID,
 		PaymentNumber:    paymentNumber,
 	}
-	if err = api.queues.dash.PublishMessage(confirmation); err != nil {
+	if err = api.publish(c, api.queues.dash, confirmation); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -427,66 +431,103 @@ func (api *API) CreateDashPayment(c *gin.Context) {
 	Respond(c, http.StatusOK, gin.H{"response": p})
 }
 
-func (api *API) stripeCharge(c *gin.Context) {
+// createStripePaymentIntent is used to start a credit purchase with stripe.
+// credits are granted once stripe notifies us the payment succeeded
+func (api *API) createStripePaymentIntent(c *gin.Context) {
 	username, err := GetAuthenticatedUserFromContext(c)
 	if err != nil {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	forms, missingField := api.extractPostForms(c, "stripe_token", "stripe_email", "value_in_cents")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req stripeIntentRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	valueInCentsInt, err := strconv.ParseInt(forms["value_in_cents"], 10, 64)
-	if err != nil {
+	pi, err := api.billing.CreatePaymentIntent(username, req.StripeEmail, req.ValueInCents)
+	switch err {
+	case nil:
+	case billing.ErrInvalidAmount:
 		Fail(c, err)
 		return
+	default:
+		api.LogError(c, err, eh.PaymentCreationError)(http.StatusBadRequest)
+		return
 	}
-	valueInCentsFloat, err := strconv.ParseFloat(forms["value_in_cents"], 64)
+	Respond(c, http.StatusOK, gin.H{"response": gin.H{
+		"payment_intent":  pi.ID,
+		"client_secret":   pi.ClientSecret,
+		"publishable_key": api.cfg.Stripe.PublishableKey,
+	}})
+}
+
+// getStripePayment is used to check whether a stripe payment has completed
+func (api *API) getStripePayment(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
 	if err != nil {
-		Fail(c, err)
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// set the secret key after input validation
-	stripe.Key = api.cfg.Stripe.SecretKey
-	// set the source for the charge
-	// in this case it is a tokenized version of the credit card
-	source, err := stripe.SourceParamsFor(forms["stripe_token"])
-	if err != nil {
-		Fail(c, err)
+	payment, err := api.billing.FindPayment(username, c.Param("id"))
+	switch err {
+	case nil:
+	case billing.ErrPaymentNotFound:
+		// payments of other users are not found, rather than forbidden
+		Fail(c, err, http.StatusNotFound)
+		return
+	default:
+		api.LogError(c, err, eh.PaymentSearchError)(http.StatusBadRequest)
 		return
 	}
-	// initialize credit card charge parameters
-	ch, err := charge.New(&stripe.ChargeParams{
-		Amount:      stripe.Int64(valueInCentsInt),
-		Currency:    stripe.String(string(stripe.CurrencyUSD)),
-		Description: stripe.String("temporal credit purchase"),
-		// StatementDescriptor is what appears in their credit card billing report
-		StatementDescriptor: stripe.String("credit purchase"),
-		// email the receipt goes to
-		ReceiptEmail: stripe.String(forms["stripe_email"]),
-		Source:       source,
-		Params: stripe.Params{
-			Metadata: map[string]string{
-				"order_type": "temporal.credits",
-			},
-		},
-	})
+	Respond(c, http.StatusOK, gin.H{"response": payment})
+}
+
+// stripeCharge is used to purchase credits by charging a tokenized card.
+// It is deprecated in favour of payment intents, which support cards that
+// require authentication, and is kept until existing clients have moved
+func (api *API) stripeCharge(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
 	if err != nil {
-		api.LogError(c, err, err.Error())(http.StatusBadRequest)
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	api.l.Infow("payment complete", "payment.method", "stripe", "user", username, "charge", ch)
-	// add credits to use
-	if _, err := api.um.AddCredits(username, valueInCentsFloat/100); err != nil {
-		api.LogError(c, err, "failed to grant credits")(http.StatusInternalServerError)
+	c.Header("Deprecation", "true")
+	c.Header("Link", "</v2/payments/stripe/intent>; rel=\"successor-version\"")
+	var req stripeChargeRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	api.l.Infow("credits granted", "payment.method", "stripe", "credit.amount", valueInCentsFloat/100)
+	payment, err := api.billing.Charge(username, req.StripeEmail, req.StripeToken, req.ValueInCents)
+	switch err {
+	case nil:
+	case billing.ErrInvalidAmount:
+		Fail(c, err)
+		return
+	default:
+		api.LogError(c, err, eh.PaymentCreationError)(http.StatusBadRequest)
+		return
+	}
+	api.l.Infow("deprecated stripe charge", "user", username, "charge", payment.ChargeID)
 	Respond(c, http.StatusOK, gin.H{"response": "stripe credit purchase successful"})
 }
 
+// stripeWebhook receives payment events from stripe
+func (api *API) stripeWebhook(c *gin.Context) {
+	payload, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, maxStripeWebhookSize))
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	switch err := api.billing.HandleWebhook(payload, c.GetHeader("Stripe-Signature")); err {
+	case nil:
+		Respond(c, http.StatusOK, gin.H{"response": "event processed"})
+	case billing.ErrInvalidSignature, billing.ErrWebhookNotConfigured:
+		Fail(c, err)
+	default:
+		// stripe retries events until they are acknowledged
+		api.LogError(c, err, "failed to process stripe event")(http.StatusInternalServerError)
+	}
+}
+
 // GetPaymentStatus is used to retrieve whether or not a payment is confirmed
 func (api *API) getPaymentStatus(c *gin.Context) {
 	username, err := GetAuthenticatedUserFromContext(c)
@@ -507,35 +548,11 @@ func (api *API) getPaymentStatus(c *gin.Context) {
 	Respond(c, http.StatusOK, gin.H{"response": payment.Confirmed})
 }
 
-// GetUSDValue is used to retrieve the usd value of a given payment type
-func (api *API) getUSDValue(paymentType string) (float64, error) {
-	var (
-		cost float64
-		err  error
-	)
-	switch paymentType {
-	case "eth":
-		cost, err = utils.RetrieveUsdPrice("ethereum", api.getCMCKey())
-	case "xmr":
-		cost, err = utils.RetrieveUsdPrice("monero", api.getCMCKey())
-	case "dash":
-		cost, err = utils.RetrieveUsdPrice("dash", api.getCMCKey())
-	case "btc":
-		cost, err = utils.RetrieveUsdPrice("bitcoin", api.getCMCKey())
-	case "bch":
-		cost, err = utils.RetrieveUsdPrice("bitcoin-cash", api.getCMCKey())
-	case "ltc":
-		cost, err = utils.RetrieveUsdPrice("litecoin", api.getCMCKey())
-	case "rtc":
-		cost, err = RtcCostUsd, nil
-	default:
-		return 0, errors.New(eh.InvalidPaymentTypeError)
-	}
-	// if we have an error, and the cost is 0 return the error
-	// otherwise if we have an error, and a non-zero cost
-	// then we should return the most recent price we have
-	if err != nil && cost == 0 {
-		return 0, err
+// quotePrice returns the current usd value of a single unit of the given payment type
+func (api *API) quotePrice(paymentType string) (*pricing.Quote, error) {
+	quote, err := api.prices.Quote(context.Background(), paymentType)
+	if err == pricing.ErrUnsupportedCoin {
+		return nil, errors.New(eh.InvalidPaymentTypeError)
 	}
-	return cost, nil
+	return quote, err
 }
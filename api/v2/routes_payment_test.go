@@ -3,6 +3,7 @@ package v2
 import (
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/RTradeLtd/Temporal/mocks"
@@ -93,4 +94,44 @@ func Test_API_Routes_Payments(t *testing.T) {
 	urlValues.Add("tx_hash", "0x1")
 	req.PostForm = urlValues
 	api.r.ServeHTTP(testRecorder, req)
+
+	// test stripe payment intent creation with an invalid amount
+	// /v2/payments/stripe/intent
+	urlValues = url.Values{}
+	urlValues.Add("stripe_email", "test@example.com")
+	urlValues.Add("value_in_cents", "0")
+	if err := sendRequest(
+		api, "POST", "/v2/payments/stripe/intent", 400, nil, urlValues, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// test stripe payment lookup for an unknown payment
+	// /v2/payments/stripe/intent/:id
+	if err := sendRequest(
+		api, "GET", "/v2/payments/stripe/intent/pi_unknown", 404, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// test deprecated stripe charge without a card token
+	// /v2/payments/stripe/charge
+	urlValues = url.Values{}
+	urlValues.Add("stripe_email", "test@example.com")
+	urlValues.Add("value_in_cents", "100")
+	if err := sendRequest(
+		api, "POST", "/v2/payments/stripe/charge", 400, nil, urlValues, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// test stripe webhook without a valid signature
+	// /v2/payments/stripe/webhook
+	testRecorder = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", stripeWebhookPath, strings.NewReader(`{"id":"evt_test","type":"payment_intent.succeeded"}`))
+	req.Header.Add("Stripe-Signature", "t=0,v1=invalid")
+	api.r.ServeHTTP(testRecorder, req)
+	if testRecorder.Code != 400 {
+		t.Fatalf("expected status 400, got %v", testRecorder.Code)
+	}
 }
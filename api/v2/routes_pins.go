@@ -0,0 +1,352 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/pins"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/Temporal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	gocid "github.com/ipfs/go-cid"
+	"github.com/jinzhu/gorm"
+)
+
+// routes implementing the ipfs pinning service api, which is specified at
+// https://ipfs.github.io/pinning-services-api-spec. Errors are reported in
+// the format of the specification, rather than our own
+
+const (
+	// defaultPinHoldTime is the number of months content is pinned
+	// for, unless set with the hold_time meta of a pin
+	defaultPinHoldTime int64 = 1
+	// defaultPinsLimit is the number of pins listed, unless set with limit
+	defaultPinsLimit = 10
+	// maxPinsCIDs is the number of cids pins can be listed by at once
+	maxPinsCIDs = 10
+	// originsConnectTimeout is how long is spent connecting to pin origins
+	originsConnectTimeout = time.Minute
+)
+
+// listPins is used to list the pin requests of a user, newest first
+func (api *API) listPins(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		failPin(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var query pinningServiceQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		failPin(c, http.StatusBadRequest, bindingDetails(err))
+		return
+	}
+	filter, err := query.filter()
+	if err != nil {
+		failPin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	q, err := api.pins.List(username, *filter)
+	if err != nil {
+		failPin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	var count int
+	if err := q.Count(&count).Error; err != nil {
+		api.failPinInternal(c, err, "failed to count pin requests")
+		return
+	}
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultPinsLimit
+	}
+	var reqs []pins.Request
+	if err := q.Limit(limit).Find(&reqs).Error; err != nil {
+		api.failPinInternal(c, err, "failed to find pin requests")
+		return
+	}
+	results := pinningServiceResults{Count: count, Results: make([]pinningServiceStatus, len(reqs))}
+	for i := range reqs {
+		results.Results[i] = api.pinStatus(&reqs[i])
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// addPin is used to pin content, charging the user for the hold time of the pin
+func (api *API) addPin(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		failPin(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var pin pinningServicePin
+	if err := c.ShouldBindJSON(&pin); err != nil {
+		failPin(c, http.StatusBadRequest, bindingDetails(err))
+		return
+	}
+	api.createPin(c, username, &pin, nil)
+}
+
+// getPin is used to get a pin request of the user
+func (api *API) getPin(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		failPin(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	req, ok := api.findPin(c, username)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, api.pinStatus(req))
+}
+
+// replacePin is used to replace a pin request with a new one, in one step
+func (api *API) replacePin(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		failPin(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	old, ok := api.findPin(c, username)
+	if !ok {
+		return
+	}
+	var pin pinningServicePin
+	if err := c.ShouldBindJSON(&pin); err != nil {
+		failPin(c, http.StatusBadRequest, bindingDetails(err))
+		return
+	}
+	api.createPin(c, username, &pin, old)
+}
+
+// removePin is used to remove a pin request. The content stays pinned
+// until the hold time that was paid for runs out
+func (api *API) removePin(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		failPin(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	req, ok := api.findPin(c, username)
+	if !ok {
+		return
+	}
+	if err := api.pins.Remove(req); err != nil {
+		api.failPinInternal(c, err, "failed to remove pin request")
+		return
+	}
+	api.l.Infow("pin request removed", "user", username, "request_id", req.RequestID)
+	c.Status(http.StatusAccepted)
+}
+
+// createPin records a pin request, replacing old when given, and queues the
+// content to be pinned to the cluster. Content the user has already uploaded
+// is not charged for again, and is reported as pinned right away
+func (api *API) createPin(c *gin.Context, username string, pin *pinningServicePin, old *pins.Request) {
+	if _, err := gocid.Decode(pin.CID); err != nil {
+		failPin(c, http.StatusBadRequest, "invalid cid: "+err.Error())
+		return
+	}
+	for _, origin := range pin.Origins {
+		if _, err := utils.GenerateMultiAddrFromString(origin); err != nil {
+			failPin(c, http.StatusBadRequest, "invalid origin "+origin+": "+err.Error())
+			return
+		}
+	}
+	holdTime := defaultPinHoldTime
+	if value, ok := pin.Meta["hold_time"]; ok {
+		months, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || months <= 0 {
+			failPin(c, http.StatusBadRequest, "hold_time meta must be a positive number of months")
+			return
+		}
+		holdTime = months
+	}
+	if err := api.validateHoldTime(username, holdTime); err != nil {
+		failPin(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	req := &pins.Request{
+		RequestID: pins.NewRequestID(),
+		UserName:  username,
+		CID:       pin.CID,
+		Name:      pin.Name,
+		Origins:   pin.Origins,
+		Meta:      pin.Meta,
+		HoldTime:  holdTime,
+	}
+	record := func(tx *gorm.DB) error {
+		if old != nil {
+			return pins.NewManager(tx).Replace(old, req)
+		}
+		return pins.NewManager(tx).Create(req)
+	}
+	if upload, err := api.upm.FindUploadByHashAndUserAndNetwork(username, pin.CID, "public"); err == nil || upload != nil {
+		req.Status = pins.Pinned
+		if err := record(api.dbm.DB); err != nil {
+			api.failPinInternal(c, err, "failed to record pin request")
+			return
+		}
+		c.JSON(http.StatusAccepted, api.pinStatus(req))
+		return
+	}
+	cost, size, err := api.pinCost(username, pin.CID, holdTime)
+	if err != nil {
+		api.LogError(c, err, "failed to calculate pin cost")
+		failPin(c, http.StatusBadRequest, "failed to calculate the cost of the pin")
+		return
+	}
+	qp := queue.IPFSClusterPin{
+		CID:              pin.CID,
+		NetworkName:      "public",
+		UserName:         username,
+		HoldTimeInMonths: holdTime,
+		Size:             size,
+		CreditCost:       cost,
+		FileName:         pin.Name,
+		PinRequestID:     req.RequestID,
+	}
+	if err := api.charge(c, username, cost, uint64(size), ledger.Meta{CallType: "pin", CID: pin.CID}, queue.IpfsClusterPinQueue, qp, record); err != nil {
+		api.LogError(c, err.err, err.message)
+		failPin(c, err.status, err.message)
+		return
+	}
+	if len(pin.Origins) > 0 {
+		go api.connectOrigins(req.RequestID, pin.Origins)
+	}
+	api.l.Infow("pin request sent to backend", "user", username, "request_id", req.RequestID)
+	c.JSON(http.StatusAccepted, api.pinStatus(req))
+}
+
+// connectOrigins connects our node to the origins of a pin, so that
+// content only they provide can be found
+func (api *API) connectOrigins(requestID string, origins []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), originsConnectTimeout)
+	defer cancel()
+	if err := api.ipfs.SwarmConnect(ctx, origins...); err != nil {
+		api.l.Warnw("failed to connect to pin origins", "request_id", requestID, "error", err)
+	}
+}
+
+// findPin returns the pin request named by the requestid parameter, failing
+// the request if the user has no such pin request
+func (api *API) findPin(c *gin.Context, username string) (*pins.Request, bool) {
+	req, err := api.pins.Find(username, c.Param("requestid"))
+	switch {
+	case err == pins.ErrNotFound:
+		failPin(c, http.StatusNotFound, "the specified pin request does not exist")
+		return nil, false
+	case err != nil:
+		api.failPinInternal(c, err, "failed to find pin request")
+		return nil, false
+	}
+	return req, true
+}
+
+// pinStatus returns the pinning service api representation of a pin request
+func (api *API) pinStatus(req *pins.Request) pinningServiceStatus {
+	status := pinningServiceStatus{
+		RequestID: req.RequestID,
+		Status:    req.Status,
+		Created:   req.CreatedAt,
+		Pin: pinningServicePin{
+			CID:     req.CID,
+			Name:    req.Name,
+			Origins: req.Origins,
+			Meta:    req.Meta,
+		},
+		Delegates: api.delegates,
+		Info:      map[string]string{},
+	}
+	if status.Delegates == nil {
+		status.Delegates = []string{}
+	}
+	if req.Reason != "" {
+		status.Info["status_details"] = req.Reason
+	}
+	return status
+}
+
+// filter returns the pin request filter described by the query
+func (q *pinningServiceQuery) filter() (*pins.Filter, error) {
+	filter := &pins.Filter{
+		Name:   q.Name,
+		Match:  pins.Match(q.Match),
+		Before: q.Before,
+		After:  q.After,
+	}
+	if q.CID != "" {
+		filter.CIDs = strings.Split(q.CID, ",")
+		if len(filter.CIDs) > maxPinsCIDs {
+			return nil, errors.New("cid must list at most 10 cids")
+		}
+	}
+	if q.Status == "" {
+		// the pinning service api lists pinned content unless asked otherwise
+		filter.Statuses = []pins.Status{pins.Pinned}
+	} else {
+		for _, s := range strings.Split(q.Status, ",") {
+			status, ok := parsePinStatus(s)
+			if !ok {
+				return nil, errors.New("status must be any of queued, pinning, pinned or failed")
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	if q.Meta != "" {
+		if err := json.Unmarshal([]byte(q.Meta), &filter.Meta); err != nil {
+			return nil, errors.New("meta must be a json object of strings")
+		}
+	}
+	return filter, nil
+}
+
+// parsePinStatus returns the pin request status named s
+func parsePinStatus(s string) (pins.Status, bool) {
+	for _, status := range pins.Statuses {
+		if string(status) == s {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// failPin writes an error response in the format of the pinning service api,
+// where the reason is derived from the status code
+func failPin(c *gin.Context, status int, details string) {
+	var resp pinningServiceError
+	switch status {
+	case http.StatusPaymentRequired:
+		resp.Error.Reason = "INSUFFICIENT_FUNDS"
+	default:
+		resp.Error.Reason = strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	resp.Error.Details = details
+	c.AbortWithStatusJSON(status, resp)
+}
+
+// failPinInternal logs an unexpected error, and fails the request
+func (api *API) failPinInternal(c *gin.Context, err error, message string) {
+	api.LogError(c, err, message)
+	failPin(c, http.StatusInternalServerError, message)
+}
+
+// bindingDetails describes why a request could not be bound
+func bindingDetails(err error) string {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err.Error()
+	}
+	fe := validationErrs[0]
+	if fe.Tag() == "required" {
+		return fe.Field() + " is required"
+	}
+	return fe.Field() + " " + validationMessage(fe)
+}
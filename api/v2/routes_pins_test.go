@@ -0,0 +1,193 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/Temporal/pins"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/google/uuid"
+)
+
+func Test_API_Routes_Pins(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tag pins so previous runs do not affect the results
+	tag := uuid.New().String()
+	defer db.Unscoped().Where("user_name = ? AND meta @> ?", "testuser", `{"tag":"`+tag+`"}`).Delete(&pins.Request{})
+
+	pinBody := func(pin pinningServicePin) *bytes.Reader {
+		data, err := json.Marshal(pin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.NewReader(data)
+	}
+
+	// errors are in the format of the specification, including auth errors
+	var pinErr pinningServiceError
+	recorder := httptest.NewRecorder()
+	api.r.ServeHTTP(recorder, httptest.NewRequest("GET", "/v2/pinning/pins", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status %v", recorder.Code)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &pinErr); err != nil || pinErr.Error.Reason != "UNAUTHORIZED" {
+		t.Fatalf("unexpected error %s", recorder.Body.String())
+	}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		pin        pinningServicePin
+		wantReason string
+		wantStatus int
+	}{
+		{"InvalidCID", "POST", "/v2/pinning/pins", pinningServicePin{CID: "notarealhash"}, "BAD_REQUEST", 400},
+		{"MissingCID", "POST", "/v2/pinning/pins", pinningServicePin{Name: "name"}, "BAD_REQUEST", 400},
+		{"InvalidOrigin", "POST", "/v2/pinning/pins", pinningServicePin{CID: testPIN2, Origins: []string{"notamultiaddr"}}, "BAD_REQUEST", 400},
+		{"InvalidHoldTime", "POST", "/v2/pinning/pins", pinningServicePin{CID: testPIN2, Meta: map[string]string{"hold_time": "-1"}}, "BAD_REQUEST", 400},
+		{"NotFound", "GET", "/v2/pinning/pins/" + uuid.New().String(), pinningServicePin{}, "NOT_FOUND", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pinErr pinningServiceError
+			if err := sendRequest(
+				api, tt.method, tt.path, tt.wantStatus, pinBody(tt.pin), nil, &pinErr,
+			); err != nil {
+				t.Fatal(err)
+			}
+			if pinErr.Error.Reason != tt.wantReason {
+				t.Fatalf("expected reason %s, got %+v", tt.wantReason, pinErr)
+			}
+		})
+	}
+
+	// POST /v2/pinning/pins
+	var status pinningServiceStatus
+	if err := sendRequest(
+		api, "POST", "/v2/pinning/pins", 202, pinBody(pinningServicePin{
+			CID:  testPIN2,
+			Name: "pinning-service",
+			Meta: map[string]string{"tag": tag, "hold_time": "2"},
+		}), nil, &status,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if status.RequestID == "" || status.Pin.CID != testPIN2 || status.Delegates == nil {
+		t.Fatalf("unexpected pin status %+v", status)
+	}
+	if status.Status != pins.Queued && status.Status != pins.Pinned {
+		t.Fatalf("unexpected status %s", status.Status)
+	}
+
+	// GET /v2/pinning/pins/:requestid
+	var found pinningServiceStatus
+	if err := sendRequest(
+		api, "GET", "/v2/pinning/pins/"+status.RequestID, 200, nil, nil, &found,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if found.RequestID != status.RequestID || found.Pin.Name != "pinning-service" {
+		t.Fatalf("unexpected pin status %+v", found)
+	}
+
+	// GET /v2/pinning/pins
+	query := url.Values{
+		"cid":   {testPIN2},
+		"name":  {"PINNING"},
+		"match": {"ipartial"},
+		"meta":  {`{"tag":"` + tag + `"}`},
+		// the pin may not have completed yet
+		"status": {"queued,pinning,pinned"},
+	}
+	var results pinningServiceResults
+	if err := sendRequest(
+		api, "GET", "/v2/pinning/pins?"+query.Encode(), 200, nil, nil, &results,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if results.Count != 1 || len(results.Results) != 1 || results.Results[0].RequestID != status.RequestID {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	query.Set("match", "exact")
+	if err := sendRequest(
+		api, "GET", "/v2/pinning/pins?"+query.Encode(), 200, nil, nil, &results,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if results.Count != 0 || len(results.Results) != 0 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	query.Set("match", "notamatch")
+	if err := sendRequest(
+		api, "GET", "/v2/pinning/pins?"+query.Encode(), 400, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendRequest(
+		api, "GET", "/v2/pinning/pins?status=notastatus", 400, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	// only pinned content is listed by default
+	if filter, err := (&pinningServiceQuery{}).filter(); err != nil {
+		t.Fatal(err)
+	} else if len(filter.Statuses) != 1 || filter.Statuses[0] != pins.Pinned {
+		t.Fatalf("unexpected default statuses %v", filter.Statuses)
+	}
+
+	// POST /v2/pinning/pins/:requestid
+	var replaced pinningServiceStatus
+	if err := sendRequest(
+		api, "POST", "/v2/pinning/pins/"+status.RequestID, 202, pinBody(pinningServicePin{
+			CID:  testPIN2,
+			Name: "replaced",
+			Meta: map[string]string{"tag": tag},
+		}), nil, &replaced,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if replaced.RequestID == "" || replaced.RequestID == status.RequestID || replaced.Pin.Name != "replaced" {
+		t.Fatalf("unexpected pin status %+v", replaced)
+	}
+	if err := sendRequest(
+		api, "GET", "/v2/pinning/pins/"+status.RequestID, 404, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// DELETE /v2/pinning/pins/:requestid
+	if err := sendRequest(
+		api, "DELETE", "/v2/pinning/pins/"+replaced.RequestID, 202, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendRequest(
+		api, "GET", "/v2/pinning/pins/"+replaced.RequestID, 404, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+}
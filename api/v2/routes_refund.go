@@ -0,0 +1,152 @@
+package v2
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/RTradeLtd/Temporal/billing"
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/refunds"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// requestStripeRefund is used to refund unused credits to the card of a stripe payment
+func (api *API) requestStripeRefund(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	var req stripeRefundRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	refund, err := api.refunds.RequestStripe(username, req.PaymentIntentID, req.Amount, req.Reason)
+	if err != nil {
+		api.failRefund(c, err)
+		return
+	}
+	api.l.Infow("stripe refund requested", "user", username, "refund", refund.ID, "amount", refund.Amount, "status", refund.Status)
+	Respond(c, http.StatusOK, gin.H{"response": refund})
+}
+
+// requestCryptoRefund is used to request unused credits bought with a crypto
+// payment be paid out to an address, once approved by an administrator
+func (api *API) requestCryptoRefund(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	var req cryptoRefundRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	refund, err := api.refunds.RequestPayout(username, req.PaymentNumber, req.Address, req.Amount, req.Reason)
+	if err != nil {
+		api.failRefund(c, err)
+		return
+	}
+	api.l.Infow("crypto refund requested", "user", username, "refund", refund.ID, "amount", refund.Amount)
+	Respond(c, http.StatusOK, gin.H{"response": refund})
+}
+
+// getRefunds is used to list the refund requests of the authenticated user
+func (api *API) getRefunds(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	api.pageIt(c, api.refunds.History(username), &[]refunds.Request{})
+}
+
+// getRefundQueue is used by administrators to list refunds awaiting review or payout
+func (api *API) getRefundQueue(c *gin.Context) {
+	if _, ok := api.authorizeAdmin(c); !ok {
+		return
+	}
+	api.pageIt(c, api.refunds.Queue(), &[]refunds.Request{})
+}
+
+// approveRefund is used by administrators to approve a crypto payout
+func (api *API) approveRefund(c *gin.Context) {
+	admin, ok := api.authorizeAdmin(c)
+	if !ok {
+		return
+	}
+	var req refundNoteRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	api.reviewRefund(c, admin, func(id uint, admin string) (*refunds.Request, error) {
+		return api.refunds.Approve(id, admin, req.Note)
+	})
+}
+
+// denyRefund is used by administrators to deny a refund, returning the credits
+func (api *API) denyRefund(c *gin.Context) {
+	admin, ok := api.authorizeAdmin(c)
+	if !ok {
+		return
+	}
+	var req refundDenyRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	api.reviewRefund(c, admin, func(id uint, admin string) (*refunds.Request, error) {
+		return api.refunds.Deny(id, admin, req.Note)
+	})
+}
+
+// refundPaid is used by administrators to record the transaction a payout was sent in
+func (api *API) refundPaid(c *gin.Context) {
+	admin, ok := api.authorizeAdmin(c)
+	if !ok {
+		return
+	}
+	var req refundPaidRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	api.reviewRefund(c, admin, func(id uint, admin string) (*refunds.Request, error) {
+		return api.refunds.Paid(id, admin, req.TxHash)
+	})
+}
+
+// reviewRefund applies the action of an authorized administrator to the refund in the url
+func (api *API) reviewRefund(c *gin.Context, admin string, review func(id uint, admin string) (*refunds.Request, error)) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	req, err := review(uint(id), admin)
+	if err != nil {
+		api.failRefund(c, err)
+		return
+	}
+	api.l.Infow("refund reviewed", "admin", admin, "refund", req.ID, "status", req.Status)
+	Respond(c, http.StatusOK, gin.H{"response": req})
+}
+
+func (api *API) failRefund(c *gin.Context, err error) {
+	switch {
+	case err == ledger.ErrInsufficientCredits:
+		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
+	case err == refunds.ErrNotFound:
+		Fail(c, err, http.StatusNotFound)
+	case err == refunds.ErrInvalidAmount,
+		err == refunds.ErrNotRefundable,
+		err == refunds.ErrInvalidStatus,
+		err == refunds.ErrNotReviewable,
+		err == billing.ErrInvalidAmount:
+		Fail(c, err)
+	case gorm.IsRecordNotFoundError(err):
+		api.LogError(c, err, eh.PaymentSearchError)(http.StatusBadRequest)
+	default:
+		api.LogError(c, err, eh.RefundError)(http.StatusBadRequest)
+	}
+}
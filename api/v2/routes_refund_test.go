@@ -0,0 +1,137 @@
+package v2
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/audit"
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/Temporal/refunds"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/google/uuid"
+)
+
+func Test_API_Routes_Refund(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	number := time.Now().UnixNano()
+	payment, err := models.NewPaymentManager(db).NewPayment(
+		number, "0xdeposit", "0x"+uuid.New().String(), 10, 0.05, "ethereum", "eth", "testuser",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(payment)
+	if err := db.Model(payment).Update("confirmed", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Where("payment = ?", strconv.FormatInt(number, 10)).Delete(&refunds.Request{})
+
+	tests := []struct {
+		name       string
+		path       string
+		form       map[string]string
+		wantStatus int
+	}{
+		{"StripeUnknownPayment", "/v2/payments/refunds/stripe", map[string]string{
+			"payment_intent_id": "pi_" + uuid.New().String(), "amount": "1",
+		}, 400},
+		{"CryptoMissingAddress", "/v2/payments/refunds/crypto", map[string]string{
+			"payment_number": strconv.FormatInt(number, 10), "amount": "1",
+		}, 400},
+		{"CryptoTooMuch", "/v2/payments/refunds/crypto", map[string]string{
+			"payment_number": strconv.FormatInt(number, 10), "address": "0xabc", "amount": "11",
+		}, 400},
+		{"Crypto", "/v2/payments/refunds/crypto", map[string]string{
+			"payment_number": strconv.FormatInt(number, 10), "address": "0xabc", "amount": "1",
+		}, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urlValues := url.Values{}
+			for k, v := range tt.form {
+				urlValues.Add(k, v)
+			}
+			if err := sendRequest(
+				api, "POST", tt.path, tt.wantStatus, nil, urlValues, nil,
+			); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// list refunds
+	// /v2/payments/refunds
+	if err := sendRequest(
+		api, "GET", "/v2/payments/refunds", 200, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	// list refunds awaiting review
+	// /v2/admin/refunds
+	if err := sendRequest(
+		api, "GET", "/v2/admin/refunds", 200, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	var req refunds.Request
+	if err := db.Where("payment = ?", strconv.FormatInt(number, 10)).First(&req).Error; err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.FormatUint(uint64(req.ID), 10)
+	// deny refund
+	// /v2/admin/refunds/:id/deny
+	if err := sendRequest(
+		api, "POST", "/v2/admin/refunds/"+id+"/deny", 400, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendRequest(
+		api, "POST", "/v2/admin/refunds/"+id+"/deny", 200, nil, url.Values{"note": {"test"}}, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	// reviews are audited on the account of the user who requested the refund
+	var event audit.Event
+	if err := db.Where("action = ? AND target = ?", audit.RefundReview, "refund-"+id).
+		Order("id DESC").First(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+	if event.Account != req.UserName {
+		t.Fatalf("expected review to be audited on the account of %s, got %+v", req.UserName, event)
+	}
+	// denied refunds can not be paid
+	// /v2/admin/refunds/:id/paid
+	if err := sendRequest(
+		api, "POST", "/v2/admin/refunds/"+id+"/paid", 400, nil, url.Values{"tx_hash": {"0xhash"}}, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendRequest(
+		api, "POST", "/v2/admin/refunds/0/approve", 404, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -11,13 +11,14 @@ import (
 	"github.com/c2h5oh/datasize"
 
 	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
 	"github.com/RTradeLtd/Temporal/queue"
-	"github.com/RTradeLtd/Temporal/utils"
 	"github.com/RTradeLtd/crypto/v2"
 	"github.com/RTradeLtd/database/v2/models"
 	ipfsapi "github.com/RTradeLtd/go-ipfs-api"
 	"github.com/gin-gonic/gin"
 	gocid "github.com/ipfs/go-cid"
+	"github.com/jinzhu/gorm"
 	multihash "github.com/multiformats/go-multihash"
 )
 
@@ -34,15 +35,12 @@ func (api *API) pinHashLocally(c *gin.Context) {
 		Fail(c, err)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "hold_time")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req pinRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	// parse hold time
-	holdTimeInt, err := api.validateHoldTime(username, forms["hold_time"])
-	if err != nil {
+	// validate hold time
+	if err := api.validateHoldTime(username, req.HoldTime); err != nil {
 		Fail(c, err)
 		return
 	}
@@ -51,41 +49,27 @@ func (api *API) pinHashLocally(c *gin.Context) {
 	// upload content matching this hash before, and we don't want to charge them
 	// so we should abort further processing
 	if err == nil || upload != nil {
-		Respond(c, http.StatusBadRequest, gin.H{"response": alreadyUploadedMessage})
+		FailWithMessage(c, alreadyUploadedMessage, http.StatusBadRequest)
 		return
 	}
 	// determine cost of upload
-	cost, size, err := utils.CalculatePinCost(username, hash, holdTimeInt, api.ipfs, api.usage)
+	cost, size, err := api.pinCost(username, hash, req.HoldTime)
 	if err != nil {
 		api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
 		return
 	}
-	// validate, and deduct credits if they can upload
-	if err := api.validateUserCredits(username, cost); err != nil {
-		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
-		return
-	}
-	// update their data usage
-	if err := api.usage.UpdateDataUsage(username, uint64(size)); err != nil {
-		api.LogError(c, err, eh.CantUploadError)(http.StatusBadRequest)
-		api.refundUserCredits(username, "pin", cost)
-		return
-	}
 	// construct pin message
 	qp := queue.IPFSClusterPin{
 		CID:              hash,
 		NetworkName:      "public",
 		UserName:         username,
-		HoldTimeInMonths: holdTimeInt,
+		HoldTimeInMonths: req.HoldTime,
 		Size:             size,
 		CreditCost:       cost,
-		FileName:         c.PostForm("file_name"),
+		FileName:         req.FileName,
 	}
-	// sent pin message
-	if err = api.queues.cluster.PublishMessage(qp); err != nil {
-		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
-		api.refundUserCredits(username, "pin", cost)
-		api.usage.ReduceDataUsage(username, uint64(size))
+	// charge the user and queue the pin message
+	if !api.chargeAndEnqueue(c, username, cost, uint64(size), ledger.Meta{CallType: "pin", CID: hash}, queue.IpfsClusterPinQueue, qp) {
 		return
 	}
 	// log success and return
@@ -100,33 +84,26 @@ func (api *API) addFile(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "hold_time")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	// fetch the file, and create a handler to interact with it
+	var req addFileRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	// parse hold time
-	holdTimeInMonthsInt, err := api.validateHoldTime(username, forms["hold_time"])
-	if err != nil {
+	// validate hold time
+	if err := api.validateHoldTime(username, req.HoldTime); err != nil {
 		Fail(c, err)
 		return
 	}
 	var defaultHash = "sha2-256"
-	hashType := c.PostForm("hash_type")
+	hashType := req.HashType
 	if hashType == "" {
 		hashType = defaultHash
 	}
 	if _, ok := multihash.Names[hashType]; !ok {
-		Fail(c, errors.New("invalid multihash type given in post form hash_type"))
-		return
-	}
-	// fetch the file, and create a handler to interact with it
-	fileHandler, err := c.FormFile("file")
-	if err != nil {
-		Fail(c, err)
+		FailWithInvalidField(c, "hash_type", "is not a valid multihash type")
 		return
 	}
+	fileHandler := req.File
 	fileName := fileHandler.Filename
 	// validate the size of upload is within limits
 	if err := api.FileSizeCheck(fileHandler.Size); err != nil {
@@ -164,25 +141,14 @@ func (api *API) addFile(c *gin.Context) {
 	fileSizeInGB := uint64(fileHandler.Size) / datasize.GB.Bytes()
 	api.l.Debug("user", username, "file_size_in_gb", fileSizeInGB)
 	// calculate code of upload
-	cost, err := utils.CalculateFileCost(username, holdTimeInMonthsInt, fileHandler.Size, api.usage)
+	cost, err := api.fileCost(username, req.HoldTime, fileHandler.Size)
 	if err != nil {
 		api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
 		return
 	}
-	// validate they have enough credits to pay for the upload
-	if err = api.validateUserCredits(username, cost); err != nil {
-		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
-		return
-	}
-	// update their data usage
-	if err := api.usage.UpdateDataUsage(username, uint64(fileHandler.Size)); err != nil {
-		api.LogError(c, err, eh.CantUploadError)(http.StatusBadRequest)
-		api.refundUserCredits(username, "file", cost)
-		return
-	}
 	var reader io.Reader
 	// encrypt file is passphrase is given
-	if c.PostForm("passphrase") != "" {
+	if req.Passphrase != "" {
 		userUsage, err := api.usage.FindByUserName(username)
 		if err != nil {
 			api.LogError(c, err, eh.UserSearchError)(http.StatusBadRequest)
@@ -196,22 +162,17 @@ func (api *API) addFile(c *gin.Context) {
 			maxSize := megabytesUint * 275
 			if fileHandler.Size > int64(maxSize) {
 				Fail(c, errors.New("free accounts are limited to a max file size of 275MB when using on-demand encryption"))
-				api.refundUserCredits(username, "file", cost)
-				api.usage.ReduceDataUsage(username, uint64(fileHandler.Size))
 				return
 			}
 		}
 		// html decode strings
-		decodedPassPhrase := html.UnescapeString(c.PostForm("passphrase"))
+		decodedPassPhrase := html.UnescapeString(req.Passphrase)
 		encrypted, err := crypto.NewEncryptManager(decodedPassPhrase).Encrypt(bytes.NewReader(fileBytes))
 		if err != nil {
 			api.LogError(c, err, eh.EncryptionError)(http.StatusBadRequest)
-			api.refundUserCredits(username, "file", cost)
-			api.usage.ReduceDataUsage(username, uint64(fileHandler.Size))
 			return
 		}
 		reader = bytes.NewReader(encrypted)
-		// generate an encryption manager and encrypt
 	} else {
 		reader = bytes.NewReader(fileBytes)
 	}
@@ -219,31 +180,29 @@ func (api *API) addFile(c *gin.Context) {
 	resp, err := api.ipfs.Add(reader, ipfsapi.Hash(hashType))
 	if err != nil {
 		api.LogError(c, err, eh.IPFSAddError)(http.StatusBadRequest)
-		api.refundUserCredits(username, "file", cost)
-		api.usage.ReduceDataUsage(username, uint64(fileHandler.Size))
 		return
 	}
-	// if this was an encrypted upload we need to update the encrypted upload table
-	// ipfs cluster pin handles updating the regular uploads table
-	if c.PostForm("passphrase") != "" {
-		if _, err := api.ue.NewUpload(username, fileHandler.Filename, "public", resp); err != nil {
-			api.LogError(c, err, eh.DatabaseUpdateError)(http.StatusBadRequest)
-			// dont refund here as the data is already available on ipfs
-			return
-		}
-	}
 	api.l.Debug("file uploaded to ipfs")
 	qp := queue.IPFSClusterPin{
 		CID:              resp,
 		NetworkName:      "public",
 		UserName:         username,
-		HoldTimeInMonths: holdTimeInMonthsInt,
+		HoldTimeInMonths: req.HoldTime,
 		FileName:         fileName,
 		Size:             fileHandler.Size,
 	}
-	// send message to rabbitmq
-	if err = api.queues.cluster.PublishMessage(qp); err != nil {
-		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
+	// if this was an encrypted upload we need to update the encrypted upload table
+	// ipfs cluster pin handles updating the regular uploads table
+	var record func(tx *gorm.DB) error
+	if req.Passphrase != "" {
+		record = func(tx *gorm.DB) error {
+			_, err := models.NewEncryptedUploadManager(tx).NewUpload(username, fileHandler.Filename, "public", resp)
+			return err
+		}
+	}
+	// charge for the upload, and send the cluster pin through the outbox
+	if err := api.charge(c, username, cost, uint64(fileHandler.Size), ledger.Meta{CallType: "file", CID: resp}, queue.IpfsClusterPinQueue, qp, record); err != nil {
+		api.LogError(c, err.err, err.message)(err.status)
 		return
 	}
 	// log and return
@@ -260,10 +219,8 @@ func (api *API) ipfsPubSubPublish(c *gin.Context) {
 	}
 	// topic is the topic which the pubsub message will be addressed to
 	topic := c.Param("topic")
-	// extract post form
-	forms, missingField := api.extractPostForms(c, "message")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req pubSubRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// validate they can submit pubsub message calls
@@ -272,7 +229,7 @@ func (api *API) ipfsPubSubPublish(c *gin.Context) {
 		return
 	}
 	// publish the actual message
-	if err = api.ipfs.PubSubPublish(topic, forms["message"]); err != nil {
+	if err = api.ipfs.PubSubPublish(topic, req.Message); err != nil {
 		api.LogError(c, err, eh.IPFSPubSubPublishError)(http.StatusBadRequest)
 		return
 	}
@@ -283,7 +240,7 @@ func (api *API) ipfsPubSubPublish(c *gin.Context) {
 	}
 	// log and return
 	api.l.Infow("ipfs pub sub message published", "user", username)
-	Respond(c, http.StatusOK, gin.H{"response": gin.H{"topic": topic, "message": forms["message"]}})
+	Respond(c, http.StatusOK, gin.H{"response": gin.H{"topic": topic, "message": req.Message}})
 }
 
 // GetObjectStatForIpfs is used to get the object stats for the particular cid
@@ -346,15 +303,12 @@ func (api *API) extendPin(c *gin.Context) {
 		Fail(c, err)
 		return
 	}
-	// extract needed post forms
-	forms, missingField := api.extractPostForms(c, "hold_time")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req holdTimeRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// validate the hold time
-	holdTimeInt, err := api.validateHoldTime(username, forms["hold_time"])
-	if err != nil {
+	if err := api.validateHoldTime(username, req.HoldTime); err != nil {
 		Fail(c, err)
 		return
 	}
@@ -370,23 +324,23 @@ func (api *API) extendPin(c *gin.Context) {
 		return
 	}
 	// ensure even with pin time extension, it wont breach two year limit
-	if err := api.ensureLEMaxPinTime(upload, holdTimeInt, usg.Tier); err != nil {
+	if err := api.ensureLEMaxPinTime(upload, req.HoldTime, usg.Tier); err != nil {
 		Fail(c, err)
 		return
 	}
 	// calculate cost of hold time extension
-	cost, _, err := utils.CalculatePinCost(username, hash, holdTimeInt, api.ipfs, api.usage)
+	cost, _, err := api.pinCost(username, hash, req.HoldTime)
 	if err != nil {
 		api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
 		return
 	}
 	// validate they have enough credits
-	if err := api.validateUserCredits(username, cost); err != nil {
+	if err := api.validateUserCredits(username, "pin", cost); err != nil {
 		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
 		return
 	}
 	// extend garbage collection period
-	if err := api.upm.ExtendGarbageCollectionPeriod(username, hash, "public", int(holdTimeInt)); err != nil {
+	if err := api.upm.ExtendGarbageCollectionPeriod(username, hash, "public", int(req.HoldTime)); err != nil {
 		api.LogError(c, err, eh.PinExtendError)(http.StatusBadRequest)
 		api.refundUserCredits(username, "pin", cost)
 		return
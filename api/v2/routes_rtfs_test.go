@@ -59,14 +59,14 @@ func Test_API_Routes_IPFS_Public(t *testing.T) {
 	if _, err = io.Copy(fileWriter, fh); err != nil {
 		t.Fatal(err)
 	}
+	if err := bodyWriter.WriteField("hold_time", "5"); err != nil {
+		t.Fatal(err)
+	}
 	bodyWriter.Close()
 	testRecorder := httptest.NewRecorder()
 	req := httptest.NewRequest("POST", "/v2/ipfs/public/file/add", bodyBuf)
 	req.Header.Add("Authorization", authHeader)
 	req.Header.Add("Content-Type", bodyWriter.FormDataContentType())
-	urlValues := url.Values{}
-	urlValues.Add("hold_time", "5")
-	req.PostForm = urlValues
 	api.r.ServeHTTP(testRecorder, req)
 	if testRecorder.Code != 200 {
 		t.Fatal("bad http status code recovered from /v2/ipfs/public/file/add")
@@ -99,7 +99,7 @@ func Test_API_Routes_IPFS_Public(t *testing.T) {
 	// test pinning - success
 	// /v2/ipfs/public/pin
 	apiResp = apiResponse{}
-	urlValues = url.Values{}
+	urlValues := url.Values{}
 	urlValues.Add("hold_time", "5")
 	if err := sendRequest(
 		api, "POST", "/v2/ipfs/public/pin/"+testPIN2, 200, nil, urlValues, &apiResp,
@@ -241,7 +241,7 @@ func Test_API_Routes_IPFS_Public(t *testing.T) {
 	urlValues.Add("content_hash", hash)
 	urlValues.Add("passphrase", "password123")
 	if err := sendRequest(
-		api, "POST", "/v2/ipfs/utils/laser/beam", 200, nil, urlValues, nil,
+		api, "POST", "/v2/ipfs/utils/laser/beam", 202, nil, urlValues, nil,
 	); err != nil {
 		t.Fatal(err)
 	}
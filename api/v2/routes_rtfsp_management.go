@@ -24,28 +24,20 @@ func (api *API) createIPFSNetwork(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract network name
-	networkName, exists := c.GetPostForm("network_name")
-	if !exists {
-		FailWithMissingField(c, "network_name")
+	// extract network name, and the optional parameters
+	var req createNetworkRequest
+	if !api.bind(c, &req) {
 		return
 	}
+	networkName := req.NetworkName
 	switch strings.ToLower(networkName) {
 	case "public", "etherswarm":
 		Fail(c, errors.New("networok name cant be public, PUBLIC, etherswarm, or ETHERSWARM"))
 		return
 	}
-	// retrieve parameters - thse are all optional
-	swarmKey, _ := c.GetPostForm("swarm_key")
-	bPeers, _ := c.GetPostFormArray("bootstrap_peers")
-	users := c.PostFormArray("users")
-	if users == nil {
-		users = []string{username}
-	} else {
-		users = append(users, username)
-	}
+	users := append(req.Users, username)
 	// create the network in our database
-	network, err := api.nm.CreateHostedPrivateNetwork(networkName, swarmKey, bPeers, models.NetworkAccessOptions{Users: users, Owner: username})
+	network, err := api.nm.CreateHostedPrivateNetwork(networkName, req.SwarmKey, req.BootstrapPeers, models.NetworkAccessOptions{Users: users, Owner: username})
 	if err != nil {
 		api.LogError(c, err, eh.NetworkCreationError)(http.StatusBadRequest)
 		return
@@ -97,11 +89,11 @@ func (api *API) startIPFSPrivateNetwork(c *gin.Context) {
 		return
 	}
 	// get network name
-	networkName, exists := c.GetPostForm("network_name")
-	if !exists {
-		FailWithMissingField(c, "network_name")
+	var req networkRequest
+	if !api.bind(c, &req) {
 		return
 	}
+	networkName := req.NetworkName
 	logger := api.l.With("user", username, "network_name", networkName)
 	logger.Info("private ipfs network start requested")
 	if err := api.isNetworkOwner(networkName, username); err != nil {
@@ -134,11 +126,11 @@ func (api *API) stopIPFSPrivateNetwork(c *gin.Context) {
 		return
 	}
 	// get network name
-	networkName, exists := c.GetPostForm("network_name")
-	if !exists {
-		FailWithMissingField(c, "network_name")
+	var req networkRequest
+	if !api.bind(c, &req) {
 		return
 	}
+	networkName := req.NetworkName
 	logger := api.l.With("user", username, "network_name", networkName)
 	logger.Info("private ipfs network shutdown requested")
 	// verify admin access to network
@@ -173,11 +165,11 @@ func (api *API) removeIPFSPrivateNetwork(c *gin.Context) {
 		return
 	}
 	// get the network name
-	networkName, exists := c.GetPostForm("network_name")
-	if !exists {
-		FailWithMissingField(c, "network_name")
+	var req networkRequest
+	if !api.bind(c, &req) {
 		return
 	}
+	networkName := req.NetworkName
 	logger := api.l.With("user", username, "network_name", networkName)
 	logger.Info("private ipfs network shutdown requested")
 	// verify admin access to network
@@ -260,7 +252,11 @@ func (api *API) getIPFSPrivateNetworkByName(c *gin.Context) {
 	}
 	// retrieve additional stats if requested
 	// otherwise send generic information from the database directly
-	if c.Param("stats") == "true" {
+	var query networkStatsQuery
+	if !api.bindQuery(c, &query) {
+		return
+	}
+	if query.Stats {
 		logger.Info("retrieving additional stats from orchestrator")
 		stats, err := api.orch.NetworkStats(c, &nexus.NetworkRequest{Network: netName})
 		if err != nil {
@@ -315,16 +311,11 @@ func (api *API) addUsersToNetwork(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	networkName, exists := c.GetPostForm("network_name")
-	if !exists {
-		FailWithMissingField(c, "network_name")
-		return
-	}
-	users, exists := c.GetPostFormArray("users")
-	if !exists {
-		FailWithMissingField(c, "users")
+	var req networkUsersRequest
+	if !api.bind(c, &req) {
 		return
 	}
+	networkName, users := req.NetworkName, req.Users
 	network, err := api.nm.GetNetworkByName(networkName)
 	if err != nil {
 		api.LogError(c, err, eh.NetworkSearchError)(http.StatusInternalServerError)
@@ -369,16 +360,11 @@ func (api *API) removeUsersFromNetwork(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	networkName, exists := c.GetPostForm("network_name")
-	if !exists {
-		FailWithMissingField(c, "network_name")
-		return
-	}
-	users, exists := c.GetPostFormArray("users")
-	if !exists {
-		FailWithMissingField(c, "users")
+	var req networkUsersRequest
+	if !api.bind(c, &req) {
 		return
 	}
+	networkName, users := req.NetworkName, req.Users
 	network, err := api.nm.GetNetworkByName(networkName)
 	if err != nil {
 		api.LogError(c, err, eh.NetworkSearchError)(http.StatusInternalServerError)
@@ -427,16 +413,11 @@ func (api *API) addOwnersToNetwork(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	networkName, exists := c.GetPostForm("network_name")
-	if !exists {
-		FailWithMissingField(c, "network_name")
-		return
-	}
-	owners, exists := c.GetPostFormArray("owners")
-	if !exists {
-		FailWithMissingField(c, "owners")
+	var req networkOwnersRequest
+	if !api.bind(c, &req) {
 		return
 	}
+	networkName, owners := req.NetworkName, req.Owners
 	if err := api.isNetworkOwner(networkName, username); err != nil {
 		api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusUnauthorized)
 		return
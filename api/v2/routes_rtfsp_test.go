@@ -233,15 +233,17 @@ func Test_API_Routes_IPFS_Private(t *testing.T) {
 	if _, err = io.Copy(fileWriter, fh); err != nil {
 		t.Fatal(err)
 	}
+	if err := bodyWriter.WriteField("hold_time", "5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bodyWriter.WriteField("network_name", "abc123"); err != nil {
+		t.Fatal(err)
+	}
 	bodyWriter.Close()
 	testRecorder := httptest.NewRecorder()
 	req := httptest.NewRequest("POST", "/v2/ipfs/private/file/add", bodyBuf)
 	req.Header.Add("Authorization", authHeader)
 	req.Header.Add("Content-Type", bodyWriter.FormDataContentType())
-	urlValues = url.Values{}
-	urlValues.Add("hold_time", "5")
-	urlValues.Add("network_name", "abc123")
-	req.PostForm = urlValues
 	api.r.ServeHTTP(testRecorder, req)
 	if testRecorder.Code != 200 {
 		t.Fatal("bad http status code recovered from /v2/ipfs/private/file/add")
@@ -382,7 +384,7 @@ func Test_API_Routes_IPFS_Private(t *testing.T) {
 	urlValues.Add("content_hash", hash)
 	urlValues.Add("passphrase", "password123")
 	if err := sendRequest(
-		api, "POST", "/v2/ipfs/utils/laser/beam", 200, nil, urlValues, nil,
+		api, "POST", "/v2/ipfs/utils/laser/beam", 202, nil, urlValues, nil,
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -395,7 +397,7 @@ func Test_API_Routes_IPFS_Private(t *testing.T) {
 	urlValues.Add("content_hash", hash)
 	urlValues.Add("passphrase", "password123")
 	if err := sendRequest(
-		api, "POST", "/v2/ipfs/utils/laser/beam", 200, nil, urlValues, nil,
+		api, "POST", "/v2/ipfs/utils/laser/beam", 202, nil, urlValues, nil,
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -408,7 +410,7 @@ func Test_API_Routes_IPFS_Private(t *testing.T) {
 	urlValues.Add("content_hash", hash)
 	urlValues.Add("passphrase", "password123")
 	if err := sendRequest(
-		api, "POST", "/v2/ipfs/utils/laser/beam", 200, nil, urlValues, nil,
+		api, "POST", "/v2/ipfs/utils/laser/beam", 202, nil, urlValues, nil,
 	); err != nil {
 		t.Fatal(err)
 	}
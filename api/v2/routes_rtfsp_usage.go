@@ -39,40 +39,37 @@ func (api *API) pinToHostedIPFSNetwork(c *gin.Context) {
 		Fail(c, err)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "network_name", "hold_time")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req privatePinRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// ensure user has access to network
-	if err = CheckAccessForPrivateNetwork(username, forms["network_name"], api.dbm.DB); err != nil {
+	if err = CheckAccessForPrivateNetwork(username, req.NetworkName, api.dbm.DB); err != nil {
 		api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusBadRequest)
 		return
 	}
-	// parse hold time
-	holdTimeInt, err := api.validateHoldTime(username, forms["hold_time"])
-	if err != nil {
+	// validate hold time
+	if err := api.validateHoldTime(username, req.HoldTime); err != nil {
 		Fail(c, err)
 		return
 	}
-	upload, err := api.upm.FindUploadByHashAndUserAndNetwork(username, hash, forms["network_name"])
+	upload, err := api.upm.FindUploadByHashAndUserAndNetwork(username, hash, req.NetworkName)
 	if err == nil || upload != nil {
-		Respond(c, http.StatusBadRequest, gin.H{"response": alreadyUploadedMessage})
+		FailWithMessage(c, alreadyUploadedMessage, http.StatusBadRequest)
 		return
 	}
 	// create pin message
 	ip := queue.IPFSPin{
 		CID:              hash,
-		NetworkName:      forms["network_name"],
+		NetworkName:      req.NetworkName,
 		UserName:         username,
-		HoldTimeInMonths: holdTimeInt,
+		HoldTimeInMonths: req.HoldTime,
 		CreditCost:       0,
 		JWT:              GetAuthToken(c),
-		FileName:         c.PostForm("file_name"),
+		FileName:         req.FileName,
 	}
 	// send message for processing
-	if err = api.queues.pin.PublishMessage(ip); err != nil {
+	if err = api.publish(c, api.queues.pin, ip); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -92,31 +89,23 @@ func (api *API) addFileToHostedIPFSNetwork(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "network_name", "hold_time")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	// fetch the file, and create a handler to interact with it
+	var req privateAddFileRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// verify user has access to private network
-	if err := CheckAccessForPrivateNetwork(username, forms["network_name"], api.dbm.DB); err != nil {
+	if err := CheckAccessForPrivateNetwork(username, req.NetworkName, api.dbm.DB); err != nil {
 		api.LogError(c, err, eh.PrivateNetworkAccessError)
 		Fail(c, err)
 		return
 	}
-	// parse hold time
-	holdTimeInt, err := api.validateHoldTime(username, forms["hold_time"])
-	if err != nil {
-		Fail(c, err)
-		return
-	}
-	// fetch the file, and create a handler to interact with it
-	fileHandler, err := c.FormFile("file")
-	if err != nil {
-		// user error, do not log
+	// validate hold time
+	if err := api.validateHoldTime(username, req.HoldTime); err != nil {
 		Fail(c, err)
 		return
 	}
+	fileHandler := req.File
 	fileName := fileHandler.Filename
 	// validate file size
 	if err := api.FileSizeCheck(fileHandler.Size); err != nil {
@@ -139,16 +128,16 @@ func (api *API) addFileToHostedIPFSNetwork(c *gin.Context) {
 		api.LogError(c, err, eh.IPFSAddError)(http.StatusInternalServerError)
 		return
 	}
-	upload, err := api.upm.FindUploadByHashAndUserAndNetwork(username, hash, forms["network_name"])
+	upload, err := api.upm.FindUploadByHashAndUserAndNetwork(username, hash, req.NetworkName)
 	if err == nil || upload != nil {
 		Respond(c, http.StatusOK, gin.H{"response": hash, "notice": alreadyUploadedMessage})
 		return
 	}
 	var reader io.Reader
 	// encrypt file if passphrase is given
-	if c.PostForm("passphrase") != "" {
+	if req.Passphrase != "" {
 		// html decode strings
-		decodedPassPhrase := html.UnescapeString(c.PostForm("passphrase"))
+		decodedPassPhrase := html.UnescapeString(req.Passphrase)
 		encrypted, err := crypto.NewEncryptManager(decodedPassPhrase).Encrypt(file)
 		if err != nil {
 			api.LogError(c, err, eh.EncryptionError)(http.StatusBadRequest)
@@ -159,7 +148,7 @@ func (api *API) addFileToHostedIPFSNetwork(c *gin.Context) {
 		reader = bytes.NewReader(fileBytes)
 	}
 	// format a url to connect to for private network
-	apiURL := api.GetIPFSEndpoint(forms["network_name"])
+	apiURL := api.GetIPFSEndpoint(req.NetworkName)
 	// connect to private ifps network
 	ipfsManager, err := rtfs.NewManager(apiURL, GetAuthToken(c), time.Minute*60)
 	if err != nil {
@@ -174,7 +163,7 @@ func (api *API) addFileToHostedIPFSNetwork(c *gin.Context) {
 	}
 	// if this was an encrypted upload we need to update the encrypted upload table
 	// ipfs cluster pin handles updating the regular uploads table
-	if c.PostForm("passphrase") != "" {
+	if req.Passphrase != "" {
 		if _, err := api.ue.NewUpload(username, fileHandler.Filename, "public", resp); err != nil {
 			api.LogError(c, err, eh.DatabaseUpdateError)(http.StatusBadRequest)
 			return
@@ -183,7 +172,7 @@ func (api *API) addFileToHostedIPFSNetwork(c *gin.Context) {
 	upload, err = api.upm.FindUploadByHashAndUserAndNetwork(
 		username,
 		resp,
-		forms["network_name"],
+		req.NetworkName,
 	)
 	if err != nil && err != gorm.ErrRecordNotFound {
 		api.LogError(c, err, eh.UploadSearchError)(http.StatusBadRequest)
@@ -191,14 +180,14 @@ func (api *API) addFileToHostedIPFSNetwork(c *gin.Context) {
 	}
 	if upload == nil {
 		_, err = api.upm.NewUpload(resp, "file", models.UploadOptions{
-			NetworkName:      forms["network_name"],
+			NetworkName:      req.NetworkName,
 			Username:         username,
-			HoldTimeInMonths: holdTimeInt,
+			HoldTimeInMonths: req.HoldTime,
 			FileName:         fileName,
 			Size:             fileHandler.Size,
 		})
 	} else {
-		_, err = api.upm.UpdateUpload(holdTimeInt, username, resp, forms["network_name"])
+		_, err = api.upm.UpdateUpload(req.HoldTime, username, resp, req.NetworkName)
 	}
 	if err != nil {
 		api.LogError(c, err, eh.DatabaseUpdateError)(http.StatusBadRequest)
@@ -222,19 +211,17 @@ func (api *API) ipfsPubSubPublishToHostedIPFSNetwork(c *gin.Context) {
 	}
 	// get the topic to publish a message too
 	topic := c.Param("topic")
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "network_name", "message")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
+	var req privatePubSubRequest
+	if !api.bind(c, &req) {
 		return
 	}
 	// validate access to private network
-	if err := CheckAccessForPrivateNetwork(username, forms["network_name"], api.dbm.DB); err != nil {
+	if err := CheckAccessForPrivateNetwork(username, req.NetworkName, api.dbm.DB); err != nil {
 		api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusBadRequest)
 		return
 	}
 	// format a url to connect too
-	apiURL := api.GetIPFSEndpoint(forms["network_name"])
+	apiURL := api.GetIPFSEndpoint(req.NetworkName)
 	// connect to private ipfs network
 	manager, err := rtfs.NewManager(apiURL, GetAuthToken(c), time.Minute*60)
 	if err != nil {
@@ -242,13 +229,13 @@ func (api *API) ipfsPubSubPublishToHostedIPFSNetwork(c *gin.Context) {
 		return
 	}
 	// publish the actual message
-	if err = manager.PubSubPublish(topic, forms["message"]); err != nil {
+	if err = manager.PubSubPublish(topic, req.Message); err != nil {
 		api.LogError(c, err, eh.IPFSPubSubPublishError)(http.StatusBadRequest)
 		return
 	}
 	// log and return
 	api.l.Infow("private ipfs pub sub message published", "user", username)
-	Respond(c, http.StatusOK, gin.H{"response": gin.H{"topic": topic, "message": forms["message"]}})
+	Respond(c, http.StatusOK, gin.H{"response": gin.H{"topic": topic, "message": req.Message}})
 }
 
 // GetObjectStatForIpfsForHostedIPFSNetwork is  used to get object stats from a private ipfs network
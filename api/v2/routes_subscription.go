@@ -0,0 +1,130 @@
+package v2
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/subscription"
+	"github.com/gin-gonic/gin"
+)
+
+// getSubscriptionPlans is used to list the plans available for subscription
+func (api *API) getSubscriptionPlans(c *gin.Context) {
+	plans, err := api.subscriptions.Plans()
+	if err != nil {
+		api.LogError(c, err, eh.SubscriptionSearchError)(http.StatusBadRequest)
+		return
+	}
+	Respond(c, http.StatusOK, gin.H{"response": plans})
+}
+
+// getSubscription is used to retrieve the subscription of the authenticated user
+func (api *API) getSubscription(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	sub, err := api.subscriptions.Find(username)
+	if err != nil {
+		api.LogError(c, err, eh.SubscriptionSearchError)(http.StatusBadRequest)
+		return
+	}
+	Respond(c, http.StatusOK, gin.H{"response": sub})
+}
+
+// subscribe is used to subscribe the authenticated user to a plan
+func (api *API) subscribe(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	var req planRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	sub, err := api.subscriptions.Subscribe(username, req.Plan)
+	if err != nil {
+		api.failSubscription(c, err)
+		return
+	}
+	Respond(c, http.StatusOK, gin.H{"response": sub})
+}
+
+// changeSubscriptionPlan is used to move the authenticated user to a different
+// plan, charging or crediting them the prorated difference
+func (api *API) changeSubscriptionPlan(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	var req planRequest
+	if !api.bind(c, &req) {
+		return
+	}
+	sub, err := api.subscriptions.ChangePlan(username, req.Plan)
+	if err != nil {
+		api.failSubscription(c, err)
+		return
+	}
+	Respond(c, http.StatusOK, gin.H{"response": sub})
+}
+
+// cancelSubscription is used to stop the subscription of the authenticated
+// user from renewing at the end of its current period
+func (api *API) cancelSubscription(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	if err := api.subscriptions.Cancel(username); err != nil {
+		api.failSubscription(c, err)
+		return
+	}
+	Respond(c, http.StatusOK, gin.H{"response": "subscription will end at the end of the current period"})
+}
+
+// setupStripePaymentMethod is used to save a card for subscription renewals
+func (api *API) setupStripePaymentMethod(c *gin.Context) {
+	username, err := GetAuthenticatedUserFromContext(c)
+	if err != nil {
+		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
+		return
+	}
+	user, err := api.um.FindByUserName(username)
+	if err != nil {
+		api.LogError(c, err, eh.UserSearchError)(http.StatusBadRequest)
+		return
+	}
+	si, err := api.billing.SetupPaymentMethod(username, user.EmailAddress)
+	if err != nil {
+		api.LogError(c, err, eh.PaymentCreationError)(http.StatusBadRequest)
+		return
+	}
+	Respond(c, http.StatusOK, gin.H{"response": gin.H{
+		"setup_intent":    si.ID,
+		"client_secret":   si.ClientSecret,
+		"publishable_key": api.cfg.Stripe.PublishableKey,
+	}})
+}
+
+// failSubscription responds with the given subscription error
+func (api *API) failSubscription(c *gin.Context, err error) {
+	switch err {
+	case ledger.ErrInsufficientCredits:
+		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
+	case subscription.ErrNotSubscribed,
+		subscription.ErrAlreadySubscribed,
+		subscription.ErrSamePlan,
+		subscription.ErrPastDue,
+		subscription.ErrQuotaExceeded,
+		subscription.ErrPlanNotFound:
+		Fail(c, err)
+	default:
+		api.LogError(c, err, eh.SubscriptionUpdateError)(http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,141 @@
+package v2
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/Temporal/subscription"
+	"github.com/RTradeLtd/Temporal/utils"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/c2h5oh/datasize"
+	"github.com/google/uuid"
+)
+
+func Test_API_Routes_Subscription(t *testing.T) {
+	// load configuration
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup fake mock clients
+	fakeLens := &mocks.FakeLensV2Client{}
+	fakeOrch := &mocks.FakeServiceClient{}
+	fakeSigner := &mocks.FakeSignerClient{}
+	fakeWalletService := &mocks.FakeWalletServiceClient{}
+
+	api, err := setupAPI(t, fakeLens, fakeOrch, fakeSigner, fakeWalletService, cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err := api.usage.FindByUserName("testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// remove any existing subscription, restoring the tier afterwards
+	db.Unscoped().Where("user_name = ?", "testuser").Delete(&subscription.Subscription{})
+	defer func() {
+		db.Unscoped().Where("user_name = ?", "testuser").Delete(&subscription.Subscription{})
+		models.NewUsageManager(db).UpdateTier("testuser", usage.Tier)
+	}()
+	basic := &subscription.Plan{
+		Name:         "basic-" + uuid.New().String(),
+		MonthlyPrice: 1,
+		StorageBytes: datasize.TB.Bytes(),
+		IPNSRecords:  10,
+	}
+	pro := &subscription.Plan{
+		Name:         "pro-" + uuid.New().String(),
+		MonthlyPrice: 2,
+		StorageBytes: datasize.TB.Bytes() * 2,
+		IPNSRecords:  20,
+	}
+	for _, plan := range []*subscription.Plan{basic, pro} {
+		if err := api.subscriptions.CreatePlan(plan); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// list plans
+	// /v2/account/subscription/plans
+	var interfaceAPIResp interfaceAPIResponse
+	if err := sendRequest(
+		api, "GET", "/v2/account/subscription/plans", 200, nil, nil, &interfaceAPIResp,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// get subscription - not subscribed
+	// /v2/account/subscription
+	if err := sendRequest(
+		api, "GET", "/v2/account/subscription", 400, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		plan       string
+		wantStatus int
+	}{
+		{"Subscribe", "/v2/account/subscription/subscribe", basic.Name, 200},
+		{"SubscribeTwice", "/v2/account/subscription/subscribe", pro.Name, 400},
+		{"ChangeUnknownPlan", "/v2/account/subscription/change", "unknown-plan", 400},
+		{"Change", "/v2/account/subscription/change", pro.Name, 200},
+		{"ChangeSamePlan", "/v2/account/subscription/change", pro.Name, 400},
+		{"MissingPlan", "/v2/account/subscription/change", "", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urlValues := url.Values{}
+			if tt.plan != "" {
+				urlValues.Add("plan", tt.plan)
+			}
+			if err := sendRequest(
+				api, "POST", tt.path, tt.wantStatus, nil, urlValues, nil,
+			); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// subscribed users are not charged for storage within their paid period
+	hash := "QmS4ustL54uo8FzR9455qaxZwuMiUhyvMcX9Ba8nUH4uVv"
+	if cost, _, err := api.pinCost("testuser", hash, 1); err != nil {
+		t.Fatal(err)
+	} else if cost != 0 {
+		t.Fatalf("expected no charge for subscribed user, got %v", cost)
+	}
+	// but are charged for storage held beyond it
+	full, _, err := utils.CalculatePinCost("testuser", hash, 5, api.ipfs, api.usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost, _, err := api.pinCost("testuser", hash, 5); err != nil {
+		t.Fatal(err)
+	} else if cost != full*4/5 {
+		t.Fatalf("expected a charge of %v beyond the paid period, got %v", full*4/5, cost)
+	}
+
+	// cancel subscription
+	// /v2/account/subscription/cancel
+	if err := sendRequest(
+		api, "POST", "/v2/account/subscription/cancel", 200, nil, nil, nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := api.subscriptions.Find("testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sub.CancelAtPeriodEnd || sub.PlanID != pro.ID {
+		t.Fatalf("unexpected subscription %+v", sub)
+	}
+}
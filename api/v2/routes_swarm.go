@@ -6,7 +6,6 @@ import (
 	"net/http"
 
 	"github.com/RTradeLtd/Temporal/eh"
-	"github.com/RTradeLtd/Temporal/utils"
 	"github.com/RTradeLtd/database/v2/models"
 	"github.com/gin-gonic/gin"
 )
@@ -22,17 +21,15 @@ func (api *API) SwarmUpload(c *gin.Context) {
 		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
 		return
 	}
-	holdTime := c.PostForm("hold_time")
-	holdTimeInMonthsInt, err := api.validateHoldTime(username, holdTime)
-	if err != nil {
-		Fail(c, err)
+	var req swarmUploadRequest
+	if !api.bind(c, &req) {
 		return
 	}
-	fileHandler, err := c.FormFile("file")
-	if err != nil {
+	if err := api.validateHoldTime(username, req.HoldTime); err != nil {
 		Fail(c, err)
 		return
 	}
+	fileHandler := req.File
 	fileSize := fileHandler.Size
 	// ensure file size is within acceptable parameters
 	if err := api.FileSizeCheck(fileHandler.Size); err != nil {
@@ -40,13 +37,13 @@ func (api *API) SwarmUpload(c *gin.Context) {
 		return
 	}
 	// calculate the cost of the file
-	cost, err := utils.CalculateFileCost(username, holdTimeInMonthsInt, fileSize, api.usage)
+	cost, err := api.fileCost(username, req.HoldTime, fileSize)
 	if err != nil {
 		api.LogError(c, err, eh.CostCalculationError)(http.StatusBadRequest)
 		return
 	}
 	// validate they have enough credits to pay for the upload
-	if err = api.validateUserCredits(username, cost); err != nil {
+	if err = api.validateUserCredits(username, "file", cost); err != nil {
 		api.LogError(c, err, eh.InvalidBalanceError)(http.StatusPaymentRequired)
 		return
 	}
@@ -57,7 +54,6 @@ func (api *API) SwarmUpload(c *gin.Context) {
 		return
 	}
 	// now begin with the actual file uploading
-	isTar := c.PostForm("is_tar")
 	// open file handler
 	openFile, err := fileHandler.Open()
 	if err != nil {
@@ -75,7 +71,7 @@ func (api *API) SwarmUpload(c *gin.Context) {
 		return
 	}
 	// upload to both of our swarm nodes
-	swarmHash, err := api.swarmUpload(fileBytes, isTar == "true")
+	swarmHash, err := api.swarmUpload(fileBytes, req.IsTar)
 	if err != nil {
 		api.LogError(c, err, err.Error())
 		api.refundUserCredits(username, "file", cost)
@@ -86,7 +82,7 @@ func (api *API) SwarmUpload(c *gin.Context) {
 	if _, err := api.upm.NewUpload(swarmHash, "swarm-file", models.UploadOptions{
 		Username:         username,
 		NetworkName:      "etherswarm",
-		HoldTimeInMonths: holdTimeInMonthsInt,
+		HoldTimeInMonths: req.HoldTime,
 		Size:             fileSize,
 	}); err != nil {
 		Fail(c, err)
@@ -7,7 +7,6 @@ import (
 	"io/ioutil"
 	"mime/multipart"
 	"net/http/httptest"
-	"net/url"
 	"os"
 	"testing"
 
@@ -61,14 +60,14 @@ func Test_Routes_Swarm(t *testing.T) {
 	if _, err := io.Copy(fileWriter, fh); err != nil {
 		t.Fatal(err)
 	}
+	if err := bodyWriter.WriteField("hold_time", "5"); err != nil {
+		t.Fatal(err)
+	}
 	bodyWriter.Close()
 	testRecorder := httptest.NewRecorder()
 	req := httptest.NewRequest("POST", "/v2/swarm/upload", bodyBuf)
 	req.Header.Add("Authorization", authHeader)
 	req.Header.Add("Content-Type", bodyWriter.FormDataContentType())
-	urlValues := url.Values{}
-	urlValues.Add("hold_time", "5")
-	req.PostForm = urlValues
 	api.r.ServeHTTP(testRecorder, req)
 	if testRecorder.Code != 200 {
 		t.Fatal("bad http status code recovered from /v2/swarm/upload")
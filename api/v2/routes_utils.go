@@ -1,7 +1,6 @@
 package v2
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -11,12 +10,9 @@ import (
 
 	"github.com/RTradeLtd/Temporal/eh"
 	"github.com/RTradeLtd/Temporal/queue"
-	"github.com/RTradeLtd/crypto/v2"
-	"github.com/RTradeLtd/database/v2/models"
 	mnemonics "github.com/RTradeLtd/entropy-mnemonics"
 	pb "github.com/RTradeLtd/grpc/krab"
 	"github.com/RTradeLtd/rtfs/v2"
-	"github.com/RTradeLtd/rtfs/v2/beam"
 	"github.com/ezzarghili/recaptcha-go"
 	"github.com/gin-gonic/gin"
 	gocid "github.com/ipfs/go-cid"
@@ -36,86 +32,6 @@ func (api *API) SystemsCheck(c *gin.Context) {
 	})
 }
 
-// BeamContent is used to beam content from one network to another
-func (api *API) beamContent(c *gin.Context) {
-	username, err := GetAuthenticatedUserFromContext(c)
-	if err != nil {
-		api.LogError(c, err, eh.NoAPITokenError)(http.StatusBadRequest)
-		return
-	}
-	// extract post forms
-	forms, missingField := api.extractPostForms(c, "source_network", "destination_network", "content_hash")
-	if missingField != "" {
-		FailWithMissingField(c, missingField)
-		return
-	}
-	var (
-		source, dest string
-		net1Conn     *rtfs.IpfsManager
-	)
-	// validate the network to connect to
-	if forms["source_network"] == "public" {
-		source = api.cfg.IPFS.APIConnection.Host + ":" + api.cfg.IPFS.APIConnection.Port
-		net1Conn, err = rtfs.NewManager(source, "", time.Minute*60)
-	} else {
-		// if non public network, validate user has access
-		if err := CheckAccessForPrivateNetwork(username, forms["source_network"], api.dbm.DB); err != nil {
-			api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusBadRequest)
-			return
-		}
-		// format a url to connect to
-		source = api.GetIPFSEndpoint(forms["source_network"])
-		// connect to the actual network
-		net1Conn, err = rtfs.NewManager(source, GetAuthToken(c), time.Minute*60)
-	}
-	// ensure connection was successful
-	if err != nil {
-		api.LogError(c, err, eh.IPFSConnectionError)(http.StatusBadRequest)
-		return
-	}
-	// validate the network to connect to
-	if forms["destination_network"] == "public" {
-		dest = api.cfg.IPFS.APIConnection.Host + ":" + api.cfg.IPFS.APIConnection.Port
-	} else {
-		// non public network, validate user has access
-		if err := CheckAccessForPrivateNetwork(username, forms["destination_network"], api.dbm.DB); err != nil {
-			api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusBadRequest)
-			return
-		}
-		dest = api.GetIPFSEndpoint(forms["destination_network"])
-	}
-	// perform optional encryption of content
-	if passphrase := c.PostForm("passphrase"); passphrase != "" {
-		// encrypt the file file
-		data, err := net1Conn.Cat(forms["content_hash"])
-		if err != nil {
-			api.LogError(c, err, eh.IPFSCatError)(http.StatusBadRequest)
-			return
-		}
-		// re-add the encrypted content to the source network
-		newCid, err := net1Conn.Add(bytes.NewReader(data))
-		if err != nil {
-			api.LogError(c, err, eh.IPFSAddError)(http.StatusBadRequest)
-			return
-		}
-		// update the content hash to beam
-		forms["content_hash"] = newCid
-	}
-	// create our dual network connection
-	laserBeam, err := beam.NewLaser(source, dest, GetAuthToken(c))
-	if err != nil {
-		api.LogError(c, err, "failed to initialize laser beam")(http.StatusBadRequest)
-		return
-	}
-	// initiate the content transfer
-	if err := laserBeam.BeamFromSource(forms["content_hash"]); err != nil {
-		api.LogError(c, err, "failed to tranfer content")(http.StatusBadRequest)
-		return
-	}
-	// return
-	Respond(c, http.StatusOK, gin.H{"response": gin.H{"status": "content transferred", "content_hash": forms["content_hash"]}})
-}
-
 // ExportKey is used to export an ipfs key as a mnemonic phrase
 func (api *API) exportKey(c *gin.Context) {
 	username, err := GetAuthenticatedUserFromContext(c)
@@ -194,13 +110,16 @@ func (api *API) downloadContentHash(c *gin.Context) {
 		Fail(c, err)
 		return
 	}
+	var req downloadRequest
+	if !api.bind(c, &req) {
+		return
+	}
 	// get the network name, default to public if not specified
-	networkName := c.PostForm("network_name")
+	networkName := req.NetworkName
 	var manager rtfs.Manager
-	if networkName == "" {
-		networkName = "public"
+	if networkName == "" || networkName == "public" {
 		manager = api.ipfs
-	} else if networkName != "public" {
+	} else {
 		// validate user access to network
 		if err := CheckAccessForPrivateNetwork(username, networkName, api.dbm.DB); err != nil {
 			api.LogError(c, err, eh.PrivateNetworkAccessError)(http.StatusBadRequest)
@@ -216,76 +135,72 @@ func (api *API) downloadContentHash(c *gin.Context) {
 		}
 	}
 	// fetch the specified content type from the user
-	contentType := c.PostForm("content_type")
+	contentType := req.ContentType
 	// if not specified, provide a default
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
-
-	// get any extra headers the user might want
-	exHeaders := c.PostFormArray("extra_headers")
-
-	// read the contents of the file
-	contents, err := manager.Cat(contentHash)
-	if err != nil {
-		api.LogError(c, err, eh.IPFSCatError)(http.StatusBadRequest)
-		return
-	}
-	reader := bytes.NewReader(contents)
-	size := len(contents)
-	// decrypt Temporal-encrypted content if key is provided
-	decryptKey := c.PostForm("decrypt_key")
-	if decryptKey != "" {
-		decrypted, err := crypto.NewEncryptManager(decryptKey).Decrypt(reader)
-		if err != nil {
-			Fail(c, err)
-			return
-		}
-		size = len(decrypted)
-		reader = bytes.NewReader(decrypted)
+	// the decryption key may also be sent as a header, keeping it out of urls
+	decryptKey := req.DecryptKey
+	if decryptKey == "" {
+		decryptKey = c.GetHeader(decryptKeyHeader)
 	}
 
-	// parse extra headers if there are any
+	// parse extra headers if there are any, json requests send them as an object
 	extraHeaders := make(map[string]string)
+	for header, value := range req.Headers {
+		extraHeaders[header] = value
+	}
+	exHeaders := req.ExtraHeaders
 	// only process if there is actual data to process
 	if len(exHeaders) > 0 {
 		// the array must be of equal length, as a header has two parts
 		// the name of the header, and its value
 		if len(exHeaders)%2 != 0 {
-			FailWithMessage(c, "extra_headers post form is not even in length")
+			FailWithInvalidField(c, "extra_headers", "must contain pairs of header names and values")
 			return
 		}
 		// parse through the available headers
 		for i := 0; i < len(exHeaders); i += 2 {
-			if i+1 < len(exHeaders) {
-				header := exHeaders[i]
-				value := exHeaders[i+1]
-				extraHeaders[header] = value
-			}
+			extraHeaders[exHeaders[i]] = exHeaders[i+1]
 		}
 	}
+	extraHeaders["Content-Type"] = contentType
+
+	// the size of the file is needed to serve ranges of it
+	ipfsPath := "/ipfs/" + contentHash
+	stat, err := statIPFSPath(c.Request.Context(), manager, ipfsPath)
+	if err != nil {
+		api.LogError(c, err, eh.IPFSObjectStatError)(http.StatusBadRequest)
+		return
+	}
+	if stat.Type == "directory" {
+		api.LogError(c, errors.New("directories can not be downloaded"), eh.IPFSCatError)(http.StatusBadRequest)
+		return
+	}
 	api.l.Infow("ipfs content download served", "user", username)
-	c.DataFromReader(200, int64(size), contentType, reader, extraHeaders)
+	// stream the file, rather than reading all of it into memory
+	api.serveIPFSFile(c, manager, ipfsPath, stat, decryptKey, extraHeaders)
 }
 
-func (api *API) handleUserCreate(c *gin.Context, forms map[string]string, createErr error) {
+func (api *API) handleUserCreate(c *gin.Context, username, email, orgName string, createErr error) {
 	if createErr != nil {
-		switch createErr.Error() {
-		case eh.DuplicateEmailError:
+		switch eh.CodeOf(createErr) {
+		case eh.DuplicateEmail:
 			api.LogError(
 				c,
 				createErr,
 				eh.DuplicateEmailError,
 				"email",
-				forms["email_address"])(http.StatusBadRequest)
+				email)(http.StatusBadRequest)
 			return
-		case eh.DuplicateUserNameError:
+		case eh.DuplicateUserName:
 			api.LogError(
 				c,
 				createErr,
 				eh.DuplicateUserNameError,
 				"username",
-				forms["username"])(http.StatusBadRequest)
+				username)(http.StatusBadRequest)
 			return
 		default:
 			api.LogError(
@@ -296,35 +211,21 @@ func (api *API) handleUserCreate(c *gin.Context, forms map[string]string, create
 		}
 	}
 	// generate a random token to validate email
-	user, err := api.um.GenerateEmailVerificationToken(forms["username"])
+	user, err := api.um.GenerateEmailVerificationToken(username)
 	if err != nil {
 		api.LogError(c, err, eh.EmailTokenGenerationError)(http.StatusBadRequest)
 		return
 	}
-	// generate a jwt used to trigger email validation
-	token, err := api.generateEmailJWTToken(user.UserName, user.EmailVerificationToken)
+	// generate the url the user clicks to activate email
+	url, err := api.emailVerificationURL(user)
 	if err != nil {
-		api.LogError(c, err, "failed to generate email verification jwt")
+		api.LogError(c, err, "failed to generate email verification jwt")(http.StatusInternalServerError)
 		return
 	}
-	var url string
-	// format the url the user clicks to activate email
-	if dev {
-		url = fmt.Sprintf(
-			"https://dev.api.temporal.cloud/v2/account/email/verify/%s/%s",
-			user.UserName, token,
-		)
-	} else {
-		url = fmt.Sprintf(
-			"https://api.temporal.cloud/v2/account/email/verify/%s/%s",
-			user.UserName, token,
-		)
-
-	}
 	// format a link tag
 	link := fmt.Sprintf("<a href=\"%s\">link</a>", url)
 	emailSubject := fmt.Sprintf(
-		"%s Welcome To Temporal 🌌 Read This For Crucial Getting Started Tips", forms["organization_name"],
+		"%s Welcome To Temporal 🌌 Read This For Crucial Getting Started Tips", orgName,
 	)
 	// build email message
 	es := queue.EmailSend{
@@ -358,7 +259,7 @@ func (api *API) handleUserCreate(c *gin.Context, forms map[string]string, create
 		Emails:      []string{user.EmailAddress},
 	}
 	// send email message to queue for processing
-	if err = api.queues.email.PublishMessage(es); err != nil {
+	if err = api.publish(c, api.queues.email, es); err != nil {
 		api.LogError(c, err, eh.QueuePublishError)(http.StatusBadRequest)
 		return
 	}
@@ -381,23 +282,22 @@ func (api *API) handleUserCreate(c *gin.Context, forms map[string]string, create
 		)
 	}
 	// return
-	Respond(c, http.StatusOK, gin.H{"response": struct {
-		*models.User
-		Status string
-	}{
-		user, status,
-	},
-	})
+	Respond(c, http.StatusOK, gin.H{"response": registerResponse{user, status}})
 }
 
 func (api *API) verifyCaptcha(c *gin.Context) {
+	var req captchaRequest
+	if !api.bind(c, &req) {
+		return
+	}
 	err := api.captcha.VerifyWithOptions(
-		c.PostForm("g-recaptcha-response"),
+		req.Response,
 		// require a threshold of 0.8, default is 0.5
 		recaptcha.VerifyOption{Threshold: 0.8},
 	)
 	if err != nil {
 		Fail(c, errors.New("captcha validation failed"))
+		return
 	}
 	Respond(c, http.StatusOK, gin.H{"response": "captcha validation succeeded"})
 }
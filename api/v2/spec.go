@@ -0,0 +1,748 @@
+package v2
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/Temporal/api/middleware"
+	"github.com/RTradeLtd/Temporal/audit"
+	"github.com/RTradeLtd/Temporal/beams"
+	"github.com/RTradeLtd/Temporal/billing"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/Temporal/refunds"
+	"github.com/RTradeLtd/Temporal/subscription"
+	"github.com/RTradeLtd/database/v2/models"
+	pbLens "github.com/RTradeLtd/grpc/lensv2"
+)
+
+// operations documents every route registered in setupRoutes. Routes
+// without an entry here fail Test_API_OpenAPI
+var operations = map[string]operation{
+	// specification
+	"GET " + openAPIPath: {
+		Summary:  "Get the openapi specification of the api",
+		Tag:      "system",
+		Public:   true,
+		Raw:      true,
+		Response: map[string]interface{}{},
+	},
+
+	// system checks
+	"GET /v2/systems/check": {
+		Summary:  "Check the api is online",
+		Tag:      "system",
+		Public:   true,
+		Raw:      true,
+		Response: systemsCheckResponse{},
+	},
+	"GET /v2/statistics/stats": {
+		Summary:  "Get request statistics, for administrators",
+		Tag:      "admin",
+		Raw:      true,
+		Response: statsResponse{},
+	},
+
+	// account recovery
+	"POST /v2/forgot/username": {
+		Summary:  "Email a user name reminder",
+		Tag:      "account",
+		Public:   true,
+		Request:  emailRequest{},
+		Response: "",
+	},
+	"POST /v2/forgot/password": {
+		Summary:  "Reset a password, emailing the new one",
+		Tag:      "account",
+		Public:   true,
+		Request:  emailRequest{},
+		Response: "",
+	},
+
+	// authentication
+	"POST /v2/auth/register": {
+		Summary:  "Register an account",
+		Tag:      "auth",
+		Public:   true,
+		Request:  registerRequest{},
+		Response: registerResponse{},
+	},
+	"POST /v2/auth/login": {
+		Summary:  "Log in, returning a jwt",
+		Tag:      "auth",
+		Public:   true,
+		Raw:      true,
+		Request:  middleware.Login{},
+		Response: tokenResponse{},
+	},
+	"GET /v2/auth/refresh": {
+		Summary:  "Refresh a jwt before it expires",
+		Tag:      "auth",
+		Raw:      true,
+		Response: tokenResponse{},
+	},
+
+	// lens
+	"POST /v2/lens/index": {
+		Summary:  "Index an object for search",
+		Tag:      "lens",
+		Public:   true,
+		Request:  lensIndexRequest{},
+		Response: pbLens.Document{},
+	},
+	"POST /v2/lens/search": {
+		Summary:  "Search indexed objects",
+		Tag:      "lens",
+		Public:   true,
+		Request:  lensSearchRequest{},
+		Response: pbLens.SearchResp{},
+	},
+
+	// payments
+	"POST /v2/payments/dash/create": {
+		Summary:  "Create a dash payment for credits",
+		Tag:      "payments",
+		Request:  creditValueRequest{},
+		Response: dashPaymentResponse{},
+	},
+	"POST /v2/payments/eth/request": {
+		Summary:  "Request a signed message to pay for credits with eth or rtc",
+		Tag:      "payments",
+		Request:  signedPaymentRequest{},
+		Response: signedPaymentResponse{},
+	},
+	"POST /v2/payments/eth/confirm": {
+		Summary:  "Submit the transaction of an eth or rtc payment",
+		Tag:      "payments",
+		Request:  confirmPaymentRequest{},
+		Response: models.Payment{},
+	},
+	"POST /v2/payments/bch/create": {
+		Summary:  "Create a bch payment for credits",
+		Tag:      "payments",
+		Request:  creditValueRequest{},
+		Response: bchPaymentResponse{},
+	},
+	"POST /v2/payments/bch/confirm": {
+		Summary:  "Submit the transaction of a bch payment",
+		Tag:      "payments",
+		Request:  confirmPaymentRequest{},
+		Response: queue.BchPaymentConfirmation{},
+	},
+	"POST /v2/payments/stripe/charge": {
+		Summary:     "Purchase credits by charging a tokenized card",
+		Description: "Deprecated in favour of payment intents, which support cards requiring authentication",
+		Tag:         "payments",
+		Request:     stripeChargeRequest{},
+		Response:    "",
+		Deprecated:  true,
+	},
+	"POST /v2/payments/stripe/intent": {
+		Summary:  "Start a credit purchase with stripe",
+		Tag:      "payments",
+		Request:  stripeIntentRequest{},
+		Response: stripeIntentResponse{},
+	},
+	"GET /v2/payments/stripe/intent/:id": {
+		Summary:  "Get a stripe payment",
+		Tag:      "payments",
+		Response: billing.StripePayment{},
+	},
+	"POST /v2/payments/stripe/payment-method": {
+		Summary:  "Start saving a card for subscriptions",
+		Tag:      "payments",
+		Response: stripeSetupResponse{},
+	},
+	"POST " + stripeWebhookPath: {
+		Summary:     "Receive stripe events",
+		Description: "Events are authenticated by the Stripe-Signature header",
+		Tag:         "payments",
+		Public:      true,
+		Response:    "",
+	},
+	"GET /v2/payments/status/:number": {
+		Summary:  "Check whether a payment is confirmed",
+		Tag:      "payments",
+		Response: false,
+	},
+	"GET /v2/payments/refunds": {
+		Summary:  "List refund requests",
+		Tag:      "refunds",
+		Paged:    true,
+		Response: refunds.Request{},
+	},
+	"POST /v2/payments/refunds/stripe": {
+		Summary:  "Request a refund of a stripe payment",
+		Tag:      "refunds",
+		Request:  stripeRefundRequest{},
+		Response: refunds.Request{},
+	},
+	"POST /v2/payments/refunds/crypto": {
+		Summary:  "Request a payout refund of a crypto payment",
+		Tag:      "refunds",
+		Request:  cryptoRefundRequest{},
+		Response: refunds.Request{},
+	},
+
+	// administration
+	"GET /v2/admin/refunds": {
+		Summary:  "List refund requests awaiting review",
+		Tag:      "admin",
+		Paged:    true,
+		Response: refunds.Request{},
+	},
+	"POST /v2/admin/refunds/:id/approve": {
+		Summary:  "Approve a refund request",
+		Tag:      "admin",
+		Request:  refundNoteRequest{},
+		Response: refunds.Request{},
+	},
+	"POST /v2/admin/refunds/:id/deny": {
+		Summary:  "Deny a refund request",
+		Tag:      "admin",
+		Request:  refundDenyRequest{},
+		Response: refunds.Request{},
+	},
+	"POST /v2/admin/refunds/:id/paid": {
+		Summary:  "Record the payout of an approved crypto refund",
+		Tag:      "admin",
+		Request:  refundPaidRequest{},
+		Response: refunds.Request{},
+	},
+	"GET /v2/admin/users": {
+		Summary:  "Search users",
+		Tag:      "admin",
+		Paged:    true,
+		Query:    userSearchQuery{},
+		Response: adminUser{},
+	},
+	"GET /v2/admin/users/:user": {
+		Summary:  "Get a user along with their usage",
+		Tag:      "admin",
+		Response: adminUserResponse{},
+	},
+	"POST /v2/admin/users/:user/credits": {
+		Summary:  "Grant or revoke credits",
+		Tag:      "admin",
+		Request:  adjustCreditsRequest{},
+		Response: ledger.Entry{},
+	},
+	"POST /v2/admin/users/:user/tier": {
+		Summary:  "Move a user to a different tier",
+		Tag:      "admin",
+		Request:  tierRequest{},
+		Response: "",
+	},
+	"POST /v2/admin/users/:user/disable": {
+		Summary:  "Disable a user account",
+		Tag:      "admin",
+		Response: adminUser{},
+	},
+	"POST /v2/admin/users/:user/enable": {
+		Summary:  "Enable a disabled user account",
+		Tag:      "admin",
+		Response: adminUser{},
+	},
+	"POST /v2/admin/users/:user/verification": {
+		Summary:  "Resend the email verification link of a user",
+		Tag:      "admin",
+		Response: "",
+	},
+	"GET /v2/admin/users/:user/uploads": {
+		Summary:  "List the uploads of a user",
+		Tag:      "admin",
+		Paged:    true,
+		Response: models.Upload{},
+	},
+	"GET /v2/admin/users/:user/jobs/failed": {
+		Summary:  "List the failed and refunded jobs of a user",
+		Tag:      "admin",
+		Paged:    true,
+		Response: ledger.Entry{},
+	},
+	"GET /v2/admin/audit": {
+		Summary:  "Search the audit log",
+		Tag:      "admin",
+		Paged:    true,
+		Query:    auditSearchQuery{},
+		Response: audit.Event{},
+	},
+
+	// accounts
+	"GET /v2/account/token/username": {
+		Summary:  "Get the user name of the authenticated user",
+		Tag:      "account",
+		Response: "",
+	},
+	"POST /v2/account/password/change": {
+		Summary:  "Change password",
+		Tag:      "account",
+		Request:  changePasswordRequest{},
+		Response: "",
+	},
+	"GET /v2/account/key/export/:name": {
+		Summary:     "Export an ipfs key",
+		Description: "Returns the mnemonic phrase of the key, which is then deleted",
+		Tag:         "keys",
+		Response:    "",
+	},
+	"GET /v2/account/key/ipfs/get": {
+		Summary:  "List ipfs keys",
+		Tag:      "keys",
+		Response: keyNamesResponse{},
+	},
+	"POST /v2/account/key/ipfs/new": {
+		Summary:  "Create an ipfs key",
+		Tag:      "keys",
+		Request:  createKeyRequest{},
+		Response: "",
+	},
+	"GET /v2/account/credits/available": {
+		Summary:  "Get available credits",
+		Tag:      "credits",
+		Response: float64(0),
+	},
+	"GET /v2/account/credits/history": {
+		Summary:     "List credit ledger entries",
+		Description: "With format=csv, every entry is returned as a csv file",
+		Tag:         "credits",
+		Paged:       true,
+		Query:       formatQuery{},
+		Response:    ledger.Entry{},
+	},
+	"GET /v2/account/audit": {
+		Summary:     "List audit events of the authenticated user",
+		Description: "With format=jsonl, every event is returned as json lines",
+		Tag:         "account",
+		Paged:       true,
+		Query:       formatQuery{},
+		Response:    audit.Event{},
+	},
+	"GET /v2/account/subscription": {
+		Summary:  "Get the current subscription",
+		Tag:      "subscriptions",
+		Response: subscription.Subscription{},
+	},
+	"GET /v2/account/subscription/plans": {
+		Summary:  "List subscription plans",
+		Tag:      "subscriptions",
+		Response: []subscription.Plan{},
+	},
+	"POST /v2/account/subscription/subscribe": {
+		Summary:  "Subscribe to a plan",
+		Tag:      "subscriptions",
+		Request:  planRequest{},
+		Response: subscription.Subscription{},
+	},
+	"POST /v2/account/subscription/change": {
+		Summary:  "Change subscription plan",
+		Tag:      "subscriptions",
+		Request:  planRequest{},
+		Response: subscription.Subscription{},
+	},
+	"POST /v2/account/subscription/cancel": {
+		Summary:  "Cancel the subscription at the end of the current period",
+		Tag:      "subscriptions",
+		Response: "",
+	},
+	"GET /v2/account/email/verify/:user/:token": {
+		Summary:  "Verify an email address",
+		Tag:      "account",
+		Public:   true,
+		Response: "",
+	},
+	"POST /v2/account/email/forgot": {
+		Summary:  "Get the email address of the authenticated user",
+		Tag:      "account",
+		Response: "",
+	},
+	"POST /v2/account/upgrade": {
+		Summary:  "Upgrade to the paid tier",
+		Tag:      "account",
+		Response: "",
+	},
+	"GET /v2/account/usage": {
+		Summary:  "Get data usage and limits",
+		Tag:      "account",
+		Response: models.Usage{},
+	},
+
+	// public ipfs
+	"POST /v2/ipfs/public/pin/:hash": {
+		Summary:  "Pin content to public ipfs",
+		Tag:      "ipfs",
+		Request:  pinRequest{},
+		Response: "",
+	},
+	"POST /v2/ipfs/public/pin/:hash/extend": {
+		Summary:  "Extend the hold time of a pin",
+		Tag:      "ipfs",
+		Request:  holdTimeRequest{},
+		Response: "",
+	},
+	"POST /v2/ipfs/public/file/add": {
+		Summary:  "Add a file to public ipfs",
+		Tag:      "ipfs",
+		Request:  addFileRequest{},
+		Response: "",
+	},
+	"POST /v2/ipfs/public/car/import": {
+		Summary:     "Import the blocks of a car file, pinning each of its roots",
+		Description: "Roots are charged for as pins of content already on ipfs, except roots the user has already uploaded",
+		Tag:         "ipfs",
+		Request:     carImportRequest{},
+		Response:    carImportResponse{},
+	},
+	"GET /v2/ipfs/public/car/export/:cid": {
+		Summary:     "Export a pinned dag as a car file",
+		Description: "The car file is streamed, so failures after it has started are only seen as a truncated file",
+		Tag:         "ipfs",
+		Raw:         true,
+		Produces:    carContentType,
+	},
+	"POST /v2/ipfs/public/pubsub/publish/:topic": {
+		Summary:  "Publish a pubsub message",
+		Tag:      "ipfs",
+		Request:  pubSubRequest{},
+		Response: pubSubResponse{},
+	},
+	"GET /v2/ipfs/public/stat/:hash": {
+		Summary: "Get object stats",
+		Tag:     "ipfs",
+	},
+	"GET /v2/ipfs/public/dag/:hash": {
+		Summary: "Get a dag object",
+		Tag:     "ipfs",
+	},
+
+	// private ipfs networks
+	"GET /v2/ipfs/private/networks": {
+		Summary:  "List the private networks the user can access",
+		Tag:      "private networks",
+		Response: []string{},
+	},
+	"DELETE /v2/ipfs/private/network/users/remove": {
+		Summary:  "Remove users from a private network",
+		Tag:      "private networks",
+		Request:  networkUsersRequest{},
+		Response: "",
+	},
+	"POST /v2/ipfs/private/network/users/add": {
+		Summary:  "Add users to a private network",
+		Tag:      "private networks",
+		Request:  networkUsersRequest{},
+		Response: "",
+	},
+	"POST /v2/ipfs/private/network/owners/add": {
+		Summary:  "Add owners to a private network",
+		Tag:      "private networks",
+		Request:  networkOwnersRequest{},
+		Response: "",
+	},
+	"GET /v2/ipfs/private/network/:name": {
+		Summary:  "Get a private network",
+		Tag:      "private networks",
+		Query:    networkStatsQuery{},
+		Response: networkResponse{},
+	},
+	"POST /v2/ipfs/private/network/new": {
+		Summary:  "Create and start a private network",
+		Tag:      "private networks",
+		Request:  createNetworkRequest{},
+		Response: networkCreatedResponse{},
+	},
+	"POST /v2/ipfs/private/network/stop": {
+		Summary:  "Stop a private network",
+		Tag:      "private networks",
+		Request:  networkRequest{},
+		Response: networkStateResponse{},
+	},
+	"POST /v2/ipfs/private/network/start": {
+		Summary:  "Start a private network",
+		Tag:      "private networks",
+		Request:  networkRequest{},
+		Response: networkStateResponse{},
+	},
+	"DELETE /v2/ipfs/private/network/remove": {
+		Summary:  "Remove a private network",
+		Tag:      "private networks",
+		Request:  networkRequest{},
+		Response: networkStateResponse{},
+	},
+	"POST /v2/ipfs/private/pin/:hash": {
+		Summary:  "Pin content to a private network",
+		Tag:      "private networks",
+		Request:  privatePinRequest{},
+		Response: "",
+	},
+	"GET /v2/ipfs/private/pin/check/:hash/:networkName": {
+		Summary:  "Check whether content is pinned on a private network",
+		Tag:      "private networks",
+		Response: false,
+	},
+	"POST /v2/ipfs/private/file/add": {
+		Summary:  "Add a file to a private network",
+		Tag:      "private networks",
+		Request:  privateAddFileRequest{},
+		Response: "",
+	},
+	"POST /v2/ipfs/private/pubsub/publish/:topic": {
+		Summary:  "Publish a pubsub message on a private network",
+		Tag:      "private networks",
+		Request:  privatePubSubRequest{},
+		Response: pubSubResponse{},
+	},
+	"GET /v2/ipfs/private/stat/:hash/:networkName": {
+		Summary: "Get object stats from a private network",
+		Tag:     "private networks",
+	},
+	"GET /v2/ipfs/private/dag/:hash/:networkName": {
+		Summary: "Get a dag object from a private network",
+		Tag:     "private networks",
+	},
+	"GET /v2/ipfs/private/uploads/:networkName": {
+		Summary:     "List uploads to a private network",
+		Description: "Pages are only returned with paged=true",
+		Tag:         "private networks",
+		Query:       pagedQuery{},
+		Response:    []models.Upload{},
+	},
+
+	// ipfs utilities
+	"GET /v2/ipfs/utils/download/:hash": {
+		Summary:     "Download content",
+		Description: "Range and conditional requests are supported. The decryption key may be sent in the X-Decrypt-Key header instead",
+		Tag:         "ipfs",
+		Raw:         true,
+		Produces:    "application/octet-stream",
+		Query:       downloadRequest{},
+	},
+	"POST /v2/ipfs/utils/download/:hash": {
+		Summary:     "Download content",
+		Description: "Range requests are supported. The decryption key may be sent in the X-Decrypt-Key header instead",
+		Tag:         "ipfs",
+		Raw:         true,
+		Produces:    "application/octet-stream",
+		Request:     downloadRequest{},
+	},
+	"POST /v2/ipfs/utils/laser/beam": {
+		Summary:     "Transfer content between networks",
+		Description: "Content is transferred in the background by a beam job, charged for as a pin on the destination network",
+		Tag:         "ipfs",
+		Status:      http.StatusAccepted,
+		Request:     beamRequest{},
+		Response:    beams.Job{},
+	},
+	"GET /v2/ipfs/utils/laser/beams": {
+		Summary:  "List beam jobs",
+		Tag:      "ipfs",
+		Paged:    true,
+		Response: beams.Job{},
+	},
+	"GET /v2/ipfs/utils/laser/beams/:id": {
+		Summary:     "Get a beam job",
+		Description: "Blocks and bytes report how much of the content has been transferred",
+		Tag:         "ipfs",
+		Response:    beams.Job{},
+	},
+	"DELETE /v2/ipfs/utils/laser/beams/:id": {
+		Summary:     "Cancel a beam job",
+		Description: "Jobs may be cancelled while queued or transferring, refunding the credits charged for them",
+		Tag:         "ipfs",
+		Response:    beams.Job{},
+	},
+
+	// ipns
+	"POST /v2/ipns/public/publish/details": {
+		Summary:  "Publish an ipns record",
+		Tag:      "ipns",
+		Request:  ipnsPublishRequest{},
+		Response: "",
+	},
+	"POST /v2/ipns/public/pin": {
+		Summary:  "Pin the content an ipns record resolves to",
+		Tag:      "ipns",
+		Request:  ipnsPinRequest{},
+		Response: "",
+	},
+	"GET /v2/ipns/records": {
+		Summary:     "List published ipns records",
+		Description: "Pages are only returned with paged=true",
+		Tag:         "ipns",
+		Query:       pagedQuery{},
+		Response:    []models.IPNS{},
+	},
+
+	// gateway
+	"GET /v2/gateway/ipfs/:cid":         gatewayIPFSOperation,
+	"HEAD /v2/gateway/ipfs/:cid":        gatewayIPFSOperation,
+	"GET /v2/gateway/ipfs/:cid/*path":   gatewayIPFSOperation,
+	"HEAD /v2/gateway/ipfs/:cid/*path":  gatewayIPFSOperation,
+	"GET /v2/gateway/ipns/:name":        gatewayIPNSOperation,
+	"HEAD /v2/gateway/ipns/:name":       gatewayIPNSOperation,
+	"GET /v2/gateway/ipns/:name/*path":  gatewayIPNSOperation,
+	"HEAD /v2/gateway/ipns/:name/*path": gatewayIPNSOperation,
+
+	// database
+	"GET /v2/database/uploads": {
+		Summary:     "List uploads",
+		Description: "Pages are only returned with paged=true",
+		Tag:         "uploads",
+		Query:       pagedQuery{},
+		Response:    []models.Upload{},
+	},
+	"GET /v2/database/uploads/encrypted": {
+		Summary:     "List encrypted uploads",
+		Description: "Pages are only returned with paged=true",
+		Tag:         "uploads",
+		Query:       pagedQuery{},
+		Response:    []models.EncryptedUpload{},
+	},
+	"POST /v2/database/uploads/search": {
+		Summary:     "Search uploads by file name",
+		Description: "Pages are only returned with paged=true",
+		Tag:         "uploads",
+		Query:       pagedQuery{},
+		Request:     searchUploadsRequest{},
+		Response:    []models.Upload{},
+	},
+
+	// frontend
+	"GET /v2/frontend/cost/calculate/:hash/:hold_time": {
+		Summary:  "Calculate the cost of pinning content",
+		Tag:      "cost",
+		Response: float64(0),
+	},
+	"POST /v2/frontend/cost/calculate/file": {
+		Summary:  "Calculate the cost of uploading a file",
+		Tag:      "cost",
+		Request:  fileCostRequest{},
+		Response: float64(0),
+	},
+
+	// organizations
+	"GET /v2/org/get/model": {
+		Summary:  "Get an organization",
+		Tag:      "organizations",
+		Request:  orgRequest{},
+		Response: models.Organization{},
+	},
+	"GET /v2/org/get/billing/report": {
+		Summary: "Generate a billing report of an organization",
+		Tag:     "organizations",
+		Request: billingReportRequest{},
+	},
+	"POST /v2/org/new": {
+		Summary:  "Create an organization",
+		Tag:      "organizations",
+		Request:  orgRequest{},
+		Response: "",
+	},
+	"POST /v2/org/register/user": {
+		Summary:  "Register an organization user",
+		Tag:      "organizations",
+		Request:  registerOrgUserRequest{},
+		Response: registerResponse{},
+	},
+	"POST /v2/org/user/uploads": {
+		Summary:     "List the uploads of an organization user",
+		Description: "With as_csv=true, every upload is returned as a csv file",
+		Tag:         "organizations",
+		Request:     orgUserUploadsRequest{},
+		Response:    pagedResponse{},
+	},
+
+	// ens
+	"POST /v2/ens/claim": {
+		Summary:  "Claim an ens name",
+		Tag:      "ens",
+		Response: "",
+	},
+	"POST /v2/ens/update": {
+		Summary:  "Update the content hash of an ens name",
+		Tag:      "ens",
+		Request:  contentHashRequest{},
+		Response: "",
+	},
+
+	// captcha
+	"POST /v2/captcha/verify": {
+		Summary:  "Verify a recaptcha token",
+		Tag:      "captcha",
+		Public:   true,
+		Request:  captchaRequest{},
+		Response: "",
+	},
+
+	// swarm
+	"POST /v2/swarm/upload": {
+		Summary:  "Upload a file to swarm",
+		Tag:      "swarm",
+		Request:  swarmUploadRequest{},
+		Response: "",
+	},
+
+	// ipfs pinning service api
+	"GET /v2/pinning/pins": {
+		Summary:     "List pin requests, newest first",
+		Description: "Part of the ipfs pinning service api, whose errors are returned in the format of its specification",
+		Tag:         "pinning",
+		Query:       pinningServiceQuery{},
+		Raw:         true,
+		Response:    pinningServiceResults{},
+	},
+	"POST /v2/pinning/pins": {
+		Summary:     "Pin content, charging credits for the hold time of the pin",
+		Description: "Part of the ipfs pinning service api. Content is pinned for one month unless the hold_time meta sets the number of months",
+		Tag:         "pinning",
+		Request:     pinningServicePin{},
+		JSON:        true,
+		Raw:         true,
+		Status:      http.StatusAccepted,
+		Response:    pinningServiceStatus{},
+	},
+	"GET /v2/pinning/pins/:requestid": {
+		Summary:     "Get a pin request",
+		Description: "Part of the ipfs pinning service api",
+		Tag:         "pinning",
+		Raw:         true,
+		Response:    pinningServiceStatus{},
+	},
+	"POST /v2/pinning/pins/:requestid": {
+		Summary:     "Replace a pin request with a new one",
+		Description: "Part of the ipfs pinning service api. The replacement has a new request id",
+		Tag:         "pinning",
+		Request:     pinningServicePin{},
+		JSON:        true,
+		Raw:         true,
+		Status:      http.StatusAccepted,
+		Response:    pinningServiceStatus{},
+	},
+	"DELETE /v2/pinning/pins/:requestid": {
+		Summary:     "Remove a pin request",
+		Description: "Part of the ipfs pinning service api. The content stays pinned until the hold time paid for runs out",
+		Tag:         "pinning",
+		Raw:         true,
+		Status:      http.StatusAccepted,
+		Response:    "",
+	},
+}
+
+// gateway operations are shared by the routes with and without a path
+var (
+	gatewayIPFSOperation = operation{
+		Summary:     "Get content by cid",
+		Description: "Directories are served by their index.html, or listed. Range and conditional requests are supported, and content encrypted by temporal is decrypted with the passphrase in the X-Decrypt-Key header",
+		Tag:         "gateway",
+		Query:       gatewayQuery{},
+		Raw:         true,
+		Produces:    "application/octet-stream",
+	}
+	gatewayIPNSOperation = operation{
+		Summary:     "Get the content an ipns name resolves to",
+		Description: "Served in the same way as content by cid",
+		Tag:         "gateway",
+		Query:       gatewayQuery{},
+		Raw:         true,
+		Produces:    "application/octet-stream",
+	}
+)
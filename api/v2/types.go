@@ -1,7 +1,9 @@
 package v2
 
 import (
+	"github.com/RTradeLtd/Temporal/payments"
 	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/Temporal/settings"
 	"github.com/RTradeLtd/kaas/v2"
 	xss "github.com/dvwright/xss-mw"
 
@@ -23,6 +25,14 @@ var (
 type Options struct {
 	DebugLogging bool
 	DevMode      bool
+	// Stripe configures stripe webhooks
+	Stripe settings.Stripe
+	// Pricing configures the sources used to price crypto payments
+	Pricing settings.Pricing
+	// Pinning configures the ipfs pinning service api
+	Pinning settings.Pinning
+	// Payments configures how crypto payments are checked on chain
+	Payments settings.Payments
 }
 
 // Clients is used to configure service clients we use
@@ -31,6 +41,9 @@ type Clients struct {
 	Orch      pbOrch.ServiceClient
 	Signer    pbSigner.SignerClient
 	BchWallet pbBchWallet.WalletServiceClient
+	// Chains are used to check payments on chain, keyed by blockchain.
+	// When nil they are built from Options.Payments.
+	Chains map[string]payments.Chain
 }
 
 // CreditRefund is a data object to contain refund information
@@ -41,15 +54,16 @@ type CreditRefund struct {
 }
 
 type queues struct {
-	pin     *queue.Manager
-	cluster *queue.Manager
-	email   *queue.Manager
-	ipns    *queue.Manager
-	key     *queue.Manager
-	dash    *queue.Manager
-	eth     *queue.Manager
-	bch     *queue.Manager
-	ens     *queue.Manager
+	pin     *queue.Publisher
+	cluster *queue.Publisher
+	beam    *queue.Publisher
+	email   *queue.Publisher
+	ipns    *queue.Publisher
+	key     *queue.Publisher
+	dash    *queue.Publisher
+	eth     *queue.Publisher
+	bch     *queue.Publisher
+	ens     *queue.Publisher
 }
 
 // kaas key managers
@@ -11,6 +11,12 @@ import (
 	"time"
 
 	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/payments"
+	"github.com/RTradeLtd/Temporal/pricing"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/Temporal/settings"
+	"github.com/RTradeLtd/Temporal/utils"
 	"github.com/RTradeLtd/database/v2/models"
 	gpaginator "github.com/RTradeLtd/gpaginator"
 	"github.com/RTradeLtd/swampi"
@@ -21,35 +27,28 @@ import (
 )
 
 const (
-	// RtcCostUsd is the price of a single RTC in USD
+	// RtcCostUsd is the price of a single RTC in USD, used
+	// unless another static price is configured
 	RtcCostUsd = 0.125
 )
 
 // pageIt is used to serve paginated responses
 func (api *API) pageIt(c *gin.Context, db *gorm.DB, model interface{}) {
-	page := c.Query("page")
-	if page == "" {
-		page = "1"
-	}
-	limit := c.Query("limit")
-	if limit == "" {
-		limit = "10"
-	}
-	pageInt, err := strconv.Atoi(page)
-	if err != nil {
-		Fail(c, err, http.StatusBadRequest)
+	var query pageQuery
+	if !api.bindQuery(c, &query) {
 		return
 	}
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil {
-		Fail(c, err, http.StatusBadRequest)
-		return
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.Limit == 0 {
+		query.Limit = 10
 	}
 	paged, err := gpaginator.Paging(
 		&gpaginator.Param{
 			DB:    db,
-			Page:  pageInt,
-			Limit: limitInt,
+			Page:  query.Page,
+			Limit: query.Limit,
 			// sort results starting with newest first
 			OrderBy: []string{"created_at DESC"},
 		},
@@ -115,6 +114,25 @@ func (api *API) generateEmailJWTToken(username, verificationString string) (stri
 	return verificationJWT.SignedString([]byte(api.cfg.API.JWT.Key))
 }
 
+// emailVerificationURL is used to generate the url a user clicks to verify their email
+func (api *API) emailVerificationURL(user *models.User) (string, error) {
+	// generate a jwt used to trigger email validation
+	token, err := api.generateEmailJWTToken(user.UserName, user.EmailVerificationToken)
+	if err != nil {
+		return "", err
+	}
+	if dev {
+		return fmt.Sprintf(
+			"https://dev.api.temporal.cloud/v2/account/email/verify/%s/%s",
+			user.UserName, token,
+		), nil
+	}
+	return fmt.Sprintf(
+		"https://api.temporal.cloud/v2/account/email/verify/%s/%s",
+		user.UserName, token,
+	), nil
+}
+
 func (api *API) verifyEmailJWTToken(jwtString, username string) error {
 	// parse the jwt for a token
 	token, err := jwt.Parse(jwtString, func(token *jwt.Token) (interface{}, error) {
@@ -189,19 +207,98 @@ func (api *API) verifyEmailJWTToken(jwtString, username string) error {
 	return nil
 }
 
-// validateUserCredits is used to validate whether or not a user has enough credits to pay for an action
-// and if they do, it is deducted from their account
-func (api *API) validateUserCredits(username string, cost float64) error {
-	availableCredits, err := api.um.GetCreditsForUser(username)
-	if err != nil {
+// validateUserCredits is used to validate whether or not a user has enough credits to pay for an action,
+// deducting the cost from their balance if they do
+func (api *API) validateUserCredits(username, callType string, cost float64) error {
+	// calls free to the user are not recorded in the ledger
+	if cost == 0 {
+		return nil
+	}
+	if _, err := api.ledger.Debit(username, cost, ledger.Meta{CallType: callType}); err != nil {
+		if err == ledger.ErrInsufficientCredits {
+			return errors.New(eh.InvalidBalanceError)
+		}
 		return err
 	}
-	if availableCredits < cost {
-		return errors.New(eh.InvalidBalanceError)
+	return nil
+}
+
+// chargeAndEnqueue deducts the cost of a call from the users credits, records its
+// data usage and writes the resulting message to the outbox, all within a single
+// database transaction. The message is published by the outbox relay once the
+// transaction commits, so users are never charged for messages that are lost, and
+// messages are never sent without being paid for. When false is returned, an error
+// response has already been sent.
+func (api *API) chargeAndEnqueue(c *gin.Context, username string, cost float64, size uint64, meta ledger.Meta, q queue.Queue, msg interface{}) bool {
+	if err := api.charge(c, username, cost, size, meta, q, msg, nil); err != nil {
+		api.LogError(c, err.err, err.message)(err.status)
+		return false
+	}
+	return true
+}
+
+// chargeError is a failure to charge a user for a call, with the
+// message and status code it is reported with
+type chargeError struct {
+	err     error
+	message string
+	status  int
+}
+
+// charge is used by chargeAndEnqueue, additionally calling record within the
+// transaction when given, so that records of the call are only kept if the
+// user was charged for it
+func (api *API) charge(c *gin.Context, username string, cost float64, size uint64, meta ledger.Meta, q queue.Queue, msg interface{}, record func(tx *gorm.DB) error) *chargeError {
+	return api.chargeAll(c, username, []pendingCharge{{cost, size, meta, q, msg}}, record)
+}
+
+// pendingCharge is a call to charge a user for, along with the message sent for it
+type pendingCharge struct {
+	cost float64
+	size uint64
+	meta ledger.Meta
+	q    queue.Queue
+	msg  interface{}
+}
+
+// chargeAll charges a user for several calls within a single transaction, so
+// that either every message is enqueued and paid for, or none are
+func (api *API) chargeAll(c *gin.Context, username string, charges []pendingCharge, record func(tx *gorm.DB) error) *chargeError {
+	tx := api.dbm.DB.Begin()
+	if tx.Error != nil {
+		return &chargeError{tx.Error, eh.DatabaseUpdateError, http.StatusBadRequest}
+	}
+	defer tx.Rollback()
+	for _, charge := range charges {
+		queued, err := queue.EnqueueContext(c.Request.Context(), tx, charge.q, charge.msg)
+		if err != nil {
+			return &chargeError{err, eh.QueuePublishError, http.StatusBadRequest}
+		}
+		// validate, and deduct credits if they can upload
+		charge.meta.JobID = queued.MessageID
+		if charge.cost != 0 {
+			if _, err := ledger.NewManager(tx).Debit(username, charge.cost, charge.meta); err != nil {
+				if err == ledger.ErrInsufficientCredits {
+					return &chargeError{err, eh.InvalidBalanceError, http.StatusPaymentRequired}
+				}
+				return &chargeError{err, eh.DatabaseUpdateError, http.StatusInternalServerError}
+			}
+		}
+		// update their data usage
+		if err := models.NewUsageManager(tx).UpdateDataUsage(username, charge.size); err != nil {
+			return &chargeError{err, eh.CantUploadError, http.StatusBadRequest}
+		}
+	}
+	if record != nil {
+		if err := record(tx); err != nil {
+			return &chargeError{err, eh.DatabaseUpdateError, http.StatusBadRequest}
+		}
 	}
-	if _, err := api.um.RemoveCredits(username, cost); err != nil {
-		return err
+	if err := tx.Commit().Error; err != nil {
+		return &chargeError{err, eh.DatabaseUpdateError, http.StatusBadRequest}
 	}
+	// publish right away rather than waiting for the relay to poll
+	api.outbox.Notify()
 	return nil
 }
 
@@ -209,11 +306,27 @@ func (api *API) validateUserCredits(username string, cost float64) error {
 // Note that we do not do any error handling here, instead we will log the information so that we may manually
 // remediate the situation
 func (api *API) refundUserCredits(username, callType string, cost float64) {
-	if _, err := api.um.AddCredits(username, cost); err != nil {
+	if _, err := api.ledger.Credit(username, ledger.Refund, cost, ledger.Meta{
+		Reason:   "api call failed",
+		CallType: callType,
+	}); err != nil {
 		api.l.With("user", username, "call_type", callType, "error", err.Error()).Error(eh.CreditRefundError)
 	}
 }
 
+// publish is used to send a message to the backend through the given publisher.
+// Messages which rabbitmq has not confirmed in time remain in the publisher outbox
+// and are delivered once the connection recovers, so they are treated as sent
+func (api *API) publish(c *gin.Context, qp *queue.Publisher, msg interface{}) error {
+	if err := qp.PublishMessageContext(c.Request.Context(), msg); err != nil {
+		if err != queue.ErrPublishPending {
+			return err
+		}
+		api.l.Warnw("message queued for delayed delivery", "pending", qp.Pending())
+	}
+	return nil
+}
+
 // validateAdminRequest is used to validate whether or not the requesting user is an administrator
 func (api *API) validateAdminRequest(username string) error {
 	isAdmin, err := api.um.CheckIfAdmin(username)
@@ -226,53 +339,31 @@ func (api *API) validateAdminRequest(username string) error {
 	return nil
 }
 
-// used to extract needed post forms that should be provided with api calls.
-// if the second return parameter, the string is non-empty, this is the name of the field which was missing
-// we then use this to fail with a meaningful message
-func (api *API) extractPostForms(c *gin.Context, formNames ...string) (map[string]string, string) {
-	forms := make(map[string]string)
-	for _, name := range formNames {
-		value, exists := c.GetPostForm(name)
-		if !exists {
-			return nil, name
-		}
-		if value == "" { // prevent empty values counting as valid
-			return nil, name
-		}
-		forms[name] = value
-	}
-	return forms, ""
-}
-
-// ValidateHoldTime is used to perform parsing of requested hold times,
-// returning an int64 type of the provided hold time
-func (api *API) validateHoldTime(username, holdTime string) (int64, error) {
+// ValidateHoldTime is used to check requested hold times are within
+// the limits of the users tier
+func (api *API) validateHoldTime(username string, holdTime int64) error {
 	var (
 		// 1 year
 		freeHoldTimeLimitInMonths int64 = 12
 		// two years
 		nonFreeHoldTimeLimitInMonths int64 = 24
 	)
-	holdTimeInt, err := strconv.ParseInt(holdTime, 10, 64)
-	if err != nil {
-		return 0, err
-	}
 	usageTier, err := api.usage.FindByUserName(username)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	switch usageTier.Tier {
 	case models.Free, models.Unverified:
-		if holdTimeInt > freeHoldTimeLimitInMonths {
-			return 0, errors.New("free accounts are limited to maximum hold times of 12 month")
+		if holdTime > freeHoldTimeLimitInMonths {
+			return errors.New("free accounts are limited to maximum hold times of 12 month")
 
 		}
 	default:
-		if holdTimeInt > nonFreeHoldTimeLimitInMonths {
-			return 0, errors.New("non free accounts are limited to a maximum hold time of 24 months")
+		if holdTime > nonFreeHoldTimeLimitInMonths {
+			return errors.New("non free accounts are limited to a maximum hold time of 24 months")
 		}
 	}
-	return holdTimeInt, nil
+	return nil
 }
 
 func (api *API) ensureLEMaxPinTime(upload *models.Upload, holdTime int64, tier models.DataUsageTier) error {
@@ -298,6 +389,53 @@ func (api *API) getCMCKey() string {
 	return api.cfg.APIKeys.CoinMarketCap
 }
 
+// newPriceOracle returns the oracle used to price payments from the configured sources
+func (api *API) newPriceOracle(cfg settings.Pricing) *pricing.Oracle {
+	static := map[string]float64{"rtc": RtcCostUsd}
+	for coin, price := range cfg.Static {
+		static[coin] = price
+	}
+	enabled := func(source string) bool {
+		if len(cfg.Sources) == 0 {
+			return true
+		}
+		for _, s := range cfg.Sources {
+			if s == source {
+				return true
+			}
+		}
+		return false
+	}
+	sources := []pricing.PriceOracle{pricing.NewStatic(static)}
+	if enabled("cmc") {
+		sources = append(sources, pricing.NewCMC("", api.getCMCKey()))
+	}
+	if enabled("coingecko") {
+		sources = append(sources, pricing.NewCoinGecko(""))
+	}
+	return pricing.New(api.dbm.DB, api.l, pricing.Options{MaxDeviation: cfg.MaxDeviation}, sources...)
+}
+
+// newChains returns the chains used to check crypto payments, keyed by blockchain
+func (api *API) newChains(cfg settings.Payments) map[string]payments.Chain {
+	chains := map[string]payments.Chain{
+		payments.Dash: payments.NewDash(api.dc, cfg.Confirmations[payments.Dash]),
+	}
+	if api.bchWallet != nil {
+		chains[payments.BitcoinCash] = payments.NewBitcoinCash(
+			api.bchWallet, int32(cfg.Confirmations[payments.BitcoinCash]),
+		)
+	}
+	if cfg.EthereumURL != "" {
+		chains[payments.Ethereum] = payments.NewEthereum(
+			cfg.EthereumURL, cfg.PaymentContract, int64(cfg.Confirmations[payments.Ethereum]),
+		)
+	} else {
+		api.l.Warn("no ethereum url configured, ethereum payments will not be confirmed")
+	}
+	return chains
+}
+
 func (api *API) getCaptchaKey() string {
 	if os.Getenv("RECAPTCHA_KEY") != "" {
 		return os.Getenv("RECAPTCHA_KEY")
@@ -338,3 +476,38 @@ func (api *API) swarmUpload(data []byte, isTar bool) (string, error) {
 	}
 	return hashes[0], nil
 }
+
+// pinCost calculates the cost of pinning a hash. Subscribed users are not
+// charged for the months covered by their paid subscription period, and their
+// storage quota is enforced by the usage limits of the plan
+func (api *API) pinCost(username, hash string, holdTimeInMonths int64) (float64, int64, error) {
+	cost, size, err := utils.CalculatePinCost(username, hash, holdTimeInMonths, api.ipfs, api.usage)
+	if err != nil {
+		return cost, size, err
+	}
+	return api.uncoveredCost(username, cost, holdTimeInMonths), size, nil
+}
+
+// fileCost calculates the cost of storing a file, less the months covered
+// by the subscription of subscribed users
+func (api *API) fileCost(username string, holdTimeInMonths, size int64) (float64, error) {
+	cost, err := utils.CalculateFileCost(username, holdTimeInMonths, size, api.usage)
+	if err != nil {
+		return cost, err
+	}
+	return api.uncoveredCost(username, cost, holdTimeInMonths), nil
+}
+
+// uncoveredCost returns the part of the cost of storing content for the hold
+// time which is not paid for by the subscription of a user
+func (api *API) uncoveredCost(username string, cost float64, holdTimeInMonths int64) float64 {
+	if holdTimeInMonths <= 0 {
+		return cost
+	}
+	covered, err := api.subscriptions.CoveredMonths(username, holdTimeInMonths)
+	if err != nil {
+		api.l.Errorw("failed to check subscription", "user", username, "error", err)
+		return cost
+	}
+	return cost * float64(holdTimeInMonths-covered) / float64(holdTimeInMonths)
+}
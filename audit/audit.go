@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// Action is a security-sensitive action recorded in the audit log
+type Action string
+
+const (
+	// KeyExport is the export, and removal, of an ipfs key
+	KeyExport Action = "key.export"
+	// PasswordChange is a change to an account password
+	PasswordChange Action = "account.password.change"
+	// NetworkUsersAdd is the authorization of users to access a private network
+	NetworkUsersAdd Action = "network.users.add"
+	// NetworkUsersRemove is the removal of users from a private network
+	NetworkUsersRemove Action = "network.users.remove"
+	// NetworkOwnersAdd is the addition of owners to a private network
+	NetworkOwnersAdd Action = "network.owners.add"
+	// NetworkRemove is the removal of a private network
+	NetworkRemove Action = "network.remove"
+	// CreditAdjust is an administrator granting or revoking credits
+	CreditAdjust Action = "admin.credits.adjust"
+	// TierChange is an administrator changing the tier of a user
+	TierChange Action = "admin.tier.change"
+	// AccountDisable is an administrator disabling an account
+	AccountDisable Action = "admin.account.disable"
+	// AccountEnable is an administrator enabling an account
+	AccountEnable Action = "admin.account.enable"
+	// VerificationResend is an administrator re-sending a verification email
+	VerificationResend Action = "admin.verification.resend"
+	// RefundReview is an administrator approving, denying or paying a refund
+	RefundReview Action = "admin.refund.review"
+)
+
+// Outcome is whether an audited action succeeded
+type Outcome string
+
+const (
+	// Success means the action was carried out
+	Success Outcome = "success"
+	// Failure means the action was rejected, or failed
+	Failure Outcome = "failure"
+)
+
+// Event is a single audited action. Events are never updated or deleted
+type Event struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	// Actor is the user that performed the action
+	Actor  string `gorm:"type:varchar(255);index" json:"actor"`
+	Action Action `gorm:"type:varchar(64);index" json:"action"`
+	// Target is what the action was performed on, ie a key or network name
+	Target string `gorm:"type:varchar(255)" json:"target"`
+	// Account is the user the target belongs to, which lets
+	// users see actions taken on their account by others
+	Account   string  `gorm:"type:varchar(255);index" json:"account"`
+	Detail    string  `gorm:"type:text" json:"detail,omitempty"`
+	RequestID string  `gorm:"type:varchar(64);index" json:"request_id"`
+	IP        string  `gorm:"type:varchar(64)" json:"ip"`
+	Outcome   Outcome `gorm:"type:varchar(16)" json:"outcome"`
+	// Status is the http status code the action was answered with
+	Status int `json:"status"`
+}
+
+// TableName returns the table used to store audit events
+func (Event) TableName() string {
+	return "audit_log"
+}
+
+// Log records and queries audit events
+type Log struct {
+	db *gorm.DB
+	l  *zap.SugaredLogger
+}
+
+// New returns a new audit log
+func New(db *gorm.DB, logger *zap.SugaredLogger) *Log {
+	return &Log{db: db, l: logger.Named("audit")}
+}
+
+// Record appends an event to the audit log
+func (a *Log) Record(event *Event) error {
+	if err := a.db.Create(event).Error; err != nil {
+		return err
+	}
+	a.l.Infow("action audited",
+		"actor", event.Actor,
+		"action", event.Action,
+		"target", event.Target,
+		"request-id", event.RequestID,
+		"outcome", event.Outcome)
+	return nil
+}
+
+// History returns a query for the events performed by, or on the account of, a user
+func (a *Log) History(username string) *gorm.DB {
+	return a.db.Model(&Event{}).Where("actor = ? OR account = ?", username, username)
+}
+
+// Search returns a query for all events, optionally filtered
+// by actor, action and account. Empty filters are ignored
+func (a *Log) Search(actor string, action Action, account string) *gorm.DB {
+	query := a.db.Model(&Event{})
+	if actor != "" {
+		query = query.Where("actor = ?", actor)
+	}
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if account != "" {
+		query = query.Where("account = ?", account)
+	}
+	return query
+}
+
+// Export writes the events matched by query to w as json lines, oldest first
+func Export(w io.Writer, query *gorm.DB) error {
+	rows, err := query.Order("created_at ASC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		var event Event
+		if err := query.ScanRows(rows, &event); err != nil {
+			return err
+		}
+		if err := enc.Encode(&event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
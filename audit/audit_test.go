@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestLog(t *testing.T) {
+	db := loadDatabase(t)
+	a := New(db, zaptest.NewLogger(t).Sugar())
+	// use unique users so previous runs do not affect the results
+	var (
+		admin = "admin-" + uuid.New().String()
+		user  = "user-" + uuid.New().String()
+		other = "other-" + uuid.New().String()
+	)
+	defer db.Where("actor IN (?)", []string{admin, user, other}).Delete(&Event{})
+
+	events := []*Event{
+		{Actor: user, Action: KeyExport, Target: "mykey", Account: user, Outcome: Success, Status: 200},
+		{Actor: user, Action: PasswordChange, Target: user, Account: user, Outcome: Failure, Status: 400},
+		{Actor: admin, Action: CreditAdjust, Target: user, Account: user, Detail: "amount=10", Outcome: Success, Status: 200},
+		{Actor: other, Action: NetworkRemove, Target: "network", Account: other, Outcome: Success, Status: 200},
+	}
+	for _, event := range events {
+		if err := a.Record(event); err != nil {
+			t.Fatal(err)
+		}
+		if event.ID == 0 || event.CreatedAt.IsZero() {
+			t.Fatalf("event not recorded %+v", event)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query *gorm.DB
+		want  int
+	}{
+		{"UserHistory", a.History(user), 3},
+		{"AdminHistory", a.History(admin), 1},
+		{"SearchActor", a.Search(user, "", ""), 2},
+		{"SearchAction", a.Search(user, KeyExport, ""), 1},
+		{"SearchAccount", a.Search("", "", user), 3},
+		{"SearchActorAndAccount", a.Search(admin, "", user), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int
+			if err := tt.query.Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Fatalf("expected %v events, got %v", tt.want, count)
+			}
+		})
+	}
+
+	// exports are one event per line, oldest first
+	var buf bytes.Buffer
+	if err := Export(&buf, a.History(user)); err != nil {
+		t.Fatal(err)
+	}
+	var exported []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		exported = append(exported, event)
+	}
+	if len(exported) != 3 {
+		t.Fatalf("expected 3 exported events, got %v", len(exported))
+	}
+	for i, event := range exported {
+		if event.ID != events[i].ID || event.Action != events[i].Action || event.Outcome != events[i].Outcome {
+			t.Fatalf("expected %+v, got %+v", events[i], event)
+		}
+	}
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(&Event{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
@@ -0,0 +1,6 @@
+// Package audit implements an append-only log of security-sensitive actions,
+// such as exporting keys, changing passwords or granting credits. Every event
+// records who acted, on what, from where and whether they succeeded, so that
+// users can review what happened to their account, and administrators can
+// investigate what happened to the platform.
+package audit
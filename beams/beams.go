@@ -0,0 +1,288 @@
+package beams
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// Status is the state of a beam job
+type Status string
+
+const (
+	// Queued jobs are waiting to be processed by the beam queue
+	Queued Status = "queued"
+	// Transferring jobs are copying blocks to the destination network
+	Transferring Status = "transferring"
+	// Pinning jobs have transferred every block, and are being
+	// pinned on the destination network
+	Pinning Status = "pinning"
+	// Complete jobs have been pinned on the destination
+	// network, and recorded as an upload
+	Complete Status = "complete"
+	// Failed jobs could not be transferred or pinned
+	Failed Status = "failed"
+	// Cancelled jobs were stopped by the user
+	Cancelled Status = "cancelled"
+)
+
+var (
+	// ErrNotFound is returned when a beam job does not exist
+	ErrNotFound = errors.New("beam job not found")
+	// ErrStopped is returned when updating the progress of a
+	// job which is no longer being processed
+	ErrStopped = errors.New("beam job is no longer being processed")
+	// ErrNotCancellable is returned when cancelling a job which
+	// is pinning, or has already finished
+	ErrNotCancellable = errors.New("beam job can only be cancelled while queued or transferring")
+	// ErrRefunded is returned when refunding a job which has already
+	// been refunded, or which neither failed nor was cancelled
+	ErrRefunded = errors.New("beam job can not be refunded")
+)
+
+// Job is a job beaming content from one network to another
+type Job struct {
+	gorm.Model
+	// JobID identifies the job to users
+	JobID              string `gorm:"type:varchar(64);unique_index" json:"job_id"`
+	UserName           string `gorm:"type:varchar(255);index" json:"user_name"`
+	CID                string `gorm:"type:varchar(255)" json:"cid"`
+	SourceNetwork      string `gorm:"type:varchar(255)" json:"source_network"`
+	DestinationNetwork string `gorm:"type:varchar(255)" json:"destination_network"`
+	// HoldTime is the number of months the content is
+	// stored on the destination network for
+	HoldTime int64 `json:"hold_time"`
+	// Size is the size of the content charged for
+	Size       int64   `json:"size"`
+	CreditCost float64 `json:"credit_cost"`
+	Status     Status  `gorm:"type:varchar(16);index" json:"status"`
+	// TotalBlocks is the number of blocks in the dag, known once transferring
+	TotalBlocks int64 `json:"total_blocks"`
+	// Blocks and Bytes are how much of the dag has been transferred
+	Blocks int64 `json:"blocks"`
+	Bytes  int64 `json:"bytes"`
+	// Reason is why the job failed
+	Reason string `gorm:"type:text" json:"reason,omitempty"`
+	// Refunded is whether the credits charged for a failed
+	// or cancelled job have been refunded
+	Refunded bool `json:"refunded"`
+}
+
+// TableName returns the table used to store beam jobs
+func (Job) TableName() string {
+	return "beam_jobs"
+}
+
+// Secret holds the credentials a job is processed with, which are kept out
+// of queue messages, as those are stored for longer than the job runs. It
+// is deleted once the job finishes
+type Secret struct {
+	JobID string `gorm:"type:varchar(64);primary_key"`
+	// JWT authenticates the user to private networks
+	JWT string `gorm:"type:text"`
+	// Passphrase encrypts or decrypts the content of crypted jobs
+	Passphrase string `gorm:"type:text"`
+	CreatedAt  time.Time
+}
+
+// TableName returns the table used to store the secrets of beam jobs
+func (Secret) TableName() string {
+	return "beam_secrets"
+}
+
+// Manager is used to record and update beam jobs. Status changes are made
+// with conditional updates, so that a job being cancelled and failed at
+// once is only ever refunded once
+type Manager struct {
+	db *gorm.DB
+}
+
+// NewManager is used to instantiate our beam job manager. If the given
+// database handle is a transaction, jobs are recorded within it
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// Create records a new job, assigning it a job id unless it has one
+func (m *Manager) Create(job *Job) error {
+	if job.JobID == "" {
+		job.JobID = NewJobID()
+	}
+	if job.Status == "" {
+		job.Status = Queued
+	}
+	return m.db.Create(job).Error
+}
+
+// NewJobID returns a new, random, job id
+func NewJobID() string {
+	return uuid.New().String()
+}
+
+// Find returns a job of a user
+func (m *Manager) Find(username, jobID string) (*Job, error) {
+	var job Job
+	if err := m.db.Where("job_id = ? AND user_name = ?", jobID, username).First(&job).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// SetSecret records the credentials a job is processed with
+func (m *Manager) SetSecret(secret *Secret) error {
+	return m.db.Create(secret).Error
+}
+
+// Secret returns the credentials a job is processed with, which
+// no longer exist once the job has finished
+func (m *Manager) Secret(jobID string) (*Secret, error) {
+	var secret Secret
+	if err := m.db.Where("job_id = ?", jobID).First(&secret).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// List returns a query for the jobs of a user
+func (m *Manager) List(username string) *gorm.DB {
+	return m.db.Model(&Job{}).Where("user_name = ?", username)
+}
+
+// Start marks a job as transferring a dag of total blocks, resetting its
+// progress so that redelivered jobs start over. ErrStopped is returned
+// if the job was cancelled, or has finished
+func (m *Manager) Start(jobID string, total int64) error {
+	return m.update(jobID, []Status{Queued, Transferring}, map[string]interface{}{
+		"status":       Transferring,
+		"total_blocks": total,
+		"blocks":       0,
+		"bytes":        0,
+	})
+}
+
+// Progress records the blocks and bytes transferred by a job so far.
+// ErrStopped is returned if the job was cancelled
+func (m *Manager) Progress(jobID string, blocks, bytes int64) error {
+	return m.update(jobID, []Status{Transferring}, map[string]interface{}{
+		"blocks": blocks,
+		"bytes":  bytes,
+	})
+}
+
+// Replace records the cid of the content a transferring job beams in place
+// of the requested content, such as its encrypted copy. ErrStopped is
+// returned if the job was cancelled
+func (m *Manager) Replace(jobID, cid string) error {
+	return m.update(jobID, []Status{Transferring}, map[string]interface{}{"cid": cid})
+}
+
+// Pin marks a job which has transferred every block as pinning, after
+// which it can no longer be cancelled. ErrStopped is returned if the
+// job was cancelled
+func (m *Manager) Pin(jobID string) error {
+	return m.update(jobID, []Status{Transferring}, map[string]interface{}{"status": Pinning})
+}
+
+// Complete marks a pinning job as complete
+func (m *Manager) Complete(jobID string) error {
+	if err := m.update(jobID, []Status{Pinning}, map[string]interface{}{"status": Complete}); err != nil {
+		return err
+	}
+	return m.deleteSecret(jobID)
+}
+
+// Fail marks a job which has not finished as failed, for the given reason.
+// ErrStopped is returned if the job was cancelled, or has finished
+func (m *Manager) Fail(jobID, reason string) error {
+	if err := m.update(jobID, []Status{Queued, Transferring, Pinning}, map[string]interface{}{
+		"status": Failed,
+		"reason": reason,
+	}); err != nil {
+		return err
+	}
+	return m.deleteSecret(jobID)
+}
+
+// Cancel stops a job of a user which is queued or transferring, returning
+// the job with the status it was cancelled in. Queued jobs are never started
+// by the beam queue, while transferring jobs are stopped once their progress
+// is next recorded. Cancelled jobs must be refunded by the caller
+func (m *Manager) Cancel(username, jobID string) (*Job, error) {
+	job, err := m.Find(username, jobID)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range []Status{Queued, Transferring} {
+		err := m.update(job.JobID, []Status{status}, map[string]interface{}{"status": Cancelled})
+		if err == nil {
+			if err := m.deleteSecret(job.JobID); err != nil {
+				return nil, err
+			}
+			job.Status = status
+			return job, nil
+		}
+		if err != ErrStopped {
+			return nil, err
+		}
+	}
+	return nil, ErrNotCancellable
+}
+
+// Refund refunds the credits charged for a job which failed or was
+// cancelled, along with the data usage it was counted towards. Jobs are
+// marked as refunded with a conditional update, so that they are only
+// ever refunded once, and ErrRefunded is returned for those which were
+func (m *Manager) Refund(jobID, reason string) error {
+	result := m.db.Model(&Job{}).
+		Where("job_id = ? AND status IN (?) AND refunded = ?", jobID, []Status{Failed, Cancelled}, false).
+		Update("refunded", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefunded
+	}
+	var job Job
+	if err := m.db.Where("job_id = ?", jobID).First(&job).Error; err != nil {
+		return err
+	}
+	if job.CreditCost > 0 {
+		if _, err := ledger.NewManager(m.db).Credit(job.UserName, ledger.Refund, job.CreditCost, ledger.Meta{
+			Reason:   reason,
+			CallType: "beam",
+			CID:      job.CID,
+			JobID:    job.JobID,
+		}); err != nil {
+			return err
+		}
+	}
+	return models.NewUsageManager(m.db).ReduceDataUsage(job.UserName, uint64(job.Size))
+}
+
+// deleteSecret deletes the credentials of a job which has finished
+func (m *Manager) deleteSecret(jobID string) error {
+	return m.db.Where("job_id = ?", jobID).Delete(&Secret{}).Error
+}
+
+// update applies updates to a job in one of the given statuses,
+// returning ErrStopped if it is in none of them
+func (m *Manager) update(jobID string, from []Status, updates map[string]interface{}) error {
+	result := m.db.Model(&Job{}).Where("job_id = ? AND status IN (?)", jobID, from).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStopped
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package beams
+
+import (
+	"testing"
+
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+func TestManager(t *testing.T) {
+	db := loadDatabase(t)
+	m := NewManager(db)
+	// use a unique user so previous runs do not affect the results
+	user := "user-" + uuid.New().String()
+	defer db.Unscoped().Where("user_name = ?", user).Delete(&Job{})
+
+	job := &Job{UserName: user, CID: "cid1", SourceNetwork: "public", DestinationNetwork: "private"}
+	if err := m.Create(job); err != nil {
+		t.Fatal(err)
+	}
+	if job.JobID == "" || job.Status != Queued {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if _, err := m.Find("otheruser", job.JobID); err != ErrNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// progress is only recorded while transferring
+	if err := m.Progress(job.JobID, 1, 10); err != ErrStopped {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := m.Start(job.JobID, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Progress(job.JobID, 2, 20); err != nil {
+		t.Fatal(err)
+	}
+	found, err := m.Find(user, job.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Status != Transferring || found.TotalBlocks != 3 || found.Blocks != 2 || found.Bytes != 20 {
+		t.Fatalf("unexpected job %+v", found)
+	}
+
+	// restarting a redelivered job resets its progress
+	if err := m.Start(job.JobID, 3); err != nil {
+		t.Fatal(err)
+	}
+	if found, err = m.Find(user, job.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if found.Blocks != 0 || found.Bytes != 0 {
+		t.Fatalf("unexpected job %+v", found)
+	}
+
+	// cancelled jobs stop recording progress, and can not be cancelled again
+	cancelled, err := m.Cancel(user, job.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != Transferring {
+		t.Fatalf("unexpected cancel from %s", cancelled.Status)
+	}
+	if err := m.Progress(job.JobID, 3, 30); err != ErrStopped {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := m.Fail(job.JobID, "failed to transfer content"); err != ErrStopped {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := m.Cancel(user, job.JobID); err != ErrNotCancellable {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := m.Cancel(user, "notarealjob"); err != ErrNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// queued jobs can be cancelled before they are started
+	queued := &Job{UserName: user, CID: "cid2"}
+	if err := m.Create(queued); err != nil {
+		t.Fatal(err)
+	}
+	if cancelled, err = m.Cancel(user, queued.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != Queued {
+		t.Fatalf("unexpected cancel from %s", cancelled.Status)
+	}
+	if err := m.Start(queued.JobID, 1); err != ErrStopped {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// pinning jobs can no longer be cancelled
+	pinned := &Job{UserName: user, CID: "cid3"}
+	if err := m.Create(pinned); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start(pinned.JobID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Pin(pinned.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Cancel(user, pinned.JobID); err != ErrNotCancellable {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := m.Complete(pinned.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Fail(pinned.JobID, "failed to pin content"); err != ErrStopped {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := m.Refund(pinned.JobID, "beam cancelled"); err != ErrRefunded {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// cancelled jobs are refunded once
+	refunded := &Job{UserName: "testuser", CID: "cid4"}
+	if err := m.Create(refunded); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Where("job_id = ?", refunded.JobID).Delete(&Job{})
+	if err := m.Refund(refunded.JobID, "beam cancelled"); err != ErrRefunded {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// secrets are kept until the job finishes
+	if err := m.SetSecret(&Secret{JobID: refunded.JobID, Passphrase: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := m.Secret(refunded.JobID); err != nil {
+		t.Fatal(err)
+	} else if secret.Passphrase != "password123" {
+		t.Fatalf("unexpected secret %+v", secret)
+	}
+	if _, err := m.Cancel("testuser", refunded.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Secret(refunded.JobID); err != ErrNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := m.Refund(refunded.JobID, "beam cancelled"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Refund(refunded.JobID, "beam cancelled"); err != ErrRefunded {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var count int
+	if err := m.List(user).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 jobs, got %v", count)
+	}
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(&Job{}, &Secret{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
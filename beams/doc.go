@@ -0,0 +1,7 @@
+// Package beams tracks jobs beaming content from one ipfs network to another.
+// Jobs are processed by the beam queue, which copies the blocks of the dag
+// being beamed one at a time, recording how many blocks and bytes have been
+// transferred so far. A job moves from queued to transferring to pinning to
+// complete, or failed. Users may cancel jobs until they are pinning, and are
+// refunded the credits charged for storage on the destination network.
+package beams
@@ -0,0 +1,4 @@
+// Package billing handles credit purchases made through external payment
+// processors. Credits granted, or taken back, by a payment are always
+// recorded in the credit ledger, linked to the processors payment ids.
+package billing
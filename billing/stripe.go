@@ -0,0 +1,683 @@
+package billing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/jinzhu/gorm"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/charge"
+	"github.com/stripe/stripe-go/customer"
+	"github.com/stripe/stripe-go/paymentintent"
+	"github.com/stripe/stripe-go/refund"
+	"github.com/stripe/stripe-go/setupintent"
+	"github.com/stripe/stripe-go/webhook"
+	"go.uber.org/zap"
+)
+
+// stripe event types we act on
+const (
+	eventPaymentSucceeded = "payment_intent.succeeded"
+	eventPaymentFailed    = "payment_intent.payment_failed"
+	eventChargeRefunded   = "charge.refunded"
+	eventDisputeCreated   = "charge.dispute.created"
+	eventDisputeClosed    = "charge.dispute.closed"
+	eventSetupSucceeded   = "setup_intent.succeeded"
+)
+
+// metadataUserName is the payment intent metadata key holding the purchasing user
+const metadataUserName = "username"
+
+// PaymentStatus is the state of a stripe payment
+type PaymentStatus string
+
+const (
+	// StatusPending is a payment which has not yet been completed by the user
+	StatusPending PaymentStatus = "pending"
+	// StatusSucceeded is a payment for which credits have been granted
+	StatusSucceeded PaymentStatus = "succeeded"
+	// StatusFailed is a payment which was declined
+	StatusFailed PaymentStatus = "failed"
+	// StatusRefunded is a payment which was, at least partially, refunded
+	StatusRefunded PaymentStatus = "refunded"
+	// StatusDisputed is a payment the card holder has disputed
+	StatusDisputed PaymentStatus = "disputed"
+)
+
+var (
+	// ErrInvalidSignature is returned for webhook events not signed by stripe
+	ErrInvalidSignature = errors.New("invalid stripe webhook signature")
+	// ErrWebhookNotConfigured is returned for webhook events received without
+	// a signing secret to verify them with
+	ErrWebhookNotConfigured = errors.New("stripe webhook signing secret is not configured")
+	// ErrPaymentNotFound is returned when a user has no payment with the given id
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrInvalidAmount is returned when creating a payment for a non-positive amount
+	ErrInvalidAmount = errors.New("payment amount must be greater than zero")
+	// ErrNoPaymentMethod is returned when charging a user without a saved payment method
+	ErrNoPaymentMethod = errors.New("user does not have a saved payment method")
+	// ErrPaymentIncomplete is returned when a saved payment method could not be charged
+	// without the user being present, ie because the bank requires authentication
+	ErrPaymentIncomplete = errors.New("payment requires user action")
+	// ErrNotRefundable is returned when refunding more than is left of a payment
+	ErrNotRefundable = errors.New("refund exceeds the amount left to refund")
+	// ErrRefundPending is returned when stripe did not say whether a refund was
+	// issued, ie because the request timed out. The refund stays recorded
+	// against the payment, and is settled once stripe confirms it
+	ErrRefundPending = errors.New("refund was sent to stripe, but not confirmed")
+)
+
+// StripeConfig is used to configure stripe payments
+type StripeConfig struct {
+	// SecretKey is the stripe api key
+	SecretKey string
+	// WebhookSecret is used to verify webhook event signatures
+	WebhookSecret string
+	// APIURL optionally overrides the stripe api url, ie for stripe-mock
+	APIURL string
+}
+
+// StripePayment tracks a credit purchase made through a stripe payment intent
+type StripePayment struct {
+	gorm.Model
+	PaymentIntentID string `gorm:"type:varchar(255);unique_index" json:"payment_intent_id"`
+	ChargeID        string `gorm:"type:varchar(255);index" json:"charge_id"`
+	UserName        string `gorm:"type:varchar(255);index" json:"user_name"`
+	Email           string `gorm:"type:varchar(255)" json:"email"`
+	// AmountCents is the amount paid in usd cents
+	AmountCents int64 `json:"amount_cents"`
+	// RefundedCents is the amount refunded, in usd cents
+	RefundedCents int64 `json:"refunded_cents"`
+	// DisputedCents is the amount disputed by the card holder, in usd cents
+	DisputedCents int64 `json:"disputed_cents"`
+	// ReinstatedCents is the amount of disputes decided in our favour, in usd
+	// cents, which is granted back to the user
+	ReinstatedCents int64         `json:"reinstated_cents"`
+	Status          PaymentStatus `gorm:"type:varchar(32)" json:"status"`
+}
+
+// refundable returns the number of cents of a payment which
+// have not been refunded, or lost to disputes
+func (p *StripePayment) refundable() int64 {
+	return p.AmountCents - p.RefundedCents - p.DisputedCents + p.ReinstatedCents
+}
+
+// TableName returns the table used to store stripe payments
+func (StripePayment) TableName() string {
+	return "stripe_payments"
+}
+
+// StripeCustomer links a user to their stripe customer, and the payment
+// method saved for off session payments such as subscription renewals
+type StripeCustomer struct {
+	gorm.Model
+	UserName        string `gorm:"type:varchar(255);unique_index" json:"user_name"`
+	CustomerID      string `gorm:"type:varchar(255);unique_index" json:"customer_id"`
+	PaymentMethodID string `gorm:"type:varchar(255)" json:"payment_method_id"`
+}
+
+// TableName returns the table used to store stripe customers
+func (StripeCustomer) TableName() string {
+	return "stripe_customers"
+}
+
+// Stripe is used to purchase credits through stripe. Payments are made with
+// payment intents, which support strong customer authentication, and credits
+// are only granted once stripe notifies us of a successful payment through a
+// webhook. This means a payment is never lost if we fail while it is processing,
+// as stripe keeps retrying the webhook until we have recorded it.
+type Stripe struct {
+	db            *gorm.DB
+	l             *zap.SugaredLogger
+	webhookSecret string
+}
+
+// NewStripe is used to instantiate our stripe payment handler
+func NewStripe(db *gorm.DB, logger *zap.SugaredLogger, cfg StripeConfig) *Stripe {
+	stripe.Key = cfg.SecretKey
+	if cfg.APIURL != "" {
+		stripe.SetBackend(stripe.APIBackend, stripe.GetBackendWithConfig(
+			stripe.APIBackend,
+			&stripe.BackendConfig{URL: cfg.APIURL},
+		))
+	}
+	return &Stripe{
+		db:            db,
+		l:             logger.Named("stripe"),
+		webhookSecret: cfg.WebhookSecret,
+	}
+}
+
+// CreatePaymentIntent is used to start a credit purchase. The client secret of
+// the returned payment intent is used by the frontend to confirm the payment
+func (s *Stripe) CreatePaymentIntent(username, email string, amountCents int64) (*stripe.PaymentIntent, error) {
+	if amountCents <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	params := &stripe.PaymentIntentParams{
+		Amount:             stripe.Int64(amountCents),
+		Currency:           stripe.String(string(stripe.CurrencyUSD)),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		Description:        stripe.String("temporal credit purchase"),
+		// StatementDescriptor is what appears in their credit card billing report
+		StatementDescriptor: stripe.String("credit purchase"),
+		// email the receipt goes to
+		ReceiptEmail: stripe.String(email),
+	}
+	params.AddMetadata("order_type", "temporal.credits")
+	params.AddMetadata(metadataUserName, username)
+	pi, err := paymentintent.New(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&StripePayment{
+		PaymentIntentID: pi.ID,
+		UserName:        username,
+		Email:           email,
+		AmountCents:     amountCents,
+		Status:          StatusPending,
+	}).Error; err != nil {
+		return nil, err
+	}
+	s.l.Infow("payment intent created", "user", username, "payment_intent", pi.ID, "amount_cents", amountCents)
+	return pi, nil
+}
+
+// FindPayment returns the payment of a user for the given payment intent.
+// ErrPaymentNotFound is returned if it does not exist, or belongs to
+// another user
+func (s *Stripe) FindPayment(username, paymentIntentID string) (*StripePayment, error) {
+	var payment StripePayment
+	if err := s.db.Where("payment_intent_id = ?", paymentIntentID).First(&payment).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	if payment.UserName != username {
+		return nil, ErrPaymentNotFound
+	}
+	return &payment, nil
+}
+
+// Charge purchases credits by charging a tokenized card, granting them
+// before returning. This is how credits were bought before payment intents,
+// and is kept so existing clients continue to work, but cards which require
+// authentication can not be charged this way. The charge is recorded as a
+// payment keyed by its charge id, so refunds and disputes of it are reversed
+func (s *Stripe) Charge(username, email, token string, amountCents int64) (*StripePayment, error) {
+	if amountCents <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	source, err := stripe.SourceParamsFor(token)
+	if err != nil {
+		return nil, err
+	}
+	params := &stripe.ChargeParams{
+		Amount:      stripe.Int64(amountCents),
+		Currency:    stripe.String(string(stripe.CurrencyUSD)),
+		Description: stripe.String("temporal credit purchase"),
+		// StatementDescriptor is what appears in their credit card billing report
+		StatementDescriptor: stripe.String("credit purchase"),
+		// email the receipt goes to
+		ReceiptEmail: stripe.String(email),
+		Source:       source,
+	}
+	params.AddMetadata("order_type", "temporal.credits")
+	params.AddMetadata(metadataUserName, username)
+	ch, err := charge.New(params)
+	if err != nil {
+		return nil, err
+	}
+	payment := &StripePayment{
+		PaymentIntentID: ch.ID,
+		ChargeID:        ch.ID,
+		UserName:        username,
+		Email:           email,
+		AmountCents:     ch.Amount,
+		Status:          StatusSucceeded,
+	}
+	if err := s.transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		_, err := ledger.NewManager(tx).Credit(username, ledger.Purchase, float64(ch.Amount)/100, ledger.Meta{
+			Reason: "stripe credit purchase",
+			JobID:  ch.ID,
+		})
+		return err
+	}); err != nil {
+		// the card has been charged, so this must be remediated manually
+		s.l.Errorw("failed to grant credits for charge", "user", username, "charge", ch.ID, "error", err)
+		return nil, err
+	}
+	s.l.Infow("credits granted",
+		"payment.method", "stripe",
+		"user", username,
+		"charge", ch.ID,
+		"credit.amount", float64(ch.Amount)/100)
+	return payment, nil
+}
+
+// SetupPaymentMethod is used to save a payment method for future off session
+// payments. The client secret of the returned setup intent is used by the
+// frontend to collect the card, which is saved once stripe notifies us the
+// setup succeeded
+func (s *Stripe) SetupPaymentMethod(username, email string) (*stripe.SetupIntent, error) {
+	var cust StripeCustomer
+	err := s.db.Where("user_name = ?", username).First(&cust).Error
+	if gorm.IsRecordNotFoundError(err) {
+		params := &stripe.CustomerParams{Email: stripe.String(email)}
+		params.AddMetadata(metadataUserName, username)
+		c, err := customer.New(params)
+		if err != nil {
+			return nil, err
+		}
+		cust = StripeCustomer{UserName: username, CustomerID: c.ID}
+		if err := s.db.Create(&cust).Error; err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	params := &stripe.SetupIntentParams{
+		Customer:           stripe.String(cust.CustomerID),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		Usage:              stripe.String(string(stripe.SetupIntentUsageOffSession)),
+	}
+	params.AddMetadata(metadataUserName, username)
+	return setupintent.New(params)
+}
+
+// TopUp purchases credits for a user with their saved payment method, without
+// them being present. Credits are granted before returning, so they can be
+// spent immediately
+func (s *Stripe) TopUp(username string, amountCents int64) error {
+	if amountCents <= 0 {
+		return ErrInvalidAmount
+	}
+	var cust StripeCustomer
+	if err := s.db.Where("user_name = ?", username).First(&cust).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrNoPaymentMethod
+		}
+		return err
+	}
+	if cust.PaymentMethodID == "" {
+		return ErrNoPaymentMethod
+	}
+	params := &stripe.PaymentIntentParams{
+		Amount:        stripe.Int64(amountCents),
+		Currency:      stripe.String(string(stripe.CurrencyUSD)),
+		Customer:      stripe.String(cust.CustomerID),
+		PaymentMethod: stripe.String(cust.PaymentMethodID),
+		Description:   stripe.String("temporal credit top up"),
+		OffSession:    stripe.Bool(true),
+		Confirm:       stripe.Bool(true),
+	}
+	params.AddMetadata("order_type", "temporal.credits")
+	params.AddMetadata(metadataUserName, username)
+	pi, err := paymentintent.New(params)
+	if err != nil {
+		return err
+	}
+	if pi.Status != stripe.PaymentIntentStatusSucceeded {
+		s.l.Warnw("off session payment incomplete", "user", username, "payment_intent", pi.ID, "status", pi.Status)
+		return ErrPaymentIncomplete
+	}
+	// the webhook for this payment is a no-op, as the credits are already granted
+	return s.paymentSucceeded(pi)
+}
+
+// Reserve records a refund of part of a payment within tx, before it is
+// issued with Refund, so that concurrent refunds can not exceed the payment,
+// and the refund webhook does not reverse any credits, which the caller is
+// responsible for taking back in the same transaction
+func (s *Stripe) Reserve(tx *gorm.DB, paymentIntentID, username string, amountCents int64) error {
+	if amountCents <= 0 {
+		return ErrInvalidAmount
+	}
+	payment, err := lockPayment(tx, "payment_intent_id = ? AND user_name = ?", paymentIntentID, username)
+	if err != nil {
+		return err
+	}
+	if payment.Status != StatusSucceeded && payment.Status != StatusRefunded {
+		return ErrNotRefundable
+	}
+	if amountCents > payment.refundable() {
+		return ErrNotRefundable
+	}
+	return tx.Model(payment).Updates(map[string]interface{}{
+		"refunded_cents": gorm.Expr("refunded_cents + ?", amountCents),
+		"status":         StatusRefunded,
+	}).Error
+}
+
+// Refund returns a reserved refund to the card the payment was made with. It
+// is sent with the idempotency key, so that a refund which is sent again, ie
+// because it was not confirmed, is issued at most once. The reservation is
+// only released if stripe declines the refund, otherwise ErrRefundPending is
+// returned and the refund may be sent again
+func (s *Stripe) Refund(paymentIntentID, username, idempotencyKey string, amountCents int64) (string, error) {
+	var payment StripePayment
+	if err := s.db.Where("payment_intent_id = ? AND user_name = ?", paymentIntentID, username).First(&payment).Error; err != nil {
+		return "", err
+	}
+	params := &stripe.RefundParams{
+		Charge: stripe.String(payment.ChargeID),
+		Amount: stripe.Int64(amountCents),
+	}
+	params.AddMetadata(metadataUserName, username)
+	params.SetIdempotencyKey(idempotencyKey)
+	re, err := refund.New(params)
+	if err != nil && !declined(err) {
+		// the refund may have been issued, so it is kept until stripe settles it
+		s.l.Warnw("stripe refund not confirmed", "user", username, "payment_intent", paymentIntentID, "amount_cents", amountCents, "error", err)
+		return "", ErrRefundPending
+	}
+	if err != nil {
+		if rerr := s.release(payment.ID, amountCents); rerr != nil {
+			// the payment can not be refunded again until this is remediated manually
+			s.l.Errorw("failed to release refund", "user", username, "payment_intent", paymentIntentID, "amount_cents", amountCents, "error", rerr)
+		}
+		return "", err
+	}
+	s.l.Infow("payment refunded", "user", username, "payment_intent", paymentIntentID, "refund", re.ID, "amount_cents", amountCents)
+	return re.ID, nil
+}
+
+// declined returns whether stripe definitively refused a request, rather than
+// failing to process it, or being unreachable. Rate limited requests and
+// idempotency conflicts may still be processed
+func declined(err error) bool {
+	e, ok := err.(*stripe.Error)
+	if !ok {
+		return false
+	}
+	switch e.HTTPStatusCode {
+	case http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return e.HTTPStatusCode >= http.StatusBadRequest && e.HTTPStatusCode < http.StatusInternalServerError
+}
+
+// release takes back a refund recorded against a payment which stripe did not
+// issue, marking the payment as succeeded if nothing else has been refunded
+func (s *Stripe) release(id uint, amountCents int64) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		var payment StripePayment
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&payment, id).Error; err != nil {
+			return err
+		}
+		payment.RefundedCents -= amountCents
+		if payment.RefundedCents <= 0 && payment.Status == StatusRefunded {
+			payment.Status = StatusSucceeded
+		}
+		return tx.Save(&payment).Error
+	})
+}
+
+// WebhookEnabled returns whether a signing secret is configured to verify
+// webhook events with. Without one, no events are accepted
+func (s *Stripe) WebhookEnabled() bool {
+	return s.webhookSecret != ""
+}
+
+// HandleWebhook verifies and processes a webhook event sent by stripe. Events
+// may be delivered more than once, so processing them is idempotent. An error
+// other than ErrInvalidSignature or ErrWebhookNotConfigured means the event
+// should be retried.
+func (s *Stripe) HandleWebhook(payload []byte, signature string) error {
+	// an empty secret is known to anyone, so would verify forged events
+	if !s.WebhookEnabled() {
+		return ErrWebhookNotConfigured
+	}
+	event, err := webhook.ConstructEvent(payload, signature, s.webhookSecret)
+	if err != nil {
+		s.l.Warnw("rejected stripe webhook", "error", err)
+		return ErrInvalidSignature
+	}
+	l := s.l.With("event", event.ID, "type", event.Type)
+	switch event.Type {
+	case eventPaymentSucceeded, eventPaymentFailed:
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+			return err
+		}
+		if event.Type == eventPaymentFailed {
+			return s.updateStatus(pi.ID, StatusPending, StatusFailed)
+		}
+		return s.paymentSucceeded(&pi)
+	case eventChargeRefunded:
+		var ch stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &ch); err != nil {
+			return err
+		}
+		return s.reverse(ch.ID, func(p *StripePayment) (int64, PaymentStatus) {
+			refunded := ch.AmountRefunded - p.RefundedCents
+			p.RefundedCents = ch.AmountRefunded
+			return refunded, StatusRefunded
+		}, fmt.Sprintf("stripe refund of charge %s", ch.ID))
+	case eventSetupSucceeded:
+		var si stripe.SetupIntent
+		if err := json.Unmarshal(event.Data.Raw, &si); err != nil {
+			return err
+		}
+		return s.setupSucceeded(&si)
+	case eventDisputeCreated:
+		var dp stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dp); err != nil {
+			return err
+		}
+		if dp.Charge == nil {
+			return fmt.Errorf("dispute %s has no charge", dp.ID)
+		}
+		return s.reverse(dp.Charge.ID, func(p *StripePayment) (int64, PaymentStatus) {
+			if p.DisputedCents >= dp.Amount {
+				return 0, StatusDisputed
+			}
+			disputed := dp.Amount - p.DisputedCents
+			p.DisputedCents = dp.Amount
+			return disputed, StatusDisputed
+		}, fmt.Sprintf("stripe dispute %s of charge %s", dp.ID, dp.Charge.ID))
+	case eventDisputeClosed:
+		var dp stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dp); err != nil {
+			return err
+		}
+		if dp.Charge == nil {
+			return fmt.Errorf("dispute %s has no charge", dp.ID)
+		}
+		if dp.Status != stripe.DisputeStatusWon {
+			l.Infow("dispute closed without being won", "dispute", dp.ID, "status", dp.Status)
+			return nil
+		}
+		return s.reinstate(dp.Charge.ID, fmt.Sprintf("stripe dispute %s of charge %s won", dp.ID, dp.Charge.ID))
+	default:
+		l.Debug("ignoring stripe webhook")
+		return nil
+	}
+}
+
+// paymentSucceeded grants the credits purchased by a payment, unless
+// they have already been granted
+func (s *Stripe) paymentSucceeded(pi *stripe.PaymentIntent) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		payment, err := lockPayment(tx, "payment_intent_id = ?", pi.ID)
+		if gorm.IsRecordNotFoundError(err) {
+			// the intent was created outside of temporal, ie through the dashboard
+			username := pi.Metadata[metadataUserName]
+			if username == "" {
+				s.l.Warnw("ignoring payment intent without a user", "payment_intent", pi.ID)
+				return nil
+			}
+			payment = &StripePayment{
+				PaymentIntentID: pi.ID,
+				UserName:        username,
+				AmountCents:     pi.Amount,
+				Status:          StatusPending,
+			}
+			if err := tx.Create(payment).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		if payment.Status != StatusPending && payment.Status != StatusFailed {
+			// credits have already been granted
+			return nil
+		}
+		payment.AmountCents = pi.AmountReceived
+		payment.Status = StatusSucceeded
+		if pi.Charges != nil && len(pi.Charges.Data) > 0 {
+			payment.ChargeID = pi.Charges.Data[0].ID
+		}
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		credits := float64(payment.AmountCents) / 100
+		if _, err := ledger.NewManager(tx).Credit(payment.UserName, ledger.Purchase, credits, ledger.Meta{
+			Reason: "stripe credit purchase",
+			JobID:  pi.ID,
+		}); err != nil {
+			return err
+		}
+		s.l.Infow("credits granted",
+			"payment.method", "stripe",
+			"user", payment.UserName,
+			"payment_intent", pi.ID,
+			"credit.amount", credits)
+		return nil
+	})
+}
+
+// setupSucceeded saves the payment method of a completed setup intent
+func (s *Stripe) setupSucceeded(si *stripe.SetupIntent) error {
+	if si.Customer == nil || si.PaymentMethod == nil {
+		return fmt.Errorf("setup intent %s has no customer or payment method", si.ID)
+	}
+	result := s.db.Model(&StripeCustomer{}).
+		Where("customer_id = ?", si.Customer.ID).
+		Update("payment_method_id", si.PaymentMethod.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		s.l.Warnw("ignoring setup intent of unknown customer", "setup_intent", si.ID, "customer", si.Customer.ID)
+		return nil
+	}
+	s.l.Infow("payment method saved", "customer", si.Customer.ID, "setup_intent", si.ID)
+	return nil
+}
+
+// reverse takes back the credits of a refunded or disputed charge. The update
+// function records the new totals on the payment, returning the number of cents
+// not previously reversed
+func (s *Stripe) reverse(chargeID string, update func(*StripePayment) (int64, PaymentStatus), reason string) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		payment, err := lockPayment(tx, "charge_id = ?", chargeID)
+		if gorm.IsRecordNotFoundError(err) {
+			s.l.Warnw("ignoring reversal of unknown charge", "charge", chargeID)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		cents, status := update(payment)
+		if cents <= 0 {
+			// this reversal has already been processed
+			return nil
+		}
+		payment.Status = status
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		credits := float64(cents) / 100
+		if _, err := ledger.NewManager(tx).Reverse(payment.UserName, credits, ledger.Meta{
+			Reason: reason,
+			JobID:  payment.PaymentIntentID,
+		}); err != nil {
+			return err
+		}
+		s.l.Warnw("credits reversed",
+			"payment.method", "stripe",
+			"user", payment.UserName,
+			"payment_intent", payment.PaymentIntentID,
+			"reason", reason,
+			"credit.amount", credits)
+		return nil
+	})
+}
+
+// reinstate grants back the credits taken for the disputes of a charge which
+// were decided in our favour, unless they have already been granted back
+func (s *Stripe) reinstate(chargeID, reason string) error {
+	return s.transaction(func(tx *gorm.DB) error {
+		payment, err := lockPayment(tx, "charge_id = ?", chargeID)
+		if gorm.IsRecordNotFoundError(err) {
+			s.l.Warnw("ignoring dispute of unknown charge", "charge", chargeID)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		cents := payment.DisputedCents - payment.ReinstatedCents
+		if cents <= 0 {
+			// this dispute has already been reinstated
+			return nil
+		}
+		payment.ReinstatedCents = payment.DisputedCents
+		payment.Status = StatusSucceeded
+		if payment.RefundedCents > 0 {
+			payment.Status = StatusRefunded
+		}
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		credits := float64(cents) / 100
+		if _, err := ledger.NewManager(tx).Credit(payment.UserName, ledger.Purchase, credits, ledger.Meta{
+			Reason: reason,
+			JobID:  payment.PaymentIntentID,
+		}); err != nil {
+			return err
+		}
+		s.l.Infow("credits reinstated",
+			"payment.method", "stripe",
+			"user", payment.UserName,
+			"payment_intent", payment.PaymentIntentID,
+			"reason", reason,
+			"credit.amount", credits)
+		return nil
+	})
+}
+
+// updateStatus changes the status of a payment, if it is in the expected state
+func (s *Stripe) updateStatus(paymentIntentID string, from, to PaymentStatus) error {
+	return s.db.Model(&StripePayment{}).
+		Where("payment_intent_id = ? AND status = ?", paymentIntentID, from).
+		Update("status", to).Error
+}
+
+func (s *Stripe) transaction(fn func(tx *gorm.DB) error) error {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// lockPayment fetches a payment, locking its row until the transaction completes
+func lockPayment(tx *gorm.DB, query string, args ...interface{}) (*StripePayment, error) {
+	var payment StripePayment
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where(query, args...).
+		First(&payment).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
@@ -0,0 +1,275 @@
+package billing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/webhook"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	testUser          = "testuser"
+	testWebhookSecret = "whsec_test"
+)
+
+func TestStripe_CreatePaymentIntent(t *testing.T) {
+	// start a mock server with `make stripe-mock`
+	mockURL := os.Getenv("STRIPE_MOCK_URL")
+	if mockURL == "" {
+		t.Skip("STRIPE_MOCK_URL not set")
+	}
+	db := loadDatabase(t)
+	s := NewStripe(db, zaptest.NewLogger(t).Sugar(), StripeConfig{
+		SecretKey:     "sk_test_123",
+		WebhookSecret: testWebhookSecret,
+		APIURL:        mockURL,
+	})
+	if _, err := s.CreatePaymentIntent(testUser, "test@example.com", 0); err != ErrInvalidAmount {
+		t.Fatalf("expected %v, got %v", ErrInvalidAmount, err)
+	}
+	pi, err := s.CreatePaymentIntent(testUser, "test@example.com", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.ClientSecret == "" {
+		t.Fatal("client secret should be set")
+	}
+	payment, err := s.FindPayment(testUser, pi.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(payment)
+	// payments of other users are not found
+	if _, err := s.FindPayment("otheruser", pi.ID); err != ErrPaymentNotFound {
+		t.Fatalf("expected %v, got %v", ErrPaymentNotFound, err)
+	}
+	if payment.Status != StatusPending || payment.UserName != testUser {
+		t.Fatalf("unexpected payment %+v", payment)
+	}
+}
+
+func TestStripe_HandleWebhook(t *testing.T) {
+	db := loadDatabase(t)
+	s := NewStripe(db, zaptest.NewLogger(t).Sugar(), StripeConfig{WebhookSecret: testWebhookSecret})
+	um := models.NewUserManager(db)
+	if _, err := ledger.NewManager(db).Open(testUser); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		piID     = "pi_" + uuid.New().String()
+		chargeID = "ch_" + uuid.New().String()
+	)
+	payment := &StripePayment{
+		PaymentIntentID: piID,
+		UserName:        testUser,
+		AmountCents:     1000,
+		Status:          StatusPending,
+	}
+	if err := db.Create(payment).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(payment)
+	start, err := um.GetCreditsForUser(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	succeeded := event(t, "payment_intent.succeeded", map[string]interface{}{
+		"id":              piID,
+		"object":          "payment_intent",
+		"amount":          1000,
+		"amount_received": 1000,
+		"charges": map[string]interface{}{
+			"object": "list",
+			"data":   []map[string]interface{}{{"id": chargeID, "object": "charge"}},
+		},
+	})
+	refunded := event(t, "charge.refunded", map[string]interface{}{
+		"id":              chargeID,
+		"object":          "charge",
+		"amount":          1000,
+		"amount_refunded": 250,
+	})
+	disputeID := "dp_" + uuid.New().String()
+	disputed := event(t, "charge.dispute.created", map[string]interface{}{
+		"id":     disputeID,
+		"object": "dispute",
+		"amount": 750,
+		"charge": chargeID,
+	})
+	won := event(t, "charge.dispute.closed", map[string]interface{}{
+		"id":     disputeID,
+		"object": "dispute",
+		"amount": 750,
+		"charge": chargeID,
+		"status": "won",
+	})
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+		wantErr   error
+		// wantCredits is the expected change in credits since the test started
+		wantCredits float64
+		wantStatus  PaymentStatus
+	}{
+		{"BadSignature", succeeded, sign(succeeded, "whsec_wrong"), ErrInvalidSignature, 0, StatusPending},
+		{"Succeeded", succeeded, sign(succeeded, testWebhookSecret), nil, 10, StatusSucceeded},
+		{"SucceededRetry", succeeded, sign(succeeded, testWebhookSecret), nil, 10, StatusSucceeded},
+		{"Refunded", refunded, sign(refunded, testWebhookSecret), nil, 7.5, StatusRefunded},
+		{"RefundedRetry", refunded, sign(refunded, testWebhookSecret), nil, 7.5, StatusRefunded},
+		{"Disputed", disputed, sign(disputed, testWebhookSecret), nil, 0, StatusDisputed},
+		{"DisputedRetry", disputed, sign(disputed, testWebhookSecret), nil, 0, StatusDisputed},
+		{"DisputeWon", won, sign(won, testWebhookSecret), nil, 7.5, StatusRefunded},
+		{"DisputeWonRetry", won, sign(won, testWebhookSecret), nil, 7.5, StatusRefunded},
+		{"DisputedAfterWon", disputed, sign(disputed, testWebhookSecret), nil, 7.5, StatusRefunded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.HandleWebhook(tt.payload, tt.signature); err != tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			credits, err := um.GetCreditsForUser(testUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := credits - start; diff < tt.wantCredits-0.001 || diff > tt.wantCredits+0.001 {
+				t.Fatalf("expected credits to change by %v, changed by %v", tt.wantCredits, diff)
+			}
+			p, err := s.FindPayment(testUser, piID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Status != tt.wantStatus {
+				t.Fatalf("expected status %s, got %s", tt.wantStatus, p.Status)
+			}
+		})
+	}
+	// every change must be linked to the payment intent
+	var entries []ledger.Entry
+	if err := db.Where("job_id = ?", piID).Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 ledger entries, got %v", len(entries))
+	}
+}
+
+func TestStripe_HandleWebhook_NotConfigured(t *testing.T) {
+	db := loadDatabase(t)
+	s := NewStripe(db, zaptest.NewLogger(t).Sugar(), StripeConfig{})
+	if s.WebhookEnabled() {
+		t.Fatal("webhook should not be enabled without a secret")
+	}
+	// events signed with an empty secret are forgeable, so are never accepted
+	succeeded := event(t, "payment_intent.succeeded", map[string]interface{}{
+		"id":              "pi_" + uuid.New().String(),
+		"object":          "payment_intent",
+		"amount":          1000,
+		"amount_received": 1000,
+		"metadata":        map[string]string{"username": testUser},
+	})
+	if err := s.HandleWebhook(succeeded, sign(succeeded, "")); err != ErrWebhookNotConfigured {
+		t.Fatalf("expected %v, got %v", ErrWebhookNotConfigured, err)
+	}
+}
+
+func TestStripe_SetupWebhook(t *testing.T) {
+	db := loadDatabase(t)
+	s := NewStripe(db, zaptest.NewLogger(t).Sugar(), StripeConfig{WebhookSecret: testWebhookSecret})
+	cust := &StripeCustomer{UserName: "setup-" + uuid.New().String(), CustomerID: "cus_" + uuid.New().String()}
+	if err := db.Create(cust).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(cust)
+	// users can not be topped up until their payment method is saved
+	if err := s.TopUp(cust.UserName, 1000); err != ErrNoPaymentMethod {
+		t.Fatalf("expected %v, got %v", ErrNoPaymentMethod, err)
+	}
+	succeeded := event(t, "setup_intent.succeeded", map[string]interface{}{
+		"id":             "seti_" + uuid.New().String(),
+		"object":         "setup_intent",
+		"customer":       cust.CustomerID,
+		"payment_method": "pm_card_visa",
+	})
+	if err := s.HandleWebhook(succeeded, sign(succeeded, testWebhookSecret)); err != nil {
+		t.Fatal(err)
+	}
+	var saved StripeCustomer
+	if err := db.First(&saved, cust.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.PaymentMethodID != "pm_card_visa" {
+		t.Fatalf("expected payment method to be saved, got %s", saved.PaymentMethodID)
+	}
+}
+
+// event constructs a stripe webhook event payload
+func event(t *testing.T, eventType string, object map[string]interface{}) []byte {
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":     "evt_" + uuid.New().String(),
+		"object": "event",
+		"type":   eventType,
+		"data":   map[string]interface{}{"object": object},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func Test_declined(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"InvalidRequest", &stripe.Error{HTTPStatusCode: http.StatusBadRequest}, true},
+		{"CardError", &stripe.Error{HTTPStatusCode: http.StatusPaymentRequired}, true},
+		{"IdempotencyConflict", &stripe.Error{HTTPStatusCode: http.StatusConflict}, false},
+		{"RateLimited", &stripe.Error{HTTPStatusCode: http.StatusTooManyRequests}, false},
+		{"ServerError", &stripe.Error{HTTPStatusCode: http.StatusInternalServerError}, false},
+		{"NetworkError", errors.New("connection reset by peer"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := declined(tt.err); got != tt.want {
+				t.Errorf("declined() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sign generates a stripe signature header for the given payload
+func sign(payload []byte, secret string) string {
+	now := time.Now()
+	return fmt.Sprintf("t=%d,v1=%s", now.Unix(), hex.EncodeToString(webhook.ComputeSignature(now, payload, secret)))
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(&StripePayment{}, &StripeCustomer{}, &ledger.Entry{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
@@ -0,0 +1,184 @@
+package car
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	gocid "github.com/ipfs/go-cid"
+)
+
+const (
+	// maxHeaderSize is the largest header that is read
+	maxHeaderSize = 1 << 20
+	// maxSectionSize is the largest block, along with its cid, that is read.
+	// Blocks larger than this can not be exchanged by ipfs nodes either
+	maxSectionSize = 4 << 20
+	// v2HeaderSize is the size of the fixed header of version 2
+	// archives, which follows the pragma identifying them
+	v2HeaderSize = 40
+	// v2PragmaSize is the size of the pragma of version 2 archives, which
+	// is a version 1 header with a version of 2 and no roots
+	v2PragmaSize = 11
+)
+
+var (
+	// ErrNoRoots is returned when reading an archive without roots
+	ErrNoRoots = errors.New("car has no roots")
+	// ErrUnsupportedVersion is returned when reading an archive of
+	// a version other than 1 or 2
+	ErrUnsupportedVersion = errors.New("car version must be 1 or 2")
+	// ErrSectionTooLarge is returned when reading a block which is too large
+	ErrSectionTooLarge = errors.New("car block is too large")
+)
+
+// Block is a block of an archive
+type Block struct {
+	CID  gocid.Cid
+	Data []byte
+}
+
+// Reader reads blocks from an archive
+type Reader struct {
+	r *bufio.Reader
+	// Roots are the cids of the roots of the archive
+	Roots []gocid.Cid
+	// Version is the version of the archive
+	Version uint64
+}
+
+// NewReader reads the header of an archive, returning a
+// reader of its blocks
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := readSection(br, maxHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read car header: %s", err)
+	}
+	version, roots, err := decodeHeader(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode car header: %s", err)
+	}
+	switch version {
+	case 1:
+	case 2:
+		// the pragma is followed by a fixed header giving the location of
+		// a version 1 archive holding the data, which is read instead
+		fixed := make([]byte, v2HeaderSize)
+		if _, err := io.ReadFull(br, fixed); err != nil {
+			return nil, fmt.Errorf("failed to read car v2 header: %s", err)
+		}
+		offset := int64(binary.LittleEndian.Uint64(fixed[16:24]))
+		size := int64(binary.LittleEndian.Uint64(fixed[24:32]))
+		if offset < v2PragmaSize+v2HeaderSize || size < 0 {
+			return nil, errors.New("car v2 header is invalid")
+		}
+		if _, err := io.CopyN(ioutil.Discard, br, offset-v2PragmaSize-v2HeaderSize); err != nil {
+			return nil, fmt.Errorf("failed to seek to car v2 data: %s", err)
+		}
+		inner, err := NewReader(io.LimitReader(br, size))
+		if err != nil {
+			return nil, err
+		}
+		if inner.Version != 1 {
+			return nil, errors.New("car v2 data must be a car v1")
+		}
+		inner.Version = 2
+		return inner, nil
+	default:
+		return nil, ErrUnsupportedVersion
+	}
+	if len(roots) == 0 {
+		return nil, ErrNoRoots
+	}
+	return &Reader{r: br, Roots: roots, Version: version}, nil
+}
+
+// Next returns the next block of the archive, or io.EOF once every block
+// has been read. The data of blocks is checked against their cid
+func (r *Reader) Next() (*Block, error) {
+	section, err := readSection(r.r, maxSectionSize)
+	if err != nil {
+		return nil, err
+	}
+	n, id, err := gocid.CidFromBytes(section)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block cid: %s", err)
+	}
+	data := section[n:]
+	sum, err := id.Prefix().Sum(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash block %s: %s", id, err)
+	}
+	if !sum.Equals(id) {
+		return nil, fmt.Errorf("block data does not match cid %s", id)
+	}
+	return &Block{CID: id, Data: data}, nil
+}
+
+// readSection reads a section of an archive, which is prefixed
+// with its length. io.EOF is returned when there are no more sections
+func readSection(r *bufio.Reader, max uint64) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read section length: %s", err)
+	}
+	if length == 0 {
+		return nil, errors.New("car section is empty")
+	}
+	if length > max {
+		return nil, ErrSectionTooLarge
+	}
+	section := make([]byte, length)
+	if _, err := io.ReadFull(r, section); err != nil {
+		return nil, fmt.Errorf("failed to read section: %s", err)
+	}
+	return section, nil
+}
+
+// Writer writes blocks to a version 1 archive
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the header of an archive with the given roots,
+// returning a writer of its blocks
+func NewWriter(w io.Writer, roots []gocid.Cid) (*Writer, error) {
+	if len(roots) == 0 {
+		return nil, ErrNoRoots
+	}
+	cw := &Writer{w: w}
+	if err := cw.writeSection(encodeHeader(roots)); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// Write writes a block to the archive
+func (w *Writer) Write(b *Block) error {
+	return w.writeSection(b.CID.Bytes(), b.Data)
+}
+
+// writeSection writes a section made up of parts, prefixed with its length
+func (w *Writer) writeSection(parts ...[]byte) error {
+	var length int
+	for _, part := range parts {
+		length += len(part)
+	}
+	prefix := make([]byte, binary.MaxVarintLen64)
+	if _, err := w.w.Write(prefix[:binary.PutUvarint(prefix, uint64(length))]); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := w.w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
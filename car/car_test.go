@@ -0,0 +1,156 @@
+package car
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	gocid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestRoundTrip(t *testing.T) {
+	blocks := []*Block{
+		newBlock(t, gocid.NewPrefixV0(multihash.SHA2_256), "dag-pb root"),
+		newBlock(t, gocid.NewPrefixV1(gocid.Raw, multihash.SHA2_256), "raw leaf"),
+		newBlock(t, gocid.NewPrefixV1(gocid.DagCBOR, multihash.SHA2_256), "cbor node"),
+	}
+	for _, version := range []uint64{1, 2} {
+		archive := writeArchive(t, []gocid.Cid{blocks[0].CID, blocks[2].CID}, blocks)
+		if version == 2 {
+			archive = wrapV2(archive)
+		}
+		r, err := NewReader(bytes.NewReader(archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Version != version {
+			t.Fatalf("expected version %v, got %v", version, r.Version)
+		}
+		if len(r.Roots) != 2 || !r.Roots[0].Equals(blocks[0].CID) || !r.Roots[1].Equals(blocks[2].CID) {
+			t.Fatalf("unexpected roots %v", r.Roots)
+		}
+		for _, want := range blocks {
+			got, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.CID.Equals(want.CID) || !bytes.Equal(got.Data, want.Data) {
+				t.Fatalf("expected block %s, got %s", want.CID, got.CID)
+			}
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	root := newBlock(t, gocid.NewPrefixV0(multihash.SHA2_256), "root").CID
+	// {"roots": [root], "version": 1} in dag-cbor
+	want := "a265726f6f747381d82a5823" + "00" + hex.EncodeToString(root.Bytes()) + "6776657273696f6e01"
+	if got := hex.EncodeToString(encodeHeader([]gocid.Cid{root})); got != want {
+		t.Fatalf("expected header %s, got %s", want, got)
+	}
+	// unknown fields are ignored
+	data, _ := hex.DecodeString("a3" + "65726f6f747381d82a5823" + "00" + hex.EncodeToString(root.Bytes()) +
+		"656f7468657282f563616263" + "6776657273696f6e01")
+	version, roots, err := decodeHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 || len(roots) != 1 || !roots[0].Equals(root) {
+		t.Fatalf("unexpected header %v %v", version, roots)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	block := newBlock(t, gocid.NewPrefixV1(gocid.Raw, multihash.SHA2_256), "block")
+	valid := writeArchive(t, []gocid.Cid{block.CID}, []*Block{block})
+	corrupt := append([]byte{}, valid...)
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	tooLarge := writeArchive(t, []gocid.Cid{block.CID}, nil)
+	length := make([]byte, binary.MaxVarintLen64)
+	tooLarge = append(tooLarge, length[:binary.PutUvarint(length, maxSectionSize+1)]...)
+
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr error
+	}{
+		{"Empty", nil, nil},
+		{"NotCBOR", []byte{0x02, 0xff, 0xff}, nil},
+		{"NoRoots", section(encodeHeaderVersion(1)), ErrNoRoots},
+		{"Version", section(encodeHeaderVersion(3)), ErrUnsupportedVersion},
+		{"Corrupt", corrupt, nil},
+		{"Truncated", valid[:len(valid)-1], nil},
+		{"TooLarge", tooLarge, ErrSectionTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(tt.archive))
+			if err == nil {
+				_, err = r.Next()
+			}
+			if err == nil || err == io.EOF {
+				t.Fatalf("expected error, got %v", err)
+			}
+			if tt.wantErr != nil && err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func newBlock(t *testing.T, prefix gocid.Prefix, data string) *Block {
+	id, err := prefix.Sum([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Block{CID: id, Data: []byte(data)}
+}
+
+func writeArchive(t *testing.T, roots []gocid.Cid, blocks []*Block) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blocks {
+		if err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// wrapV2 returns a version 2 archive holding a version 1 archive,
+// with padding before and after it, as well as an index
+func wrapV2(v1 []byte) []byte {
+	pragma, _ := hex.DecodeString("0aa16776657273696f6e02")
+	header := make([]byte, v2HeaderSize)
+	offset := uint64(len(pragma) + len(header) + 8)
+	binary.LittleEndian.PutUint64(header[16:], offset)
+	binary.LittleEndian.PutUint64(header[24:], uint64(len(v1)))
+	binary.LittleEndian.PutUint64(header[32:], offset+uint64(len(v1))+8)
+	out := append(pragma, header...)
+	out = append(out, make([]byte, 8)...)
+	out = append(out, v1...)
+	out = append(out, make([]byte, 8)...)
+	return append(out, []byte("index")...)
+}
+
+// encodeHeaderVersion returns a header without roots of the given version
+func encodeHeaderVersion(version uint64) []byte {
+	out := appendHead(nil, cborMap, 1)
+	out = appendText(out, "version")
+	return appendHead(out, cborUint, version)
+}
+
+func section(data []byte) []byte {
+	length := make([]byte, binary.MaxVarintLen64)
+	return append(length[:binary.PutUvarint(length, uint64(len(data)))], data...)
+}
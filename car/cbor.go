@@ -0,0 +1,245 @@
+package car
+
+import (
+	"errors"
+	"fmt"
+
+	gocid "github.com/ipfs/go-cid"
+)
+
+// headers are dag-cbor maps of the form {"roots": [cid...], "version": n}.
+// Only the subset of cbor needed to read and write them is implemented
+
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+	// cidTag is the cbor tag of cids in dag-cbor
+	cidTag = 42
+	// maxDepth is how deeply nested the items of headers may be
+	maxDepth = 32
+)
+
+var errTruncated = errors.New("cbor is truncated")
+
+// encodeHeader returns the header of an archive of version 1 with the given roots
+func encodeHeader(roots []gocid.Cid) []byte {
+	out := appendHead(nil, cborMap, 2)
+	out = appendText(out, "roots")
+	out = appendHead(out, cborArray, uint64(len(roots)))
+	for _, root := range roots {
+		id := root.Bytes()
+		out = appendHead(out, cborTag, cidTag)
+		// cids are prefixed with the identity multibase
+		out = appendHead(out, cborBytes, uint64(len(id)+1))
+		out = append(out, 0)
+		out = append(out, id...)
+	}
+	out = appendText(out, "version")
+	return appendHead(out, cborUint, 1)
+}
+
+func appendText(out []byte, s string) []byte {
+	return append(appendHead(out, cborText, uint64(len(s))), s...)
+}
+
+// appendHead appends the head of a cbor item, which is its
+// major type and an argument, encoded in as few bytes as possible
+func appendHead(out []byte, major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return append(out, major|byte(arg))
+	case arg <= 0xff:
+		return append(out, major|24, byte(arg))
+	case arg <= 0xffff:
+		return append(out, major|25, byte(arg>>8), byte(arg))
+	case arg <= 0xffffffff:
+		return append(out, major|26, byte(arg>>24), byte(arg>>16), byte(arg>>8), byte(arg))
+	default:
+		out = append(out, major|27)
+		for shift := 56; shift >= 0; shift -= 8 {
+			out = append(out, byte(arg>>uint(shift)))
+		}
+		return out
+	}
+}
+
+// decodeHeader returns the version and roots of an archive header.
+// Fields other than roots and version are ignored
+func decodeHeader(data []byte) (uint64, []gocid.Cid, error) {
+	d := &decoder{data: data}
+	major, entries, err := d.head()
+	if err != nil {
+		return 0, nil, err
+	}
+	if major != cborMap {
+		return 0, nil, errors.New("header is not a map")
+	}
+	var (
+		version uint64
+		roots   []gocid.Cid
+	)
+	for i := uint64(0); i < entries; i++ {
+		key, err := d.text()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch key {
+		case "version":
+			major, arg, err := d.head()
+			if err != nil {
+				return 0, nil, err
+			}
+			if major != cborUint {
+				return 0, nil, errors.New("version is not an integer")
+			}
+			version = arg
+		case "roots":
+			if roots, err = d.cids(); err != nil {
+				return 0, nil, err
+			}
+		default:
+			if err := d.skip(0); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	if d.pos != len(d.data) {
+		return 0, nil, errors.New("header has trailing data")
+	}
+	return version, roots, nil
+}
+
+// decoder reads cbor items from data
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+// head reads the head of an item, returning its major type and argument
+func (d *decoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, errTruncated
+	}
+	major, info := d.data[d.pos]>>5, d.data[d.pos]&0x1f
+	d.pos++
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		// indefinite lengths are not allowed in dag-cbor
+		return 0, 0, fmt.Errorf("unsupported cbor argument %v", info)
+	}
+	if len(d.data)-d.pos < size {
+		return 0, 0, errTruncated
+	}
+	var arg uint64
+	for _, b := range d.data[d.pos : d.pos+size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.pos += size
+	return major, arg, nil
+}
+
+// bytes reads the content of a byte or text string of the given length
+func (d *decoder) bytes(length uint64) ([]byte, error) {
+	if uint64(len(d.data)-d.pos) < length {
+		return nil, errTruncated
+	}
+	out := d.data[d.pos : d.pos+int(length)]
+	d.pos += int(length)
+	return out, nil
+}
+
+// text reads a text string
+func (d *decoder) text() (string, error) {
+	major, length, err := d.head()
+	if err != nil {
+		return "", err
+	}
+	if major != cborText {
+		return "", errors.New("map key is not a string")
+	}
+	out, err := d.bytes(length)
+	return string(out), err
+}
+
+// cids reads an array of cids
+func (d *decoder) cids() ([]gocid.Cid, error) {
+	major, length, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborArray {
+		return nil, errors.New("roots is not an array")
+	}
+	var out []gocid.Cid
+	for i := uint64(0); i < length; i++ {
+		if major, tag, err := d.head(); err != nil {
+			return nil, err
+		} else if major != cborTag || tag != cidTag {
+			return nil, errors.New("root is not a cid")
+		}
+		major, size, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if major != cborBytes {
+			return nil, errors.New("root is not a cid")
+		}
+		id, err := d.bytes(size)
+		if err != nil {
+			return nil, err
+		}
+		if len(id) == 0 || id[0] != 0 {
+			return nil, errors.New("root is not prefixed with the identity multibase")
+		}
+		root, err := gocid.Cast(id[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid root: %s", err)
+		}
+		out = append(out, root)
+	}
+	return out, nil
+}
+
+// skip reads past an item, nested depth items deep
+func (d *decoder) skip(depth int) error {
+	if depth > maxDepth {
+		return errors.New("header is nested too deeply")
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborBytes, cborText:
+		_, err = d.bytes(arg)
+		return err
+	case cborArray:
+		for i := uint64(0); i < arg; i++ {
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+		}
+	case cborMap:
+		for i := uint64(0); i < arg; i++ {
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+		}
+	case cborTag:
+		return d.skip(depth + 1)
+	}
+	return nil
+}
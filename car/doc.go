@@ -0,0 +1,10 @@
+// Package car reads and writes content addressable archives, the format
+// used to move ipfs dags between nodes and pinning services in bulk. An
+// archive has a header listing the cids of its roots, followed by blocks,
+// each stored alongside its cid. Version 1 and 2 archives are read, with the
+// index of version 2 archives ignored, while version 1 archives are written
+// as they can be streamed without knowing their size ahead of time. The
+// format is specified at https://ipld.io/specs/transport/car. Blocks are
+// read from and added to ipfs nodes one at a time with GetBlock and PutBlock,
+// which are also used to beam dags between networks.
+package car
@@ -0,0 +1,60 @@
+package car
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api"
+	"github.com/RTradeLtd/rtfs/v2"
+	gocid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// GetBlock reads a block from the node manager is connected to
+func GetBlock(ctx context.Context, manager rtfs.Manager, id gocid.Cid) (*Block, error) {
+	resp, err := manager.CustomRequest(ctx, manager.NodeAddress(), "block/get", nil, id.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Output, maxSectionSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSectionSize {
+		return nil, ErrSectionTooLarge
+	}
+	return &Block{CID: id, Data: data}, nil
+}
+
+// PutBlock adds a block to ipfs, checking it is stored under the same cid
+func PutBlock(shell *ipfsapi.Shell, block *Block) error {
+	prefix := block.CID.Prefix()
+	// the format of version 0 cids is v0, and the codec of all others
+	format := "v0"
+	if prefix.Version != 0 {
+		name, ok := gocid.CodecToStr[prefix.Codec]
+		if !ok {
+			return fmt.Errorf("block %s has an unsupported codec", block.CID)
+		}
+		format = name
+	}
+	mhType, ok := multihash.Codes[prefix.MhType]
+	if !ok {
+		return fmt.Errorf("block %s has an unsupported hash", block.CID)
+	}
+	key, err := shell.BlockPut(block.Data, format, mhType, prefix.MhLength)
+	if err != nil {
+		return err
+	}
+	if id, err := gocid.Decode(key); err != nil || !id.Equals(block.CID) {
+		return errors.New("block " + block.CID.String() + " was stored as " + key)
+	}
+	return nil
+}
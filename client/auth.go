@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// token is the response of the login and refresh routes
+type token struct {
+	Token  string    `json:"token"`
+	Expire time.Time `json:"expire"`
+}
+
+// Login logs in with a username or email address, and password. The
+// credentials are kept to log in again once the token can not be refreshed
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.username, c.password = username, password
+	return c.login(ctx)
+}
+
+// Refresh exchanges the token for a new one, which must be done before it
+// expires. Tokens are refreshed automatically while making requests
+func (c *Client) Refresh(ctx context.Context) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.token == "" {
+		return ErrNotAuthenticated
+	}
+	return c.refresh(ctx)
+}
+
+// Token returns the current token and when it expires, which may be saved
+// and given to a later client through Options
+func (c *Client) Token() (string, time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.token, c.expire
+}
+
+// authorization returns the token to authenticate a request with, logging
+// in or refreshing the token first if needed
+func (c *Client) authorization(ctx context.Context) (string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.token == "" {
+		if c.username == "" {
+			return "", ErrNotAuthenticated
+		}
+		if err := c.login(ctx); err != nil {
+			return "", err
+		}
+		return c.token, nil
+	}
+	if c.expire.IsZero() || c.now().Before(c.expire.Add(-c.opts.RefreshWindow)) {
+		return c.token, nil
+	}
+	if err := c.refresh(ctx); err != nil {
+		switch {
+		case c.username != "":
+			// tokens can only be refreshed for a while after logging in
+			if err := c.login(ctx); err != nil {
+				return "", err
+			}
+		case !c.now().Before(c.expire):
+			return "", err
+		}
+	}
+	return c.token, nil
+}
+
+// reauthenticate logs in again after stale was rejected, unless another
+// request has already replaced it
+func (c *Client) reauthenticate(ctx context.Context, stale string) (string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.token != stale {
+		return c.token, nil
+	}
+	if c.username == "" {
+		return "", ErrNotAuthenticated
+	}
+	if err := c.login(ctx); err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+// login logs in with the stored credentials, and must be called with mux held
+func (c *Client) login(ctx context.Context) error {
+	var resp token
+	if err := c.send(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/auth/login",
+		body: map[string]string{
+			"username": c.username,
+			"password": c.password,
+		},
+		public: true,
+		raw:    true,
+	}, "", &resp); err != nil {
+		return err
+	}
+	c.token, c.expire = resp.Token, resp.Expire
+	return nil
+}
+
+// refresh refreshes the stored token, and must be called with mux held
+func (c *Client) refresh(ctx context.Context) error {
+	var resp token
+	if err := c.send(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/auth/refresh",
+		raw:    true,
+	}, c.token, &resp); err != nil {
+		return err
+	}
+	c.token, c.expire = resp.Token, resp.Expire
+	return nil
+}
@@ -0,0 +1,380 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/eh"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxRetries is how many times a failed request is retried
+	DefaultMaxRetries = 3
+	// DefaultRetryBackoff is the delay before the first retry, which is
+	// doubled for every retry after it
+	DefaultRetryBackoff = time.Millisecond * 500
+	// DefaultMaxBackoff is the longest delay between retries
+	DefaultMaxBackoff = time.Second * 30
+	// DefaultRefreshWindow is how long before it expires a token is refreshed
+	DefaultRefreshWindow = time.Hour
+	// DefaultUserAgent is sent with requests when no user agent is configured
+	DefaultUserAgent = "temporal-go-client"
+)
+
+// headers read by the api middleware
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	requestIDHeader      = "X-Request-Id"
+)
+
+var (
+	// ErrNotAuthenticated is returned when a request requires a token, but
+	// the client has neither a token nor credentials to log in with
+	ErrNotAuthenticated = errors.New("client is not authenticated")
+	// ErrNotReplayable is returned when a request must be sent again, but
+	// its body has already been read and can not be rewound
+	ErrNotReplayable = errors.New("request body can not be sent again")
+)
+
+// Options is used to configure a Client
+type Options struct {
+	// HTTPClient is used to send requests, defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Username and Password are used to log in whenever the client has no
+	// valid token
+	Username string
+	Password string
+	// Token is a previously issued jwt, which expires at TokenExpire
+	Token       string
+	TokenExpire time.Time
+	// MaxRetries is how many times failed requests are retried, retries are
+	// disabled when negative
+	MaxRetries   int
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+	// RefreshWindow is how long before it expires a token is refreshed
+	RefreshWindow time.Duration
+	UserAgent     string
+}
+
+// Error is returned when the api responds with an error status
+type Error struct {
+	// StatusCode is the http status of the response
+	StatusCode int
+	// Code identifies the error, the codes in use are listed by the eh package
+	Code    eh.Code
+	Message string
+	// Retryable indicates the request may succeed if it is retried later
+	Retryable bool
+	Details   interface{}
+	// RequestID identifies the request in the api logs
+	RequestID string
+
+	retryAfter time.Duration
+}
+
+// Error returns the error message along with its code
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Client is used to make requests to the Temporal v2 api. It is safe for
+// concurrent use
+type Client struct {
+	endpoint string
+	http     *http.Client
+	opts     Options
+
+	// mux guards the credentials, and serializes logging in
+	mux      sync.Mutex
+	username string
+	password string
+	token    string
+	expire   time.Time
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a client of the api served at endpoint, such as
+// https://api.temporal.cloud
+func New(endpoint string, opts Options) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q, expected an http or https url", endpoint)
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.RefreshWindow <= 0 {
+		opts.RefreshWindow = DefaultRefreshWindow
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent
+	}
+	return &Client{
+		endpoint: strings.TrimSuffix(u.String(), "/"),
+		http:     opts.HTTPClient,
+		opts:     opts,
+		username: opts.Username,
+		password: opts.Password,
+		token:    opts.Token,
+		expire:   opts.TokenExpire,
+		now:      time.Now,
+		sleep:    sleep,
+	}, nil
+}
+
+// request describes a call to the api
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	// body is sent as json
+	body interface{}
+	// form is sent as a multipart form instead of body
+	form *multipartForm
+	// public requests are sent without a token
+	public bool
+	// raw responses are decoded as is, rather than from the response field
+	raw bool
+	// key is the idempotency key of a mutating request, which is kept for
+	// every attempt, including the one made after logging in again
+	key string
+}
+
+// open returns the body of the request and its content type
+func (r *request) open() (io.Reader, string, error) {
+	switch {
+	case r.form != nil:
+		return r.form.open()
+	case r.body != nil:
+		data, err := json.Marshal(r.body)
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(data), "application/json", nil
+	}
+	return nil, "", nil
+}
+
+// replayable returns whether the request can be sent again
+func (r *request) replayable() bool {
+	return r.form == nil || r.form.replayable()
+}
+
+// mutating returns whether the request is made idempotent with a key
+func (r *request) mutating() bool {
+	switch r.method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return !r.public
+	}
+	return false
+}
+
+// do sends an authenticated request, logging in again and resending it
+// once should the token be rejected
+func (c *Client) do(ctx context.Context, r *request, out interface{}) error {
+	if r.public {
+		return c.send(ctx, r, "", out)
+	}
+	token, err := c.authorization(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.send(ctx, r, token, out)
+	// routes also respond with 401 when a user lacks access to a resource,
+	// which is not fixed by logging in again
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusUnauthorized ||
+		e.Code != eh.Unauthorized || !r.replayable() {
+		return err
+	}
+	if token, err = c.reauthenticate(ctx, token); err != nil {
+		return err
+	}
+	return c.send(ctx, r, token, out)
+}
+
+// send sends a request, retrying it when it fails with a retryable error.
+// Mutating requests are sent with an idempotency key, which is kept between
+// retries so the api processes the request at most once. The api releases
+// the key of requests which fail, so that retries are processed again
+func (c *Client) send(ctx context.Context, r *request, token string, out interface{}) error {
+	if r.mutating() && r.key == "" {
+		r.key = uuid.New().String()
+	}
+	// the request id is kept between retries so they are logged together
+	requestID := uuid.New().String()
+	for attempt := 0; ; attempt++ {
+		err := c.roundTrip(ctx, r, token, r.key, requestID, out)
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.opts.MaxRetries || !r.replayable() || !c.retryable(ctx, err, r.key != "") {
+			return err
+		}
+		if err := c.sleep(ctx, c.backoff(attempt, err)); err != nil {
+			return err
+		}
+	}
+}
+
+// roundTrip sends a single attempt of a request, decoding the response into out
+func (c *Client) roundTrip(ctx context.Context, r *request, token, key, requestID string, out interface{}) error {
+	body, contentType, err := r.open()
+	if err != nil {
+		return err
+	}
+	endpoint := c.endpoint + r.path
+	if len(r.query) > 0 {
+		endpoint += "?" + r.query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	req.Header.Set(requestIDHeader, requestID)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	resp, err := c.http.Do(req)
+	// make sure streamed bodies are no longer being written
+	if closer, ok := body.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeError(resp)
+	}
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	if r.raw {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	var envelope struct {
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return err
+	}
+	return json.Unmarshal(envelope.Response, out)
+}
+
+// retryable returns whether a request which failed with err should be retried
+func (c *Client) retryable(ctx context.Context, err error, keyed bool) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		// requests which failed to be sent may be retried, unlike those
+		// whose response could not be decoded
+		_, sendErr := err.(*url.Error)
+		return sendErr
+	}
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return false
+	case e.StatusCode == http.StatusConflict:
+		// the original request is still being processed
+		return keyed && e.Code == eh.Conflict
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= http.StatusInternalServerError:
+		return true
+	}
+	return e.Retryable
+}
+
+// backoff returns the delay before the given retry
+func (c *Client) backoff(attempt int, err error) time.Duration {
+	delay := c.opts.RetryBackoff << uint(attempt)
+	if delay <= 0 || delay > c.opts.MaxBackoff {
+		delay = c.opts.MaxBackoff
+	}
+	if e, ok := err.(*Error); ok && e.retryAfter > delay {
+		delay = e.retryAfter
+	}
+	return delay
+}
+
+// decodeError reads the error of a failed response
+func decodeError(resp *http.Response) *Error {
+	def := eh.Generic(resp.StatusCode)
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Code:       def.Code,
+		Message:    http.StatusText(resp.StatusCode),
+		Retryable:  def.Retryable,
+		RequestID:  resp.Header.Get(requestIDHeader),
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.retryAfter = time.Duration(seconds) * time.Second
+	}
+	var body struct {
+		Response interface{} `json:"response"`
+		// login failures return a message rather than a response
+		Message string    `json:"message"`
+		Error   *eh.Error `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return e
+	}
+	if message, ok := body.Response.(string); ok && message != "" {
+		e.Message = message
+	} else if body.Message != "" {
+		e.Message = body.Message
+	}
+	if body.Error != nil {
+		e.Code = body.Error.Code
+		e.Retryable = body.Error.Retryable
+		e.Details = body.Error.Details
+	}
+	return e
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,399 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/eh"
+)
+
+// fakeAPI records the requests made to it, responding with the handler
+// registered for their path
+type fakeAPI struct {
+	mux      sync.Mutex
+	requests []*http.Request
+	handlers map[string]http.HandlerFunc
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.Lock()
+	f.requests = append(f.requests, r)
+	handler, ok := f.handlers[r.URL.Path]
+	f.mux.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	handler(w, r)
+}
+
+func (f *fakeAPI) calls(path string) []*http.Request {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	var calls []*http.Request
+	for _, r := range f.requests {
+		if r.URL.Path == path {
+			calls = append(calls, r)
+		}
+	}
+	return calls
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func fail(w http.ResponseWriter, status int, message string) {
+	respond(w, status, map[string]interface{}{
+		"code":     status,
+		"response": message,
+		"error":    eh.New(message, status),
+	})
+}
+
+func newTestClient(t *testing.T, api *fakeAPI, opts Options) *Client {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	c, err := New(server.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sleep = func(context.Context, time.Duration) error { return nil }
+	return c
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("localhost:6767", Options{}); err == nil {
+		t.Fatal("expected endpoint without a scheme to fail")
+	}
+	c, err := New("https://api.temporal.cloud/", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.endpoint != "https://api.temporal.cloud" || c.opts.MaxRetries != DefaultMaxRetries {
+		t.Fatalf("unexpected client %+v", c)
+	}
+}
+
+func TestClient_Login(t *testing.T) {
+	now := time.Now()
+	api := &fakeAPI{handlers: map[string]http.HandlerFunc{
+		"/v2/auth/login": func(w http.ResponseWriter, r *http.Request) {
+			var login map[string]string
+			json.NewDecoder(r.Body).Decode(&login)
+			if login["username"] != "testuser" || login["password"] != "admin" {
+				respond(w, 401, map[string]interface{}{
+					"code":    401,
+					"message": "incorrect Username or Password",
+					"error":   eh.New("incorrect Username or Password", 401),
+				})
+				return
+			}
+			respond(w, 200, map[string]interface{}{"code": 200, "token": "login", "expire": now.Add(time.Hour * 24)})
+		},
+		"/v2/auth/refresh": func(w http.ResponseWriter, r *http.Request) {
+			respond(w, 200, map[string]interface{}{"code": 200, "token": "refreshed", "expire": now.Add(time.Hour * 48)})
+		},
+	}}
+	c := newTestClient(t, api, Options{})
+	err := c.Login(context.Background(), "testuser", "wrong")
+	if e, ok := err.(*Error); !ok || e.StatusCode != 401 || e.Code != eh.Unauthorized || e.Message != "incorrect Username or Password" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := c.Login(context.Background(), "testuser", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if token, expire := c.Token(); token != "login" || !expire.Equal(now.Add(time.Hour*24)) {
+		t.Fatalf("unexpected token %s expiring %s", token, expire)
+	}
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	refreshes := api.calls("/v2/auth/refresh")
+	if len(refreshes) != 1 || refreshes[0].Header.Get("Authorization") != "Bearer login" {
+		t.Fatalf("unexpected refresh requests %v", refreshes)
+	}
+	if token, _ := c.Token(); token != "refreshed" {
+		t.Fatalf("unexpected token %s", token)
+	}
+}
+
+func TestClient_authorization(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		opts        Options
+		refreshFail bool
+		wantToken   string
+		wantErr     error
+	}{
+		{"NoCredentials", Options{}, false, "", ErrNotAuthenticated},
+		{"Login", Options{Username: "testuser", Password: "admin"}, false, "login", nil},
+		{"Valid", Options{Token: "valid", TokenExpire: now.Add(time.Hour * 2)}, false, "valid", nil},
+		{"Refresh", Options{Token: "valid", TokenExpire: now.Add(time.Minute)}, false, "refreshed", nil},
+		{"RefreshFailed", Options{Token: "valid", TokenExpire: now.Add(time.Minute)}, true, "valid", nil},
+		{"RefreshFailedLogin", Options{
+			Username: "testuser", Password: "admin", Token: "valid", TokenExpire: now.Add(time.Minute),
+		}, true, "login", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeAPI{handlers: map[string]http.HandlerFunc{
+				"/v2/auth/login": func(w http.ResponseWriter, r *http.Request) {
+					respond(w, 200, map[string]interface{}{"code": 200, "token": "login", "expire": now.Add(time.Hour * 24)})
+				},
+				"/v2/auth/refresh": func(w http.ResponseWriter, r *http.Request) {
+					if tt.refreshFail {
+						fail(w, 401, "Token is expired")
+						return
+					}
+					respond(w, 200, map[string]interface{}{"code": 200, "token": "refreshed", "expire": now.Add(time.Hour * 24)})
+				},
+			}}
+			c := newTestClient(t, api, tt.opts)
+			token, err := c.authorization(context.Background())
+			if err != tt.wantErr {
+				t.Fatalf("authorization() error = %v, want %v", err, tt.wantErr)
+			}
+			if token != tt.wantToken {
+				t.Fatalf("authorization() = %v, want %v", token, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestClient_reauthenticate(t *testing.T) {
+	api := &fakeAPI{handlers: map[string]http.HandlerFunc{
+		"/v2/auth/login": func(w http.ResponseWriter, r *http.Request) {
+			respond(w, 200, map[string]interface{}{"code": 200, "token": "login", "expire": time.Now().Add(time.Hour * 24)})
+		},
+		"/v2/account/credits/available": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer login" {
+				fail(w, 401, "signature is invalid")
+				return
+			}
+			respond(w, 200, map[string]interface{}{"code": 200, "response": 10.5})
+		},
+		"/v2/ipfs/private/network/start": func(w http.ResponseWriter, r *http.Request) {
+			fail(w, 401, eh.PrivateNetworkAccessError)
+		},
+	}}
+	c := newTestClient(t, api, Options{Username: "testuser", Password: "admin", Token: "revoked"})
+	credits, err := c.Credits(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credits != 10.5 {
+		t.Fatalf("unexpected credits %v", credits)
+	}
+	if calls := api.calls("/v2/auth/login"); len(calls) != 1 {
+		t.Fatalf("expected a single login, got %v", len(calls))
+	}
+	// lacking access to a resource does not log in again
+	if _, err := c.StartNetwork(context.Background(), "myspace"); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls := api.calls("/v2/auth/login"); len(calls) != 1 {
+		t.Fatalf("expected a single login, got %v", len(calls))
+	}
+}
+
+func TestClient_retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     []int
+		message      string
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"ServerError", []int{500, 503}, "", false, 3},
+		{"RateLimited", []int{429}, "", false, 2},
+		{"Conflict", []int{409}, "request with this idempotency key is already being processed", false, 2},
+		{"RetryableError", []int{400}, eh.IPFSAddError, false, 2},
+		{"BadRequest", []int{400}, eh.MaxHoldTimeError, true, 1},
+		{"TooManyFailures", []int{500, 500, 500, 500}, "", true, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			api := &fakeAPI{handlers: map[string]http.HandlerFunc{
+				"/v2/ipfs/public/pin/" + testHash: func(w http.ResponseWriter, r *http.Request) {
+					attempts++
+					if attempts <= len(tt.failures) {
+						message := tt.message
+						if message == "" {
+							message = http.StatusText(tt.failures[attempts-1])
+						}
+						fail(w, tt.failures[attempts-1], message)
+						return
+					}
+					respond(w, 200, map[string]interface{}{"code": 200, "response": "pin request sent to backend"})
+				},
+			}}
+			c := newTestClient(t, api, Options{Token: "token"})
+			err := c.Pin(context.Background(), testHash, PinOptions{HoldTime: 1})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Pin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			calls := api.calls("/v2/ipfs/public/pin/" + testHash)
+			if len(calls) != tt.wantAttempts {
+				t.Fatalf("got %v attempts, want %v", len(calls), tt.wantAttempts)
+			}
+			key := calls[0].Header.Get(idempotencyKeyHeader)
+			if key == "" {
+				t.Fatal("no idempotency key sent")
+			}
+			// retries keep the key, so the api processes the request at most once
+			for _, call := range calls[1:] {
+				if call.Header.Get(idempotencyKeyHeader) != key {
+					t.Fatal("retry changed idempotency key")
+				}
+				if call.Header.Get(requestIDHeader) != calls[0].Header.Get(requestIDHeader) {
+					t.Fatal("retry changed request id")
+				}
+			}
+		})
+	}
+}
+
+func TestClient_Upload(t *testing.T) {
+	var attempts int
+	api := &fakeAPI{handlers: map[string]http.HandlerFunc{
+		"/v2/ipfs/public/file/add": func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				fail(w, 400, err.Error())
+				return
+			}
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				fail(w, 400, err.Error())
+				return
+			}
+			data, _ := ioutil.ReadAll(file)
+			if string(data) != "hello world" || header.Filename != "hello.txt" || r.FormValue("hold_time") != "5" {
+				fail(w, 400, "unexpected form")
+				return
+			}
+			if attempts == 1 {
+				fail(w, 503, "the service is temporarily unavailable")
+				return
+			}
+			respond(w, 200, map[string]interface{}{"code": 200, "response": testHash})
+		},
+	}}
+	c := newTestClient(t, api, Options{Token: "token"})
+
+	// seekable files are rewound to be retried
+	hash, err := c.Upload(context.Background(), strings.NewReader("hello world"), "hello.txt", UploadOptions{HoldTime: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != testHash || attempts != 2 {
+		t.Fatalf("unexpected hash %s after %v attempts", hash, attempts)
+	}
+
+	// streams are not
+	attempts = 0
+	_, err = c.Upload(context.Background(), ioutil.NopCloser(strings.NewReader("hello world")), "hello.txt", UploadOptions{HoldTime: 5})
+	if e, ok := err.(*Error); !ok || e.StatusCode != 503 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("stream was sent %v times", attempts)
+	}
+}
+
+func TestPager(t *testing.T) {
+	records := []string{"a", "b", "c", "d", "e"}
+	api := &fakeAPI{handlers: map[string]http.HandlerFunc{
+		"/v2/database/uploads": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("paged") != "true" {
+				fail(w, 400, "not paged")
+				return
+			}
+			var page, limit int
+			json.Unmarshal([]byte(r.URL.Query().Get("page")), &page)
+			json.Unmarshal([]byte(r.URL.Query().Get("limit")), &limit)
+			start, end := (page-1)*limit, page*limit
+			if start > len(records) {
+				start = len(records)
+			}
+			if end > len(records) {
+				end = len(records)
+			}
+			respond(w, 200, map[string]interface{}{"code": 200, "response": map[string]interface{}{
+				"total_record": len(records),
+				"total_page":   (len(records) + limit - 1) / limit,
+				"records":      records[start:end],
+				"limit":        limit,
+				"page":         page,
+			}})
+		},
+	}}
+	c := newTestClient(t, api, Options{Token: "token"})
+
+	pages := c.Uploads(2)
+	var got [][]string
+	for pages.Next(context.Background()) {
+		var page []string
+		if err := pages.Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, page)
+	}
+	if err := pages.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || strings.Join(got[2], ",") != "e" {
+		t.Fatalf("unexpected pages %v", got)
+	}
+
+	var all []string
+	if err := c.Uploads(0).All(context.Background(), &all); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(all, ",") != "a,b,c,d,e" {
+		t.Fatalf("unexpected records %v", all)
+	}
+	if err := c.Uploads(0).All(context.Background(), all); err == nil {
+		t.Fatal("expected records which are not a pointer to fail")
+	}
+
+	// an empty result has no pages
+	records = nil
+	pages = c.Uploads(0)
+	if pages.Next(context.Background()) {
+		t.Fatal("expected no pages")
+	}
+	if pages.Err() != nil {
+		t.Fatal(pages.Err())
+	}
+
+	// errors stop iteration
+	api.mux.Lock()
+	api.handlers["/v2/database/uploads"] = func(w http.ResponseWriter, r *http.Request) {
+		fail(w, 400, eh.UploadSearchError)
+	}
+	api.mux.Unlock()
+	pages = c.Uploads(0)
+	if pages.Next(context.Background()) {
+		t.Fatal("expected no pages")
+	}
+	var e *Error
+	if !errors.As(pages.Err(), &e) || e.Message != eh.UploadSearchError {
+		t.Fatalf("unexpected error %v", pages.Err())
+	}
+}
+
+const testHash = "QmS4ustL54uo8FzR9455qaxZwuMiUhyvMcX9Ba8nUH4uVv"
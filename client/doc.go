@@ -0,0 +1,7 @@
+// Package client is a Go client for the Temporal v2 api. A Client logs in
+// with a username and password, or is given an existing token, and keeps the
+// token fresh by refreshing it before it expires and logging in again when it
+// is rejected. Mutating requests are sent with an Idempotency-Key, so that
+// requests which fail with a retryable error are safely retried without being
+// processed twice. Paged routes are read through a Pager.
+package client
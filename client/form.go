@@ -0,0 +1,77 @@
+package client
+
+import (
+	"io"
+	"mime/multipart"
+	"net/url"
+)
+
+// multipartForm streams a file and form fields as a multipart body, without
+// holding the file in memory
+type multipartForm struct {
+	fields   url.Values
+	fileName string
+	file     io.Reader
+	// start is the offset seekable files are rewound to when the form is
+	// sent again, and is negative for files that can not be rewound
+	start int64
+	sent  bool
+	// done is closed once the previous body has been written
+	done chan struct{}
+}
+
+func newMultipartForm(file io.Reader, fileName string, fields url.Values) *multipartForm {
+	f := &multipartForm{fields: fields, fileName: fileName, file: file, start: -1}
+	if s, ok := file.(io.Seeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			f.start = start
+		}
+	}
+	return f
+}
+
+// replayable returns whether the form can be sent again
+func (f *multipartForm) replayable() bool {
+	return !f.sent || f.start >= 0
+}
+
+// open returns a body streaming the form, along with its content type
+func (f *multipartForm) open() (io.Reader, string, error) {
+	if f.sent {
+		if f.start < 0 {
+			return nil, "", ErrNotReplayable
+		}
+		<-f.done
+		if _, err := f.file.(io.Seeker).Seek(f.start, io.SeekStart); err != nil {
+			return nil, "", err
+		}
+	}
+	f.sent = true
+	f.done = make(chan struct{})
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	go func() {
+		defer close(f.done)
+		// the write fails once the body is closed by the http client
+		pw.CloseWithError(f.write(w))
+	}()
+	return pr, w.FormDataContentType(), nil
+}
+
+func (f *multipartForm) write(w *multipart.Writer) error {
+	for name, values := range f.fields {
+		for _, value := range values {
+			if err := w.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	part, err := w.CreateFormFile("file", f.fileName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f.file); err != nil {
+		return err
+	}
+	return w.Close()
+}
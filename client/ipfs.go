@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// PinOptions configures a pin
+type PinOptions struct {
+	// HoldTime is the number of months to pin the content for
+	HoldTime int64
+	// FileName is the name to record the upload under
+	FileName string
+}
+
+// UploadOptions configures an upload
+type UploadOptions struct {
+	// HoldTime is the number of months to pin the content for
+	HoldTime int64
+	// HashType is the multihash type, defaulting to sha2-256
+	HashType string
+	// Passphrase encrypts the file before it is added when given
+	Passphrase string
+}
+
+func (opts UploadOptions) fields() url.Values {
+	fields := url.Values{"hold_time": {strconv.FormatInt(opts.HoldTime, 10)}}
+	if opts.HashType != "" {
+		fields.Set("hash_type", opts.HashType)
+	}
+	if opts.Passphrase != "" {
+		fields.Set("passphrase", opts.Passphrase)
+	}
+	return fields
+}
+
+// Pin pins content to the public ipfs network
+func (c *Client) Pin(ctx context.Context, hash string, opts PinOptions) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipfs/public/pin/" + url.PathEscape(hash),
+		body: map[string]interface{}{
+			"hold_time": opts.HoldTime,
+			"file_name": opts.FileName,
+		},
+	}, nil)
+}
+
+// ExtendPin extends the pin of content by holdTime months
+func (c *Client) ExtendPin(ctx context.Context, hash string, holdTime int64) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipfs/public/pin/" + url.PathEscape(hash) + "/extend",
+		body:   map[string]interface{}{"hold_time": holdTime},
+	}, nil)
+}
+
+// Upload streams a file to the public ipfs network, returning its hash. The
+// upload is only retried if file is an io.Seeker, such as an *os.File
+func (c *Client) Upload(ctx context.Context, file io.Reader, fileName string, opts UploadOptions) (string, error) {
+	var hash string
+	err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipfs/public/file/add",
+		form:   newMultipartForm(file, fileName, opts.fields()),
+	}, &hash)
+	return hash, err
+}
+
+// Uploads returns a pager over uploads, newest first, with records of type
+// models.Upload
+func (c *Client) Uploads(limit int) *Pager {
+	return c.pagedQuery("/v2/database/uploads", url.Values{"paged": {"true"}}, limit)
+}
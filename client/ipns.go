@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// IPNSOptions configures the publishing of an ipns record
+type IPNSOptions struct {
+	// Hash is the content hash the record points to
+	Hash string
+	// Key is the name of the key to publish with
+	Key string
+	// LifeTime is how long the record is valid for
+	LifeTime time.Duration
+	// TTL is how long the record may be cached for
+	TTL time.Duration
+	// Resolve resolves the hash before publishing
+	Resolve bool
+}
+
+// PublishIPNS publishes an ipns record. Records are published in the
+// background, and listed by IPNSRecords once published
+func (c *Client) PublishIPNS(ctx context.Context, opts IPNSOptions) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipns/public/publish/details",
+		body: map[string]interface{}{
+			"hash":      opts.Hash,
+			"key":       opts.Key,
+			"life_time": opts.LifeTime.String(),
+			"ttl":       opts.TTL.String(),
+			"resolve":   opts.Resolve,
+		},
+	}, nil)
+}
+
+// IPNSRecords returns a pager over published ipns records, newest first,
+// with records of type models.IPNS
+func (c *Client) IPNSRecords(limit int) *Pager {
+	return c.pagedQuery("/v2/ipns/records", url.Values{"paged": {"true"}}, limit)
+}
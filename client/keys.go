@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Key types accepted by CreateKey
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeED25519 = "ed25519"
+)
+
+// Keys lists the names of ipfs keys, and the ids at the same index
+type Keys struct {
+	Names []string `json:"key_names"`
+	IDs   []string `json:"key_ids"`
+}
+
+// Keys returns the ipfs keys of the user
+func (c *Client) Keys(ctx context.Context) (*Keys, error) {
+	var keys Keys
+	if err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/account/key/ipfs/get",
+	}, &keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// CreateKey creates an ipfs key of the given type and size in bits. Keys are
+// created in the background, and returned by Keys once created
+func (c *Client) CreateKey(ctx context.Context, name, keyType string, bits int) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/account/key/ipfs/new",
+		body: map[string]interface{}{
+			"key_name": name,
+			"key_type": keyType,
+			"key_bits": bits,
+		},
+	}, nil)
+}
+
+// ExportKey returns an ipfs key as a mnemonic phrase. Exported keys are
+// removed from temporal, so can no longer be used to publish records
+func (c *Client) ExportKey(ctx context.Context, name string) (string, error) {
+	var phrase string
+	err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/account/key/export/" + url.PathEscape(name),
+	}, &phrase)
+	return phrase, err
+}
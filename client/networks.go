@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/RTradeLtd/database/v2/models"
+	pbOrch "github.com/RTradeLtd/grpc/nexus"
+)
+
+// NetworkOptions configures a new private network
+type NetworkOptions struct {
+	// SwarmKey is generated when not given
+	SwarmKey       string
+	BootstrapPeers []string
+	// Users are allowed to access the network, in addition to its creator
+	Users []string
+}
+
+// CreatedNetwork describes a newly created private network
+type CreatedNetwork struct {
+	ID          uint     `json:"id"`
+	PeerID      string   `json:"peer_id"`
+	NetworkName string   `json:"network_name"`
+	SwarmKey    string   `json:"swarm_key"`
+	Users       []string `json:"users"`
+}
+
+// NetworkState is the state of a network after it was started, stopped or removed
+type NetworkState struct {
+	NetworkName string `json:"network_name"`
+	State       string `json:"state"`
+}
+
+// Network describes a private network
+type Network struct {
+	Database *models.HostedNetwork `json:"database"`
+	// NetworkStats are only returned when requested
+	NetworkStats *pbOrch.NetworkStatusReponse `json:"network_stats,omitempty"`
+}
+
+// Networks returns the names of the private networks the user can access
+func (c *Client) Networks(ctx context.Context) ([]string, error) {
+	var networks []string
+	err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/ipfs/private/networks",
+	}, &networks)
+	return networks, err
+}
+
+// Network returns a private network, including statistics from its nodes
+// when stats is true
+func (c *Client) Network(ctx context.Context, name string, stats bool) (*Network, error) {
+	var network Network
+	if err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/ipfs/private/network/" + url.PathEscape(name),
+		query:  url.Values{"stats": {strconv.FormatBool(stats)}},
+	}, &network); err != nil {
+		return nil, err
+	}
+	return &network, nil
+}
+
+// CreateNetwork creates and starts a private network
+func (c *Client) CreateNetwork(ctx context.Context, name string, opts NetworkOptions) (*CreatedNetwork, error) {
+	var network CreatedNetwork
+	if err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipfs/private/network/new",
+		body: map[string]interface{}{
+			"network_name":    name,
+			"swarm_key":       opts.SwarmKey,
+			"bootstrap_peers": opts.BootstrapPeers,
+			"users":           opts.Users,
+		},
+	}, &network); err != nil {
+		return nil, err
+	}
+	return &network, nil
+}
+
+// StartNetwork starts the nodes of a stopped private network
+func (c *Client) StartNetwork(ctx context.Context, name string) (*NetworkState, error) {
+	return c.networkState(ctx, http.MethodPost, "/v2/ipfs/private/network/start", name)
+}
+
+// StopNetwork stops the nodes of a private network
+func (c *Client) StopNetwork(ctx context.Context, name string) (*NetworkState, error) {
+	return c.networkState(ctx, http.MethodPost, "/v2/ipfs/private/network/stop", name)
+}
+
+// RemoveNetwork removes a private network, along with all of its data
+func (c *Client) RemoveNetwork(ctx context.Context, name string) (*NetworkState, error) {
+	return c.networkState(ctx, http.MethodDelete, "/v2/ipfs/private/network/remove", name)
+}
+
+func (c *Client) networkState(ctx context.Context, method, path, name string) (*NetworkState, error) {
+	var state NetworkState
+	if err := c.do(ctx, &request{
+		method: method,
+		path:   path,
+		body:   map[string]interface{}{"network_name": name},
+	}, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// AddNetworkUsers allows users to access a private network
+func (c *Client) AddNetworkUsers(ctx context.Context, name string, users ...string) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipfs/private/network/users/add",
+		body:   map[string]interface{}{"network_name": name, "users": users},
+	}, nil)
+}
+
+// RemoveNetworkUsers revokes the access of users to a private network
+func (c *Client) RemoveNetworkUsers(ctx context.Context, name string, users ...string) error {
+	return c.do(ctx, &request{
+		method: http.MethodDelete,
+		path:   "/v2/ipfs/private/network/users/remove",
+		body:   map[string]interface{}{"network_name": name, "users": users},
+	}, nil)
+}
+
+// AddNetworkOwners allows users to manage a private network
+func (c *Client) AddNetworkOwners(ctx context.Context, name string, owners ...string) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipfs/private/network/owners/add",
+		body:   map[string]interface{}{"network_name": name, "owners": owners},
+	}, nil)
+}
+
+// PinToNetwork pins content to a private network
+func (c *Client) PinToNetwork(ctx context.Context, name, hash string, opts PinOptions) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipfs/private/pin/" + url.PathEscape(hash),
+		body: map[string]interface{}{
+			"network_name": name,
+			"hold_time":    opts.HoldTime,
+			"file_name":    opts.FileName,
+		},
+	}, nil)
+}
+
+// UploadToNetwork streams a file to a private network, returning its hash.
+// The hash type can not be chosen for private networks. The upload is only
+// retried if file is an io.Seeker
+func (c *Client) UploadToNetwork(ctx context.Context, name string, file io.Reader, fileName string, opts UploadOptions) (string, error) {
+	fields := opts.fields()
+	fields.Del("hash_type")
+	fields.Set("network_name", name)
+	var hash string
+	err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/ipfs/private/file/add",
+		form:   newMultipartForm(file, fileName, fields),
+	}, &hash)
+	return hash, err
+}
+
+// NetworkUploads returns a pager over the uploads to a private network,
+// newest first, with records of type models.Upload
+func (c *Client) NetworkUploads(name string, limit int) *Pager {
+	return c.pagedQuery(
+		"/v2/ipfs/private/uploads/"+url.PathEscape(name),
+		url.Values{"paged": {"true"}},
+		limit,
+	)
+}
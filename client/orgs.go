@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/RTradeLtd/database/v2/models"
+)
+
+// Organization returns an organization owned by the user
+func (c *Client) Organization(ctx context.Context, name string) (*models.Organization, error) {
+	var org models.Organization
+	if err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/org/get/model",
+		query:  url.Values{"name": {name}},
+	}, &org); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// CreateOrganization creates an organization owned by the user
+func (c *Client) CreateOrganization(ctx context.Context, name string) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/org/new",
+		body:   map[string]interface{}{"name": name},
+	}, nil)
+}
+
+// BillingReport generates a billing report covering the last days of
+// activity of an organization's users
+func (c *Client) BillingReport(ctx context.Context, name string, days int) (*models.BillingReport, error) {
+	var report models.BillingReport
+	if err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/org/get/billing/report",
+		query: url.Values{
+			"name":           {name},
+			"number_of_days": {strconv.Itoa(days)},
+		},
+	}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// OrgUserUploads returns a pager over the uploads of an organization user,
+// with records of type models.Upload
+func (c *Client) OrgUserUploads(name, user string, limit int) *Pager {
+	return newPager(limit, func(ctx context.Context, page, limit int) (*Page, error) {
+		var out Page
+		if err := c.do(ctx, &request{
+			method: http.MethodPost,
+			path:   "/v2/org/user/uploads",
+			body: map[string]interface{}{
+				"name":  name,
+				"user":  user,
+				"page":  page,
+				"limit": limit,
+			},
+		}, &out); err != nil {
+			return nil, err
+		}
+		return &out, nil
+	})
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// DefaultPageLimit is the number of records requested per page
+const DefaultPageLimit = 10
+
+// Page is a page of records returned by a paged route
+type Page struct {
+	TotalRecord int `json:"total_record"`
+	TotalPage   int `json:"total_page"`
+	// Records are decoded with Pager.Decode
+	Records  json.RawMessage `json:"records"`
+	Offset   int             `json:"offset"`
+	Limit    int             `json:"limit"`
+	Page     int             `json:"page"`
+	PrevPage int             `json:"prev_page"`
+	NextPage int             `json:"next_page"`
+}
+
+// Pager iterates over the pages of a paged route, starting at the first:
+//
+//	pages := c.Uploads(50)
+//	for pages.Next(ctx) {
+//		var uploads []models.Upload
+//		if err := pages.Decode(&uploads); err != nil {
+//			return err
+//		}
+//	}
+//	return pages.Err()
+type Pager struct {
+	fetch func(ctx context.Context, page, limit int) (*Page, error)
+	limit int
+	next  int
+	page  *Page
+	err   error
+}
+
+func newPager(limit int, fetch func(ctx context.Context, page, limit int) (*Page, error)) *Pager {
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	return &Pager{fetch: fetch, limit: limit, next: 1}
+}
+
+// pagedQuery returns a pager over a route which is paged with query
+// parameters, such as those using the api's pageIt helper
+func (c *Client) pagedQuery(path string, query url.Values, limit int) *Pager {
+	return newPager(limit, func(ctx context.Context, page, limit int) (*Page, error) {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("page", strconv.Itoa(page))
+		q.Set("limit", strconv.Itoa(limit))
+		var out Page
+		if err := c.do(ctx, &request{
+			method: http.MethodGet,
+			path:   path,
+			query:  q,
+		}, &out); err != nil {
+			return nil, err
+		}
+		return &out, nil
+	})
+}
+
+// Next fetches the next page, returning false once there are no more pages
+// or a request failed, which is returned by Err
+func (p *Pager) Next(ctx context.Context) bool {
+	if p.err != nil || (p.page != nil && p.next > p.page.TotalPage) {
+		return false
+	}
+	page, err := p.fetch(ctx, p.next, p.limit)
+	if err != nil {
+		p.err = err
+		return false
+	}
+	p.page = page
+	p.next = page.Page + 1
+	// empty results still return a first page
+	return page.Page <= page.TotalPage
+}
+
+// Page returns the current page
+func (p *Pager) Page() *Page {
+	return p.page
+}
+
+// Decode decodes the records of the current page into records, which
+// should be a pointer to a slice
+func (p *Pager) Decode(records interface{}) error {
+	if p.page == nil {
+		return errors.New("no page has been fetched")
+	}
+	return json.Unmarshal(p.page.Records, records)
+}
+
+// Err returns the error that stopped iteration, if any
+func (p *Pager) Err() error {
+	return p.err
+}
+
+// All fetches every remaining page, appending their records to records,
+// which must be a pointer to a slice
+func (p *Pager) All(ctx context.Context, records interface{}) error {
+	out := reflect.ValueOf(records)
+	if out.Kind() != reflect.Ptr || out.Elem().Kind() != reflect.Slice {
+		return errors.New("records must be a pointer to a slice")
+	}
+	for p.Next(ctx) {
+		page := reflect.New(out.Elem().Type())
+		if err := p.Decode(page.Interface()); err != nil {
+			return err
+		}
+		out.Elem().Set(reflect.AppendSlice(out.Elem(), page.Elem()))
+	}
+	return p.Err()
+}
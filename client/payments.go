@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RTradeLtd/database/v2/models"
+)
+
+// Payment types accepted by RequestETHPayment
+const (
+	PaymentTypeRTC = "0"
+	PaymentTypeETH = "1"
+)
+
+// SignedPayment is a signed message used to pay for credits through the
+// payment contract, with eth or rtc
+type SignedPayment struct {
+	// ChargeAmountBig is the amount to pay in wei
+	ChargeAmountBig string `json:"charge_amount_big"`
+	// Method is 0 for rtc, and 1 for eth
+	Method        uint8     `json:"method"`
+	PaymentNumber int64     `json:"payment_number"`
+	Prefixed      bool      `json:"prefixed"`
+	V             uint8     `json:"v"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	Formatted     struct {
+		H string `json:"h"`
+		R string `json:"r"`
+		S string `json:"s"`
+	} `json:"formatted"`
+}
+
+// BCHPayment is a pending bch payment for credits
+type BCHPayment struct {
+	DepositAddress string `json:"deposit_address"`
+	// ChargeAmount is the amount to pay in bch
+	ChargeAmount  float64   `json:"charge_amount"`
+	PaymentNumber int64     `json:"payment_number"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// DashPayment is a pending dash payment for credits
+type DashPayment struct {
+	PaymentNumber int64
+	// ChargeAmount is the amount to pay in dash, including the forwarding fee
+	ChargeAmount     float64
+	Blockchain       string
+	Status           string
+	Network          string
+	DepositAddress   string
+	PaymentForwardID string
+}
+
+// StripeIntent is a stripe payment intent for credits, which is completed
+// with stripe using the client secret
+type StripeIntent struct {
+	PaymentIntent  string `json:"payment_intent"`
+	ClientSecret   string `json:"client_secret"`
+	PublishableKey string `json:"publishable_key"`
+}
+
+// Credits returns the credits available to the user
+func (c *Client) Credits(ctx context.Context) (float64, error) {
+	var credits float64
+	err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/account/credits/available",
+	}, &credits)
+	return credits, err
+}
+
+// CreditHistory returns a pager over the credit ledger, newest first, with
+// records of type ledger.Entry
+func (c *Client) CreditHistory(limit int) *Pager {
+	return c.pagedQuery("/v2/account/credits/history", nil, limit)
+}
+
+// RequestETHPayment requests a signed message to buy creditValue usd of
+// credits with eth or rtc, sent from sender
+func (c *Client) RequestETHPayment(ctx context.Context, paymentType, sender string, creditValue float64) (*SignedPayment, error) {
+	var payment SignedPayment
+	if err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/payments/eth/request",
+		body: map[string]interface{}{
+			"payment_type":   paymentType,
+			"sender_address": sender,
+			"credit_value":   creditValue,
+		},
+	}, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// ConfirmETHPayment submits the transaction of an eth or rtc payment
+func (c *Client) ConfirmETHPayment(ctx context.Context, paymentNumber int64, txHash string) (*models.Payment, error) {
+	var payment models.Payment
+	if err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/payments/eth/confirm",
+		body: map[string]interface{}{
+			"payment_number": paymentNumber,
+			"tx_hash":        txHash,
+		},
+	}, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// CreateBCHPayment creates a payment for creditValue usd of credits in bch
+func (c *Client) CreateBCHPayment(ctx context.Context, creditValue float64) (*BCHPayment, error) {
+	var payment BCHPayment
+	if err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/payments/bch/create",
+		body:   map[string]interface{}{"credit_value": creditValue},
+	}, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// ConfirmBCHPayment submits the transaction of a bch payment, which is
+// confirmed in the background
+func (c *Client) ConfirmBCHPayment(ctx context.Context, paymentNumber int64, txHash string) error {
+	return c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/payments/bch/confirm",
+		body: map[string]interface{}{
+			"payment_number": paymentNumber,
+			"tx_hash":        txHash,
+		},
+	}, nil)
+}
+
+// CreateDashPayment creates a payment for creditValue usd of credits in dash
+func (c *Client) CreateDashPayment(ctx context.Context, creditValue float64) (*DashPayment, error) {
+	var payment DashPayment
+	if err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/payments/dash/create",
+		body:   map[string]interface{}{"credit_value": creditValue},
+	}, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// CreateStripeIntent starts buying credits with stripe, for which a receipt
+// is sent to email
+func (c *Client) CreateStripeIntent(ctx context.Context, email string, valueInCents int64) (*StripeIntent, error) {
+	var intent StripeIntent
+	if err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v2/payments/stripe/intent",
+		body: map[string]interface{}{
+			"stripe_email":   email,
+			"value_in_cents": valueInCents,
+		},
+	}, &intent); err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// PaymentConfirmed returns whether a payment has been confirmed, and its
+// credits granted
+func (c *Client) PaymentConfirmed(ctx context.Context, paymentNumber int64) (bool, error) {
+	var confirmed bool
+	err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/v2/payments/status/" + strconv.FormatInt(paymentNumber, 10),
+	}, &confirmed)
+	return confirmed, err
+}
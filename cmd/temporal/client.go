@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/client"
+	"github.com/RTradeLtd/database/v2/models"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// user commands are run against the api of a temporal deployment, rather
+// than the deployment itself, so they are run without a configuration
+
+const (
+	defaultAPI = "https://api.temporal.cloud"
+	// environment variables which override the profile
+	profileEnv  = "TEMPORAL_PROFILE"
+	apiEnv      = "TEMPORAL_API"
+	usernameEnv = "TEMPORAL_USERNAME"
+	passwordEnv = "TEMPORAL_PASSWORD"
+)
+
+// profile is the locally stored credentials of a user
+type profile struct {
+	API      string `json:"api"`
+	Username string `json:"username"`
+	// Password is only stored when logging in with -save-password
+	Password string    `json:"password,omitempty"`
+	Token    string    `json:"token"`
+	Expire   time.Time `json:"expire"`
+}
+
+// profilePath returns where the profile is stored, which defaults to the
+// temporal directory of the user's configuration directory
+func profilePath() (string, error) {
+	if path := os.Getenv(profileEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "temporal", "profile.json"), nil
+}
+
+// loadProfile reads the stored profile, returning an empty profile if the
+// user has not logged in
+func loadProfile() (*profile, error) {
+	path, err := profilePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &profile{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var p profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid profile at %s: %s", path, err)
+	}
+	return &p, nil
+}
+
+// save stores the profile, which is only readable by the user
+func (p *profile) save() error {
+	path, err := profilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first, so the profile is never left half written
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// api returns the url of the api to use
+func (p *profile) api() string {
+	if api := os.Getenv(apiEnv); api != "" {
+		return api
+	}
+	if p.API != "" {
+		return p.API
+	}
+	return defaultAPI
+}
+
+// session is what user commands are run with
+type session struct {
+	profile *profile
+	in      io.Reader
+	out     io.Writer
+	errOut  io.Writer
+	client  *client.Client
+}
+
+// connect returns a client authenticated with the profile, or with the
+// credentials in the environment when given
+func (s *session) connect() (*client.Client, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+	opts := client.Options{
+		Username:    s.profile.Username,
+		Password:    s.profile.Password,
+		Token:       s.profile.Token,
+		TokenExpire: s.profile.Expire,
+	}
+	if username := os.Getenv(usernameEnv); username != "" {
+		opts = client.Options{Username: username, Password: os.Getenv(passwordEnv)}
+	}
+	c, err := client.New(s.profile.api(), opts)
+	if err != nil {
+		return nil, err
+	}
+	s.client = c
+	return c, nil
+}
+
+// flagSet returns the flags of a command, with usage describing its arguments
+func (s *session) flagSet(name, usage string) *flag.FlagSet {
+	f := flag.NewFlagSet(name, flag.ContinueOnError)
+	f.SetOutput(s.errOut)
+	f.Usage = func() {
+		fmt.Fprintf(s.errOut, "usage: temporal %s [flags] %s\n", name, usage)
+		f.PrintDefaults()
+	}
+	return f
+}
+
+// parseArgs parses flags given before or after the positional arguments,
+// such as in "pin <cid> -hold 6", requiring exactly n positional arguments
+func parseArgs(f *flag.FlagSet, args []string, n int) ([]string, error) {
+	var positional []string
+	for {
+		if err := f.Parse(args); err != nil {
+			return nil, err
+		}
+		if args = f.Args(); len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) != n {
+		f.Usage()
+		return nil, fmt.Errorf("expected %v arguments, got %v", n, len(positional))
+	}
+	return positional, nil
+}
+
+// userCommand is a command run against the api. Commands with children
+// run their own action when no child is named
+type userCommand struct {
+	blurb    string
+	run      func(ctx context.Context, s *session, name string, args []string) error
+	children map[string]userCommand
+}
+
+var userCommands = map[string]userCommand{
+	"login": {
+		blurb: "log in to the api, storing the token in a local profile",
+		run:   loginCommand,
+	},
+	"logout": {
+		blurb: "remove the local profile",
+		run:   logoutCommand,
+	},
+	"upload": {
+		blurb: "upload a file, printing its hash",
+		run:   uploadCommand,
+	},
+	"pin": {
+		blurb: "pin content by its hash",
+		run:   pinCommand,
+	},
+	"ipns": {
+		blurb: "ipns record commands",
+		children: map[string]userCommand{
+			"publish": {
+				blurb: "publish an ipns record pointing to a hash",
+				run:   ipnsPublishCommand,
+			},
+		},
+	},
+	"keys": {
+		blurb: "list ipfs keys",
+		run:   keysCommand,
+		children: map[string]userCommand{
+			"new": {
+				blurb: "create an ipfs key",
+				run:   newKeyCommand,
+			},
+		},
+	},
+	"uploads": {
+		blurb: "upload commands",
+		children: map[string]userCommand{
+			"ls": {
+				blurb: "list uploads, newest first",
+				run:   listUploadsCommand,
+			},
+		},
+	},
+	"credits": {
+		blurb: "print available credits",
+		run:   creditsCommand,
+	},
+}
+
+// runUserCommand runs the user command named by args, returning the exit code
+func runUserCommand(ctx context.Context, in io.Reader, out, errOut io.Writer, args []string) int {
+	name := args[0]
+	command, ok := userCommands[name]
+	if !ok {
+		fmt.Fprintf(errOut, "unknown command %s\n", name)
+		return 1
+	}
+	args = args[1:]
+	for len(args) > 0 {
+		child, ok := command.children[args[0]]
+		if !ok {
+			break
+		}
+		name, command, args = name+" "+args[0], child, args[1:]
+	}
+	if command.run == nil {
+		fmt.Fprintf(errOut, "usage: temporal %s <command>\n", name)
+		printUserCommands(errOut, name, command.children)
+		return 1
+	}
+	p, err := loadProfile()
+	if err != nil {
+		fmt.Fprintln(errOut, "failed to load profile:", err)
+		return 1
+	}
+	s := &session{profile: p, in: in, out: out, errOut: errOut}
+	err = command.run(ctx, s, name, args)
+	switch {
+	case err == flag.ErrHelp:
+		return 0
+	case err == client.ErrNotAuthenticated:
+		fmt.Fprintln(errOut, "not logged in, run temporal login first")
+		return 1
+	case err != nil:
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	// store tokens which were refreshed while running the command
+	if s.client != nil && s.profile.Username != "" && os.Getenv(usernameEnv) == "" {
+		if token, expire := s.client.Token(); token != s.profile.Token {
+			s.profile.Token, s.profile.Expire = token, expire
+			if err := s.profile.save(); err != nil {
+				fmt.Fprintln(errOut, "failed to save profile:", err)
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// printUserCommands lists commands, prefixed with the name of their parent
+func printUserCommands(w io.Writer, parent string, commands map[string]userCommand) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", strings.TrimSpace(parent+" "+name), commands[name].blurb)
+	}
+	tw.Flush()
+}
+
+func loginCommand(ctx context.Context, s *session, name string, args []string) error {
+	f := s.flagSet(name, "")
+	api := f.String("api", s.profile.api(), "url of the api")
+	username := f.String("user", s.profile.Username, "username or email address")
+	password := f.String("password", "", "password, which is read from stdin when not given")
+	savePassword := f.Bool("save-password", false,
+		"store the password in the profile, to log in again once the token can not be refreshed")
+	if _, err := parseArgs(f, args, 0); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("a username is required, given with -user")
+	}
+	if *password == "" {
+		var err error
+		if *password, err = readPassword(s); err != nil {
+			return err
+		}
+	}
+	c, err := client.New(*api, client.Options{})
+	if err != nil {
+		return err
+	}
+	if err := c.Login(ctx, *username, *password); err != nil {
+		return err
+	}
+	token, expire := c.Token()
+	s.profile = &profile{API: *api, Username: *username, Token: token, Expire: expire}
+	if *savePassword {
+		s.profile.Password = *password
+	}
+	if err := s.profile.save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "logged in as %s\n", *username)
+	return nil
+}
+
+// readPassword reads a password from stdin, without echoing it to terminals
+func readPassword(s *session) (string, error) {
+	if file, ok := s.in.(*os.File); ok && terminal.IsTerminal(int(file.Fd())) {
+		fmt.Fprint(s.errOut, "password: ")
+		password, err := terminal.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(s.errOut)
+		return string(password), err
+	}
+	password, err := bufio.NewReader(s.in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+func logoutCommand(ctx context.Context, s *session, name string, args []string) error {
+	if _, err := parseArgs(s.flagSet(name, ""), args, 0); err != nil {
+		return err
+	}
+	path, err := profilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Fprintln(s.out, "logged out")
+	return nil
+}
+
+func uploadCommand(ctx context.Context, s *session, name string, args []string) error {
+	f := s.flagSet(name, "<path>")
+	hold := f.Int64("hold", 1, "number of months to pin the file for")
+	network := f.String("network", "", "private network to upload to, instead of the public network")
+	hashType := f.String("hash-type", "", "multihash type, defaults to sha2-256")
+	passphrase := f.String("passphrase", "", "encrypt the file with the passphrase before it is added")
+	args, err := parseArgs(f, args, 1)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil {
+		return err
+	} else if info.IsDir() {
+		return fmt.Errorf("%s is a directory, only files can be uploaded", args[0])
+	}
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	opts := client.UploadOptions{HoldTime: *hold, HashType: *hashType, Passphrase: *passphrase}
+	var hash string
+	if *network != "" {
+		hash, err = c.UploadToNetwork(ctx, *network, file, filepath.Base(args[0]), opts)
+	} else {
+		hash, err = c.Upload(ctx, file, filepath.Base(args[0]), opts)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, hash)
+	return nil
+}
+
+func pinCommand(ctx context.Context, s *session, name string, args []string) error {
+	f := s.flagSet(name, "<cid>")
+	hold := f.Int64("hold", 1, "number of months to pin the content for")
+	network := f.String("network", "", "private network to pin to, instead of the public network")
+	fileName := f.String("name", "", "name to record the upload under")
+	args, err := parseArgs(f, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	opts := client.PinOptions{HoldTime: *hold, FileName: *fileName}
+	if *network != "" {
+		err = c.PinToNetwork(ctx, *network, args[0], opts)
+	} else {
+		err = c.Pin(ctx, args[0], opts)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "pinning %s for %v months\n", args[0], *hold)
+	return nil
+}
+
+func ipnsPublishCommand(ctx context.Context, s *session, name string, args []string) error {
+	f := s.flagSet(name, "<cid>")
+	key := f.String("key", "", "name of the key to publish with")
+	lifetime := f.Duration("lifetime", time.Hour*24, "how long the record is valid for")
+	ttl := f.Duration("ttl", time.Hour, "how long the record may be cached for")
+	resolve := f.Bool("resolve", false, "resolve the cid before publishing")
+	args, err := parseArgs(f, args, 1)
+	if err != nil {
+		return err
+	}
+	if *key == "" {
+		return errors.New("a key is required, given with -key")
+	}
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	if err := c.PublishIPNS(ctx, client.IPNSOptions{
+		Hash:     args[0],
+		Key:      *key,
+		LifeTime: *lifetime,
+		TTL:      *ttl,
+		Resolve:  *resolve,
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "publishing %s with key %s\n", args[0], *key)
+	return nil
+}
+
+func keysCommand(ctx context.Context, s *session, name string, args []string) error {
+	if _, err := parseArgs(s.flagSet(name, ""), args, 0); err != nil {
+		return err
+	}
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	keys, err := c.Keys(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tID")
+	for i, keyName := range keys.Names {
+		var id string
+		if i < len(keys.IDs) {
+			id = keys.IDs[i]
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", keyName, id)
+	}
+	return tw.Flush()
+}
+
+func newKeyCommand(ctx context.Context, s *session, name string, args []string) error {
+	f := s.flagSet(name, "<name>")
+	keyType := f.String("type", client.KeyTypeRSA, "rsa or ed25519")
+	bits := f.Int("bits", 2048, "size of rsa keys in bits")
+	args, err := parseArgs(f, args, 1)
+	if err != nil {
+		return err
+	}
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	if err := c.CreateKey(ctx, args[0], *keyType, *bits); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "creating key %s\n", args[0])
+	return nil
+}
+
+func listUploadsCommand(ctx context.Context, s *session, name string, args []string) error {
+	f := s.flagSet(name, "")
+	limit := f.Int("n", client.DefaultPageLimit, "number of uploads to list")
+	all := f.Bool("all", false, "list every upload")
+	network := f.String("network", "", "list the uploads to a private network")
+	if _, err := parseArgs(f, args, 0); err != nil {
+		return err
+	}
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	var pages *client.Pager
+	if *network != "" {
+		pages = c.NetworkUploads(*network, *limit)
+	} else {
+		pages = c.Uploads(*limit)
+	}
+	var uploads []models.Upload
+	if *all {
+		err = pages.All(ctx, &uploads)
+	} else if pages.Next(ctx) {
+		err = pages.Decode(&uploads)
+	} else {
+		err = pages.Err()
+	}
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HASH\tNAME\tNETWORK\tPINNED UNTIL")
+	for _, upload := range uploads {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			upload.Hash, upload.FileName, upload.NetworkName,
+			upload.GarbageCollectDate.Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
+
+func creditsCommand(ctx context.Context, s *session, name string, args []string) error {
+	if _, err := parseArgs(s.flagSet(name, ""), args, 0); err != nil {
+		return err
+	}
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	credits, err := c.Credits(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, strconv.FormatFloat(credits, 'f', -1, 64))
+	return nil
+}
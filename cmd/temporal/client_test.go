@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		n          int
+		wantHold   int64
+		wantArgs   []string
+		wantErr    bool
+		wantErrMsg string
+	}{
+		{"FlagsFirst", []string{"-hold", "6", "hash"}, 1, 6, []string{"hash"}, false, ""},
+		{"FlagsLast", []string{"hash", "--hold", "6"}, 1, 6, []string{"hash"}, false, ""},
+		{"Default", []string{"hash"}, 1, 1, []string{"hash"}, false, ""},
+		{"MissingArg", []string{"-hold", "6"}, 1, 6, nil, true, "expected 1 arguments, got 0"},
+		{"ExtraArg", []string{"a", "b"}, 1, 1, nil, true, "expected 1 arguments, got 2"},
+		{"BadFlag", []string{"hash", "-nope"}, 1, 1, nil, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{errOut: ioutil.Discard}
+			f := s.flagSet("pin", "<cid>")
+			hold := f.Int64("hold", 1, "")
+			args, err := parseArgs(f, tt.args, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErrMsg != "" && err.Error() != tt.wantErrMsg {
+				t.Fatalf("parseArgs() err = %v, want %s", err, tt.wantErrMsg)
+			}
+			if err == nil && (*hold != tt.wantHold || !reflect.DeepEqual(args, tt.wantArgs)) {
+				t.Fatalf("parseArgs() = %v with hold %v", args, *hold)
+			}
+		})
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "temporal-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "temporal", "profile.json")
+	os.Setenv(profileEnv, path)
+	defer os.Unsetenv(profileEnv)
+
+	// a missing profile is empty
+	p, err := loadProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.api() != defaultAPI {
+		t.Fatalf("unexpected api %s", p.api())
+	}
+
+	p.API, p.Username, p.Token = "http://127.0.0.1:6767", "testuser", "token"
+	p.Expire = time.Now().Add(time.Hour).Round(time.Second)
+	if err := p.save(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("profile is saved with mode %v", info.Mode().Perm())
+	}
+	loaded, err := loadProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Token != p.Token || loaded.Username != p.Username || !loaded.Expire.Equal(p.Expire) {
+		t.Fatalf("loaded %+v, saved %+v", loaded, p)
+	}
+}
+
+func TestUserCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "temporal-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(profileEnv, filepath.Join(dir, "profile.json"))
+	defer os.Unsetenv(profileEnv)
+
+	// fake api, recording the body of pin requests
+	var pinned map[string]interface{}
+	mux := http.NewServeMux()
+	respond := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer testtoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			respond(w, map[string]interface{}{"code": 401, "message": "unauthorized"})
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/v2/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		var creds map[string]string
+		json.NewDecoder(r.Body).Decode(&creds)
+		if creds["username"] != "testuser" || creds["password"] != "admin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			respond(w, map[string]interface{}{"code": 401, "message": "incorrect username or password"})
+			return
+		}
+		respond(w, map[string]interface{}{
+			"code":   200,
+			"token":  "testtoken",
+			"expire": time.Now().Add(time.Hour * 24),
+		})
+	})
+	mux.HandleFunc("/v2/account/credits/available", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			respond(w, map[string]interface{}{"code": 200, "response": 99.5})
+		}
+	})
+	mux.HandleFunc("/v2/ipfs/public/pin/", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			json.NewDecoder(r.Body).Decode(&pinned)
+			respond(w, map[string]interface{}{"code": 200, "response": "pin request sent to backend"})
+		}
+	})
+	mux.HandleFunc("/v2/database/uploads", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			respond(w, map[string]interface{}{"code": 200, "response": map[string]interface{}{
+				"total_record": 1,
+				"total_page":   1,
+				"page":         1,
+				"limit":        10,
+				"records": []map[string]interface{}{
+					{"hash": "testhash", "file_name": "config.json", "network_name": "public"},
+				},
+			}})
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	run := func(stdin string, args ...string) (string, int) {
+		var out bytes.Buffer
+		code := runUserCommand(context.Background(), strings.NewReader(stdin), &out, &out, args)
+		return out.String(), code
+	}
+
+	// commands fail until logged in
+	if out, code := run("", "credits"); code != 1 || !strings.Contains(out, "temporal login") {
+		t.Fatalf("unexpected result %v: %s", code, out)
+	}
+	if out, code := run("wrongpassword\n", "login", "-api", server.URL, "-user", "testuser"); code != 1 {
+		t.Fatalf("unexpected result %v: %s", code, out)
+	}
+	if out, code := run("admin\n", "login", "-api", server.URL, "-user", "testuser"); code != 0 {
+		t.Fatalf("unexpected result %v: %s", code, out)
+	}
+	p, err := loadProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Token != "testtoken" || p.Password != "" {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+
+	if out, code := run("", "credits"); code != 0 || out != "99.5\n" {
+		t.Fatalf("unexpected result %v: %s", code, out)
+	}
+	if out, code := run("", "pin", "testhash", "--hold", "6"); code != 0 {
+		t.Fatalf("unexpected result %v: %s", code, out)
+	}
+	if pinned["hold_time"] != float64(6) {
+		t.Fatalf("unexpected pin request %v", pinned)
+	}
+	if out, code := run("", "uploads", "ls"); code != 0 || !strings.Contains(out, "testhash") {
+		t.Fatalf("unexpected result %v: %s", code, out)
+	}
+	// commands with children require one
+	if out, code := run("", "uploads"); code != 1 || !strings.Contains(out, "uploads ls") {
+		t.Fatalf("unexpected result %v: %s", code, out)
+	}
+	if _, code := run("", "pin", "-h"); code != 0 {
+		t.Fatalf("unexpected exit code %v", code)
+	}
+
+	if out, code := run("", "logout"); code != 0 {
+		t.Fatalf("unexpected result %v: %s", code, out)
+	}
+	if _, code := run("", "credits"); code != 1 {
+		t.Fatalf("unexpected exit code %v", code)
+	}
+}
@@ -4,5 +4,12 @@ Temporal is the command-line interface for Temporal.
 
 Documentation is available via `temporal help`.
 
+Users of a Temporal deployment can also use the cli in place of the api,
+with commands such as `temporal login`, `temporal upload <path>` and
+`temporal pin <cid> -hold 6`. Credentials are stored in a local profile,
+which defaults to temporal/profile.json in the user's configuration
+directory and can be set with TEMPORAL_PROFILE. TEMPORAL_USERNAME and
+TEMPORAL_PASSWORD log in without a profile, for use in scripts.
+
 */
 package main
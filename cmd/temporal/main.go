@@ -8,15 +8,28 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
-	"sync"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"go.bobheadxi.dev/zapx/zapx"
 	"go.uber.org/zap"
 
+	"github.com/RTradeLtd/Temporal/api/middleware"
 	v2 "github.com/RTradeLtd/Temporal/api/v2"
+	"github.com/RTradeLtd/Temporal/audit"
+	"github.com/RTradeLtd/Temporal/beams"
+	"github.com/RTradeLtd/Temporal/billing"
 	clients "github.com/RTradeLtd/Temporal/grpc-clients"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/payments"
+	"github.com/RTradeLtd/Temporal/pins"
+	"github.com/RTradeLtd/Temporal/pricing"
 	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/Temporal/refunds"
+	"github.com/RTradeLtd/Temporal/settings"
+	"github.com/RTradeLtd/Temporal/subscription"
 	"github.com/RTradeLtd/cmd/v2"
 	"github.com/RTradeLtd/config/v2"
 	"github.com/RTradeLtd/database/v2"
@@ -25,6 +38,7 @@ import (
 	pbOrch "github.com/RTradeLtd/grpc/nexus"
 	pbSigner "github.com/RTradeLtd/grpc/pay"
 	"github.com/RTradeLtd/kaas/v2"
+	"github.com/c2h5oh/datasize"
 	pbBchWallet "github.com/gcash/bchwallet/rpc/walletrpc"
 	"github.com/jinzhu/gorm"
 )
@@ -45,6 +59,7 @@ var (
 	lens      pbLens.LensV2Client
 	signer    pbSigner.SignerClient
 	bchWallet pbBchWallet.WalletServiceClient
+	tSettings = &settings.Settings{}
 )
 
 // command-line flags
@@ -112,6 +127,32 @@ func newDB(cfg config.TemporalConfig) (*gorm.DB, error) {
 	return dbm.DB, nil
 }
 
+// parsePlan builds a subscription plan from the args of the create-plan command
+func parsePlan(args map[string]string) (*subscription.Plan, error) {
+	price, err := strconv.ParseFloat(args["price"], 64)
+	if err != nil {
+		return nil, err
+	}
+	storageGB, err := strconv.ParseUint(args["storageGB"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	var allowances [3]int64
+	for i, name := range []string{"ipns", "pubsub", "keys"} {
+		if allowances[i], err = strconv.ParseInt(args[name], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return &subscription.Plan{
+		Name:           args["name"],
+		MonthlyPrice:   price,
+		StorageBytes:   storageGB * datasize.GB.Bytes(),
+		IPNSRecords:    allowances[0],
+		PubSubMessages: allowances[1],
+		Keys:           allowances[2],
+	}, nil
+}
+
 func initClients(l *zap.SugaredLogger, cfg *config.TemporalConfig) (closers []func()) {
 	closers = make([]func(), 0)
 	if lens == nil {
@@ -149,6 +190,95 @@ func initClients(l *zap.SugaredLogger, cfg *config.TemporalConfig) (closers []fu
 	return
 }
 
+// localModels are the database tables owned by temporal, rather than
+// the database package, which are created by the migrate command
+var localModels = []interface{}{
+	&queue.OutboxMessage{},
+	&ledger.Entry{},
+	&middleware.IdempotencyRecord{},
+	&billing.StripePayment{},
+	&billing.StripeCustomer{},
+	&subscription.Plan{},
+	&subscription.Subscription{},
+	&payments.Quote{},
+	&pricing.Quote{},
+	&refunds.Request{},
+	&audit.Event{},
+	&pins.Request{},
+	&beams.Job{},
+	&beams.Secret{},
+}
+
+// consumers maps command names to the queue they consume from
+var consumers = map[string]queue.Queue{
+	"ipns-entry":   queue.IpnsEntryQueue,
+	"pin":          queue.IpfsPinQueue,
+	"key-creation": queue.IpfsKeyCreationQueue,
+	"cluster":      queue.IpfsClusterPinQueue,
+	"beam":         queue.IpfsBeamQueue,
+	"email-send":   queue.EmailSendQueue,
+}
+
+// parseConsumers is used to parse a comma separated list of consumer names
+func parseConsumers(names string) ([]queue.Queue, error) {
+	return lookupConsumers(strings.Split(names, ","))
+}
+
+// lookupConsumers is used to retrieve the queues for the given consumer names
+func lookupConsumers(names []string) ([]queue.Queue, error) {
+	var queues []queue.Queue
+	for _, name := range names {
+		q, ok := consumers[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown queue %s", name)
+		}
+		queues = append(queues, q)
+	}
+	return queues, nil
+}
+
+// runConsumers is used to run consumers for the given queues within a single
+// process, sharing one logger and database connection. It blocks until all
+// consumers have exited.
+func runConsumers(cfg config.TemporalConfig, logName string, queues ...queue.Queue) {
+	logger, err := zapx.New(logPath(cfg.LogDir, logName+".log"), *devMode)
+	if err != nil {
+		fmt.Println("failed to start logger ", err)
+		os.Exit(1)
+	}
+	l := logger.Named(logName).Sugar()
+	db, err := newDB(cfg)
+	if err != nil {
+		fmt.Println("failed to start db", err)
+		os.Exit(1)
+	}
+	pools := make(map[queue.Queue]queue.PoolOptions)
+	for _, q := range queues {
+		pool := tSettings.Queue.Pool(q.String())
+		pools[q] = queue.PoolOptions{Prefetch: pool.Prefetch, Workers: pool.Workers}
+	}
+	supervisor, err := queue.NewSupervisor(&cfg, db, l, queue.SupervisorOptions{
+		Queues:  queues,
+		Pools:   pools,
+		DevMode: *devMode,
+	})
+	if err != nil {
+		fmt.Println("failed to start queue supervisor", err)
+		os.Exit(1)
+	}
+	quitChannel := make(chan os.Signal)
+	signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		fmt.Println(closeMessage)
+		<-quitChannel
+		cancel()
+	}()
+	if err := supervisor.Run(ctx); err != nil {
+		fmt.Println("failed to consume messages", err)
+		os.Exit(1)
+	}
+}
+
 var commands = map[string]cmd.Cmd{
 	"api": {
 		Blurb:       "start Temporal api server",
@@ -181,7 +311,14 @@ var commands = map[string]cmd.Cmd{
 				ctx,
 				&cfg,
 				args["version"],
-				v2.Options{DebugLogging: *debug, DevMode: *devMode},
+				v2.Options{
+					DebugLogging: *debug,
+					DevMode:      *devMode,
+					Stripe:       tSettings.Stripe,
+					Pricing:      tSettings.Pricing,
+					Pinning:      tSettings.Pinning,
+					Payments:     tSettings.Payments,
+				},
 				clients,
 				l,
 			)
@@ -244,183 +381,35 @@ var commands = map[string]cmd.Cmd{
 						Blurb:       "IPNS entry creation queue",
 						Description: "Listens to requests to create IPNS records",
 						Action: func(cfg config.TemporalConfig, args map[string]string) {
-							logger, err := zapx.New(logPath(cfg.LogDir, "ipns_consumer.log"), *devMode)
-							if err != nil {
-								fmt.Println("failed to start logger ", err)
-								os.Exit(1)
-							}
-							l := logger.Named("ipns_consumer").Sugar()
-							db, err := newDB(cfg)
-							if err != nil {
-								fmt.Println("failed to start db", err)
-								os.Exit(1)
-							}
-							quitChannel := make(chan os.Signal)
-							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-							waitGroup := &sync.WaitGroup{}
-							go func() {
-								fmt.Println(closeMessage)
-								<-quitChannel
-								cancel()
-							}()
-							for {
-								qm, err := queue.New(queue.IpnsEntryQueue, cfg.RabbitMQ.URL, false, *devMode, &cfg, l)
-								if err != nil {
-									fmt.Println("failed to start queue", err)
-									os.Exit(1)
-								}
-								waitGroup.Add(1)
-								err = qm.ConsumeMessages(ctx, waitGroup, db, &cfg)
-								if err != nil && err.Error() != queue.ErrReconnect {
-									fmt.Println("failed to consume messages", err)
-									os.Exit(1)
-								} else if err != nil && err.Error() == queue.ErrReconnect {
-									continue
-								}
-								// this will only be true if we had a graceful exit to the queue process, aka CTRL+C
-								if err == nil {
-									break
-								}
-							}
-							waitGroup.Wait()
+							runConsumers(cfg, "ipns_consumer", queue.IpnsEntryQueue)
 						},
 					},
 					"pin": {
 						Blurb:       "Pin addition queue",
 						Description: "Listens to pin requests",
 						Action: func(cfg config.TemporalConfig, args map[string]string) {
-							logger, err := zapx.New(logPath(cfg.LogDir, "pin_consumer.log"), *devMode)
-							if err != nil {
-								fmt.Println("failed to start logger ", err)
-								os.Exit(1)
-							}
-							l := logger.Named("pin_consumer").Sugar()
-
-							db, err := newDB(cfg)
-							if err != nil {
-								fmt.Println("failed to start db", err)
-								os.Exit(1)
-							}
-							quitChannel := make(chan os.Signal)
-							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-							waitGroup := &sync.WaitGroup{}
-							go func() {
-								fmt.Println(closeMessage)
-								<-quitChannel
-								cancel()
-							}()
-							for {
-								qm, err := queue.New(queue.IpfsPinQueue, cfg.RabbitMQ.URL, false, *devMode, &cfg, l)
-								if err != nil {
-									fmt.Println("failed to start queue", err)
-									os.Exit(1)
-								}
-								waitGroup.Add(1)
-								err = qm.ConsumeMessages(ctx, waitGroup, db, &cfg)
-								if err != nil && err.Error() != queue.ErrReconnect {
-									fmt.Println("failed to consume messages", err)
-									os.Exit(1)
-								} else if err != nil && err.Error() == queue.ErrReconnect {
-									continue
-								}
-								// this will only be true if we had a graceful exit to the queue process, aka CTRL+C
-								if err == nil {
-									break
-								}
-							}
-							waitGroup.Wait()
+							runConsumers(cfg, "pin_consumer", queue.IpfsPinQueue)
 						},
 					},
 					"key-creation": {
 						Blurb:       "Key creation queue",
 						Description: fmt.Sprintf("Listen to key creation requests.\nMessages to this queue are broadcasted to all nodes"),
 						Action: func(cfg config.TemporalConfig, args map[string]string) {
-							logger, err := zapx.New(logPath(cfg.LogDir, "key_consumer.log"), *devMode)
-							if err != nil {
-								fmt.Println("failed to start logger ", err)
-								os.Exit(1)
-							}
-							l := logger.Named("key_consumer").Sugar()
-
-							db, err := newDB(cfg)
-							if err != nil {
-								fmt.Println("failed to start db", err)
-								os.Exit(1)
-							}
-							quitChannel := make(chan os.Signal)
-							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-							waitGroup := &sync.WaitGroup{}
-							go func() {
-								fmt.Println(closeMessage)
-								<-quitChannel
-								cancel()
-							}()
-							for {
-								qm, err := queue.New(queue.IpfsKeyCreationQueue, cfg.RabbitMQ.URL, false, *devMode, &cfg, l)
-								if err != nil {
-									fmt.Println("failed to start queue", err)
-									os.Exit(1)
-								}
-								waitGroup.Add(1)
-								err = qm.ConsumeMessages(ctx, waitGroup, db, &cfg)
-								if err != nil && err.Error() != queue.ErrReconnect {
-									fmt.Println("failed to consume messages", err)
-									os.Exit(1)
-								} else if err != nil && err.Error() == queue.ErrReconnect {
-									continue
-								}
-								// this will only be true if we had a graceful exit to the queue process, aka CTRL+C
-								if err == nil {
-									break
-								}
-							}
-							waitGroup.Wait()
+							runConsumers(cfg, "key_consumer", queue.IpfsKeyCreationQueue)
 						},
 					},
 					"cluster": {
 						Blurb:       "Cluster pin queue",
 						Description: "Listens to requests to pin content to the cluster",
 						Action: func(cfg config.TemporalConfig, args map[string]string) {
-							logger, err := zapx.New(logPath(cfg.LogDir, "cluster_pin_consumer.log"), *devMode)
-							if err != nil {
-								fmt.Println("failed to start logger ", err)
-								os.Exit(1)
-							}
-							l := logger.Named("cluster_pin_consumer").Sugar()
-
-							db, err := newDB(cfg)
-							if err != nil {
-								fmt.Println("failed to start db", err)
-								os.Exit(1)
-							}
-							quitChannel := make(chan os.Signal)
-							signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-							waitGroup := &sync.WaitGroup{}
-							go func() {
-								fmt.Println(closeMessage)
-								<-quitChannel
-								cancel()
-							}()
-							for {
-								qm, err := queue.New(queue.IpfsClusterPinQueue, cfg.RabbitMQ.URL, false, *devMode, &cfg, l)
-								if err != nil {
-									fmt.Println("failed to start queue", err)
-									os.Exit(1)
-								}
-								waitGroup.Add(1)
-								err = qm.ConsumeMessages(ctx, waitGroup, db, &cfg)
-								if err != nil && err.Error() != queue.ErrReconnect {
-									fmt.Println("failed to consume messages", err)
-									os.Exit(1)
-								} else if err != nil && err.Error() == queue.ErrReconnect {
-									continue
-								}
-								// this will only be true if we had a graceful exit to the queue process, aka CTRL+C
-								if err == nil {
-									break
-								}
-							}
-							waitGroup.Wait()
+							runConsumers(cfg, "cluster_pin_consumer", queue.IpfsClusterPinQueue)
+						},
+					},
+					"beam": {
+						Blurb:       "Beam queue",
+						Description: "Listens to requests to beam content between networks",
+						Action: func(cfg config.TemporalConfig, args map[string]string) {
+							runConsumers(cfg, "beam_consumer", queue.IpfsBeamQueue)
 						},
 					},
 				},
@@ -429,46 +418,39 @@ var commands = map[string]cmd.Cmd{
 				Blurb:       "Email send queue",
 				Description: "Listens to requests to send emails",
 				Action: func(cfg config.TemporalConfig, args map[string]string) {
-					logger, err := zapx.New(logPath(cfg.LogDir, "email_consumer.log"), *devMode)
+					runConsumers(cfg, "email_consumer", queue.EmailSendQueue)
+				},
+			},
+			"all": {
+				Blurb:       "Run all configured queues in one process",
+				Description: "Runs the consumers listed in the queue.consumers setting within a single process, defaulting to every queue.\nConsumers share a database connection pool, and are restarted individually if their connection to rabbitmq drops",
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					names := tSettings.Queue.Consumers
+					if len(names) == 0 {
+						for name := range consumers {
+							names = append(names, name)
+						}
+						sort.Strings(names)
+					}
+					queues, err := lookupConsumers(names)
 					if err != nil {
-						fmt.Println("failed to start logger ", err)
+						fmt.Println(err)
 						os.Exit(1)
 					}
-					l := logger.Named("email_consumer").Sugar()
-
-					db, err := newDB(cfg)
+					runConsumers(cfg, "queue_consumer", queues...)
+				},
+			},
+			"run": {
+				Blurb:       "Run several queues in one process",
+				Description: "Runs consumers for a comma separated list of queues within a single process, for example 'pin,cluster,email-send'.\nValid queues are ipns-entry, pin, key-creation, cluster, beam and email-send",
+				Args:        []string{"queues"},
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					queues, err := parseConsumers(args["queues"])
 					if err != nil {
-						fmt.Println("failed to start db", err)
+						fmt.Println(err)
 						os.Exit(1)
 					}
-					quitChannel := make(chan os.Signal)
-					signal.Notify(quitChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-					waitGroup := &sync.WaitGroup{}
-					go func() {
-						fmt.Println(closeMessage)
-						<-quitChannel
-						cancel()
-					}()
-					for {
-						qm, err := queue.New(queue.EmailSendQueue, cfg.RabbitMQ.URL, false, *devMode, &cfg, l)
-						if err != nil {
-							fmt.Println("failed to start queue", err)
-							os.Exit(1)
-						}
-						waitGroup.Add(1)
-						err = qm.ConsumeMessages(ctx, waitGroup, db, &cfg)
-						if err != nil && err.Error() != queue.ErrReconnect {
-							fmt.Println("failed to consume messages", err)
-							os.Exit(1)
-						} else if err != nil && err.Error() == queue.ErrReconnect {
-							continue
-						}
-						// this will only be true if we had a graceful exit to the queue process, aka CTRL+C
-						if err == nil {
-							break
-						}
-					}
-					waitGroup.Wait()
+					runConsumers(cfg, "queue_consumer", queues...)
 				},
 			},
 		},
@@ -523,7 +505,9 @@ var commands = map[string]cmd.Cmd{
 				os.Exit(1)
 			}
 			// add credits
-			if _, err := models.NewUserManager(d.DB).AddCredits(args["user"], 99999999); err != nil {
+			if _, err := ledger.NewManager(d.DB).Credit(args["user"], ledger.Adjustment, 99999999, ledger.Meta{
+				Reason: "test account credits",
+			}); err != nil {
 				fmt.Println("failed to grant credits to user account", err)
 				os.Exit(1)
 			}
@@ -573,13 +557,174 @@ var commands = map[string]cmd.Cmd{
 		Blurb:       "run database migrations",
 		Description: "Runs our initial database migrations, creating missing tables, etc. Not affected by --db.migrate",
 		Action: func(cfg config.TemporalConfig, args map[string]string) {
-			if _, err := database.New(&cfg, database.Options{
+			d, err := database.New(&cfg, database.Options{
 				SSLModeDisable: *dbNoSSL,
 				RunMigrations:  true,
-			}); err != nil {
+			})
+			if err != nil {
 				fmt.Println("failed to perform secure migration", err)
 				os.Exit(1)
 			}
+			// migrate tables managed by temporal itself
+			if err := d.DB.AutoMigrate(localModels...).Error; err != nil {
+				fmt.Println("failed to migrate temporal tables", err)
+				os.Exit(1)
+			}
+		},
+	},
+	"ledger": {
+		Blurb:         "credit ledger commands",
+		Description:   "Manage the ledger that records every change to user credit balances",
+		ChildRequired: true,
+		Children: map[string]cmd.Cmd{
+			"open": {
+				Blurb:       "record opening balances",
+				Description: "Records an opening entry for users without one, covering the part of their balance not accounted for by their ledger entries. Run once after migrating to the ledger.",
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					db, err := newDB(cfg)
+					if err != nil {
+						fmt.Println("failed to initialize database", err)
+						os.Exit(1)
+					}
+					var users []models.User
+					if err := db.Select("user_name").Find(&users).Error; err != nil {
+						fmt.Println("failed to find users", err)
+						os.Exit(1)
+					}
+					var opened int
+					for _, user := range users {
+						ok, err := ledger.NewManager(db).Open(user.UserName)
+						if err != nil {
+							fmt.Printf("failed to open ledger for %s: %s\n", user.UserName, err)
+							os.Exit(1)
+						}
+						if ok {
+							opened++
+						}
+					}
+					fmt.Printf("recorded opening balances for %v users\n", opened)
+				},
+			},
+			"reconcile": {
+				Blurb:       "find balance and ledger mismatches",
+				Description: "Compares the credit balance of every user against their ledger, listing users whose balance does not match. Exits with a non-zero status if any are found.",
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					db, err := newDB(cfg)
+					if err != nil {
+						fmt.Println("failed to initialize database", err)
+						os.Exit(1)
+					}
+					mismatches, err := ledger.NewManager(db).Reconcile()
+					if err != nil {
+						fmt.Println("failed to reconcile credit ledger", err)
+						os.Exit(1)
+					}
+					if len(mismatches) == 0 {
+						fmt.Println("all balances match the ledger")
+						return
+					}
+					for _, mm := range mismatches {
+						fmt.Printf("user %s: balance %f, ledger %f (%v entries), difference %f\n",
+							mm.UserName, mm.Balance, mm.Ledger, mm.Entries, mm.Balance-mm.Ledger)
+					}
+					fmt.Printf("found %v mismatched balances\n", len(mismatches))
+					os.Exit(1)
+				},
+			},
+		},
+	},
+	"subscription": {
+		Blurb:         "subscription plan commands",
+		Description:   "Manage subscription plans, and renew subscriptions which are due",
+		ChildRequired: true,
+		Children: map[string]cmd.Cmd{
+			"plans": {
+				Blurb:       "list subscription plans",
+				Description: "Lists the plans which can be subscribed to",
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					db, err := newDB(cfg)
+					if err != nil {
+						fmt.Println("failed to initialize database", err)
+						os.Exit(1)
+					}
+					plans, err := subscription.NewManager(db, zap.NewNop().Sugar(), nil, subscription.Options{}).Plans()
+					if err != nil {
+						fmt.Println("failed to find plans", err)
+						os.Exit(1)
+					}
+					for _, plan := range plans {
+						fmt.Printf("%s: %f credits/month, %s storage, %v ipns records, %v pubsub messages, %v keys\n",
+							plan.Name, plan.MonthlyPrice, datasize.ByteSize(plan.StorageBytes).HR(),
+							plan.IPNSRecords, plan.PubSubMessages, plan.Keys)
+					}
+				},
+			},
+			"create-plan": {
+				Blurb:       "create a subscription plan",
+				Description: "Create a subscription plan. Provide args as name, monthly price in credits, storage in gigabytes, and monthly ipns records, pubsub messages, and keys allowed.",
+				Args:        []string{"name", "price", "storageGB", "ipns", "pubsub", "keys"},
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					plan, err := parsePlan(args)
+					if err != nil {
+						fmt.Println("invalid plan", err)
+						os.Exit(1)
+					}
+					db, err := newDB(cfg)
+					if err != nil {
+						fmt.Println("failed to initialize database", err)
+						os.Exit(1)
+					}
+					if err := subscription.NewManager(db, zap.NewNop().Sugar(), nil, subscription.Options{}).CreatePlan(plan); err != nil {
+						fmt.Println("failed to create plan", err)
+						os.Exit(1)
+					}
+					fmt.Printf("created plan '%s'\n", plan.Name)
+				},
+			},
+			"retire-plan": {
+				Blurb:       "retire a subscription plan",
+				Description: "Stops new subscriptions to a plan. Existing subscribers keep renewing until they change plans.",
+				Args:        []string{"name"},
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					db, err := newDB(cfg)
+					if err != nil {
+						fmt.Println("failed to initialize database", err)
+						os.Exit(1)
+					}
+					if err := subscription.NewManager(db, zap.NewNop().Sugar(), nil, subscription.Options{}).RetirePlan(args["name"]); err != nil {
+						fmt.Println("failed to retire plan", err)
+						os.Exit(1)
+					}
+				},
+			},
+			"renew": {
+				Blurb:       "renew due subscriptions",
+				Description: "Renews every subscription whose period has ended. The api does this periodically, so this is only needed when the api is not running.",
+				Action: func(cfg config.TemporalConfig, args map[string]string) {
+					logger, err := zapx.New(logPath(cfg.LogDir, "subscriptions.log"), *devMode)
+					if err != nil {
+						fmt.Println("failed to start logger ", err)
+						os.Exit(1)
+					}
+					l := logger.Sugar()
+					db, err := newDB(cfg)
+					if err != nil {
+						fmt.Println("failed to initialize database", err)
+						os.Exit(1)
+					}
+					stripePayments := billing.NewStripe(db, l, billing.StripeConfig{
+						SecretKey:     cfg.Stripe.SecretKey,
+						WebhookSecret: tSettings.Stripe.WebhookSecret,
+						APIURL:        tSettings.Stripe.APIURL,
+					})
+					processed, err := subscription.NewManager(db, l, stripePayments, subscription.Options{}).RenewDue()
+					if err != nil {
+						fmt.Println("failed to renew subscriptions", err)
+						os.Exit(1)
+					}
+					fmt.Printf("processed %v subscriptions\n", processed)
+				},
+			},
 		},
 	},
 }
@@ -592,6 +737,13 @@ func main() {
 	// initialize global context
 	ctx, cancel = context.WithCancel(context.Background())
 
+	// run user commands, which talk to the api and need no configuration
+	if len(os.Args) > 1 {
+		if _, ok := userCommands[os.Args[1]]; ok {
+			os.Exit(runUserCommand(ctx, os.Stdin, os.Stdout, os.Stderr, os.Args[1:]))
+		}
+	}
+
 	// create app
 	temporal := cmd.New(commands, cmd.Config{
 		Name:     "Temporal",
@@ -603,6 +755,10 @@ func main() {
 
 	// run no-config commands, exit if command was run
 	if exit := temporal.PreRun(nil, os.Args[1:]); exit == cmd.CodeOK {
+		if len(os.Args) < 2 || os.Args[1] == "help" {
+			fmt.Println("\nUser commands, which are run against the api of a deployment:")
+			printUserCommands(os.Stdout, "", userCommands)
+		}
 		os.Exit(0)
 	}
 
@@ -613,6 +769,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// load settings not covered by the base configuration
+	if tSettings, err = settings.Load(*configPath); err != nil {
+		println("failed to load settings at", *configPath)
+		os.Exit(1)
+	}
+
 	// load arguments
 	flags := map[string]string{
 		"certFilePath":  tCfg.API.Connection.Certificates.CertPath,
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/RTradeLtd/Temporal/queue"
 	"github.com/RTradeLtd/config/v2"
 )
 
@@ -79,6 +80,8 @@ func TestQueuesIPFS(t *testing.T) {
 		{"IPFSKey-LogDir", args{"ipfs", "key-creation", "./tmp/"}},
 		{"IPFSCluster-NoLogDir", args{"ipfs", "cluster", ""}},
 		{"IPFSCluster-LogDir", args{"ipfs", "cluster", "./tmp/"}},
+		{"IPFSBeam-NoLogDir", args{"ipfs", "beam", ""}},
+		{"IPFSBeam-LogDir", args{"ipfs", "beam", "./tmp/"}},
 	}
 	queueCmds := commands["queue"]
 	for _, tt := range tests {
@@ -116,6 +119,16 @@ func TestQueuesEmailSend(t *testing.T) {
 	}
 }
 
+func TestQueuesAll(t *testing.T) {
+	cfg, err := config.LoadConfig("../../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	commands["queue"].Children["all"].Action(*cfg, nil)
+}
+
 func TestMigrations(t *testing.T) {
 	cfg, err := config.LoadConfig("../../testenv/config.json")
 	if err != nil {
@@ -154,3 +167,16 @@ func TestUser(t *testing.T) {
 	}
 	commands["user"].Action(*cfg, flags)
 }
+
+func TestParseConsumers(t *testing.T) {
+	queues, err := parseConsumers("pin, cluster,email-send")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queues) != 3 || queues[0] != queue.IpfsPinQueue || queues[2] != queue.EmailSendQueue {
+		t.Fatalf("bad queues %v", queues)
+	}
+	if _, err := parseConsumers("pin,foo"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,225 @@
+package eh
+
+//go:generate go run gen.go
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+)
+
+// Code is a stable, machine readable identifier for an error. Messages may be
+// reworded over time, so clients should match on codes rather than messages
+type Code string
+
+// Generic codes describe errors which are not in the catalog,
+// based on the http status they were returned with
+const (
+	// BadRequest is used for invalid requests
+	BadRequest Code = "bad_request"
+	// MissingField is used when a required field was not provided
+	MissingField Code = "missing_field"
+	// InvalidField is used when a field failed validation
+	InvalidField Code = "invalid_field"
+	// Unauthorized is used when a request could not be authenticated
+	Unauthorized Code = "unauthorized"
+	// PaymentRequired is used when a user can not pay for a request
+	PaymentRequired Code = "payment_required"
+	// Forbidden is used when a user may not perform a request
+	Forbidden Code = "forbidden"
+	// NotFound is used when the subject of a request does not exist
+	NotFound Code = "not_found"
+	// Conflict is used when a request conflicts with an earlier one
+	Conflict Code = "conflict"
+	// RateLimited is used when a user has made too many requests
+	RateLimited Code = "rate_limited"
+	// Internal is used for unexpected server errors
+	Internal Code = "internal_error"
+	// Unavailable is used when a service temporarily can not handle requests
+	Unavailable Code = "service_unavailable"
+)
+
+// Catalog codes which handlers match errors against
+const (
+	// DuplicateEmail is used when an email address is already registered
+	DuplicateEmail Code = "duplicate_email"
+	// DuplicateUserName is used when a user name is already registered
+	DuplicateUserName Code = "duplicate_username"
+)
+
+// Definition is an entry in the error catalog
+type Definition struct {
+	Code    Code
+	Message string
+	// Status is the http status the error is returned with,
+	// unless a handler has a more specific one
+	Status int
+	// Retryable indicates a request failing with the error may
+	// succeed if it is retried later, without any changes
+	Retryable bool
+}
+
+// definitions is the error catalog. Codes must never be changed or reused
+var definitions = []Definition{
+	{Code: "login_failed", Message: LoginError, Status: http.StatusBadRequest},
+	{Code: "ipfs_connection", Message: IPFSConnectionError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "private_network_access", Message: PrivateNetworkAccessError, Status: http.StatusBadRequest},
+	{Code: "api_url_check", Message: APIURLCheckError, Status: http.StatusBadRequest},
+	{Code: "ipfs_cat", Message: IPFSCatError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "ipfs_object_stat", Message: IPFSObjectStatError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "ipfs_pubsub_publish", Message: IPFSPubSubPublishError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "upload_search", Message: UploadSearchError, Status: http.StatusBadRequest},
+	{Code: "network_search", Message: NetworkSearchError, Status: http.StatusBadRequest},
+	{Code: "network_creation", Message: NetworkCreationError, Status: http.StatusBadRequest},
+	{Code: "queue_initialization", Message: QueueInitializationError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "queue_publish", Message: QueuePublishError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "key_search", Message: KeySearchError, Status: http.StatusBadRequest},
+	{Code: "key_use", Message: KeyUseError, Status: http.StatusBadRequest},
+	{Code: "ipfs_pin_parse", Message: IPFSPinParseError, Status: http.StatusBadRequest},
+	{Code: "ipfs_add", Message: IPFSAddError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "file_open", Message: FileOpenError, Status: http.StatusBadRequest},
+	{Code: "ipfs_multihash_generation", Message: IPFSMultiHashGenerationError, Status: http.StatusBadRequest},
+	{Code: "ipfs_cluster_status", Message: IPFSClusterStatusError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "ipfs_cluster_connection", Message: IPFSClusterConnectionError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "ipfs_cluster_pin_removal", Message: IPFSClusterPinRemovalError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "dnslink_manager", Message: DNSLinkManagerError, Status: http.StatusBadRequest},
+	{Code: "dnslink_entry", Message: DNSLinkEntryError, Status: http.StatusBadRequest},
+	{Code: "payment_creation", Message: PaymentCreationError, Status: http.StatusBadRequest},
+	{Code: "cost_calculation", Message: CostCalculationError, Status: http.StatusBadRequest},
+	{Code: "payment_search", Message: PaymentSearchError, Status: http.StatusBadRequest},
+	{Code: "subscription_search", Message: SubscriptionSearchError, Status: http.StatusBadRequest},
+	{Code: "subscription_update", Message: SubscriptionUpdateError, Status: http.StatusBadRequest},
+	{Code: "refund_failed", Message: RefundError, Status: http.StatusBadRequest},
+	{Code: "credit_adjust", Message: CreditAdjustError, Status: http.StatusBadRequest},
+	{Code: "account_update", Message: AccountUpdateError, Status: http.StatusBadRequest},
+	{Code: "duplicate_key_creation", Message: DuplicateKeyCreationError, Status: http.StatusConflict},
+	{Code: "user_account_creation", Message: UserAccountCreationError, Status: http.StatusBadRequest},
+	{Code: "password_change", Message: PasswordChangeError, Status: http.StatusBadRequest},
+	{Code: "no_key", Message: NoKeyError, Status: http.StatusNotFound},
+	{Code: "file_too_big", Message: FileTooBigError, Status: http.StatusBadRequest},
+	{Code: "invalid_payment_type", Message: InvalidPaymentTypeError, Status: http.StatusBadRequest},
+	{Code: "invalid_payment_blockchain", Message: InvalidPaymentBlockchainError, Status: http.StatusBadRequest},
+	{Code: "credit_check", Message: CreditCheckError, Status: http.StatusBadRequest},
+	{Code: "invalid_balance", Message: InvalidBalanceError, Status: http.StatusPaymentRequired},
+	{Code: "cmc_check", Message: CmcCheckError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "deposit_address_check", Message: DepositAddressCheckError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "user_search", Message: UserSearchError, Status: http.StatusBadRequest},
+	{Code: "credit_refund", Message: CreditRefundError, Status: http.StatusBadRequest},
+	{Code: "ipns_record_search", Message: IpnsRecordSearchError, Status: http.StatusBadRequest},
+	{Code: "unauthorized_admin_access", Message: UnAuthorizedAdminAccess, Status: http.StatusForbidden},
+	{Code: DuplicateEmail, Message: DuplicateEmailError, Status: http.StatusBadRequest},
+	{Code: DuplicateUserName, Message: DuplicateUserNameError, Status: http.StatusBadRequest},
+	{Code: "unable_to_save_user", Message: UnableToSaveUserError, Status: http.StatusBadRequest},
+	{Code: "email_verification", Message: EmailVerificationError, Status: http.StatusBadRequest},
+	{Code: "email_token_generation", Message: EmailTokenGenerationError, Status: http.StatusBadRequest},
+	{Code: "zone_search", Message: ZoneSearchError, Status: http.StatusBadRequest},
+	{Code: "record_search", Message: RecordSearchError, Status: http.StatusBadRequest},
+	{Code: "ipfs_dag_get", Message: IPFSDagGetError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "invalid_object_identifier", Message: InvalidObjectIdentifierError, Status: http.StatusBadRequest},
+	{Code: "invalid_object_type", Message: InvalidObjectTypeError, Status: http.StatusBadRequest},
+	{Code: "index_failed", Message: FailedToIndexError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "search_failed", Message: FailedToSearchError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "no_search_results", Message: NoSearchResultsError, Status: http.StatusBadRequest},
+	{Code: "chainrider_api_call", Message: ChainRiderAPICallError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "key_export", Message: KeyExportError, Status: http.StatusBadRequest},
+	{Code: "password_reset", Message: PasswordResetError, Status: http.StatusBadRequest},
+	{Code: "no_api_token", Message: NoAPITokenError, Status: http.StatusBadRequest},
+	{Code: "cant_upload", Message: CantUploadError, Status: http.StatusBadRequest},
+	{Code: "data_usage_update", Message: DataUsageUpdateError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "tier_upgrade", Message: TierUpgradeError, Status: http.StatusBadRequest},
+	{Code: "encryption_failed", Message: EncryptionError, Status: http.StatusBadRequest},
+	{Code: "decryption_failed", Message: DecryptionError, Status: http.StatusBadRequest},
+	{Code: "database_update", Message: DatabaseUpdateError, Status: http.StatusBadRequest, Retryable: true},
+	{Code: "pin_extend", Message: PinExtendError, Status: http.StatusBadRequest},
+	{Code: "max_hold_time", Message: MaxHoldTimeError, Status: http.StatusBadRequest},
+	{Code: "hostname_not_found", Message: HostNameNotFoundError, Status: http.StatusInternalServerError},
+}
+
+// generic are the definitions of the generic codes
+var generic = []Definition{
+	{Code: BadRequest, Message: "the request was invalid", Status: http.StatusBadRequest},
+	{Code: MissingField, Message: "a required field was not provided", Status: http.StatusBadRequest},
+	{Code: InvalidField, Message: "a field is invalid", Status: http.StatusBadRequest},
+	{Code: Unauthorized, Message: "the request could not be authenticated", Status: http.StatusUnauthorized},
+	{Code: PaymentRequired, Message: "payment is required", Status: http.StatusPaymentRequired},
+	{Code: Forbidden, Message: "the request is not allowed", Status: http.StatusForbidden},
+	{Code: NotFound, Message: "the requested resource does not exist", Status: http.StatusNotFound},
+	{Code: Conflict, Message: "the request conflicts with an earlier request", Status: http.StatusConflict},
+	{Code: RateLimited, Message: "too many requests", Status: http.StatusTooManyRequests, Retryable: true},
+	{Code: Internal, Message: "an unexpected error occurred", Status: http.StatusInternalServerError, Retryable: true},
+	{Code: Unavailable, Message: "the service is temporarily unavailable", Status: http.StatusServiceUnavailable, Retryable: true},
+}
+
+var byMessage = make(map[string]Definition, len(definitions))
+
+func init() {
+	for _, def := range definitions {
+		byMessage[def.Message] = def
+	}
+}
+
+// Lookup returns the catalog definition of an error message
+func Lookup(message string) (Definition, bool) {
+	def, ok := byMessage[message]
+	return def, ok
+}
+
+// CodeOf returns the code of an error, which is either an *Error, or one
+// whose message is in the catalog. The code is empty for any other error
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err == nil {
+		return ""
+	}
+	def, _ := Lookup(err.Error())
+	return def.Code
+}
+
+// Generic returns the definition used for errors which are not in the
+// catalog, and were returned with the given http status
+func Generic(status int) Definition {
+	for _, def := range generic {
+		if def.Status == status && def.Code != MissingField && def.Code != InvalidField {
+			return def
+		}
+	}
+	if status >= http.StatusInternalServerError {
+		return Definition{Code: Internal, Status: status, Retryable: true}
+	}
+	return Definition{Code: BadRequest, Status: status}
+}
+
+// Catalog returns every error definition, generic codes first, followed by
+// the catalog sorted by code
+func Catalog() []Definition {
+	defs := append([]Definition{}, definitions...)
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Code < defs[j].Code })
+	return append(append([]Definition{}, generic...), defs...)
+}
+
+// Error is the machine readable description of an error, which is returned
+// alongside the error message in api responses
+type Error struct {
+	Code      Code        `json:"code"`
+	Message   string      `json:"message"`
+	Retryable bool        `json:"retryable"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// New returns the description of an error message returned with the given
+// http status, using its catalog definition if it has one
+func New(message string, status int) *Error {
+	def, ok := Lookup(message)
+	if !ok {
+		def = Generic(status)
+	}
+	return &Error{Code: def.Code, Message: message, Retryable: def.Retryable}
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return e.Message
+}
@@ -0,0 +1,124 @@
+package eh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	// every error message must be in the catalog
+	f, err := parser.ParseFile(token.NewFileSet(), "errors.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		for i, name := range spec.Names {
+			lit, ok := spec.Values[i].(*ast.BasicLit)
+			if !ok {
+				t.Fatalf("%s is not a string literal", name)
+			}
+			message, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := Lookup(message); !ok {
+				t.Errorf("%s is not in the catalog", name)
+			}
+		}
+		return true
+	})
+
+	// codes and messages must be unique
+	codes := make(map[Code]bool)
+	messages := make(map[string]bool)
+	for _, def := range Catalog() {
+		if codes[def.Code] {
+			t.Errorf("duplicate code %s", def.Code)
+		}
+		if messages[def.Message] {
+			t.Errorf("duplicate message %q", def.Message)
+		}
+		if http.StatusText(def.Status) == "" {
+			t.Errorf("%s has invalid status %v", def.Code, def.Status)
+		}
+		codes[def.Code] = true
+		messages[def.Message] = true
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name          string
+		message       string
+		status        int
+		wantCode      Code
+		wantRetryable bool
+	}{
+		{"Catalog", IPFSConnectionError, http.StatusBadRequest, "ipfs_connection", true},
+		{"CatalogIgnoresStatus", NoKeyError, http.StatusBadRequest, "no_key", false},
+		{"GenericBadRequest", "invalid cid", http.StatusBadRequest, BadRequest, false},
+		{"GenericNotFound", "no such upload", http.StatusNotFound, NotFound, false},
+		{"GenericInternal", "oops", http.StatusBadGateway, Internal, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New(tt.message, tt.status)
+			if e.Code != tt.wantCode {
+				t.Errorf("New() code = %v, want %v", e.Code, tt.wantCode)
+			}
+			if e.Retryable != tt.wantRetryable {
+				t.Errorf("New() retryable = %v, want %v", e.Retryable, tt.wantRetryable)
+			}
+			if e.Error() != tt.message {
+				t.Errorf("New() message = %v, want %v", e.Error(), tt.message)
+			}
+		})
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{"Nil", nil, ""},
+		{"Error", New("no such upload", http.StatusNotFound), NotFound},
+		{"WrappedError", fmt.Errorf("failed: %w", New(DuplicateEmailError, http.StatusBadRequest)), DuplicateEmail},
+		{"Catalog", errors.New(DuplicateUserNameError), DuplicateUserName},
+		{"Unknown", errors.New("oops"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeOf(tt.err); got != tt.want {
+				t.Errorf("CodeOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteReference(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReference(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("../docs/errors.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatal("docs/errors.md is out of date, run go generate ./eh")
+	}
+}
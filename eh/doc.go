@@ -1,2 +1,3 @@
-// Package eh stands for "error handling", and provides error definitions
+// Package eh stands for "error handling", and provides error definitions,
+// along with a catalog mapping them to stable codes and http statuses
 package eh
@@ -53,6 +53,16 @@ const (
 	CostCalculationError = "failed to calculate cost"
 	// PaymentSearchError is an error used when searching for payment
 	PaymentSearchError = "failed to search for payment"
+	// SubscriptionSearchError is an error used when searching for subscriptions or plans
+	SubscriptionSearchError = "failed to search for subscription"
+	// SubscriptionUpdateError is an error used when changing a subscription
+	SubscriptionUpdateError = "failed to update subscription"
+	// RefundError is an error used when requesting or reviewing a refund
+	RefundError = "failed to process refund"
+	// CreditAdjustError is an error used when an administrator fails to grant or revoke credits
+	CreditAdjustError = "failed to adjust credits"
+	// AccountUpdateError is an error used when an administrator fails to update a user account
+	AccountUpdateError = "failed to update user account"
 	// DuplicateKeyCreationError is an error used when creating a key of the same name
 	DuplicateKeyCreationError = "key name already exists"
 	// UserAccountCreationError is an error used when creating a user account
@@ -126,6 +136,8 @@ const (
 	TierUpgradeError = "an error occurred upgrading your tier"
 	// EncryptionError is an error when a failure to encrypt data occurs
 	EncryptionError = "an error occurred when trying to encrypt file"
+	// DecryptionError is an error when content can not be decrypted with the given passphrase
+	DecryptionError = "failed to decrypt content, check the passphrase is correct"
 	// DatabaseUpdateError is an error message used when a failure to update the database happesn
 	DatabaseUpdateError = "en error occurred wile updating the database"
 	// PinExtendError is an error message used when someone attempts to extend the pin for content they haven't uploaded
@@ -0,0 +1,23 @@
+//go:build ignore
+// +build ignore
+
+// gen writes the error reference to docs/errors.md
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/RTradeLtd/Temporal/eh"
+)
+
+func main() {
+	f, err := os.Create("../docs/errors.md")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := eh.WriteReference(f); err != nil {
+		log.Fatal(err)
+	}
+}
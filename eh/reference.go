@@ -0,0 +1,53 @@
+package eh
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// WriteReference writes the error catalog as a markdown document
+func WriteReference(w io.Writer) error {
+	if _, err := io.WriteString(w, `# Error Reference
+
+<!-- generated by go generate ./eh, do not edit -->
+
+Failed API requests return the error message in `+"`response`"+`, along with an
+`+"`error`"+` object describing it:
+
+`+"```json"+`
+{
+  "code": 400,
+  "response": "file_name not present",
+  "error": {
+    "code": "missing_field",
+    "message": "file_name not present",
+    "retryable": false,
+    "details": { "field": "file_name" }
+  }
+}
+`+"```"+`
+
+Clients should match on `+"`error.code`"+`, as messages may change. Requests
+failing with a retryable error may succeed if retried later without changes.
+The status listed is the default, and some endpoints use a more specific one.
+
+| Code | Status | Retryable | Message |
+| ---- | ------ | --------- | ------- |
+`); err != nil {
+		return err
+	}
+	for _, def := range Catalog() {
+		retryable := "no"
+		if def.Retryable {
+			retryable = "yes"
+		}
+		if _, err := fmt.Fprintf(
+			w, "| `%s` | %d %s | %s | %s |\n",
+			def.Code, def.Status, http.StatusText(def.Status), retryable, def.Message,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
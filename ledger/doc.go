@@ -0,0 +1,4 @@
+// Package ledger implements an append-only ledger of credit transactions. Every
+// change to a users credit balance is recorded alongside the change itself, so
+// that the history of a balance can always be explained, and audited.
+package ledger
@@ -0,0 +1,273 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+)
+
+// Kind is the type of a ledger entry
+type Kind string
+
+const (
+	// Debit is a charge for an api call
+	Debit Kind = "debit"
+	// Refund returns credits for an api call that could not be completed,
+	// or for a payout that was denied
+	Refund Kind = "refund"
+	// Purchase is credits bought by the user
+	Purchase Kind = "purchase"
+	// Opening records the balance of a user at the time the ledger was introduced
+	Opening Kind = "opening"
+	// Adjustment is a manual change made by an administrator
+	Adjustment Kind = "adjustment"
+	// Reversal takes back purchased credits, ie when a payment is refunded or disputed
+	Reversal Kind = "reversal"
+	// Payout is credits the user withdrew, ie as a refund to their payment method
+	Payout Kind = "payout"
+)
+
+// tolerance is the largest difference between a balance and
+// the ledger that is attributed to floating point error
+const tolerance = 1e-6
+
+var (
+	// ErrInsufficientCredits is returned when a debit exceeds the users balance
+	ErrInsufficientCredits = errors.New("user does not have enough credits")
+	// ErrInvalidAmount is returned when recording a non-positive amount
+	ErrInvalidAmount = errors.New("amount must be greater than zero")
+)
+
+// Meta describes what a ledger entry is for
+type Meta struct {
+	// Reason is a human readable description of the entry
+	Reason string
+	// CallType is the type of api call the entry relates to, ie pin
+	CallType string
+	// CID is the content the entry relates to, if any
+	CID string
+	// JobID identifies the job or payment the entry relates to, if any
+	JobID string
+}
+
+// Entry is a single change to a users credit balance. Entries are never
+// updated or deleted, so the sum of a users entries is always their balance
+type Entry struct {
+	gorm.Model
+	UserName string `gorm:"type:varchar(255);index" json:"user_name"`
+	Kind     Kind   `gorm:"type:varchar(32)" json:"kind"`
+	// Amount is positive for credits added, and negative for credits removed
+	Amount float64 `json:"amount"`
+	// Balance is the users balance after the entry was applied
+	Balance  float64 `json:"balance"`
+	Reason   string  `gorm:"type:text" json:"reason"`
+	CallType string  `gorm:"type:varchar(255)" json:"call_type"`
+	CID      string  `gorm:"type:varchar(255);index" json:"cid"`
+	JobID    string  `gorm:"type:varchar(255);index" json:"job_id"`
+}
+
+// TableName returns the table used to store ledger entries
+func (Entry) TableName() string {
+	return "credit_ledger"
+}
+
+// Manager is used to change credit balances through the ledger
+type Manager struct {
+	DB *gorm.DB
+}
+
+// NewManager is used to instantiate our ledger manager. If the given
+// database handle is a transaction, ledger changes are made within it
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{DB: db}
+}
+
+// Debit removes credits from a user, failing if their balance is insufficient
+func (m *Manager) Debit(username string, amount float64, meta Meta) (*Entry, error) {
+	if !positive(amount) {
+		return nil, ErrInvalidAmount
+	}
+	return m.record(username, Debit, -amount, meta, false)
+}
+
+// Withdraw removes credits a user is being paid out for, failing if their balance is insufficient
+func (m *Manager) Withdraw(username string, amount float64, meta Meta) (*Entry, error) {
+	if !positive(amount) {
+		return nil, ErrInvalidAmount
+	}
+	return m.record(username, Payout, -amount, meta, false)
+}
+
+// Reverse takes back credits from a user. Unlike a debit, a reversal is recorded
+// even if it leaves the user with a negative balance, as the credits being taken
+// back may already have been spent
+func (m *Manager) Reverse(username string, amount float64, meta Meta) (*Entry, error) {
+	if !positive(amount) {
+		return nil, ErrInvalidAmount
+	}
+	return m.record(username, Reversal, -amount, meta, true)
+}
+
+// Credit adds credits to a user
+func (m *Manager) Credit(username string, kind Kind, amount float64, meta Meta) (*Entry, error) {
+	if !positive(amount) {
+		return nil, ErrInvalidAmount
+	}
+	return m.record(username, kind, amount, meta, false)
+}
+
+// positive returns whether amount is a finite amount greater than zero
+func positive(amount float64) bool {
+	return amount > 0 && !math.IsInf(amount, 0)
+}
+
+// Adjust changes the credits of a user on behalf of an administrator. Positive
+// amounts grant credits, and negative amounts revoke them, failing if the
+// user does not have enough credits left
+func (m *Manager) Adjust(username string, amount float64, meta Meta) (*Entry, error) {
+	if amount == 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return nil, ErrInvalidAmount
+	}
+	return m.record(username, Adjustment, amount, meta, false)
+}
+
+// Open records an opening entry for a user, unless they already have one.
+// The opening amount is their current balance less the entries recorded so
+// far, so that entries made before the ledger was opened still add up to the
+// balance. It returns whether or not an opening entry was recorded
+func (m *Manager) Open(username string) (bool, error) {
+	var opened bool
+	err := m.transaction(func(tx *gorm.DB) error {
+		// the user is locked first, so that no entry is recorded meanwhile
+		user, err := lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		var count int
+		if err := tx.Model(&Entry{}).Where("user_name = ? AND kind = ?", username, Opening).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		var sum struct{ Total float64 }
+		if err := tx.Model(&Entry{}).Select("COALESCE(SUM(amount), 0) AS total").Where("user_name = ?", username).Scan(&sum).Error; err != nil {
+			return err
+		}
+		opened = true
+		opening := user.Credits - sum.Total
+		return tx.Create(&Entry{
+			UserName: username,
+			Kind:     Opening,
+			Amount:   opening,
+			Balance:  opening,
+			Reason:   "opening balance",
+		}).Error
+	})
+	return opened, err
+}
+
+// History returns a query for the ledger entries of a user
+func (m *Manager) History(username string) *gorm.DB {
+	return m.DB.Model(&Entry{}).Where("user_name = ?", username)
+}
+
+// Mismatch is a user whose balance does not match their ledger
+type Mismatch struct {
+	UserName string  `json:"user_name"`
+	Balance  float64 `json:"balance"`
+	Ledger   float64 `json:"ledger"`
+	// Entries is the number of ledger entries for the user
+	Entries int `json:"entries"`
+}
+
+// Reconcile compares the balance of every user against the sum of their
+// ledger entries, returning the users for which they differ
+func (m *Manager) Reconcile() ([]Mismatch, error) {
+	rows, err := m.DB.Raw(`
+		SELECT users.user_name, users.credits, COALESCE(SUM(credit_ledger.amount), 0), COUNT(credit_ledger.id)
+		FROM users
+		LEFT JOIN credit_ledger
+			ON credit_ledger.user_name = users.user_name
+			AND credit_ledger.deleted_at IS NULL
+		WHERE users.deleted_at IS NULL
+		GROUP BY users.user_name, users.credits
+		ORDER BY users.user_name`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var mismatches []Mismatch
+	for rows.Next() {
+		var mm Mismatch
+		if err := rows.Scan(&mm.UserName, &mm.Balance, &mm.Ledger, &mm.Entries); err != nil {
+			return nil, err
+		}
+		if math.Abs(mm.Balance-mm.Ledger) > tolerance {
+			mismatches = append(mismatches, mm)
+		}
+	}
+	return mismatches, rows.Err()
+}
+
+// record applies a change to a users balance, and records it in the ledger
+func (m *Manager) record(username string, kind Kind, amount float64, meta Meta, allowNegative bool) (*Entry, error) {
+	entry := &Entry{
+		UserName: username,
+		Kind:     kind,
+		Amount:   amount,
+		Reason:   meta.Reason,
+		CallType: meta.CallType,
+		CID:      meta.CID,
+		JobID:    meta.JobID,
+	}
+	err := m.transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		entry.Balance = user.Credits + amount
+		if entry.Balance < 0 && !allowNegative {
+			return ErrInsufficientCredits
+		}
+		if err := tx.Model(user).Update("credits", entry.Balance).Error; err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// transaction runs fn within a transaction, reusing the
+// managers transaction if it was created with one
+func (m *Manager) transaction(fn func(tx *gorm.DB) error) error {
+	if _, ok := m.DB.CommonDB().(*sql.Tx); ok {
+		return fn(m.DB)
+	}
+	tx := m.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// lockUser fetches a user, locking their row until the transaction completes
+func lockUser(tx *gorm.DB, username string) (*models.User, error) {
+	var user models.User
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("user_name = ?", username).
+		First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
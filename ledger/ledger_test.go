@@ -0,0 +1,182 @@
+package ledger
+
+import (
+	"math"
+	"testing"
+
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+)
+
+const testUser = "testuser"
+
+func TestManager(t *testing.T) {
+	db := loadDatabase(t)
+	um := models.NewUserManager(db)
+	lm := NewManager(db)
+	start, err := um.GetCreditsForUser(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ensure the test user has a ledger
+	if _, err := lm.Open(testUser); err != nil {
+		t.Fatal(err)
+	}
+	var before int
+	if err := lm.History(testUser).Count(&before).Error; err != nil {
+		t.Fatal(err)
+	}
+	type args struct {
+		kind   Kind
+		amount float64
+		meta   Meta
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{"Debit", args{Debit, 1, Meta{CallType: "pin", CID: "QmS4ustL54uo8FzR9455qaxZwuMiUhyvMcX9Ba8nUH4uVv"}}, nil},
+		{"Refund", args{Refund, 1, Meta{CallType: "pin", Reason: "test refund"}}, nil},
+		{"Reversal", args{Reversal, 1, Meta{Reason: "test reversal", JobID: "pi_test"}}, nil},
+		{"Payout", args{Payout, 1, Meta{Reason: "test payout", JobID: "refund-1"}}, nil},
+		{"PayoutInsufficient", args{Payout, start + 100, Meta{}}, ErrInsufficientCredits},
+		{"Grant", args{Adjustment, 2, Meta{Reason: "test grant"}}, nil},
+		{"Revoke", args{Adjustment, -1, Meta{Reason: "test revoke"}}, nil},
+		{"RevokeInsufficient", args{Adjustment, -(start + 100), Meta{}}, ErrInsufficientCredits},
+		{"Insufficient", args{Debit, start + 100, Meta{CallType: "pin"}}, ErrInsufficientCredits},
+		{"Negative", args{Refund, -1, Meta{}}, ErrInvalidAmount},
+		{"DebitZero", args{Debit, 0, Meta{CallType: "pin"}}, ErrInvalidAmount},
+		{"DebitNaN", args{Debit, math.NaN(), Meta{CallType: "pin"}}, ErrInvalidAmount},
+		{"CreditInf", args{Refund, math.Inf(1), Meta{}}, ErrInvalidAmount},
+		{"ReverseInf", args{Reversal, math.Inf(1), Meta{}}, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				entry *Entry
+				err   error
+			)
+			switch tt.args.kind {
+			case Debit:
+				entry, err = lm.Debit(testUser, tt.args.amount, tt.args.meta)
+			case Reversal:
+				entry, err = lm.Reverse(testUser, tt.args.amount, tt.args.meta)
+			case Payout:
+				entry, err = lm.Withdraw(testUser, tt.args.amount, tt.args.meta)
+			case Adjustment:
+				entry, err = lm.Adjust(testUser, tt.args.amount, tt.args.meta)
+			default:
+				entry, err = lm.Credit(testUser, tt.args.kind, tt.args.amount, tt.args.meta)
+			}
+			if err != tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			credits, err := um.GetCreditsForUser(testUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Balance != credits {
+				t.Fatalf("entry balance %v does not match credits %v", entry.Balance, credits)
+			}
+			if entry.CallType != tt.args.meta.CallType || entry.CID != tt.args.meta.CID {
+				t.Fatal("entry metadata not recorded")
+			}
+		})
+	}
+	var after int
+	if err := lm.History(testUser).Count(&after).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after != before+6 {
+		t.Fatalf("expected %v entries, got %v", before+6, after)
+	}
+	// failed changes must not be recorded, so the ledger still matches
+	mismatches, err := lm.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mm := range mismatches {
+		if mm.UserName == testUser {
+			t.Fatalf("unexpected mismatch %+v", mm)
+		}
+	}
+	// opening an existing ledger is a no-op
+	if opened, err := lm.Open(testUser); err != nil {
+		t.Fatal(err)
+	} else if opened {
+		t.Fatal("ledger should not have been opened twice")
+	}
+}
+
+func TestManager_Open(t *testing.T) {
+	db := loadDatabase(t)
+	// the ledger is reopened within a transaction which is rolled back
+	tx := db.Begin()
+	defer tx.Rollback()
+	lm := NewManager(tx)
+	if err := tx.Unscoped().Where("user_name = ? AND kind = ?", testUser, Opening).Delete(&Entry{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// entries recorded before the ledger is opened still add up to the balance
+	if _, err := lm.Credit(testUser, Refund, 1, Meta{Reason: "test refund"}); err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := lm.Open(testUser); err != nil {
+		t.Fatal(err)
+	} else if !opened {
+		t.Fatal("ledger should have been opened")
+	}
+	mismatches, err := lm.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mm := range mismatches {
+		if mm.UserName == testUser {
+			t.Fatalf("unexpected mismatch %+v", mm)
+		}
+	}
+}
+
+func TestManager_Transaction(t *testing.T) {
+	db := loadDatabase(t)
+	start, err := models.NewUserManager(db).GetCreditsForUser(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// changes made within a rolled back transaction are discarded
+	tx := db.Begin()
+	if _, err := NewManager(tx).Debit(testUser, 1, Meta{CallType: "pin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback().Error; err != nil {
+		t.Fatal(err)
+	}
+	credits, err := models.NewUserManager(db).GetCreditsForUser(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credits != start {
+		t.Fatalf("expected %v credits, got %v", start, credits)
+	}
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(&Entry{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
@@ -0,0 +1,19 @@
+package log
+
+import "context"
+
+type contextKey string
+
+// requestIDKey is the context key request ids are stored under
+const requestIDKey contextKey = "request-id"
+
+// WithRequestID returns a copy of ctx carrying the given request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request id carried by ctx, or an empty string if it has none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
@@ -26,9 +26,10 @@ func (z loggerMiddleware) Handler(next http.Handler) http.Handler {
 		next.ServeHTTP(ww, r)
 		latency := time.Since(start)
 
-		var requestID string
-		if reqID := r.Context().Value(middleware.RequestIDKey); reqID != nil {
-			requestID = reqID.(string)
+		// prefer our own request id, falling back to one set by chi
+		requestID := RequestID(r.Context())
+		if requestID == "" {
+			requestID = middleware.GetReqID(r.Context())
 		}
 		z.l.Info("request completed",
 			// request metadata
@@ -29,6 +29,11 @@ func Test_loggerMiddleware(t *testing.T) {
 			args{"GET", "/", nil, []func(http.Handler) http.Handler{middleware.RequestID}},
 			[]string{"path", "request-id"},
 		},
+		{
+			"GET with temporal requestID",
+			args{"GET", "/", nil, []func(http.Handler) http.Handler{withRequestID}},
+			[]string{"path", "request-id"},
+		},
 		{
 			"GET with realIP",
 			args{"GET", "/", nil, []func(http.Handler) http.Handler{middleware.RealIP}},
@@ -68,3 +73,9 @@ func Test_loggerMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), "test-request-id")))
+	})
+}
@@ -0,0 +1,295 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/RTradeLtd/ChainRider-Go/dash"
+	"github.com/RTradeLtd/database/v2/models"
+	pbBchWallet "github.com/gcash/bchwallet/rpc/walletrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// default number of confirmations a payment needs, by blockchain
+const (
+	DefaultEthereumConfirmations    = 12
+	DefaultBitcoinCashConfirmations = 6
+	DefaultDashConfirmations        = 6
+)
+
+// transferTopic is the topic of erc20 Transfer(address,address,uint256) events
+const transferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+var (
+	// satoshisPerCoin is the number of satoshis, or duffs, in a bch or dash coin
+	satoshisPerCoin = 1e8
+	// weiPerEther is the number of wei in an ether, or an rtc token
+	weiPerEther = new(big.Float).SetFloat64(1e18)
+)
+
+// EthereumChain checks ethereum and rtc payments through the json-rpc api of an
+// ethereum node. Payments are sent to the payment contract, so ether is read
+// from the value of the transaction, and rtc from the Transfer events it emits
+type EthereumChain struct {
+	url           string
+	contract      string
+	confirmations int64
+	client        *http.Client
+}
+
+// NewEthereum is used to instantiate an ethereum chain. Transactions which are
+// not sent to the contract do not pay for anything, and are treated as failed
+func NewEthereum(rpcURL, contract string, confirmations int64) *EthereumChain {
+	if confirmations <= 0 {
+		confirmations = DefaultEthereumConfirmations
+	}
+	return &EthereumChain{
+		url:           rpcURL,
+		contract:      strings.ToLower(contract),
+		confirmations: confirmations,
+		client:        &http.Client{},
+	}
+}
+
+// Check returns the state of the transaction submitted for a payment
+func (e *EthereumChain) Check(ctx context.Context, payment *models.Payment, reference string) (Observation, error) {
+	if !submitted(payment) {
+		return Observation{}, nil
+	}
+	var receipt *struct {
+		Status      string `json:"status"`
+		To          string `json:"to"`
+		BlockNumber string `json:"blockNumber"`
+		Logs        []struct {
+			Address string   `json:"address"`
+			Topics  []string `json:"topics"`
+			Data    string   `json:"data"`
+		} `json:"logs"`
+	}
+	if err := e.call(ctx, "eth_getTransactionReceipt", &receipt, payment.TxHash); err != nil {
+		return Observation{}, err
+	}
+	if receipt == nil {
+		// the transaction has not been mined yet
+		return Observation{}, nil
+	}
+	if receipt.Status == "0x0" || (e.contract != "" && strings.ToLower(receipt.To) != e.contract) {
+		return Observation{Failed: true}, nil
+	}
+	var received *big.Int
+	switch payment.Type {
+	case "eth":
+		var tx struct {
+			Value string `json:"value"`
+		}
+		if err := e.call(ctx, "eth_getTransactionByHash", &tx, payment.TxHash); err != nil {
+			return Observation{}, err
+		}
+		value, err := hexInt(tx.Value)
+		if err != nil {
+			return Observation{}, err
+		}
+		received = value
+	default:
+		// tokens transferred to the contract within the transaction
+		received = new(big.Int)
+		to := "0x" + strings.Repeat("0", 24) + strings.TrimPrefix(strings.ToLower(receipt.To), "0x")
+		for _, log := range receipt.Logs {
+			if len(log.Topics) != 3 || log.Topics[0] != transferTopic || strings.ToLower(log.Topics[2]) != to {
+				continue
+			}
+			amount, err := hexInt(log.Data)
+			if err != nil {
+				return Observation{}, err
+			}
+			received.Add(received, amount)
+		}
+	}
+	var head string
+	if err := e.call(ctx, "eth_blockNumber", &head); err != nil {
+		return Observation{}, err
+	}
+	latest, err := hexInt(head)
+	if err != nil {
+		return Observation{}, err
+	}
+	mined, err := hexInt(receipt.BlockNumber)
+	if err != nil {
+		return Observation{}, err
+	}
+	confirmations := new(big.Int).Sub(latest, mined).Int64() + 1
+	coins, _ := new(big.Float).Quo(new(big.Float).SetInt(received), weiPerEther).Float64()
+	return Observation{
+		Received:  coins,
+		Confirmed: coins > 0 && confirmations >= e.confirmations,
+	}, nil
+}
+
+// call makes a json-rpc call to the ethereum node, decoding its result into out
+func (e *EthereumChain) call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return err
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("%s failed: %s", method, rpcResp.Error.Message)
+	}
+	return json.Unmarshal(rpcResp.Result, out)
+}
+
+// hexInt parses a 0x prefixed hex quantity
+func hexInt(s string) (*big.Int, error) {
+	trimmed := strings.TrimPrefix(s, "0x")
+	if trimmed == "" {
+		return new(big.Int), nil
+	}
+	i, ok := new(big.Int).SetString(trimmed, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex quantity %q", s)
+	}
+	return i, nil
+}
+
+// BitcoinCashChain checks bch payments through the bchwallet the deposit
+// addresses of payments are generated by
+type BitcoinCashChain struct {
+	wallet        pbBchWallet.WalletServiceClient
+	confirmations int32
+}
+
+// NewBitcoinCash is used to instantiate a bitcoin cash chain
+func NewBitcoinCash(wallet pbBchWallet.WalletServiceClient, confirmations int32) *BitcoinCashChain {
+	if confirmations <= 0 {
+		confirmations = DefaultBitcoinCashConfirmations
+	}
+	return &BitcoinCashChain{wallet: wallet, confirmations: confirmations}
+}
+
+// Check returns the amount the transaction submitted for a payment sent to
+// its deposit address
+func (b *BitcoinCashChain) Check(ctx context.Context, payment *models.Payment, reference string) (Observation, error) {
+	if !submitted(payment) {
+		return Observation{}, nil
+	}
+	hash, err := hex.DecodeString(payment.TxHash)
+	if err != nil {
+		return Observation{}, fmt.Errorf("invalid transaction hash %s: %s", payment.TxHash, err)
+	}
+	// transaction hashes are displayed in reverse byte order
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	resp, err := b.wallet.GetTransaction(ctx, &pbBchWallet.GetTransactionRequest{TransactionHash: hash})
+	if status.Code(err) == codes.NotFound {
+		// the wallet has not seen the transaction yet
+		return Observation{}, nil
+	} else if err != nil {
+		return Observation{}, err
+	}
+	if resp.GetTransaction() == nil {
+		return Observation{}, errors.New("wallet returned no transaction")
+	}
+	var satoshis int64
+	for _, credit := range resp.GetTransaction().GetCredits() {
+		if credit.GetAddress() == payment.DepositAddress {
+			satoshis += credit.GetAmount()
+		}
+	}
+	received := float64(satoshis) / satoshisPerCoin
+	return Observation{
+		Received:  received,
+		Confirmed: received > 0 && resp.GetConfirmations() >= b.confirmations,
+	}, nil
+}
+
+// DashClient is the part of the chainrider dash client used to check payments
+type DashClient interface {
+	GetPaymentForwardByID(paymentForwardID string) (*dash.GetPaymentForwardByIDResponse, error)
+	TransactionByHash(txHash string) (*dash.TransactionByHashResponse, error)
+}
+
+// DashChain checks dash payments through the chainrider payment
+// forward they were created with
+type DashChain struct {
+	client        DashClient
+	confirmations int
+}
+
+// NewDash is used to instantiate a dash chain
+func NewDash(client DashClient, confirmations int) *DashChain {
+	if confirmations <= 0 {
+		confirmations = DefaultDashConfirmations
+	}
+	return &DashChain{client: client, confirmations: confirmations}
+}
+
+// Check returns the amount forwarded by the payment forward of a payment,
+// which is only confirmed once every forwarded transaction is
+func (d *DashChain) Check(ctx context.Context, payment *models.Payment, reference string) (Observation, error) {
+	if reference == "" {
+		return Observation{}, errors.New("payment has no payment forward")
+	}
+	forward, err := d.client.GetPaymentForwardByID(reference)
+	if err != nil {
+		return Observation{}, err
+	}
+	if forward.Error != "" {
+		return Observation{}, errors.New(forward.Error)
+	}
+	var (
+		duffs     int
+		confirmed = len(forward.ProcessedTxs) > 0
+	)
+	for _, processed := range forward.ProcessedTxs {
+		duffs += processed.ReceivedAmountDuffs
+		tx, err := d.client.TransactionByHash(processed.TransactionHash)
+		if err != nil {
+			return Observation{}, err
+		}
+		if tx.Confirmations < d.confirmations {
+			confirmed = false
+		}
+	}
+	return Observation{
+		Received:  float64(duffs) / satoshisPerCoin,
+		Confirmed: confirmed,
+	}, nil
+}
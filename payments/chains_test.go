@@ -0,0 +1,209 @@
+package payments
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ChainRider-Go/dash"
+	"github.com/RTradeLtd/database/v2/models"
+	pbBchWallet "github.com/gcash/bchwallet/rpc/walletrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testContract = "0x00000000000000000000000000000000000000aa"
+	testSender   = "0x00000000000000000000000000000000000000bb"
+)
+
+func TestEthereumChain_Check(t *testing.T) {
+	// receipts by transaction hash, all mined in block 0x10
+	receipts := map[string]string{
+		"0xeth":      `{"status":"0x1","to":"` + testContract + `","blockNumber":"0x10","logs":[]}`,
+		"0xreverted": `{"status":"0x0","to":"` + testContract + `","blockNumber":"0x10","logs":[]}`,
+		"0xother":    `{"status":"0x1","to":"` + testSender + `","blockNumber":"0x10","logs":[]}`,
+		"0xrtc": `{"status":"0x1","to":"` + testContract + `","blockNumber":"0x10","logs":[
+			{"topics":["` + transferTopic + `","0x000000000000000000000000` + testSender[2:] + `","0x000000000000000000000000` + testContract[2:] + `"],"data":"0xde0b6b3a7640000"},
+			{"topics":["` + transferTopic + `","0x000000000000000000000000` + testSender[2:] + `","0x000000000000000000000000` + testSender[2:] + `"],"data":"0xde0b6b3a7640000"}
+		]}`,
+	}
+	var head = "0x1a"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string   `json:"method"`
+			Params []string `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Method {
+		case "eth_getTransactionReceipt":
+			receipt, ok := receipts[req.Params[0]]
+			if !ok {
+				receipt = "null"
+			}
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + receipt + `}`))
+		case "eth_getTransactionByHash":
+			// 2 ether
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"value":"0x1bc16d674ec80000"}}`))
+		case "eth_blockNumber":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + head + `"}`))
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"message":"method not found"}}`))
+		}
+	}))
+	defer srv.Close()
+	tests := []struct {
+		name          string
+		paymentType   string
+		txHash        string
+		confirmations int64
+		want          Observation
+	}{
+		{"NotSubmitted", "eth", "testuser-1", 1, Observation{}},
+		{"NotMined", "eth", "0xpending", 1, Observation{}},
+		{"Reverted", "eth", "0xreverted", 1, Observation{Failed: true}},
+		{"WrongRecipient", "eth", "0xother", 1, Observation{Failed: true}},
+		{"Ether", "eth", "0xeth", 11, Observation{Received: 2, Confirmed: true}},
+		{"EtherUnconfirmed", "eth", "0xeth", 12, Observation{Received: 2}},
+		{"Token", "rtc", "0xrtc", 11, Observation{Received: 1, Confirmed: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := NewEthereum(srv.URL, testContract, tt.confirmations)
+			got, err := chain.Check(context.Background(), &models.Payment{
+				UserName: testUser, Number: 1, Blockchain: Ethereum, Type: tt.paymentType, TxHash: tt.txHash,
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// fakeWallet returns transactions from memory, keyed by their hash in display order
+type fakeWallet struct {
+	pbBchWallet.WalletServiceClient
+	txs map[string]*pbBchWallet.GetTransactionResponse
+}
+
+func (f *fakeWallet) GetTransaction(ctx context.Context, in *pbBchWallet.GetTransactionRequest, opts ...grpc.CallOption) (*pbBchWallet.GetTransactionResponse, error) {
+	hash := make([]byte, len(in.TransactionHash))
+	for i, b := range in.TransactionHash {
+		hash[len(hash)-1-i] = b
+	}
+	resp, ok := f.txs[hex.EncodeToString(hash)]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "transaction not found")
+	}
+	return resp, nil
+}
+
+func TestBitcoinCashChain_Check(t *testing.T) {
+	wallet := &fakeWallet{txs: map[string]*pbBchWallet.GetTransactionResponse{
+		"aa01": {
+			Confirmations: 6,
+			Transaction: &pbBchWallet.TransactionDetails{Credits: []*pbBchWallet.TransactionDetails_Output{
+				{Address: "deposit", Amount: 150000000},
+				{Address: "change", Amount: 50000000},
+			}},
+		},
+	}}
+	tests := []struct {
+		name          string
+		txHash        string
+		confirmations int32
+		want          Observation
+	}{
+		{"NotSubmitted", "testuser-1", 6, Observation{}},
+		{"Unknown", "bb02", 6, Observation{}},
+		{"Confirmed", "aa01", 6, Observation{Received: 1.5, Confirmed: true}},
+		{"Unconfirmed", "aa01", 7, Observation{Received: 1.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewBitcoinCash(wallet, tt.confirmations).Check(context.Background(), &models.Payment{
+				UserName: testUser, Number: 1, Blockchain: BitcoinCash, Type: "bch", TxHash: tt.txHash, DepositAddress: "deposit",
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// fakeDash returns payment forwards and transactions from memory
+type fakeDash struct {
+	forwards map[string]*dash.GetPaymentForwardByIDResponse
+	txs      map[string]*dash.TransactionByHashResponse
+}
+
+func (f *fakeDash) GetPaymentForwardByID(id string) (*dash.GetPaymentForwardByIDResponse, error) {
+	if forward, ok := f.forwards[id]; ok {
+		return forward, nil
+	}
+	return &dash.GetPaymentForwardByIDResponse{Error: "payment forward not found"}, nil
+}
+
+func (f *fakeDash) TransactionByHash(hash string) (*dash.TransactionByHashResponse, error) {
+	return f.txs[hash], nil
+}
+
+func TestDashChain_Check(t *testing.T) {
+	// processed transactions are decoded as chainrider returns them
+	var forward dash.GetPaymentForwardByIDResponse
+	if err := json.Unmarshal([]byte(`{"payment_forward_id":"forward","processed_txs":[
+		{"transaction_hash":"tx1","received_amount_duffs":100000000},
+		{"transaction_hash":"tx2","received_amount_duffs":50000000}
+	]}`), &forward); err != nil {
+		t.Fatal(err)
+	}
+	client := &fakeDash{
+		forwards: map[string]*dash.GetPaymentForwardByIDResponse{
+			"empty":   {PaymentForwardID: "empty"},
+			"forward": &forward,
+		},
+		txs: map[string]*dash.TransactionByHashResponse{
+			"tx1": {Confirmations: 10},
+			"tx2": {Confirmations: 3},
+		},
+	}
+	tests := []struct {
+		name          string
+		reference     string
+		confirmations int
+		wantErr       bool
+		want          Observation
+	}{
+		{"NoReference", "", 6, true, Observation{}},
+		{"NotFound", "missing", 6, true, Observation{}},
+		{"NothingForwarded", "empty", 6, false, Observation{}},
+		{"Confirmed", "forward", 3, false, Observation{Received: 1.5, Confirmed: true}},
+		{"Unconfirmed", "forward", 6, false, Observation{Received: 1.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDash(client, tt.confirmations).Check(context.Background(), &models.Payment{
+				Blockchain: Dash, Type: "dash",
+			}, tt.reference)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
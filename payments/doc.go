@@ -0,0 +1,6 @@
+// Package payments tracks cryptocurrency payments after they are created. A
+// Watcher periodically rechecks unconfirmed payments, expiring or re-quoting
+// those which were never paid, and resubmitting confirmations that appear to
+// be stuck. Blockchain state is read through the Chain interface, which is
+// implemented for ethereum, bitcoin cash and dash, and can be faked in tests.
+package payments
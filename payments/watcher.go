@@ -0,0 +1,494 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/pricing"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultInterval is how often unconfirmed payments are rechecked
+	DefaultInterval = time.Minute
+	// DefaultQuoteTTL is how long the charge amount of a payment is honoured
+	DefaultQuoteTTL = time.Hour
+	// DefaultConfirmTimeout is how long a submitted payment may remain
+	// unconfirmed before its confirmation is resubmitted
+	DefaultConfirmTimeout = time.Minute * 90
+	// DefaultFailAfter is how long a submitted payment may remain
+	// unconfirmed before it is marked as failed
+	DefaultFailAfter = time.Hour * 24
+	// DefaultMaxRequotes is the number of times an unpaid payment is
+	// re-quoted at the current price before it expires
+	DefaultMaxRequotes = 3
+	// DefaultBatchSize is the maximum number of payments checked per pass
+	DefaultBatchSize = 100
+)
+
+// blockchains as recorded on payments
+const (
+	Ethereum    = "ethereum"
+	BitcoinCash = "bitcoin-cash"
+	Dash        = "dash"
+)
+
+// State is the state of a payment
+type State string
+
+const (
+	// Pending payments are waiting for funds to be sent
+	Pending State = "pending"
+	// Confirming payments have been sent, and are waiting to be confirmed
+	Confirming State = "confirming"
+	// Confirmed payments have been credited to the user
+	Confirmed State = "confirmed"
+	// Expired payments were not paid before their quote expired
+	Expired State = "expired"
+	// Failed payments were sent, but could not be confirmed
+	Failed State = "failed"
+)
+
+var (
+	// ErrQuoteExpired is returned when submitting a payment whose quote has expired
+	ErrQuoteExpired = errors.New("payment quote has expired, please create a new payment")
+	// ErrPaymentClosed is returned when submitting a payment which has already been processed
+	ErrPaymentClosed = errors.New("payment has already been processed")
+
+	// errSkip aborts the check of a payment which is being checked elsewhere
+	errSkip = errors.New("payment is locked")
+)
+
+// Observation is the state of a payment on its blockchain
+type Observation struct {
+	// Received is the amount received so far, in units of the payment type
+	Received float64
+	// Confirmed is true once the received funds have enough confirmations
+	Confirmed bool
+	// Failed is true if the payment transaction was rejected, ie reverted
+	Failed bool
+}
+
+// Chain is used to check payments on a blockchain
+type Chain interface {
+	// Check returns the state of the given payment on chain. The reference
+	// is the chain specific reference recorded when the payment was tracked
+	Check(ctx context.Context, payment *models.Payment, reference string) (Observation, error)
+}
+
+// Quoter returns the usd value of a single unit of the given payment type
+type Quoter func(paymentType string) (*pricing.Quote, error)
+
+// Quote tracks the state of a payment, and the period its charge amount is valid for
+type Quote struct {
+	gorm.Model
+	PaymentID  uint   `gorm:"unique_index" json:"payment_id"`
+	UserName   string `gorm:"type:varchar(255);index" json:"user_name"`
+	Number     int64  `json:"number"`
+	Blockchain string `gorm:"type:varchar(255)" json:"blockchain"`
+	Type       string `gorm:"type:varchar(255)" json:"type"`
+	State      State  `gorm:"type:varchar(32);index" json:"state"`
+	// Reference is chain specific data needed to confirm the
+	// payment, ie the dash payment forward id
+	Reference string `gorm:"type:varchar(255)" json:"-"`
+	// ExpiresAt is when the charge amount stops being honoured
+	ExpiresAt time.Time `json:"expires_at"`
+	// PriceQuoteID is the price quote the charge amount was calculated from
+	PriceQuoteID uint `json:"price_quote_id"`
+	// Requotes is the number of times the charge amount was updated
+	Requotes int `json:"requotes"`
+	// SubmittedAt is when the payment was first sent
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+	// ResubmittedAt is when the confirmation of the payment was last resubmitted
+	ResubmittedAt *time.Time `json:"-"`
+	CheckedAt     *time.Time `json:"checked_at,omitempty"`
+	LastError     string     `gorm:"type:text" json:"-"`
+}
+
+// TableName returns the table used to store payment quotes
+func (Quote) TableName() string {
+	return "payment_quotes"
+}
+
+// Options is used to configure a Watcher
+type Options struct {
+	Interval       time.Duration
+	QuoteTTL       time.Duration
+	ConfirmTimeout time.Duration
+	FailAfter      time.Duration
+	MaxRequotes    int
+	BatchSize      int
+}
+
+// Watcher rechecks unconfirmed payments. Payments are locked while being
+// checked, so several watchers may run against the same database
+type Watcher struct {
+	db     *gorm.DB
+	l      *zap.SugaredLogger
+	chains map[string]Chain
+	quote  Quoter
+	opts   Options
+	now    func() time.Time
+}
+
+// NewWatcher is used to instantiate a payment watcher. Chains are keyed by
+// blockchain, and payments on blockchains without a chain are only checked
+// for expiry and stuck confirmations
+func NewWatcher(db *gorm.DB, logger *zap.SugaredLogger, chains map[string]Chain, quoter Quoter, opts Options) *Watcher {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.QuoteTTL <= 0 {
+		opts.QuoteTTL = DefaultQuoteTTL
+	}
+	if opts.ConfirmTimeout <= 0 {
+		opts.ConfirmTimeout = DefaultConfirmTimeout
+	}
+	if opts.FailAfter <= 0 {
+		opts.FailAfter = DefaultFailAfter
+	}
+	if opts.MaxRequotes <= 0 {
+		opts.MaxRequotes = DefaultMaxRequotes
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	return &Watcher{
+		db:     db,
+		l:      logger.Named("payments"),
+		chains: chains,
+		quote:  quoter,
+		opts:   opts,
+		now:    time.Now,
+	}
+}
+
+// Track starts watching a newly created payment, charged at the given price
+func (w *Watcher) Track(payment *models.Payment, price *pricing.Quote, reference string) (*Quote, error) {
+	q := w.newQuote(payment, w.now())
+	q.PriceQuoteID = price.ID
+	q.Reference = reference
+	if err := w.db.Create(q).Error; err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Find returns the quote of a payment
+func (w *Watcher) Find(paymentID uint) (*Quote, error) {
+	var q Quote
+	if err := w.db.Where("payment_id = ?", paymentID).First(&q).Error; err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// Submit records that the user has sent a payment, failing if its quote has
+// expired. Quotes are honoured for payments submitted before they expire,
+// however long the payment then takes to confirm
+func (w *Watcher) Submit(payment *models.Payment) error {
+	return w.transaction(func(tx *gorm.DB) error {
+		var q Quote
+		err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("payment_id = ?", payment.ID).
+			First(&q).Error
+		if gorm.IsRecordNotFoundError(err) {
+			// payments created before quotes were tracked
+			q = *w.newQuote(payment, w.now())
+		} else if err != nil {
+			return err
+		}
+		now := w.now()
+		switch {
+		case q.State == Expired, q.State == Pending && now.After(q.ExpiresAt):
+			return ErrQuoteExpired
+		case q.State != Pending:
+			return ErrPaymentClosed
+		}
+		q.State = Confirming
+		q.SubmittedAt = &now
+		return tx.Save(&q).Error
+	})
+}
+
+// Run checks payments until the context is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.Check(ctx); err != nil {
+			w.l.Errorw("failed to check payments", "error", err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check rechecks a batch of unconfirmed payments, returning the number checked
+func (w *Watcher) Check(ctx context.Context) (int, error) {
+	if err := w.adopt(); err != nil {
+		return 0, err
+	}
+	var ids []uint
+	if err := w.db.Model(&Quote{}).
+		Where("state IN (?)", []State{Pending, Confirming}).
+		Where("checked_at IS NULL OR checked_at <= ?", w.now().Add(-w.opts.Interval)).
+		Order("checked_at asc nulls first").
+		Limit(w.opts.BatchSize).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	var checked int
+	for _, id := range ids {
+		if err := w.check(ctx, id); err != nil {
+			if err != errSkip {
+				w.l.Errorw("failed to check payment", "quote", id, "error", err.Error())
+			}
+			continue
+		}
+		checked++
+	}
+	return checked, nil
+}
+
+// adopt starts tracking recent payments created before quotes were introduced
+func (w *Watcher) adopt() error {
+	var untracked []models.Payment
+	if err := w.db.
+		Where("id NOT IN (?)", w.db.Table(Quote{}.TableName()).Select("payment_id").QueryExpr()).
+		Where("created_at > ?", w.now().Add(-w.opts.FailAfter)).
+		Limit(w.opts.BatchSize).
+		Find(&untracked).Error; err != nil {
+		return err
+	}
+	for i := range untracked {
+		payment := &untracked[i]
+		q := w.newQuote(payment, payment.CreatedAt)
+		switch {
+		case payment.Confirmed:
+			q.State = Confirmed
+		case submitted(payment):
+			q.State = Confirming
+			q.SubmittedAt = &payment.UpdatedAt
+		}
+		if err := w.db.Set("gorm:insert_option", "ON CONFLICT DO NOTHING").Create(q).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check updates the state of a single payment
+func (w *Watcher) check(ctx context.Context, id uint) error {
+	return w.transaction(func(tx *gorm.DB) error {
+		var q Quote
+		err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").First(&q, id).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return errSkip
+		} else if err != nil {
+			return err
+		}
+		var payment models.Payment
+		if err := tx.First(&payment, q.PaymentID).Error; err != nil {
+			return err
+		}
+		now := w.now()
+		q.CheckedAt = &now
+		if err := w.update(ctx, tx, &q, &payment, now); err != nil {
+			return err
+		}
+		return tx.Save(&q).Error
+	})
+}
+
+// update moves a payment to its next state, notifying the user of any change
+func (w *Watcher) update(ctx context.Context, tx *gorm.DB, q *Quote, payment *models.Payment, now time.Time) error {
+	if payment.Confirmed {
+		q.State = Confirmed
+		return w.notify(tx, q, "Payment Confirmed", fmt.Sprintf(
+			"Your payment #%v has been confirmed, and %v credits have been added to your account.",
+			q.Number, payment.USDValue,
+		))
+	}
+	var obs Observation
+	if chain, ok := w.chains[payment.Blockchain]; ok {
+		var err error
+		if obs, err = chain.Check(ctx, payment, q.Reference); err != nil {
+			// without knowing the state on chain, it is not safe to expire the payment
+			w.l.Warnw("failed to check payment on chain", "user", q.UserName, "payment", q.Number, "error", err.Error())
+			q.LastError = err.Error()
+			return nil
+		}
+		q.LastError = ""
+	}
+	switch {
+	case obs.Failed:
+		return w.fail(tx, q, "The transaction for your payment failed. No credits have been granted.")
+	case q.State == Pending && obs.Received > 0:
+		// the payment was sent without being submitted through the api
+		q.State = Confirming
+		q.SubmittedAt = &now
+		return w.notify(tx, q, "Payment Received", fmt.Sprintf(
+			"Your payment #%v has been received, and is waiting to be confirmed.", q.Number,
+		))
+	case q.State == Confirming:
+		return w.confirming(tx, q, payment, obs, now)
+	case now.After(q.ExpiresAt):
+		// only bitcoin cash charge amounts can be changed after the payment is
+		// created. Ethereum charge amounts are signed for the payment contract,
+		// and dash ones include the fee of the chainrider payment forward
+		if payment.Blockchain == BitcoinCash && q.Requotes < w.opts.MaxRequotes {
+			return w.requote(tx, q, payment, now)
+		}
+		q.State = Expired
+		return w.notify(tx, q, "Payment Expired", fmt.Sprintf(
+			"Your payment #%v expired before it was paid. Please create a new payment if you still wish to purchase credits.", q.Number,
+		))
+	}
+	return nil
+}
+
+// confirming resubmits the confirmation of a submitted payment which has not
+// been confirmed in time, failing it once it has been waiting too long
+func (w *Watcher) confirming(tx *gorm.DB, q *Quote, payment *models.Payment, obs Observation, now time.Time) error {
+	if q.SubmittedAt == nil {
+		q.SubmittedAt = &now
+	}
+	if now.Sub(*q.SubmittedAt) > w.opts.FailAfter {
+		w.l.Errorw("payment was not confirmed in time", "user", q.UserName, "payment", q.Number, "received", obs.Received)
+		return w.fail(tx, q, "Your payment could not be confirmed. Please contact support@rtradetechnologies.com with your payment number.")
+	}
+	last := *q.SubmittedAt
+	if q.ResubmittedAt != nil {
+		last = *q.ResubmittedAt
+	}
+	if now.Sub(last) < w.opts.ConfirmTimeout || !submitted(payment) {
+		return nil
+	}
+	// if we can see the payment has not confirmed on chain, there is nothing to resubmit
+	if _, ok := w.chains[payment.Blockchain]; ok && !obs.Confirmed {
+		return nil
+	}
+	msg, confirmQueue, err := confirmation(q, payment)
+	if err != nil {
+		return err
+	}
+	if _, err := queue.Enqueue(tx, confirmQueue, msg); err != nil {
+		return err
+	}
+	q.ResubmittedAt = &now
+	w.l.Infow("resubmitted payment confirmation", "user", q.UserName, "payment", q.Number)
+	return nil
+}
+
+// requote updates the charge amount of an unpaid payment to the current price
+func (w *Watcher) requote(tx *gorm.DB, q *Quote, payment *models.Payment, now time.Time) error {
+	price, err := w.quote(payment.Type)
+	if err != nil {
+		// try again on the next pass
+		q.LastError = err.Error()
+		return nil
+	}
+	if price.USD <= 0 {
+		return fmt.Errorf("invalid %s price %v", payment.Type, price.USD)
+	}
+	// cryptocurrencies we accept are divisible to 8 decimals
+	chargeAmount := math.Round(payment.USDValue/price.USD*1e8) / 1e8
+	if err := tx.Model(payment).Update("charge_amount", chargeAmount).Error; err != nil {
+		return err
+	}
+	q.Requotes++
+	q.PriceQuoteID = price.ID
+	q.ExpiresAt = now.Add(w.opts.QuoteTTL)
+	w.l.Infow("payment requoted", "user", q.UserName, "payment", q.Number, "charge_amount", chargeAmount)
+	return w.notify(tx, q, "Payment Requoted", fmt.Sprintf(
+		"Your payment #%v was not received in time, and has been requoted at the current price. Please send %v %s to %s before %s.",
+		q.Number, chargeAmount, payment.Type, payment.DepositAddress, q.ExpiresAt.UTC().Format(time.RFC1123),
+	))
+}
+
+func (w *Watcher) fail(tx *gorm.DB, q *Quote, content string) error {
+	q.State = Failed
+	return w.notify(tx, q, "Payment Failed", fmt.Sprintf("Payment #%v: %s", q.Number, content))
+}
+
+// notify queues an email to the owner of a payment, sent once the transaction commits
+func (w *Watcher) notify(tx *gorm.DB, q *Quote, subject, content string) error {
+	user, err := models.NewUserManager(tx).FindByUserName(q.UserName)
+	if err != nil {
+		return err
+	}
+	_, err = queue.Enqueue(tx, queue.EmailSendQueue, queue.EmailSend{
+		Subject:     "TEMPORAL " + subject,
+		Content:     content,
+		ContentType: "text/html",
+		UserNames:   []string{q.UserName},
+		Emails:      []string{user.EmailAddress},
+	})
+	return err
+}
+
+func (w *Watcher) transaction(fn func(tx *gorm.DB) error) error {
+	tx := w.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// newQuote returns the quote of a payment, honoured for the quote ttl
+func (w *Watcher) newQuote(payment *models.Payment, quotedAt time.Time) *Quote {
+	return &Quote{
+		PaymentID:  payment.ID,
+		UserName:   payment.UserName,
+		Number:     payment.Number,
+		Blockchain: payment.Blockchain,
+		Type:       payment.Type,
+		State:      Pending,
+		ExpiresAt:  quotedAt.Add(w.opts.QuoteTTL),
+	}
+}
+
+// submitted returns whether the user has provided what is needed to confirm
+// a payment. Until then, the tx hash is a placeholder of the user name and
+// payment number. Dash payments are confirmed through their payment forward
+func submitted(payment *models.Payment) bool {
+	return payment.Blockchain == Dash ||
+		payment.TxHash != fmt.Sprintf("%s-%v", payment.UserName, payment.Number)
+}
+
+// confirmation returns the message used to confirm a payment
+func confirmation(q *Quote, payment *models.Payment) (interface{}, queue.Queue, error) {
+	switch payment.Blockchain {
+	case Ethereum:
+		return queue.EthPaymentConfirmation{
+			UserName:      payment.UserName,
+			PaymentNumber: payment.Number,
+		}, queue.EthPaymentConfirmationQueue, nil
+	case BitcoinCash:
+		return queue.BchPaymentConfirmation{
+			UserName:      payment.UserName,
+			PaymentNumber: payment.Number,
+		}, queue.BitcoinCashPaymentConfirmationQueue, nil
+	case Dash:
+		return queue.DashPaymenConfirmation{
+			UserName:         payment.UserName,
+			PaymentForwardID: q.Reference,
+			PaymentNumber:    payment.Number,
+		}, queue.DashPaymentConfirmationQueue, nil
+	}
+	return nil, "", fmt.Errorf("unsupported blockchain %s", payment.Blockchain)
+}
@@ -0,0 +1,204 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/pricing"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap/zaptest"
+)
+
+const testUser = "testuser"
+
+// fakeChain reports a fixed observation for every payment
+type fakeChain struct {
+	obs Observation
+	err error
+}
+
+func (f *fakeChain) Check(ctx context.Context, payment *models.Payment, reference string) (Observation, error) {
+	return f.obs, f.err
+}
+
+func TestWatcher(t *testing.T) {
+	db := loadDatabase(t)
+	chain := &fakeChain{}
+	w := NewWatcher(db, zaptest.NewLogger(t).Sugar(), map[string]Chain{Ethereum: chain}, func(string) (*pricing.Quote, error) {
+		return &pricing.Quote{Model: gorm.Model{ID: 2}, USD: 500}, nil
+	}, Options{MaxRequotes: 1})
+	start := time.Now()
+	now := start
+	w.now = func() time.Time { return now }
+
+	type args struct {
+		blockchain string
+		submit     bool
+		// elapsed is the time passed since the payment was created
+		elapsed  time.Duration
+		obs      Observation
+		chainErr error
+		confirm  bool
+	}
+	tests := []struct {
+		name          string
+		args          args
+		wantState     State
+		wantRequotes  int
+		wantResubmits bool
+	}{
+		{"Fresh", args{BitcoinCash, false, time.Minute, Observation{}, nil, false}, Pending, 0, false},
+		{"Requoted", args{BitcoinCash, false, DefaultQuoteTTL + time.Minute, Observation{}, nil, false}, Pending, 1, false},
+		{"Expired", args{Ethereum, false, DefaultQuoteTTL + time.Minute, Observation{}, nil, false}, Expired, 0, false},
+		{"ChainError", args{Ethereum, false, DefaultQuoteTTL + time.Minute, Observation{}, errors.New("node down"), false}, Pending, 0, false},
+		{"Received", args{Ethereum, false, DefaultQuoteTTL + time.Minute, Observation{Received: 1}, nil, false}, Confirming, 0, false},
+		{"TxFailed", args{Ethereum, true, time.Minute, Observation{Failed: true}, nil, false}, Failed, 0, false},
+		{"Confirmed", args{Ethereum, true, time.Minute, Observation{}, nil, true}, Confirmed, 0, false},
+		{"NotConfirmedOnChain", args{Ethereum, true, DefaultConfirmTimeout + time.Minute, Observation{Received: 1}, nil, false}, Confirming, 0, false},
+		{"Stuck", args{Ethereum, true, DefaultConfirmTimeout + time.Minute, Observation{Received: 1, Confirmed: true}, nil, false}, Confirming, 0, true},
+		{"StuckWithoutChain", args{Dash, true, DefaultConfirmTimeout + time.Minute, Observation{}, nil, false}, Confirming, 0, true},
+		{"TimedOut", args{Dash, true, DefaultFailAfter + time.Minute, Observation{}, nil, false}, Failed, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = start
+			chain.obs, chain.err = tt.args.obs, tt.args.chainErr
+			payment := createPayment(t, db, tt.args.blockchain)
+			defer db.Unscoped().Delete(payment)
+			q, err := w.Track(payment, &pricing.Quote{Model: gorm.Model{ID: 1}, USD: 1000}, "forward-"+uuid.New().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Unscoped().Delete(q)
+			if tt.args.submit {
+				if tt.args.blockchain != Dash {
+					if err := db.Model(payment).Update("tx_hash", "0x"+uuid.New().String()).Error; err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := w.Submit(payment); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.args.confirm {
+				if err := db.Model(payment).Update("confirmed", true).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			now = start.Add(tt.args.elapsed)
+			if err := w.check(context.Background(), q.ID); err != nil {
+				t.Fatal(err)
+			}
+			got, err := w.Find(payment.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.State != tt.wantState {
+				t.Fatalf("expected state %s, got %s", tt.wantState, got.State)
+			}
+			if got.Requotes != tt.wantRequotes {
+				t.Fatalf("expected %v requotes, got %v", tt.wantRequotes, got.Requotes)
+			}
+			if (got.ResubmittedAt != nil) != tt.wantResubmits {
+				t.Fatalf("expected resubmitted %v, got %v", tt.wantResubmits, got.ResubmittedAt)
+			}
+			if tt.args.chainErr != nil && got.LastError == "" {
+				t.Fatal("chain error should be recorded")
+			}
+			if tt.wantRequotes > 0 {
+				var requoted models.Payment
+				if err := db.First(&requoted, payment.ID).Error; err != nil {
+					t.Fatal(err)
+				}
+				// 10 usd at 500 usd per bch
+				if requoted.ChargeAmount != 0.02 || got.PriceQuoteID != 2 {
+					t.Fatalf("expected charge amount 0.02 from quote 2, got %v from quote %v", requoted.ChargeAmount, got.PriceQuoteID)
+				}
+			}
+		})
+	}
+}
+
+func TestWatcher_Submit(t *testing.T) {
+	db := loadDatabase(t)
+	start := time.Now()
+	now := start
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration
+		wantErr error
+	}{
+		{"InTime", 0, time.Minute, nil},
+		{"Expired", 0, DefaultQuoteTTL + time.Minute, ErrQuoteExpired},
+		{"LongTTL", DefaultQuoteTTL * 2, DefaultQuoteTTL + time.Minute, nil},
+		{"ShortTTL", time.Minute * 10, time.Minute * 11, ErrQuoteExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWatcher(db, zaptest.NewLogger(t).Sugar(), nil, nil, Options{MaxRequotes: 1, QuoteTTL: tt.ttl})
+			w.now = func() time.Time { return now }
+			now = start
+			payment := createPayment(t, db, Ethereum)
+			defer db.Unscoped().Delete(payment)
+			q, err := w.Track(payment, &pricing.Quote{USD: 1000}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Unscoped().Delete(q)
+			now = start.Add(tt.elapsed)
+			if err := w.Submit(payment); err != tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil {
+				// payments can only be submitted once
+				if err := w.Submit(payment); err != ErrPaymentClosed {
+					t.Fatalf("expected %v, got %v", ErrPaymentClosed, err)
+				}
+			}
+		})
+	}
+}
+
+func createPayment(t *testing.T, db *gorm.DB, blockchain string) *models.Payment {
+	number := time.Now().UnixNano()
+	paymentType := map[string]string{Ethereum: "eth", BitcoinCash: "bch", Dash: "dash"}[blockchain]
+	payment, err := models.NewPaymentManager(db).NewPayment(
+		number,
+		"address-"+uuid.New().String(),
+		fmt.Sprintf("%s-%v", testUser, number),
+		10,
+		0.01,
+		blockchain,
+		paymentType,
+		testUser,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payment
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(&Quote{}, &queue.OutboxMessage{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
@@ -0,0 +1,7 @@
+// Package pins tracks pins requested through the ipfs pinning service api.
+// Each request records the content to pin along with the name, origins and
+// meta given by the client, and moves from queued to pinning to pinned, or
+// failed, as the cluster pin queue processes it. Removing a request stops
+// tracking it, while the content itself stays pinned until the hold time
+// paid for runs out, as with every other upload.
+package pins
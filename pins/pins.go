@@ -0,0 +1,256 @@
+package pins
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// Status is the state of a pin request
+type Status string
+
+const (
+	// Queued pins are waiting to be processed by the cluster pin queue
+	Queued Status = "queued"
+	// Pinning pins are being pinned to the cluster
+	Pinning Status = "pinning"
+	// Pinned pins have been pinned to the cluster, and recorded as an upload
+	Pinned Status = "pinned"
+	// Failed pins could not be pinned, or recorded as an upload
+	Failed Status = "failed"
+)
+
+// Statuses are the valid pin request statuses
+var Statuses = []Status{Queued, Pinning, Pinned, Failed}
+
+// Match is how names are matched when listing pin requests
+type Match string
+
+const (
+	// Exact matches names which are the same
+	Exact Match = "exact"
+	// IExact matches names which are the same, ignoring case
+	IExact Match = "iexact"
+	// Partial matches names containing the given name
+	Partial Match = "partial"
+	// IPartial matches names containing the given name, ignoring case
+	IPartial Match = "ipartial"
+)
+
+var (
+	// ErrNotFound is returned when a pin request does not exist
+	ErrNotFound = errors.New("pin request not found")
+	// ErrInvalidMatch is returned when listing with an unknown name match
+	ErrInvalidMatch = errors.New("match must be one of exact, iexact, partial or ipartial")
+)
+
+// Origins are the multiaddrs of peers known to provide pinned content
+type Origins []string
+
+// Value stores origins as a json array
+func (o Origins) Value() (driver.Value, error) {
+	if o == nil {
+		o = Origins{}
+	}
+	data, err := json.Marshal(o)
+	return string(data), err
+}
+
+// Scan reads origins stored as a json array
+func (o *Origins) Scan(src interface{}) error {
+	return scanJSON(src, o)
+}
+
+// Meta is optional information about a pin request, set by the client
+type Meta map[string]string
+
+// Value stores meta as a json object
+func (m Meta) Value() (driver.Value, error) {
+	if m == nil {
+		m = Meta{}
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+// Scan reads meta stored as a json object
+func (m *Meta) Scan(src interface{}) error {
+	return scanJSON(src, m)
+}
+
+func scanJSON(src, dst interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("can not scan %T into %T", src, dst)
+	}
+}
+
+// Request is a request to pin content to the public network
+type Request struct {
+	gorm.Model
+	// RequestID identifies the request to pinning service api clients
+	RequestID string  `gorm:"type:varchar(64);unique_index" json:"requestid"`
+	UserName  string  `gorm:"type:varchar(255);index" json:"user_name"`
+	CID       string  `gorm:"type:varchar(255);index" json:"cid"`
+	Name      string  `gorm:"type:varchar(255)" json:"name"`
+	Origins   Origins `gorm:"type:text" json:"origins"`
+	Meta      Meta    `gorm:"type:jsonb" json:"meta"`
+	Status    Status  `gorm:"type:varchar(16);index" json:"status"`
+	// HoldTime is the number of months the content is pinned for
+	HoldTime int64 `json:"hold_time"`
+	// Reason is why the pin failed
+	Reason string `gorm:"type:text" json:"reason,omitempty"`
+}
+
+// TableName returns the table used to store pin requests
+func (Request) TableName() string {
+	return "pin_requests"
+}
+
+// Filter narrows down the pin requests that are listed. Empty fields are ignored
+type Filter struct {
+	CIDs []string
+	Name string
+	// Match is how Name is matched, defaulting to Exact
+	Match    Match
+	Statuses []Status
+	// Before and After limit requests to those created in between
+	Before time.Time
+	After  time.Time
+	// Meta limits requests to those with all the given meta
+	Meta map[string]string
+}
+
+// Manager is used to record and query pin requests
+type Manager struct {
+	db *gorm.DB
+}
+
+// NewManager is used to instantiate our pin request manager. If the given
+// database handle is a transaction, requests are recorded within it
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// Create records a new pin request, assigning it a request id unless it has one
+func (m *Manager) Create(req *Request) error {
+	if req.RequestID == "" {
+		req.RequestID = NewRequestID()
+	}
+	if req.Status == "" {
+		req.Status = Queued
+	}
+	return m.db.Create(req).Error
+}
+
+// NewRequestID returns a new, random, request id
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// Find returns a pin request of a user
+func (m *Manager) Find(username, requestID string) (*Request, error) {
+	var req Request
+	if err := m.db.Where("request_id = ? AND user_name = ?", requestID, username).First(&req).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+// List returns a query for the pin requests of a user matching filter, newest first
+func (m *Manager) List(username string, filter Filter) (*gorm.DB, error) {
+	query := m.db.Model(&Request{}).Where("user_name = ?", username)
+	if len(filter.CIDs) > 0 {
+		query = query.Where("cid IN (?)", filter.CIDs)
+	}
+	if filter.Name != "" {
+		// escape like patterns, so names are always matched literally
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Name) + "%"
+		switch filter.Match {
+		case Exact, "":
+			query = query.Where("name = ?", filter.Name)
+		case IExact:
+			query = query.Where("LOWER(name) = LOWER(?)", filter.Name)
+		case Partial:
+			query = query.Where("name LIKE ?", pattern)
+		case IPartial:
+			query = query.Where("name ILIKE ?", pattern)
+		default:
+			return nil, ErrInvalidMatch
+		}
+	}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN (?)", filter.Statuses)
+	}
+	if !filter.Before.IsZero() {
+		query = query.Where("created_at < ?", filter.Before)
+	}
+	if !filter.After.IsZero() {
+		query = query.Where("created_at > ?", filter.After)
+	}
+	if len(filter.Meta) > 0 {
+		meta, err := Meta(filter.Meta).Value()
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("meta @> ?", meta)
+	}
+	return query.Order("created_at DESC, id DESC"), nil
+}
+
+// Replace records a new pin request in place of an existing one, which is removed
+func (m *Manager) Replace(old, req *Request) error {
+	return m.transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(old).Error; err != nil {
+			return err
+		}
+		return NewManager(tx).Create(req)
+	})
+}
+
+// Remove stops tracking a pin request
+func (m *Manager) Remove(req *Request) error {
+	return m.db.Delete(req).Error
+}
+
+// SetStatus updates the status of a pin request, along with
+// the reason it failed, if any
+func (m *Manager) SetStatus(requestID string, status Status, reason string) error {
+	return m.db.Model(&Request{}).Where("request_id = ?", requestID).Updates(map[string]interface{}{
+		"status": status,
+		"reason": reason,
+	}).Error
+}
+
+// transaction runs fn within a transaction, or within the
+// transaction the manager was created with
+func (m *Manager) transaction(fn func(tx *gorm.DB) error) error {
+	if _, ok := m.db.CommonDB().(*sql.Tx); ok {
+		return fn(m.db)
+	}
+	tx := m.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,138 @@
+package pins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+func TestManager(t *testing.T) {
+	db := loadDatabase(t)
+	m := NewManager(db)
+	// use a unique user so previous runs do not affect the results
+	user := "user-" + uuid.New().String()
+	defer db.Unscoped().Where("user_name = ?", user).Delete(&Request{})
+
+	reqs := []*Request{
+		{UserName: user, CID: "cid1", Name: "Website", Meta: Meta{"env": "prod", "app": "site"}},
+		{UserName: user, CID: "cid2", Name: "website-staging", Meta: Meta{"env": "staging"}, Origins: Origins{"/ip4/127.0.0.1/tcp/4001"}},
+		{UserName: user, CID: "cid3", Name: "backup_1", Status: Pinned},
+	}
+	for _, req := range reqs {
+		if err := m.Create(req); err != nil {
+			t.Fatal(err)
+		}
+		if req.RequestID == "" {
+			t.Fatal("no request id assigned")
+		}
+	}
+	if reqs[0].Status != Queued || reqs[2].Status != Pinned {
+		t.Fatalf("unexpected statuses %s and %s", reqs[0].Status, reqs[2].Status)
+	}
+
+	found, err := m.Find(user, reqs[1].RequestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.CID != "cid2" || found.Meta["env"] != "staging" || len(found.Origins) != 1 {
+		t.Fatalf("unexpected request %+v", found)
+	}
+	if _, err := m.Find("otheruser", reqs[1].RequestID); err != ErrNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		want    []string
+		wantErr error
+	}{
+		{"All", Filter{}, []string{"cid3", "cid2", "cid1"}, nil},
+		{"CIDs", Filter{CIDs: []string{"cid1", "cid3"}}, []string{"cid3", "cid1"}, nil},
+		{"Exact", Filter{Name: "Website"}, []string{"cid1"}, nil},
+		{"ExactCase", Filter{Name: "website"}, nil, nil},
+		{"IExact", Filter{Name: "website", Match: IExact}, []string{"cid1"}, nil},
+		{"Partial", Filter{Name: "site", Match: Partial}, []string{"cid2", "cid1"}, nil},
+		{"IPartial", Filter{Name: "WEB", Match: IPartial}, []string{"cid2", "cid1"}, nil},
+		{"PartialLiteral", Filter{Name: "p_1", Match: Partial}, []string{"cid3"}, nil},
+		{"PartialWildcard", Filter{Name: "%", Match: Partial}, nil, nil},
+		{"InvalidMatch", Filter{Name: "site", Match: "regex"}, nil, ErrInvalidMatch},
+		{"Statuses", Filter{Statuses: []Status{Queued, Pinning}}, []string{"cid2", "cid1"}, nil},
+		{"Meta", Filter{Meta: map[string]string{"env": "prod"}}, []string{"cid1"}, nil},
+		{"MetaAll", Filter{Meta: map[string]string{"env": "prod", "app": "other"}}, nil, nil},
+		{"After", Filter{After: time.Now().Add(time.Hour)}, nil, nil},
+		{"Before", Filter{Before: time.Now().Add(time.Hour)}, []string{"cid3", "cid2", "cid1"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := m.List(user, tt.filter)
+			if err != tt.wantErr {
+				t.Fatalf("List() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []Request
+			if err := query.Find(&got).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v requests, got %v", len(tt.want), len(got))
+			}
+			for i, req := range got {
+				if req.CID != tt.want[i] {
+					t.Fatalf("expected %s at %v, got %s", tt.want[i], i, req.CID)
+				}
+			}
+		})
+	}
+
+	// statuses are updated by request id
+	if err := m.SetStatus(reqs[0].RequestID, Failed, "failed to pin content"); err != nil {
+		t.Fatal(err)
+	}
+	if found, err = m.Find(user, reqs[0].RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if found.Status != Failed || found.Reason != "failed to pin content" {
+		t.Fatalf("unexpected request %+v", found)
+	}
+
+	// replacements get a new request id
+	replacement := &Request{UserName: user, CID: "cid4"}
+	if err := m.Replace(reqs[0], replacement); err != nil {
+		t.Fatal(err)
+	}
+	if replacement.RequestID == "" || replacement.RequestID == reqs[0].RequestID {
+		t.Fatalf("unexpected request id %s", replacement.RequestID)
+	}
+	if _, err := m.Find(user, reqs[0].RequestID); err != ErrNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := m.Remove(replacement); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Find(user, replacement.RequestID); err != ErrNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(&Request{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
@@ -0,0 +1,6 @@
+// Package pricing provides usd prices for the cryptocurrencies we accept as
+// payment. Prices are read from several sources, such as coinmarketcap and
+// coingecko, which are combined by an Oracle into a single quote. Quotes are
+// persisted, both to be reused between processes and so that payments can
+// record the price they were charged at.
+package pricing
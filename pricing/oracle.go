@@ -0,0 +1,270 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTTL is how long a quote is reused before prices are refreshed
+	DefaultTTL = time.Minute * 10
+	// DefaultMaxAge is the age at which prices are considered stale
+	DefaultMaxAge = time.Hour
+	// DefaultMaxDeviation is the fraction a price may differ from the
+	// median of all sources before it is rejected as an outlier
+	DefaultMaxDeviation = 0.1
+	// DefaultTimeout is how long sources are given to respond
+	DefaultTimeout = time.Second * 10
+)
+
+var (
+	// ErrUnsupportedCoin is returned when no source has prices for a coin
+	ErrUnsupportedCoin = errors.New("unsupported coin")
+	// ErrNoPrice is returned when too few sources returned usable prices
+	ErrNoPrice = errors.New("failed to get price")
+)
+
+// Price is the usd price of a single unit of a coin
+type Price struct {
+	USD float64
+	// UpdatedAt is when the source last updated the price
+	UpdatedAt time.Time
+}
+
+// PriceOracle is a source of usd prices. Coins are identified by the payment
+// type they are used for, ie "eth" or "bch"
+type PriceOracle interface {
+	// Name identifies the source of prices
+	Name() string
+	// Price returns the current price of a coin, or ErrUnsupportedCoin
+	// if the source does not have prices for it
+	Price(ctx context.Context, coin string) (Price, error)
+}
+
+// Quote is the price of a coin at a point in time, agreed between sources
+type Quote struct {
+	gorm.Model
+	Coin string  `gorm:"type:varchar(32);index" json:"coin"`
+	USD  float64 `json:"usd"`
+	// Sources lists the price reported by each source that was used,
+	// ie "cmc=101.5,coingecko=101.2"
+	Sources string `gorm:"type:text" json:"sources"`
+	// Rejected lists the sources that failed, or were rejected as stale
+	// or outliers, along with the reason
+	Rejected string    `gorm:"type:text" json:"rejected,omitempty"`
+	QuotedAt time.Time `gorm:"index" json:"quoted_at"`
+}
+
+// TableName returns the table used to store price quotes
+func (Quote) TableName() string {
+	return "price_quotes"
+}
+
+// Options is used to configure an Oracle
+type Options struct {
+	TTL          time.Duration
+	MaxAge       time.Duration
+	MaxDeviation float64
+	Timeout      time.Duration
+	// MinSources is the number of sources which must agree on a price
+	MinSources int
+}
+
+// Oracle combines the prices of several sources into quotes. The price quoted
+// is the median across sources, after rejecting stale prices and outliers.
+// Quotes are cached in the database, so are shared by all processes
+type Oracle struct {
+	db      *gorm.DB
+	l       *zap.SugaredLogger
+	sources []PriceOracle
+	opts    Options
+	now     func() time.Time
+
+	mux    sync.Mutex
+	quotes map[string]*Quote
+}
+
+// New is used to instantiate an oracle quoting prices from the given sources
+func New(db *gorm.DB, logger *zap.SugaredLogger, opts Options, sources ...PriceOracle) *Oracle {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.MaxDeviation <= 0 {
+		opts.MaxDeviation = DefaultMaxDeviation
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MinSources <= 0 {
+		opts.MinSources = 1
+	}
+	return &Oracle{
+		db:      db,
+		l:       logger.Named("pricing"),
+		sources: sources,
+		opts:    opts,
+		now:     time.Now,
+		quotes:  make(map[string]*Quote),
+	}
+}
+
+// Quote returns the current price of a coin. A recent quote is reused if there
+// is one, otherwise prices are refreshed. Should the refresh fail, the last
+// quote is returned as long as it is not stale
+func (o *Oracle) Quote(ctx context.Context, coin string) (*Quote, error) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	last, err := o.last(coin)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && o.now().Sub(last.QuotedAt) < o.opts.TTL {
+		return last, nil
+	}
+	quote, err := o.refresh(ctx, coin)
+	if err == nil {
+		o.quotes[coin] = quote
+		return quote, nil
+	}
+	if err != ErrUnsupportedCoin && last != nil && o.now().Sub(last.QuotedAt) < o.opts.MaxAge {
+		o.l.Warnw("failed to refresh price, using last quote", "coin", coin, "quote", last.ID, "error", err.Error())
+		return last, nil
+	}
+	return nil, err
+}
+
+// Find returns a previously issued quote
+func (o *Oracle) Find(id uint) (*Quote, error) {
+	var quote Quote
+	if err := o.db.First(&quote, id).Error; err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// last returns the latest quote for a coin, which may have been issued by another process
+func (o *Oracle) last(coin string) (*Quote, error) {
+	if quote, ok := o.quotes[coin]; ok && o.now().Sub(quote.QuotedAt) < o.opts.TTL {
+		return quote, nil
+	}
+	var quote Quote
+	err := o.db.Where("coin = ?", coin).Order("quoted_at desc").First(&quote).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	o.quotes[coin] = &quote
+	return &quote, nil
+}
+
+// refresh queries every source, and records the agreed price
+func (o *Oracle) refresh(ctx context.Context, coin string) (*Quote, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.opts.Timeout)
+	defer cancel()
+	type result struct {
+		source string
+		price  Price
+		err    error
+	}
+	results := make([]result, len(o.sources))
+	var wg sync.WaitGroup
+	for i, source := range o.sources {
+		wg.Add(1)
+		go func(i int, source PriceOracle) {
+			defer wg.Done()
+			price, err := source.Price(ctx, coin)
+			results[i] = result{source.Name(), price, err}
+		}(i, source)
+	}
+	wg.Wait()
+
+	var (
+		now      = o.now()
+		prices   = make(map[string]float64)
+		rejected []string
+	)
+	for _, r := range results {
+		switch {
+		case r.err == ErrUnsupportedCoin:
+			continue
+		case r.err != nil:
+			o.l.Warnw("failed to get price", "source", r.source, "coin", coin, "error", r.err.Error())
+			rejected = append(rejected, fmt.Sprintf("%s=error", r.source))
+		case r.price.USD <= 0 || math.IsNaN(r.price.USD) || math.IsInf(r.price.USD, 0):
+			rejected = append(rejected, fmt.Sprintf("%s=invalid", r.source))
+		case now.Sub(r.price.UpdatedAt) > o.opts.MaxAge:
+			rejected = append(rejected, fmt.Sprintf("%s=stale", r.source))
+		default:
+			prices[r.source] = r.price.USD
+		}
+	}
+	if len(prices) == 0 && len(rejected) == 0 {
+		return nil, ErrUnsupportedCoin
+	}
+	// reject prices which differ too far from the consensus
+	mid := median(prices)
+	for source, price := range prices {
+		if math.Abs(price-mid)/mid > o.opts.MaxDeviation {
+			o.l.Warnw("rejected outlier price", "source", source, "coin", coin, "price", price, "median", mid)
+			rejected = append(rejected, fmt.Sprintf("%s=outlier", source))
+			delete(prices, source)
+		}
+	}
+	if len(prices) < o.opts.MinSources {
+		return nil, ErrNoPrice
+	}
+	quote := &Quote{
+		Coin:     coin,
+		USD:      median(prices),
+		Sources:  format(prices),
+		Rejected: strings.Join(sorted(rejected), ","),
+		QuotedAt: now,
+	}
+	if err := o.db.Create(quote).Error; err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+func median(prices map[string]float64) float64 {
+	if len(prices) == 0 {
+		return 0
+	}
+	values := make([]float64, 0, len(prices))
+	for _, price := range prices {
+		values = append(values, price)
+	}
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// format lists prices by source, in a stable order
+func format(prices map[string]float64) string {
+	formatted := make([]string, 0, len(prices))
+	for source, price := range prices {
+		formatted = append(formatted, fmt.Sprintf("%s=%v", source, price))
+	}
+	return strings.Join(sorted(formatted), ",")
+}
+
+func sorted(s []string) []string {
+	sort.Strings(s)
+	return s
+}
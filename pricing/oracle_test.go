@@ -0,0 +1,153 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeSource reports a fixed price for every coin
+type fakeSource struct {
+	name  string
+	price Price
+	err   error
+	calls int
+}
+
+func (f *fakeSource) Name() string { return f.name }
+
+func (f *fakeSource) Price(ctx context.Context, coin string) (Price, error) {
+	f.calls++
+	return f.price, f.err
+}
+
+func TestOracle_Quote(t *testing.T) {
+	db := loadDatabase(t)
+	now := time.Now()
+	fresh := func(usd float64) Price { return Price{USD: usd, UpdatedAt: now} }
+	tests := []struct {
+		name         string
+		sources      []*fakeSource
+		wantErr      error
+		wantUSD      float64
+		wantRejected string
+	}{
+		{"Median", []*fakeSource{
+			{name: "a", price: fresh(100)},
+			{name: "b", price: fresh(102)},
+			{name: "c", price: fresh(101)},
+		}, nil, 101, ""},
+		{"EvenMedian", []*fakeSource{
+			{name: "a", price: fresh(100)},
+			{name: "b", price: fresh(102)},
+		}, nil, 101, ""},
+		{"Outlier", []*fakeSource{
+			{name: "a", price: fresh(100)},
+			{name: "b", price: fresh(102)},
+			{name: "c", price: fresh(1000)},
+		}, nil, 101, "c=outlier"},
+		{"Stale", []*fakeSource{
+			{name: "a", price: fresh(100)},
+			{name: "b", price: Price{USD: 50, UpdatedAt: now.Add(-DefaultMaxAge * 2)}},
+		}, nil, 100, "b=stale"},
+		{"Failed", []*fakeSource{
+			{name: "a", price: fresh(100)},
+			{name: "b", err: errors.New("rate limited")},
+			{name: "c", price: fresh(0)},
+		}, nil, 100, "b=error,c=invalid"},
+		{"Unsupported", []*fakeSource{
+			{name: "a", err: ErrUnsupportedCoin},
+		}, ErrUnsupportedCoin, 0, ""},
+		{"NoPrice", []*fakeSource{
+			{name: "a", err: errors.New("rate limited")},
+		}, ErrNoPrice, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := make([]PriceOracle, len(tt.sources))
+			for i, source := range tt.sources {
+				sources[i] = source
+			}
+			o := New(db, zaptest.NewLogger(t).Sugar(), Options{}, sources...)
+			o.now = func() time.Time { return now }
+			coin := "test-" + uuid.New().String()[:8]
+			quote, err := o.Quote(context.Background(), coin)
+			if err != tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			defer db.Unscoped().Delete(quote)
+			if quote.USD != tt.wantUSD {
+				t.Fatalf("expected price %v, got %v", tt.wantUSD, quote.USD)
+			}
+			if quote.Rejected != tt.wantRejected {
+				t.Fatalf("expected rejected %q, got %q", tt.wantRejected, quote.Rejected)
+			}
+			if _, err := o.Find(quote.ID); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOracle_Cache(t *testing.T) {
+	db := loadDatabase(t)
+	now := time.Now()
+	source := &fakeSource{name: "a", price: Price{USD: 100, UpdatedAt: now}}
+	o := New(db, zaptest.NewLogger(t).Sugar(), Options{}, source)
+	o.now = func() time.Time { return now }
+	coin := "test-" + uuid.New().String()[:8]
+	defer db.Unscoped().Where("coin = ?", coin).Delete(&Quote{})
+
+	quote, err := o.Quote(context.Background(), coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// quotes are shared through the database
+	other := New(db, zaptest.NewLogger(t).Sugar(), Options{}, source)
+	other.now = o.now
+	cached, err := other.Quote(context.Background(), coin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.ID != quote.ID || source.calls != 1 {
+		t.Fatalf("expected cached quote %v, got %v after %v calls", quote.ID, cached.ID, source.calls)
+	}
+	// once expired, prices are refreshed, falling back to the last quote on failure
+	now = now.Add(DefaultTTL)
+	source.err = errors.New("rate limited")
+	if cached, err = o.Quote(context.Background(), coin); err != nil {
+		t.Fatal(err)
+	} else if cached.ID != quote.ID || source.calls != 2 {
+		t.Fatalf("expected last quote %v, got %v after %v calls", quote.ID, cached.ID, source.calls)
+	}
+	// until the last quote is stale
+	now = now.Add(DefaultMaxAge)
+	if _, err := o.Quote(context.Background(), coin); err != ErrNoPrice {
+		t.Fatalf("expected %v, got %v", ErrNoPrice, err)
+	}
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(&Quote{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
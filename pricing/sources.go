@@ -0,0 +1,173 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// CMCURL is the url of the coinmarketcap api
+	CMCURL = "https://pro-api.coinmarketcap.com"
+	// CoinGeckoURL is the url of the coingecko api
+	CoinGeckoURL = "https://api.coingecko.com"
+)
+
+// slugs maps payment types to the identifiers used by coinmarketcap and coingecko
+var slugs = map[string]string{
+	"eth":  "ethereum",
+	"xmr":  "monero",
+	"dash": "dash",
+	"btc":  "bitcoin",
+	"bch":  "bitcoin-cash",
+	"ltc":  "litecoin",
+}
+
+// CMC reads prices from the coinmarketcap api
+type CMC struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewCMC is used to instantiate a coinmarketcap price source. The url may be
+// left empty to use the public api
+func NewCMC(apiURL, apiKey string) *CMC {
+	if apiURL == "" {
+		apiURL = CMCURL
+	}
+	return &CMC{url: apiURL, apiKey: apiKey, client: &http.Client{}}
+}
+
+// Name identifies coinmarketcap prices
+func (c *CMC) Name() string { return "cmc" }
+
+// Price returns the coinmarketcap price of a coin
+func (c *CMC) Price(ctx context.Context, coin string) (Price, error) {
+	slug, ok := slugs[coin]
+	if !ok {
+		return Price{}, ErrUnsupportedCoin
+	}
+	req, err := http.NewRequest("GET", c.url+"/v1/cryptocurrency/quotes/latest?"+url.Values{"slug": {slug}}.Encode(), nil)
+	if err != nil {
+		return Price{}, err
+	}
+	req.Header.Add("X-CMC_PRO_API_KEY", c.apiKey)
+	var resp struct {
+		Status struct {
+			ErrorMessage string `json:"error_message"`
+		} `json:"status"`
+		// keyed by coinmarketcap id
+		Data map[string]struct {
+			Slug  string `json:"slug"`
+			Quote struct {
+				USD struct {
+					Price       float64   `json:"price"`
+					LastUpdated time.Time `json:"last_updated"`
+				} `json:"USD"`
+			} `json:"quote"`
+		} `json:"data"`
+	}
+	if err := get(ctx, c.client, req, &resp); err != nil {
+		if resp.Status.ErrorMessage != "" {
+			return Price{}, errors.New(resp.Status.ErrorMessage)
+		}
+		return Price{}, err
+	}
+	for _, data := range resp.Data {
+		if data.Slug == slug {
+			return Price{USD: data.Quote.USD.Price, UpdatedAt: data.Quote.USD.LastUpdated}, nil
+		}
+	}
+	return Price{}, fmt.Errorf("no price for %s", slug)
+}
+
+// CoinGecko reads prices from the coingecko api
+type CoinGecko struct {
+	url    string
+	client *http.Client
+}
+
+// NewCoinGecko is used to instantiate a coingecko price source. The url may be
+// left empty to use the public api
+func NewCoinGecko(apiURL string) *CoinGecko {
+	if apiURL == "" {
+		apiURL = CoinGeckoURL
+	}
+	return &CoinGecko{url: apiURL, client: &http.Client{}}
+}
+
+// Name identifies coingecko prices
+func (c *CoinGecko) Name() string { return "coingecko" }
+
+// Price returns the coingecko price of a coin
+func (c *CoinGecko) Price(ctx context.Context, coin string) (Price, error) {
+	id, ok := slugs[coin]
+	if !ok {
+		return Price{}, ErrUnsupportedCoin
+	}
+	req, err := http.NewRequest("GET", c.url+"/api/v3/simple/price?"+url.Values{
+		"ids":                     {id},
+		"vs_currencies":           {"usd"},
+		"include_last_updated_at": {"true"},
+	}.Encode(), nil)
+	if err != nil {
+		return Price{}, err
+	}
+	var resp map[string]struct {
+		USD           float64 `json:"usd"`
+		LastUpdatedAt int64   `json:"last_updated_at"`
+	}
+	if err := get(ctx, c.client, req, &resp); err != nil {
+		return Price{}, err
+	}
+	price, ok := resp[id]
+	if !ok {
+		return Price{}, fmt.Errorf("no price for %s", id)
+	}
+	return Price{USD: price.USD, UpdatedAt: time.Unix(price.LastUpdatedAt, 0)}, nil
+}
+
+// Static reports fixed prices, for coins which are not listed on exchanges
+// such as rtc, or for development
+type Static struct {
+	prices map[string]float64
+	now    func() time.Time
+}
+
+// NewStatic is used to instantiate a source of fixed prices, keyed by payment type
+func NewStatic(prices map[string]float64) *Static {
+	return &Static{prices: prices, now: time.Now}
+}
+
+// Name identifies static prices
+func (s *Static) Name() string { return "static" }
+
+// Price returns the configured price of a coin
+func (s *Static) Price(ctx context.Context, coin string) (Price, error) {
+	price, ok := s.prices[coin]
+	if !ok {
+		return Price{}, ErrUnsupportedCoin
+	}
+	// configured prices never go stale
+	return Price{USD: price, UpdatedAt: s.now()}, nil
+}
+
+// get sends a request, decoding the json response into out even when the
+// request fails, so that api error messages can be reported
+func get(ctx context.Context, client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decodeErr := json.NewDecoder(resp.Body).Decode(out)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return decodeErr
+}
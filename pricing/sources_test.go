@@ -0,0 +1,68 @@
+package pricing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSources(t *testing.T) {
+	updated := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/cryptocurrency/quotes/latest":
+			if r.Header.Get("X-CMC_PRO_API_KEY") != "key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"status":{"error_message":"invalid api key"}}`))
+				return
+			}
+			if r.URL.Query().Get("slug") != "ethereum" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status":{"error_message":"invalid slug"}}`))
+				return
+			}
+			w.Write([]byte(`{"data":{"1027":{"slug":"ethereum","quote":{"USD":{"price":250.5,"last_updated":"2019-06-01T12:00:00.000Z"}}}}}`))
+		case "/api/v3/simple/price":
+			if r.URL.Query().Get("ids") != "ethereum" {
+				w.Write([]byte(`{}`))
+				return
+			}
+			w.Write([]byte(`{"ethereum":{"usd":251.5,"last_updated_at":1559390400}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	tests := []struct {
+		name      string
+		source    PriceOracle
+		coin      string
+		wantErr   bool
+		wantPrice Price
+	}{
+		{"CMC", NewCMC(srv.URL, "key"), "eth", false, Price{250.5, updated}},
+		{"CMCBadKey", NewCMC(srv.URL, "wrong"), "eth", true, Price{}},
+		{"CMCMissing", NewCMC(srv.URL, "key"), "btc", true, Price{}},
+		{"CMCUnsupported", NewCMC(srv.URL, "key"), "rtc", true, Price{}},
+		{"CoinGecko", NewCoinGecko(srv.URL), "eth", false, Price{251.5, updated}},
+		{"CoinGeckoMissing", NewCoinGecko(srv.URL), "btc", true, Price{}},
+		{"Static", NewStatic(map[string]float64{"rtc": 0.125}), "rtc", false, Price{USD: 0.125}},
+		{"StaticUnsupported", NewStatic(map[string]float64{"rtc": 0.125}), "eth", true, Price{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, err := tt.source.Price(context.Background(), tt.coin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Price() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if price.USD != tt.wantPrice.USD {
+				t.Fatalf("expected price %v, got %v", tt.wantPrice.USD, price.USD)
+			}
+			if !tt.wantPrice.UpdatedAt.IsZero() && !price.UpdatedAt.Equal(tt.wantPrice.UpdatedAt) {
+				t.Fatalf("expected update time %v, got %v", tt.wantPrice.UpdatedAt, price.UpdatedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/beams"
+	"github.com/RTradeLtd/Temporal/car"
+	"github.com/RTradeLtd/crypto/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api"
+	"github.com/RTradeLtd/rtfs/v2"
+	gocid "github.com/ipfs/go-cid"
+	"github.com/jinzhu/gorm"
+	"github.com/streadway/amqp"
+)
+
+// beamProgressInterval is how often the progress of beam jobs is recorded,
+// which is also about how long cancelled jobs keep transferring for
+const beamProgressInterval = 5 * time.Second
+
+// ProcessIPFSBeams is used to process messages sent to rabbitmq requesting content be beamed between networks
+func (qm *Manager) ProcessIPFSBeams(ctx context.Context, wg *sync.WaitGroup, msgs <-chan amqp.Delivery) error {
+	uploadManager := models.NewUploadManager(qm.db)
+	beamManager := beams.NewManager(qm.db)
+	qm.l.Info("processing ipfs beam requests")
+	for {
+		select {
+		case d := <-msgs:
+			qm.dispatch(ctx, wg, d, func(d amqp.Delivery) {
+				qm.processIPFSBeam(ctx, d, wg, uploadManager, beamManager)
+			})
+		case <-ctx.Done():
+			qm.Close()
+			wg.Done()
+			return nil
+		case msg := <-qm.ErrCh:
+			qm.Close()
+			wg.Done()
+			qm.l.Errorw(
+				"a protocol connection error stopping rabbitmq was received",
+				"error", msg.Error())
+			return errors.New(ErrReconnect)
+		}
+	}
+}
+
+func (qm *Manager) processIPFSBeam(ctx context.Context, d amqp.Delivery, wg *sync.WaitGroup, um *models.UploadManager, bm *beams.Manager) {
+	defer wg.Done()
+	l := qm.deliveryLogger(d)
+	l.Info("new beam request detected")
+	beam := IPFSBeam{}
+	if err := json.Unmarshal(d.Body, &beam); err != nil {
+		l.Errorw(
+			"failed to unmarshal message",
+			"error", err.Error())
+		d.Ack(false)
+		return
+	}
+	l = l.With(
+		"job_id", beam.JobID,
+		"cid", beam.CID,
+		"user", beam.UserName)
+	// fail marks the job as failed, refunding the user unless
+	// the job was cancelled in the meantime
+	fail := func(reason string, err error) {
+		l.Errorw(reason, "error", err.Error())
+		if err := qm.failBeam(beam.JobID, reason); err == beams.ErrStopped {
+			l.Info("beam job stopped before it failed")
+		} else if err != nil {
+			l.Errorw("failed to update beam job", "error", err.Error())
+		}
+		d.Ack(false)
+	}
+	root, err := gocid.Decode(beam.CID)
+	if err != nil {
+		fail("invalid cid", err)
+		return
+	}
+	secret, err := bm.Secret(beam.JobID)
+	if err != nil {
+		fail("failed to find beam job secret", err)
+		return
+	}
+	src, _, err := qm.connectNetwork(beam.SourceNetwork, beam.UserName, secret.JWT)
+	if err != nil {
+		fail("failed to connect to source network", err)
+		return
+	}
+	dst, dstShell, err := qm.connectNetwork(beam.DestinationNetwork, beam.UserName, secret.JWT)
+	if err != nil {
+		fail("failed to connect to destination network", err)
+		return
+	}
+	job, err := bm.Find(beam.UserName, beam.JobID)
+	if err != nil {
+		fail("failed to find beam job", err)
+		return
+	}
+	if job.Status == beams.Pinning {
+		// jobs redelivered once pinning have been transferred already, and
+		// can no longer be cancelled, so go straight to pinning the content
+		// recorded on the job, which is the copy of crypted content
+		beam.CID = job.CID
+	} else {
+		// crypted content is beamed as a single copy, rather than by block
+		var ids []gocid.Cid
+		total := int64(1)
+		if !beam.Crypted {
+			refs, err := src.Refs(beam.CID, true, true)
+			if err != nil {
+				fail("failed to list the blocks of the content", err)
+				return
+			}
+			ids = []gocid.Cid{root}
+			for _, ref := range refs {
+				id, err := gocid.Decode(ref)
+				if err != nil {
+					fail("failed to list the blocks of the content", err)
+					return
+				}
+				ids = append(ids, id)
+			}
+			total = int64(len(ids))
+		}
+		// cancelled jobs were refunded when cancelled
+		if err := bm.Start(beam.JobID, total); err == beams.ErrStopped {
+			l.Info("beam job stopped before it was started")
+			d.Ack(false)
+			return
+		} else if err != nil {
+			fail("failed to start beam job", err)
+			return
+		}
+		l.Infow(
+			"beaming content",
+			"source", beam.SourceNetwork,
+			"destination", beam.DestinationNetwork,
+			"blocks", total)
+		if beam.Crypted {
+			var hash string
+			if hash, err = beamCrypted(src, dst, bm, beam, secret.Passphrase); err == nil {
+				beam.CID = hash
+			}
+		} else {
+			err = transferBlocks(ctx, src, ids, func(block *car.Block) error {
+				return car.PutBlock(dstShell, block)
+			}, func(blocks, bytes int64) error {
+				return bm.Progress(beam.JobID, blocks, bytes)
+			})
+		}
+		if err == nil {
+			// once pinning, the job can no longer be cancelled
+			err = bm.Pin(beam.JobID)
+		}
+		switch {
+		case err == beams.ErrStopped:
+			l.Info("beam job cancelled")
+			d.Ack(false)
+			return
+		case ctx.Err() != nil:
+			// the transfer starts over once the message is redelivered
+			d.Nack(false, true)
+			return
+		case err != nil:
+			fail("failed to transfer content", err)
+			return
+		}
+	}
+	if err := dst.Pin(beam.CID); err != nil {
+		fail("failed to pin content", err)
+		return
+	}
+	upload, err := um.FindUploadByHashAndUserAndNetwork(beam.UserName, beam.CID, beam.DestinationNetwork)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		l.Errorw(
+			"failed to check database for upload",
+			"error", err.Error())
+		bm.Fail(beam.JobID, "failed to record upload")
+		d.Ack(false)
+		return
+	}
+	if upload == nil {
+		_, err = um.NewUpload(beam.CID, "beam", models.UploadOptions{
+			NetworkName:      beam.DestinationNetwork,
+			Username:         beam.UserName,
+			HoldTimeInMonths: beam.HoldTimeInMonths,
+			Size:             beam.Size})
+	} else {
+		_, err = um.UpdateUpload(beam.HoldTimeInMonths, beam.UserName, beam.CID, beam.DestinationNetwork)
+	}
+	if err != nil {
+		l.Errorw(
+			"failed to update database",
+			"error", err.Error())
+		bm.Fail(beam.JobID, "failed to record upload")
+	} else {
+		// encrypted copies are recorded so users can find them, which
+		// is not reason enough to fail content which has been pinned
+		if beam.Encrypted {
+			if _, err := models.NewEncryptedUploadManager(qm.db).NewUpload(
+				beam.UserName, beam.FileName, beam.DestinationNetwork, beam.CID,
+			); err != nil {
+				l.Errorw(
+					"failed to record encrypted upload",
+					"error", err.Error())
+			}
+		}
+		l.Info("successfully processed beam request")
+		bm.Complete(beam.JobID)
+	}
+	d.Ack(false)
+}
+
+// beamCrypted adds the encrypted, or decrypted, copy of the content of a beam
+// to the destination network, recording it as the content of the job. The
+// copy is pinned as it is added, so that it is not garbage collected before
+// the job finishes
+func beamCrypted(src, dst rtfs.Manager, bm *beams.Manager, beam IPFSBeam, passphrase string) (string, error) {
+	content, err := cryptContent(src, beam.CID, passphrase, beam.Decrypt)
+	if err != nil {
+		return "", err
+	}
+	// jobs cancelled while crypting are stopped before the copy is added
+	if err := bm.Progress(beam.JobID, 0, 0); err != nil {
+		return "", err
+	}
+	hash, err := dst.Add(bytes.NewReader(content), ipfsapi.Pin(true))
+	if err != nil {
+		return "", err
+	}
+	if err := bm.Replace(beam.JobID, hash); err != nil {
+		return "", err
+	}
+	return hash, bm.Progress(beam.JobID, 1, int64(len(content)))
+}
+
+// cryptContent encrypts the content at hash with passphrase, or decrypts it.
+// The crypto package authenticates content as a whole, so it is held in memory
+func cryptContent(src rtfs.Manager, hash, passphrase string, decrypt bool) ([]byte, error) {
+	data, err := src.Cat(hash)
+	if err != nil {
+		return nil, err
+	}
+	manager := crypto.NewEncryptManager(passphrase)
+	if decrypt {
+		return manager.Decrypt(bytes.NewReader(data))
+	}
+	return manager.Encrypt(bytes.NewReader(data))
+}
+
+// transferBlocks copies the blocks with the given cids from src using put,
+// reporting the blocks and bytes transferred every beamProgressInterval, and
+// once done. The transfer stops as soon as a report fails
+func transferBlocks(ctx context.Context, src rtfs.Manager, ids []gocid.Cid, put func(*car.Block) error, report func(blocks, bytes int64) error) error {
+	var (
+		bytes    int64
+		reported = time.Now()
+	)
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		block, err := car.GetBlock(ctx, src, id)
+		if err != nil {
+			return err
+		}
+		if err := put(block); err != nil {
+			return err
+		}
+		bytes += int64(len(block.Data))
+		if time.Since(reported) >= beamProgressInterval {
+			if err := report(int64(i+1), bytes); err != nil {
+				return err
+			}
+			reported = time.Now()
+		}
+	}
+	return report(int64(len(ids)), bytes)
+}
+
+// connectNetwork returns a connection to the api of an ipfs network, along
+// with a shell used to add blocks to it. Users must have access to private
+// networks, whose api is reached through nexus with the jwt of the user
+func (qm *Manager) connectNetwork(network, username, jwt string) (*rtfs.IpfsManager, *ipfsapi.Shell, error) {
+	if network == "public" {
+		apiURL := qm.cfg.IPFS.APIConnection.Host + ":" + qm.cfg.IPFS.APIConnection.Port
+		manager, err := rtfs.NewManager(apiURL, "", time.Minute*60)
+		return manager, ipfsapi.NewShell(apiURL), err
+	}
+	canAccess, err := models.NewUserManager(qm.db).CheckIfUserHasAccessToNetwork(username, network)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !canAccess {
+		return nil, nil, errors.New("user does not have access to private network")
+	}
+	apiURL := fmt.Sprintf("%s/network/%s/api", qm.cfg.Nexus.Host+":"+qm.cfg.Nexus.Delegator.Port, network)
+	manager, err := rtfs.NewManager(apiURL, jwt, time.Minute*60)
+	return manager, ipfsapi.NewDirectShell(apiURL).WithAuthorization(jwt), err
+}
+
+// failBeam marks a job as failed and refunds it at once. ErrStopped is
+// returned if the job was cancelled, in which case it was refunded
+// when cancelled
+func (qm *Manager) failBeam(jobID, reason string) error {
+	tx := qm.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer tx.Rollback()
+	bm := beams.NewManager(tx)
+	if err := bm.Fail(jobID, reason); err != nil {
+		return err
+	}
+	if err := bm.Refund(jobID, reason); err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/RTradeLtd/Temporal/beams"
+	"github.com/RTradeLtd/Temporal/car"
+	"github.com/RTradeLtd/Temporal/mocks"
+	"github.com/RTradeLtd/crypto/v2"
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api"
+	gocid "github.com/ipfs/go-cid"
+)
+
+func Test_transferBlocks(t *testing.T) {
+	blocks := map[string][]byte{testCID: []byte("hello"), testCID2: []byte("world!")}
+	src := &mocks.FakeManager{}
+	src.CustomRequestStub = func(ctx context.Context, url, command string, opts map[string]string, args ...string) (*ipfsapi.Response, error) {
+		if command != "block/get" {
+			t.Fatalf("unexpected command %s", command)
+		}
+		return &ipfsapi.Response{Output: ioutil.NopCloser(bytes.NewReader(blocks[args[0]]))}, nil
+	}
+	var ids []gocid.Cid
+	for _, hash := range []string{testCID, testCID2} {
+		id, err := gocid.Decode(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	errPut := errors.New("put failed")
+	tests := []struct {
+		name       string
+		putErr     error
+		reportErr  error
+		wantErr    error
+		wantPuts   int
+		wantReport [2]int64
+	}{
+		{"Success", nil, nil, nil, 2, [2]int64{2, 11}},
+		{"PutFails", errPut, nil, errPut, 1, [2]int64{}},
+		{"Cancelled", nil, beams.ErrStopped, beams.ErrStopped, 2, [2]int64{2, 11}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				puts     int
+				reported [2]int64
+			)
+			err := transferBlocks(context.Background(), src, ids, func(block *car.Block) error {
+				puts++
+				if !bytes.Equal(block.Data, blocks[block.CID.String()]) {
+					t.Fatalf("unexpected data %s for block %s", block.Data, block.CID)
+				}
+				return tt.putErr
+			}, func(blocks, bytes int64) error {
+				reported = [2]int64{blocks, bytes}
+				return tt.reportErr
+			})
+			if err != tt.wantErr {
+				t.Fatalf("transferBlocks() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if puts != tt.wantPuts || reported != tt.wantReport {
+				t.Fatalf("unexpected %v puts, and report of %v", puts, reported)
+			}
+		})
+	}
+
+	// transfers stop once the consumer is shutting down
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := transferBlocks(ctx, src, ids, func(*car.Block) error {
+		t.Fatal("unexpected put")
+		return nil
+	}, func(int64, int64) error {
+		t.Fatal("unexpected report")
+		return nil
+	}); err != context.Canceled {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func Test_cryptContent(t *testing.T) {
+	original := []byte("beamed content")
+	src := &mocks.FakeManager{}
+	src.CatReturns(original, nil)
+	encrypted, err := cryptContent(src, testCID, "password123", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(encrypted, original) {
+		t.Fatal("expected content to be encrypted")
+	}
+	// the beamed copy decrypts back to the original content
+	decrypted, err := crypto.NewEncryptManager("password123").Decrypt(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, original) {
+		t.Fatalf("expected %s, got %s", original, decrypted)
+	}
+	// as does a copy beamed with decrypt
+	src.CatReturns(encrypted, nil)
+	if decrypted, err = cryptContent(src, testCID, "password123", true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, original) {
+		t.Fatalf("expected %s, got %s", original, decrypted)
+	}
+	if _, err := cryptContent(src, testCID, "wrongpassword", true); err == nil {
+		t.Fatal("expected decrypting with the wrong passphrase to fail")
+	}
+	// content which was not encrypted can not be decrypted
+	src.CatReturns(original, nil)
+	if _, err := cryptContent(src, testCID, "password123", true); err == nil {
+		t.Fatal("expected decrypting unencrypted content to fail")
+	}
+}
@@ -40,8 +40,9 @@ func (qm *Manager) ProcessIPFSKeyCreation(ctx context.Context, wg *sync.WaitGrou
 	for {
 		select {
 		case d := <-msgs:
-			wg.Add(1)
-			go qm.processIPFSKeyCreation(d, wg, kbPrimary, kbBackup, userManager)
+			qm.dispatch(ctx, wg, d, func(d amqp.Delivery) {
+				qm.processIPFSKeyCreation(d, wg, kbPrimary, kbBackup, userManager)
+			})
 		case <-ctx.Done():
 			qm.Close()
 			wg.Done()
@@ -82,8 +83,9 @@ func (qm *Manager) ProccessIPFSPins(ctx context.Context, wg *sync.WaitGroup, msg
 	for {
 		select {
 		case d := <-msgs:
-			wg.Add(1)
-			go qm.processIPFSPin(d, wg, userManager, networkManager, uploadManager, qmCluster, ipfsManager)
+			qm.dispatch(ctx, wg, d, func(d amqp.Delivery) {
+				qm.processIPFSPin(d, wg, userManager, networkManager, uploadManager, qmCluster, ipfsManager)
+			})
 		case <-ctx.Done():
 			qm.Close()
 			wg.Done()
@@ -101,10 +103,11 @@ func (qm *Manager) ProccessIPFSPins(ctx context.Context, wg *sync.WaitGroup, msg
 
 func (qm *Manager) processIPFSPin(d amqp.Delivery, wg *sync.WaitGroup, usrm *models.UserManager, nm *models.HostedNetworkManager, upldm *models.UploadManager, qmCluster *Manager, ipfsManager *rtfs.IpfsManager) {
 	defer wg.Done()
-	qm.l.Info("new pin request detected")
+	l := qm.deliveryLogger(d)
+	l.Info("new pin request detected")
 	pin := &IPFSPin{}
 	if err := json.Unmarshal(d.Body, pin); err != nil {
-		qm.l.Errorw("failed to unmarshal message", "error", err.Error())
+		l.Errorw("failed to unmarshal message", "error", err.Error())
 		d.Ack(false)
 		return
 	}
@@ -113,12 +116,12 @@ func (qm *Manager) processIPFSPin(d amqp.Delivery, wg *sync.WaitGroup, usrm *mod
 	if pin.NetworkName != "public" {
 		canAccess, err := usrm.CheckIfUserHasAccessToNetwork(pin.UserName, pin.NetworkName)
 		if err != nil {
-			qm.l.Errorw("failed to lookup private network in database", "error", err.Error())
+			l.Errorw("failed to lookup private network in database", "error", err.Error())
 			d.Ack(false)
 			return
 		}
 		if !canAccess {
-			qm.l.Errorw(
+			l.Errorw(
 				"unauthorized private network access",
 				"error", errors.New("user does not have access to private network").Error(),
 				"user", pin.UserName)
@@ -129,7 +132,7 @@ func (qm *Manager) processIPFSPin(d amqp.Delivery, wg *sync.WaitGroup, usrm *mod
 		// connect to ipfs
 		ipfsManager, err = rtfs.NewManager(apiURL, pin.JWT, time.Minute*60)
 		if err != nil {
-			qm.l.Infow(
+			l.Infow(
 				"failed to initialize connection to ipfs",
 				"error", err.Error(),
 				"user", pin.UserName,
@@ -138,10 +141,10 @@ func (qm *Manager) processIPFSPin(d amqp.Delivery, wg *sync.WaitGroup, usrm *mod
 			return
 		}
 	}
-	qm.l.Infow(
+	l.Infow(
 		"initializing connection to ipfs",
 		"user", pin.UserName)
-	qm.l.Infow(
+	l.Infow(
 		"pinning hash to ipfs",
 		"cid", pin.CID,
 		"user", pin.UserName,
@@ -149,10 +152,10 @@ func (qm *Manager) processIPFSPin(d amqp.Delivery, wg *sync.WaitGroup, usrm *mod
 	// pin the content
 	if err := ipfsManager.Pin(pin.CID); err != nil {
 		if pin.NetworkName == "public" {
-			qm.refundCredits(pin.UserName, "pin", pin.CreditCost)
+			qm.refundCredits(pin.UserName, "pin", pin.CID, pin.CreditCost)
 		}
 		models.NewUsageManager(qm.db).ReduceDataUsage(pin.UserName, uint64(pin.Size))
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to pin hash to ipfs",
 			"error", err.Error(),
 			"user", pin.UserName,
@@ -162,13 +165,13 @@ func (qm *Manager) processIPFSPin(d amqp.Delivery, wg *sync.WaitGroup, usrm *mod
 	}
 	// cluster support for private networks isn't available yet
 	// as such, skip additional processing for cluster pins
-	qm.l.Infof(
+	l.Infof(
 		"successfully process pin request",
 		"user", pin.UserName,
 		"network", pin.NetworkName)
 	upload, err := upldm.FindUploadByHashAndUserAndNetwork(pin.UserName, pin.CID, pin.NetworkName)
 	if err != nil && err != gorm.ErrRecordNotFound {
-		qm.l.Errorw(
+		l.Errorw(
 			"fail to check database for upload",
 			"error", err.Error(),
 			"user", pin.UserName)
@@ -189,7 +192,7 @@ func (qm *Manager) processIPFSPin(d amqp.Delivery, wg *sync.WaitGroup, usrm *mod
 	}
 	// validate whether or not the database was updated properly
 	if err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to update database",
 			"error", err.Error(),
 			"user", pin.UserName)
@@ -199,10 +202,11 @@ func (qm *Manager) processIPFSPin(d amqp.Delivery, wg *sync.WaitGroup, usrm *mod
 
 func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, kbPrimary *kaas.Client, kbBackup *kaas.Client, um *models.UserManager) {
 	defer wg.Done()
-	qm.l.Info("new key creation request detected")
+	l := qm.deliveryLogger(d)
+	l.Info("new key creation request detected")
 	key := IPFSKeyCreation{}
 	if err := json.Unmarshal(d.Body, &key); err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to unmarshal message",
 			"error", err.Error())
 		d.Ack(false)
@@ -212,7 +216,7 @@ func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, k
 	// whenever a user creates a key, the API call will prepend their username and a hyphen before sending the message for processing
 	// this check ensures that the key was properly prefixed
 	if strings.Split(key.Name, "-")[0] != key.UserName {
-		qm.l.Errorf("invalid key name %s, must be prefixed with: %s-", key.Name, key.UserName)
+		l.Errorf("invalid key name %s, must be prefixed with: %s-", key.Name, key.UserName)
 		d.Ack(false)
 		return
 	}
@@ -235,7 +239,7 @@ func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, k
 		// ed25519 keys use 256 bits, so regardless of what the user provides for bit size, hard set 256
 		bitsInt = 256
 	default:
-		qm.l.Errorw(
+		l.Errorw(
 			"invalid key type for creation request",
 			"error", fmt.Errorf("key must be ed25519 or rsa, not %s", key.Type),
 			"user", key.UserName,
@@ -246,7 +250,7 @@ func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, k
 	// generate the appropriate keypair
 	pk, _, err := ci.GenerateKeyPair(keyTypeInt, bitsInt)
 	if err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to create key",
 			"error", err.Error(),
 			"user", key.UserName,
@@ -257,7 +261,7 @@ func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, k
 	// retrieve a human friendly format, also verifying the key is a valid ipfs key
 	id, err := peer.IDFromPrivateKey(pk)
 	if err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to get peer id from private key",
 			"error", err.Error(),
 			"user", key.UserName,
@@ -268,7 +272,7 @@ func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, k
 	// convert the key to bytes to send to krab for processing
 	pkBytes, err := pk.Bytes()
 	if err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to marshal key to bytes",
 			"error", err.Error(),
 			"user", key.UserName,
@@ -279,7 +283,7 @@ func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, k
 
 	// store the key in local krab
 	if _, err := kbPrimary.PutPrivateKey(context.Background(), &pb.KeyPut{Name: key.Name, PrivateKey: pkBytes}); err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to store key in primary krab",
 			"error", err.Error(),
 			"user", key.UserName,
@@ -291,7 +295,7 @@ func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, k
 		// store the key in remote krab
 		// dont fail on fallback
 		if _, err := kbBackup.PutPrivateKey(context.Background(), &pb.KeyPut{Name: key.Name, PrivateKey: pkBytes}); err != nil {
-			qm.l.Warnw(
+			l.Warnw(
 				"failed to store key in krab",
 				"error", err.Error(),
 				"user", key.UserName,
@@ -300,13 +304,13 @@ func (qm *Manager) processIPFSKeyCreation(d amqp.Delivery, wg *sync.WaitGroup, k
 	}
 	// doesn't need a refund, key was generated and stored in our keystore, but information not saved to db
 	if err := um.AddIPFSKeyForUser(key.UserName, key.Name, id.Pretty()); err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to update database",
 			"error", err.Error(),
 			"user", key.UserName,
 			"key_name", key.Name)
 	} else {
-		qm.l.Infow(
+		l.Infow(
 			"successfully processed key creation request",
 			"user", key.UserName,
 			"key_name", key.Name)
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"sync"
 
+	"github.com/RTradeLtd/Temporal/pins"
 	"github.com/RTradeLtd/Temporal/rtfscluster"
 	"github.com/RTradeLtd/database/v2/models"
 	"github.com/jinzhu/gorm"
@@ -23,8 +24,9 @@ func (qm *Manager) ProcessIPFSClusterPins(ctx context.Context, wg *sync.WaitGrou
 	for {
 		select {
 		case d := <-msgs:
-			wg.Add(1)
-			go qm.processIPFSClusterPin(ctx, d, wg, clusterManager, uploadManager)
+			qm.dispatch(ctx, wg, d, func(d amqp.Delivery) {
+				qm.processIPFSClusterPin(ctx, d, wg, clusterManager, uploadManager)
+			})
 		case <-ctx.Done():
 			qm.Close()
 			wg.Done()
@@ -42,58 +44,64 @@ func (qm *Manager) ProcessIPFSClusterPins(ctx context.Context, wg *sync.WaitGrou
 
 func (qm *Manager) processIPFSClusterPin(ctx context.Context, d amqp.Delivery, wg *sync.WaitGroup, cm *rtfscluster.ClusterManager, um *models.UploadManager) {
 	defer wg.Done()
-	qm.l.Info("new cluster pin request detected")
+	l := qm.deliveryLogger(d)
+	l.Info("new cluster pin request detected")
 	clusterAdd := IPFSClusterPin{}
 	if err := json.Unmarshal(d.Body, &clusterAdd); err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to unmarshal message",
 			"error", err.Error())
 		d.Ack(false)
 		return
 	}
 	if clusterAdd.NetworkName != "public" {
-		qm.l.Errorw(
+		l.Errorw(
 			"private clustered networks not yet supported",
 			"error", errors.New("private network clusters not supported").Error(),
 			"cid", clusterAdd.CID,
 			"user", clusterAdd.UserName)
+		qm.setPinStatus(clusterAdd.PinRequestID, pins.Failed, "private networks are not supported")
 		d.Ack(false)
 		return
 	}
+	qm.setPinStatus(clusterAdd.PinRequestID, pins.Pinning, "")
 	encodedCid, err := cm.DecodeHashString(clusterAdd.CID)
 	if err != nil {
-		qm.refundCredits(clusterAdd.UserName, "pin", clusterAdd.CreditCost)
+		qm.refundCredits(clusterAdd.UserName, "pin", clusterAdd.CID, clusterAdd.CreditCost)
 		models.NewUsageManager(qm.db).ReduceDataUsage(clusterAdd.UserName, uint64(clusterAdd.Size))
-		qm.l.Errorw(
+		l.Errorw(
 			"bad cid format detected",
 			"error", err.Error(),
 			"cid", clusterAdd.CID,
 			"user", clusterAdd.UserName)
+		qm.setPinStatus(clusterAdd.PinRequestID, pins.Failed, "invalid cid")
 		d.Ack(false)
 		return
 	}
-	qm.l.Infow(
+	l.Infow(
 		"pinning hash to cluster",
 		"cid", clusterAdd.CID,
 		"user", clusterAdd.UserName)
 	if err = cm.Pin(ctx, encodedCid); err != nil {
-		_ = qm.refundCredits(clusterAdd.UserName, "pin", clusterAdd.CreditCost)
+		_ = qm.refundCredits(clusterAdd.UserName, "pin", clusterAdd.CID, clusterAdd.CreditCost)
 		_ = models.NewUsageManager(qm.db).ReduceDataUsage(clusterAdd.UserName, uint64(clusterAdd.Size))
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to pin hash to cluster",
 			"error", err.Error(),
 			"cid", clusterAdd.CID,
 			"user", clusterAdd.UserName)
+		qm.setPinStatus(clusterAdd.PinRequestID, pins.Failed, "failed to pin content")
 		d.Ack(false)
 		return
 	}
 	upload, err := um.FindUploadByHashAndUserAndNetwork(clusterAdd.UserName, clusterAdd.CID, clusterAdd.NetworkName)
 	if err != nil && err != gorm.ErrRecordNotFound {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to check database for upload",
 			"error", err.Error(),
 			"cid", clusterAdd.CID,
 			"user", clusterAdd.UserName)
+		qm.setPinStatus(clusterAdd.PinRequestID, pins.Failed, "failed to record upload")
 		d.Ack(false)
 		return
 	}
@@ -108,16 +116,32 @@ func (qm *Manager) processIPFSClusterPin(ctx context.Context, d amqp.Delivery, w
 		_, err = um.UpdateUpload(clusterAdd.HoldTimeInMonths, clusterAdd.UserName, clusterAdd.CID, clusterAdd.NetworkName)
 	}
 	if err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to update database",
 			"error", err.Error(),
 			"cid", clusterAdd.CID,
 			"user", clusterAdd.UserName)
+		qm.setPinStatus(clusterAdd.PinRequestID, pins.Failed, "failed to record upload")
 	} else {
-		qm.l.Infow(
+		l.Infow(
 			"successfully processed cluster pin request",
 			"cid", clusterAdd.CID,
 			"user", clusterAdd.UserName)
+		qm.setPinStatus(clusterAdd.PinRequestID, pins.Pinned, "")
 	}
 	d.Ack(false)
 }
+
+// setPinStatus updates the status of pins requested through the pinning service api
+func (qm *Manager) setPinStatus(requestID string, status pins.Status, reason string) {
+	if requestID == "" {
+		return
+	}
+	if err := pins.NewManager(qm.db).SetStatus(requestID, status, reason); err != nil {
+		qm.l.Errorw(
+			"failed to update pin request status",
+			"error", err.Error(),
+			"request_id", requestID,
+			"status", status)
+	}
+}
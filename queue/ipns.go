@@ -93,8 +93,9 @@ func (qm *Manager) ProcessIPNSEntryCreationRequests(ctx context.Context, wg *syn
 	for {
 		select {
 		case d := <-msgs:
-			wg.Add(1)
-			go qm.processIPNSEntryCreationRequest(ctx, d, wg, kbBackup, ipnsManager, publisher)
+			qm.dispatch(ctx, wg, d, func(d amqp.Delivery) {
+				qm.processIPNSEntryCreationRequest(ctx, d, wg, kbBackup, ipnsManager, publisher)
+			})
 		case <-ctx.Done():
 			qm.Close()
 			wg.Done()
@@ -113,10 +114,11 @@ func (qm *Manager) ProcessIPNSEntryCreationRequests(ctx context.Context, wg *syn
 
 func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.Delivery, wg *sync.WaitGroup, kbBackup *kaas.Client, im *models.IpnsManager, pub rtns.Service) {
 	defer wg.Done()
-	qm.l.Info("new ipns entry creation detected")
+	l := qm.deliveryLogger(d)
+	l.Info("new ipns entry creation detected")
 	ie := IPNSEntry{}
 	if err := json.Unmarshal(d.Body, &ie); err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to unmarshal message",
 			"error", err.Error())
 		d.Ack(false)
@@ -124,13 +126,13 @@ func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.D
 	}
 	// temporarily do not process ipns creation requests for non public networks
 	if ie.NetworkName != "public" {
-		qm.l.Errorw(
+		l.Errorw(
 			"private networks not supported for ipns",
 			"user", ie.UserName)
 		d.Ack(false)
 		return
 	}
-	qm.l.Infow(
+	l.Infow(
 		"publishing ipns entry",
 		"user", ie.UserName,
 		"key", ie.Key,
@@ -143,7 +145,7 @@ func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.D
 	if err != nil {
 		// do not cache entries if the key is not available in the primary keystore
 		cache = false
-		qm.l.Warnw(
+		l.Warnw(
 			"failed to retrieve private key from priamry krab, attempting backup",
 			"error", err.Error(),
 			"user", ie.UserName,
@@ -154,8 +156,8 @@ func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.D
 			var errCheck error
 			resp, errCheck := kbBackup.GetPrivateKey(context.Background(), &pb.KeyGet{Name: ie.Key})
 			if errCheck != nil {
-				qm.refundCredits(ie.UserName, "ipns", ie.CreditCost)
-				qm.l.Errorw(
+				qm.refundCredits(ie.UserName, "ipns", ie.CID, ie.CreditCost)
+				l.Errorw(
 					"failed to retrieve private key from backup krab",
 					"error", err.Error(),
 					"user", ie.UserName,
@@ -166,8 +168,8 @@ func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.D
 			}
 			pk, err = ci.UnmarshalPrivateKey(resp.GetPrivateKey())
 			if err != nil {
-				qm.refundCredits(ie.UserName, "ipns", ie.CreditCost)
-				qm.l.Errorw(
+				qm.refundCredits(ie.UserName, "ipns", ie.CID, ie.CreditCost)
+				l.Errorw(
 					"failed to unmarshal private key",
 					"error", err.Error(),
 					"user", ie.UserName,
@@ -177,7 +179,7 @@ func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.D
 				return
 			}
 		} else {
-			qm.l.Errorw(
+			l.Errorw(
 				"primary krab key retrieval failure, with dev mode disabled, aborting",
 				"user", ie.UserName,
 				"key", ie.Key,
@@ -195,8 +197,8 @@ func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.D
 	cctx := context.WithValue(ctx, ipnsPublishTTL, ie.TTL)
 	eol := time.Now().Add(ie.LifeTime)
 	if err := pub.PublishWithEOL(cctx, pk, eol, cache, ie.Key, ie.CID); err != nil {
-		qm.refundCredits(ie.UserName, "ipns", ie.CreditCost)
-		qm.l.Errorw(
+		qm.refundCredits(ie.UserName, "ipns", ie.CID, ie.CreditCost)
+		l.Errorw(
 			"failed to publish ipns entry",
 			"error", err.Error(),
 			"user", ie.UserName,
@@ -209,7 +211,7 @@ func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.D
 	id, err := peer.IDFromPrivateKey(pk)
 	if err != nil {
 		// do not refund here since the record is published
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to unmarshal peer identity private key",
 			"error", err.Error(),
 			"user", ie.UserName,
@@ -225,14 +227,14 @@ func (qm *Manager) processIPNSEntryCreationRequest(ctx context.Context, d amqp.D
 		_, err = im.UpdateIPNSEntry(id.Pretty(), ie.CID, ie.NetworkName, ie.UserName, ie.LifeTime, ie.TTL)
 	}
 	if err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to update ipns entry in database",
 			"error", err.Error(),
 			"user", ie.UserName,
 			"key", ie.Key,
 			"cid", ie.CID)
 	} else {
-		qm.l.Infow(
+		l.Infow(
 			"successfully processed ipns entry creation request",
 			"user", ie.UserName,
 			"key", ie.Key,
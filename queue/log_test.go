@@ -1,10 +1,16 @@
 package queue
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/RTradeLtd/Temporal/log"
 	"github.com/RTradeLtd/config/v2"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
 	"go.uber.org/zap/zaptest/observer"
 )
 
@@ -44,3 +50,56 @@ func TestLog_Consumer(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLog_RequestID(t *testing.T) {
+	dev = true
+	cfg, err := config.LoadConfig(testCfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPublisher(EthPaymentConfirmationQueue, testRabbitAddress, cfg, zaptest.NewLogger(t).Sugar(), PublisherOptions{DevMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	observer, out := observer.New(zap.InfoLevel)
+	qm, err := New(EthPaymentConfirmationQueue, testRabbitAddress, false, dev, cfg, zap.New(observer).Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qm.Close()
+	// the request id of the context is sent along with the message
+	id := uuid.New().String()
+	ctx := log.WithRequestID(context.Background(), id)
+	if err := p.PublishMessageContext(ctx, EthPaymentConfirmation{UserName: id}); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := qm.channel.Consume(qm.QueueName.String(), "", false, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(time.Second * 10)
+	for {
+		select {
+		case d := <-msgs:
+			var confirmation EthPaymentConfirmation
+			if err := json.Unmarshal(d.Body, &confirmation); err != nil || confirmation.UserName != id {
+				// leave messages published by other tests alone
+				d.Nack(false, true)
+				continue
+			}
+			d.Ack(false)
+			if requestID(d) != id {
+				t.Fatalf("expected request id %s, got %s", id, requestID(d))
+			}
+			// and attached to the consumer logs
+			qm.deliveryLogger(d).Info("processing")
+			if got := out.All()[out.Len()-1].ContextMap()["request-id"]; got != id {
+				t.Fatalf("expected request id %s in logs, got %v", id, got)
+			}
+			return
+		case <-timeout:
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
@@ -21,8 +21,9 @@ func (qm *Manager) ProcessMailSends(ctx context.Context, wg *sync.WaitGroup, db
 	for {
 		select {
 		case d := <-msgs:
-			wg.Add(1)
-			go qm.processMailSend(d, wg, mm)
+			qm.dispatch(ctx, wg, d, func(d amqp.Delivery) {
+				qm.processMailSend(d, wg, mm)
+			})
 		case <-ctx.Done():
 			qm.Close()
 			wg.Done()
@@ -40,10 +41,11 @@ func (qm *Manager) ProcessMailSends(ctx context.Context, wg *sync.WaitGroup, db
 
 func (qm *Manager) processMailSend(d amqp.Delivery, wg *sync.WaitGroup, mm *mail.Manager) {
 	defer wg.Done()
-	qm.l.Info("new email send request detected")
+	l := qm.deliveryLogger(d)
+	l.Info("new email send request detected")
 	es := EmailSend{}
 	if err := json.Unmarshal(d.Body, &es); err != nil {
-		qm.l.Errorw(
+		l.Errorw(
 			"failed to unmarshal message",
 			"error", err.Error())
 		d.Ack(false)
@@ -52,13 +54,13 @@ func (qm *Manager) processMailSend(d amqp.Delivery, wg *sync.WaitGroup, mm *mail
 	for k, v := range es.Emails {
 		_, err := mm.SendEmail(es.Subject, es.Content, es.ContentType, es.UserNames[k], v)
 		if err != nil {
-			qm.l.Errorw(
+			l.Errorw(
 				"failed to send email",
 				"error", err.Error(),
 				"email", v,
 				"user", es.UserNames[k])
 		}
-		qm.l.Infow(
+		l.Infow(
 			"email sent",
 			"email", v,
 			"user", es.UserNames[k])
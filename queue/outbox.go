@@ -0,0 +1,381 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/log"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultRelayInterval is how often the relay polls the outbox when
+	// it has not been notified of new messages
+	DefaultRelayInterval = time.Second * 5
+	// DefaultRelayBatchSize is the maximum number of messages the relay
+	// publishes in a single pass
+	DefaultRelayBatchSize = 100
+	// DefaultRelayClaimTimeout is how long messages are claimed by a relay
+	// for, before other relays may publish them
+	DefaultRelayClaimTimeout = time.Minute * 5
+	// DefaultRelayMaxAttempts is the number of failed attempts at publishing
+	// a message after which it is given up on
+	DefaultRelayMaxAttempts = 10
+	// DefaultRelayRetention is how long published messages are kept
+	// in the outbox before they are purged
+	DefaultRelayRetention = time.Hour * 24 * 7
+	// relayPurgeInterval is how often published messages are purged
+	relayPurgeInterval = time.Hour
+)
+
+// errInvalidBody is returned for messages which can never be published
+var errInvalidBody = errors.New("outbox message body is not valid json")
+
+// OutboxMessage is a message written to the database alongside the changes
+// that produced it. Messages are published to rabbitmq by a Relay, which
+// guarantees that a message is published if, and only if, the transaction
+// which created it was committed. The body of a message is cleared once it is
+// published, and messages which repeatedly fail to publish are marked as failed
+// and left in the outbox for inspection, without being retried.
+type OutboxMessage struct {
+	gorm.Model
+	// MessageID uniquely identifies the message, and is sent to rabbitmq
+	// so that consumers are able to recognize redelivered messages
+	MessageID string `gorm:"type:varchar(36);unique_index"`
+	// RequestID is the id of the api request the message was written for, if any
+	RequestID string `gorm:"type:varchar(64)"`
+	Queue     string `gorm:"type:varchar(255);index"`
+	Body      string `gorm:"type:text"`
+	// Attempts is the number of failed attempts at publishing the message
+	Attempts  int
+	LastError string     `gorm:"type:text"`
+	Published bool       `gorm:"index"`
+	SentAt    *time.Time `gorm:"type:timestamp"`
+	// Failed is whether publishing the message was given up on
+	Failed bool `gorm:"index"`
+	// ClaimedUntil is when the claim of the relay publishing the
+	// message expires, after which it may be published again
+	ClaimedUntil *time.Time `gorm:"type:timestamp"`
+}
+
+// TableName returns the table used to store outbox messages
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
+// Enqueue writes a message for the given queue to the outbox. It should be
+// called with the transaction that makes the changes the message relates to,
+// so that the message is only ever published if that transaction commits.
+func Enqueue(tx *gorm.DB, queue Queue, body interface{}) (*OutboxMessage, error) {
+	return EnqueueContext(context.Background(), tx, queue, body)
+}
+
+// EnqueueContext is like Enqueue, but tags the message with
+// the request id carried by ctx, if any
+func EnqueueContext(ctx context.Context, tx *gorm.DB, queue Queue, body interface{}) (*OutboxMessage, error) {
+	bodyMarshaled, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	msg := &OutboxMessage{
+		MessageID: uuid.New().String(),
+		RequestID: log.RequestID(ctx),
+		Queue:     queue.String(),
+		Body:      string(bodyMarshaled),
+	}
+	if err := tx.Create(msg).Error; err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// RelayOptions is used to configure a Relay
+type RelayOptions struct {
+	// Interval is how often the outbox is polled for unpublished messages
+	Interval time.Duration
+	// BatchSize is the maximum number of messages published per pass
+	BatchSize int
+	// ClaimTimeout is how long messages are claimed for while being
+	// published, which is renewed while rabbitmq is yet to confirm them
+	ClaimTimeout time.Duration
+	// MaxAttempts is the number of failed attempts at publishing a message
+	// after which it is marked as failed. Attempts made while rabbitmq is
+	// unavailable are not counted
+	MaxAttempts int
+	// Retention is how long published messages are kept before being purged
+	Retention time.Duration
+}
+
+// Relay publishes messages written to the outbox. Messages are claimed before
+// they are published, so that several relays may run against the same
+// database without publishing a message twice, and claims are held until
+// rabbitmq confirms a message, however long it is unavailable for. Only
+// messages claimed by a relay which stopped are published again, so each
+// message keeps its id across attempts, allowing consumers to recognize them.
+type Relay struct {
+	db         *gorm.DB
+	l          *zap.SugaredLogger
+	publishers map[Queue]*Publisher
+	opts       RelayOptions
+	notify     chan struct{}
+}
+
+// NewRelay is used to instantiate an outbox relay, publishing messages
+// through the given publishers
+func NewRelay(db *gorm.DB, logger *zap.SugaredLogger, publishers map[Queue]*Publisher, opts RelayOptions) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultRelayInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultRelayBatchSize
+	}
+	if opts.ClaimTimeout <= 0 {
+		opts.ClaimTimeout = DefaultRelayClaimTimeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultRelayMaxAttempts
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRelayRetention
+	}
+	return &Relay{
+		db:         db,
+		l:          logger.Named("relay"),
+		publishers: publishers,
+		opts:       opts,
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes up the relay so that newly committed messages are
+// published without waiting for the next poll
+func (r *Relay) Notify() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes messages from the outbox until the context is cancelled,
+// periodically purging messages published longer ago than the retention
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	purge := time.NewTicker(relayPurgeInterval)
+	defer purge.Stop()
+	for {
+		// keep going while full batches are being published
+		for {
+			published, err := r.Flush()
+			if err != nil {
+				r.l.Errorw("failed to relay outbox messages", "error", err.Error())
+				break
+			}
+			if published < r.opts.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-r.notify:
+		case <-purge.C:
+			if _, err := r.Purge(); err != nil {
+				r.l.Errorw("failed to purge outbox messages", "error", err.Error())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Purge deletes messages published longer ago than the
+// retention, returning the number of messages deleted
+func (r *Relay) Purge() (int64, error) {
+	res := r.db.Unscoped().
+		Where("published = ? AND sent_at < ?", true, time.Now().Add(-r.opts.Retention)).
+		Delete(&OutboxMessage{})
+	return res.RowsAffected, res.Error
+}
+
+// Flush publishes a single batch of unpublished messages, returning the number
+// of messages published. Messages which fail to publish are left in the outbox
+// to be retried on the next pass until they reach the maximum attempts, while
+// messages rabbitmq is yet to confirm stay claimed until it does.
+func (r *Relay) Flush() (int, error) {
+	msgs, err := r.claim()
+	if err != nil {
+		return 0, err
+	}
+	var published int
+	for i, msg := range msgs {
+		result, err := r.send(msg)
+		if err != nil {
+			r.record(msg, err)
+			if unavailable(err) {
+				// rabbitmq is unavailable, so there is no point in continuing
+				r.release(msgs[i+1:])
+				break
+			}
+			continue
+		}
+		timer := time.NewTimer(r.confirmTimeout(msg))
+		select {
+		case err = <-result:
+			timer.Stop()
+		case <-timer.C:
+			err = ErrPublishPending
+		}
+		if err == ErrPublishPending {
+			// the publisher delivers the message once rabbitmq is reachable,
+			// so it must not be published again in the meantime
+			go r.await(msg, result)
+			r.release(msgs[i+1:])
+			break
+		}
+		if r.record(msg, err) && err == nil {
+			published++
+		}
+	}
+	return published, nil
+}
+
+// claim selects a batch of unpublished messages which have not failed and are
+// not claimed by another relay, claiming them until the claim timeout. The claim is
+// committed before publishing, so messages are not locked while waiting
+// for rabbitmq
+func (r *Relay) claim() ([]OutboxMessage, error) {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	var msgs []OutboxMessage
+	if err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+		Where("published = ? AND failed = ? AND (claimed_until IS NULL OR claimed_until < ?)", false, false, now).
+		Order("id asc").
+		Limit(r.opts.BatchSize).
+		Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+	}
+	until := now.Add(r.opts.ClaimTimeout)
+	if err := tx.Model(&OutboxMessage{}).
+		Where("id IN (?)", ids).
+		Update("claimed_until", &until).Error; err != nil {
+		return nil, err
+	}
+	return msgs, tx.Commit().Error
+}
+
+// await records the result of a message rabbitmq has not yet confirmed,
+// renewing its claim until it does. The publisher always reports a result,
+// failing the message if it is closed before it could be delivered
+func (r *Relay) await(msg OutboxMessage, result <-chan error) {
+	renew := time.NewTicker(r.opts.ClaimTimeout / 2)
+	defer renew.Stop()
+	for {
+		select {
+		case err := <-result:
+			r.record(msg, err)
+			return
+		case <-renew.C:
+			until := time.Now().Add(r.opts.ClaimTimeout)
+			if err := r.db.Model(&msg).Update("claimed_until", &until).Error; err != nil {
+				r.l.Errorw("failed to renew outbox message claim", "message_id", msg.MessageID, "error", err.Error())
+			}
+		}
+	}
+}
+
+// record marks a message as published, clearing its body, or records the
+// failure to publish it and releases its claim so it is retried, marking it
+// as failed once it can not be published, returning whether it was recorded
+func (r *Relay) record(msg OutboxMessage, pubErr error) bool {
+	updates := map[string]interface{}{"claimed_until": gorm.Expr("NULL")}
+	switch {
+	case pubErr == nil:
+		now := time.Now()
+		updates["published"] = true
+		updates["sent_at"] = &now
+		updates["body"] = ""
+	case unavailable(pubErr):
+		// the message never reached rabbitmq, so the attempt is not counted
+		updates["last_error"] = pubErr.Error()
+	default:
+		attempts := msg.Attempts + 1
+		updates["attempts"] = attempts
+		updates["last_error"] = pubErr.Error()
+		if pubErr == errInvalidBody || attempts >= r.opts.MaxAttempts {
+			updates["failed"] = true
+			r.l.Errorw("giving up on publishing outbox message",
+				"message_id", msg.MessageID,
+				"queue", msg.Queue,
+				"attempts", attempts,
+				"error", pubErr.Error())
+			break
+		}
+		r.l.Warnw("failed to publish outbox message",
+			"message_id", msg.MessageID,
+			"queue", msg.Queue,
+			"attempts", attempts,
+			"error", pubErr.Error())
+	}
+	if err := r.db.Model(&msg).Updates(updates).Error; err != nil {
+		// published messages are published again once their claim expires
+		r.l.Errorw("failed to record outbox message", "message_id", msg.MessageID, "error", err.Error())
+		return false
+	}
+	return true
+}
+
+// release gives up the claim on messages which were not published
+func (r *Relay) release(msgs []OutboxMessage) {
+	if len(msgs) == 0 {
+		return
+	}
+	ids := make([]uint, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+	}
+	if err := r.db.Model(&OutboxMessage{}).
+		Where("id IN (?)", ids).
+		Update("claimed_until", gorm.Expr("NULL")).Error; err != nil {
+		r.l.Errorw("failed to release outbox messages", "error", err.Error())
+	}
+}
+
+// send hands a message to the publisher of its queue, returning
+// the channel rabbitmq's confirmation is reported on
+func (r *Relay) send(msg OutboxMessage) (<-chan error, error) {
+	publisher, ok := r.publishers[Queue(msg.Queue)]
+	if !ok {
+		return nil, fmt.Errorf("no publisher configured for queue %s", msg.Queue)
+	}
+	if !json.Valid([]byte(msg.Body)) {
+		return nil, errInvalidBody
+	}
+	return publisher.send(msg.MessageID, msg.RequestID, []byte(msg.Body))
+}
+
+// unavailable returns whether a message failed to publish because
+// rabbitmq is unavailable, rather than because of the message
+func unavailable(err error) bool {
+	return err == ErrOutboxFull || err == ErrPublisherClosed
+}
+
+// confirmTimeout returns how long to wait for a message to be confirmed
+func (r *Relay) confirmTimeout(msg OutboxMessage) time.Duration {
+	return r.publishers[Queue(msg.Queue)].opts.ConfirmTimeout
+}
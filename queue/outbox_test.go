@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/log"
+	"github.com/RTradeLtd/config/v2"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestOutbox(t *testing.T) {
+	cfg, err := config.LoadConfig(testCfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&OutboxMessage{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	logger := zaptest.NewLogger(t).Sugar()
+	body := EthPaymentConfirmation{UserName: "testuser", PaymentNumber: 22}
+
+	// messages from rolled back transactions must never be published
+	tx := db.Begin()
+	rolledBack, err := Enqueue(tx, EthPaymentConfirmationQueue, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback().Error; err != nil {
+		t.Fatal(err)
+	}
+	if !db.Where("message_id = ?", rolledBack.MessageID).First(&OutboxMessage{}).RecordNotFound() {
+		t.Fatal("message from rolled back transaction should not exist")
+	}
+
+	// messages from committed transactions are published by the relay
+	tx = db.Begin()
+	committed, err := EnqueueContext(log.WithRequestID(context.Background(), "outbox-test"), tx, EthPaymentConfirmationQueue, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed.RequestID != "outbox-test" {
+		t.Fatalf("expected request id to be recorded, got %s", committed.RequestID)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPublisher(EthPaymentConfirmationQueue, testRabbitAddress, cfg, logger, PublisherOptions{DevMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	relay := NewRelay(db, logger, map[Queue]*Publisher{EthPaymentConfirmationQueue: p}, RelayOptions{})
+	for {
+		published, err := relay.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if published < DefaultRelayBatchSize {
+			break
+		}
+	}
+	var msg OutboxMessage
+	if err := db.Where("message_id = ?", committed.MessageID).First(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Published || msg.SentAt == nil {
+		t.Fatal("message should have been published")
+	}
+	if msg.Body != "" {
+		t.Fatal("body of published message should have been cleared")
+	}
+
+	// published messages are not published again
+	published, err := relay.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 0 {
+		t.Fatalf("expected no messages to be published, got %v", published)
+	}
+
+	// messages for queues without a publisher are kept for later
+	tx = db.Begin()
+	unrouted, err := Enqueue(tx, IpfsPinQueue, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	msg = OutboxMessage{}
+	if err := db.Where("message_id = ?", unrouted.MessageID).First(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	if msg.Published || msg.Failed || msg.Attempts != 1 || msg.LastError == "" {
+		t.Fatalf("unexpected message state %+v", msg)
+	}
+
+	// messages are given up on once they reach the maximum attempts
+	if err := db.Model(&msg).Update("attempts", DefaultRelayMaxAttempts-1).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := relay.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg = OutboxMessage{}
+	if err := db.Where("message_id = ?", unrouted.MessageID).First(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	if msg.Published || !msg.Failed || msg.Attempts != DefaultRelayMaxAttempts {
+		t.Fatalf("message should have failed without being retried, got %+v", msg)
+	}
+	db.Unscoped().Delete(&msg)
+
+	// published messages are purged once past the retention
+	sentAt := time.Now().Add(-DefaultRelayRetention - time.Minute)
+	if err := db.Model(&OutboxMessage{}).Where("message_id = ?", committed.MessageID).Update("sent_at", &sentAt).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Unscoped().Where("message_id = ?", committed.MessageID).First(&OutboxMessage{}).RecordNotFound() {
+		t.Fatal("published message should have been purged")
+	}
+
+	// messages claimed by another relay are left for it to publish
+	tx = db.Begin()
+	claimed, err := Enqueue(tx, EthPaymentConfirmationQueue, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Minute)
+	if err := db.Model(claimed).Update("claimed_until", &until).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	msg = OutboxMessage{}
+	if err := db.Where("message_id = ?", claimed.MessageID).First(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	if msg.Published || msg.Attempts != 0 {
+		t.Fatalf("claimed message should not be published, got %+v", msg)
+	}
+	db.Unscoped().Delete(&msg)
+}
@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// defaultPrefetch is the prefetch count used when a channel is first opened
+	defaultPrefetch = 10
+	// poolReportInterval is how often consumers log worker pool utilization
+	poolReportInterval = time.Minute
+)
+
+// PoolOptions is used to configure the worker pool of a queue consumer
+type PoolOptions struct {
+	// Prefetch is the maximum number of unacknowledged
+	// messages rabbitmq will deliver to the consumer
+	Prefetch int
+	// Workers is the maximum number of messages processed concurrently
+	Workers int
+}
+
+// PoolStats is a snapshot of worker pool utilization
+type PoolStats struct {
+	// Workers is the size of the pool
+	Workers int `json:"workers"`
+	// Active is the number of workers currently processing a message
+	Active int `json:"active"`
+	// Processed is the number of messages processed since the pool was created
+	Processed uint64 `json:"processed"`
+	// Utilization is the ratio of active workers to pool size
+	Utilization float64 `json:"utilization"`
+}
+
+// workerPool bounds the number of messages a consumer processes at once.
+// Acquiring a worker blocks while the pool is exhausted, which stops the
+// consumer from taking further deliveries and lets rabbitmq hold on to
+// messages until we are able to process them.
+type workerPool struct {
+	slots     chan struct{}
+	processed uint64
+}
+
+func newWorkerPool(workers int) *workerPool {
+	if workers <= 0 {
+		workers = defaultPrefetch
+	}
+	return &workerPool{slots: make(chan struct{}, workers)}
+}
+
+// acquire blocks until a worker is available, or the context is cancelled
+func (wp *workerPool) acquire(ctx context.Context) error {
+	select {
+	case wp.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release returns a worker to the pool
+func (wp *workerPool) release() {
+	<-wp.slots
+	atomic.AddUint64(&wp.processed, 1)
+}
+
+func (wp *workerPool) stats() PoolStats {
+	var (
+		workers = cap(wp.slots)
+		active  = len(wp.slots)
+	)
+	return PoolStats{
+		Workers:     workers,
+		Active:      active,
+		Processed:   atomic.LoadUint64(&wp.processed),
+		Utilization: float64(active) / float64(workers),
+	}
+}
+
+// SetPoolOptions is used to configure the prefetch count and worker pool
+// size of a consumer. It must be called before ConsumeMessages
+func (qm *Manager) SetPoolOptions(opts PoolOptions) error {
+	if opts.Prefetch <= 0 {
+		opts.Prefetch = defaultPrefetch
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = opts.Prefetch
+	}
+	if err := qm.channel.Qos(opts.Prefetch, 0, false); err != nil {
+		return err
+	}
+	qm.pool = newWorkerPool(opts.Workers)
+	qm.l.Infow("worker pool configured",
+		"prefetch", opts.Prefetch,
+		"workers", opts.Workers)
+	return nil
+}
+
+// PoolStats returns the current utilization of the consumers worker pool
+func (qm *Manager) PoolStats() PoolStats {
+	if qm.pool == nil {
+		return PoolStats{}
+	}
+	return qm.pool.stats()
+}
+
+// dispatch hands a delivery off to the worker pool, blocking until a worker
+// is available. If the context is cancelled while waiting, the delivery is
+// returned to the queue so that it may be processed by another consumer.
+func (qm *Manager) dispatch(ctx context.Context, wg *sync.WaitGroup, d amqp.Delivery, process func(amqp.Delivery)) {
+	if err := qm.pool.acquire(ctx); err != nil {
+		d.Nack(false, true)
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer qm.pool.release()
+		process(d)
+	}()
+}
+
+// reportPoolUtilization periodically logs worker pool utilization until
+// the given context is cancelled
+func (qm *Manager) reportPoolUtilization(ctx context.Context) {
+	ticker := time.NewTicker(poolReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stats := qm.pool.stats()
+			qm.l.Infow("worker pool utilization",
+				"workers", stats.Workers,
+				"active", stats.Active,
+				"processed", stats.Processed,
+				"utilization", stats.Utilization)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
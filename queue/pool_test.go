@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	wp := newWorkerPool(2)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := wp.acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := wp.stats(); stats.Active != 2 || stats.Utilization != 1 {
+		t.Fatalf("bad stats %+v", stats)
+	}
+	// the pool is exhausted, so acquiring should block until cancelled
+	cctx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	if err := wp.acquire(cctx); err == nil {
+		t.Fatal("expected error acquiring from exhausted pool")
+	}
+	wp.release()
+	if err := wp.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wp.release()
+	wp.release()
+	if stats := wp.stats(); stats.Active != 0 || stats.Processed != 3 || stats.Workers != 2 {
+		t.Fatalf("bad stats %+v", stats)
+	}
+}
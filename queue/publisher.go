@@ -0,0 +1,367 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/log"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultOutboxSize is the default number of messages a publisher
+	// buffers while waiting for rabbitmq to become available
+	DefaultOutboxSize = 1000
+	// DefaultConfirmTimeout is the default amount of time a publish waits
+	// for rabbitmq to confirm a message
+	DefaultConfirmTimeout = time.Second * 10
+)
+
+var (
+	// ErrOutboxFull is returned when a message can not be buffered
+	// because the publisher outbox is at capacity
+	ErrOutboxFull = errors.New("publisher outbox is full")
+	// ErrPublishPending is returned when a message has been buffered, but was
+	// not confirmed by rabbitmq in time. The message remains in the outbox and
+	// will be delivered once rabbitmq is reachable, so it must not be retried
+	ErrPublishPending = errors.New("message queued for delivery but not yet confirmed")
+	// ErrPublishRejected is returned when rabbitmq refuses to accept a message
+	ErrPublishRejected = errors.New("message rejected by rabbitmq")
+	// ErrPublisherClosed is returned when publishing with a closed publisher
+	ErrPublisherClosed = errors.New("publisher is closed")
+
+	errConnectionLost = errors.New("connection to rabbitmq lost")
+)
+
+// PublisherOptions is used to configure a Publisher
+type PublisherOptions struct {
+	// OutboxSize is the maximum number of messages buffered
+	// while rabbitmq is unavailable
+	OutboxSize int
+	// ConfirmTimeout is how long PublishMessage waits for
+	// rabbitmq to confirm a message before returning ErrPublishPending
+	ConfirmTimeout time.Duration
+	// DevMode toggles dev mode
+	DevMode bool
+}
+
+// Publisher is used to publish messages to a queue. Unlike a plain Manager it
+// transparently reconnects to rabbitmq with backoff when the connection drops,
+// buffering messages in a bounded outbox until they can be delivered. Messages
+// are published with publisher confirms, so a successful publish means that
+// rabbitmq has taken responsibility for the message.
+type Publisher struct {
+	queue     Queue
+	url       string
+	cfg       *config.TemporalConfig
+	l         *zap.SugaredLogger
+	opts      PublisherOptions
+	outbox    chan *outboxMessage
+	connected int32
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	// mux guards closing, so that no message is buffered once the
+	// outbox is being flushed
+	mux       sync.RWMutex
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// outboxMessage is a message waiting to be confirmed by rabbitmq
+type outboxMessage struct {
+	id        string
+	requestID string
+	body      []byte
+	result    chan error
+}
+
+// NewPublisher is used to instantiate a publisher for the given queue.
+// The initial connection must succeed so that misconfiguration is caught
+// on startup, after which connection failures are handled automatically
+func NewPublisher(queue Queue, url string, cfg *config.TemporalConfig, logger *zap.SugaredLogger, opts PublisherOptions) (*Publisher, error) {
+	if opts.OutboxSize <= 0 {
+		opts.OutboxSize = DefaultOutboxSize
+	}
+	if opts.ConfirmTimeout <= 0 {
+		opts.ConfirmTimeout = DefaultConfirmTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Publisher{
+		queue:   queue,
+		url:     url,
+		cfg:     cfg,
+		l:       logger,
+		opts:    opts,
+		outbox:  make(chan *outboxMessage, opts.OutboxSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	qm, confirms, err := p.connect()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go p.run(qm, confirms)
+	return p, nil
+}
+
+// PublishMessage is used to publish a message, waiting until it has been
+// confirmed by rabbitmq. If rabbitmq is unavailable the message is held in the
+// outbox, and ErrPublishPending is returned if it is not confirmed in time.
+func (p *Publisher) PublishMessage(body interface{}) error {
+	return p.PublishMessageWithID("", body)
+}
+
+// PublishMessageContext is like PublishMessage, but tags the message
+// with the request id carried by ctx, if any
+func (p *Publisher) PublishMessageContext(ctx context.Context, body interface{}) error {
+	bodyMarshaled, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return p.publish("", log.RequestID(ctx), bodyMarshaled)
+}
+
+// PublishMessageWithID is like PublishMessage, but tags the message with
+// the given id so that redelivered messages can be recognized
+func (p *Publisher) PublishMessageWithID(id string, body interface{}) error {
+	bodyMarshaled, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return p.publish(id, "", bodyMarshaled)
+}
+
+// publish buffers an already marshaled message in the outbox,
+// and waits for it to be confirmed by rabbitmq
+func (p *Publisher) publish(id, requestID string, body []byte) error {
+	result, err := p.send(id, requestID, body)
+	if err != nil {
+		return err
+	}
+	timer := time.NewTimer(p.opts.ConfirmTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return ErrPublishPending
+	}
+}
+
+// send buffers an already marshaled message in the outbox, returning the
+// channel its result is sent on once rabbitmq confirms it, or the
+// publisher is closed before it could be delivered
+func (p *Publisher) send(id, requestID string, body []byte) (<-chan error, error) {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	if p.ctx.Err() != nil {
+		return nil, ErrPublisherClosed
+	}
+	select {
+	case <-p.closing:
+		return nil, ErrPublisherClosed
+	default:
+	}
+	msg := &outboxMessage{id: id, requestID: requestID, body: body, result: make(chan error, 1)}
+	select {
+	case p.outbox <- msg:
+	default:
+		p.l.Errorw("publisher outbox is full, dropping message", "queue", p.queue.String())
+		return nil, ErrOutboxFull
+	}
+	return msg.result, nil
+}
+
+// Connected returns whether or not the publisher is connected to rabbitmq
+func (p *Publisher) Connected() bool {
+	return atomic.LoadInt32(&p.connected) == 1
+}
+
+// Pending returns the number of messages waiting in the outbox
+func (p *Publisher) Pending() int {
+	return len(p.outbox)
+}
+
+// Close stops the publisher, after delivering the messages still in the
+// outbox. Messages which are not confirmed within the confirm timeout are
+// failed with ErrPublisherClosed, leaving those published by an outbox relay
+// in the database to be published again
+func (p *Publisher) Close() error {
+	p.closeOnce.Do(func() {
+		p.mux.Lock()
+		close(p.closing)
+		p.mux.Unlock()
+	})
+	timer := time.NewTimer(p.opts.ConfirmTimeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+	case <-timer.C:
+		p.l.Warnw("publisher closed before its outbox was flushed",
+			"queue", p.queue.String(),
+			"pending", p.Pending())
+	}
+	p.cancel()
+	<-p.done
+	return nil
+}
+
+// connect opens a connection to rabbitmq with publisher confirms enabled
+func (p *Publisher) connect() (*Manager, chan amqp.Confirmation, error) {
+	qm, err := New(p.queue, p.url, true, p.opts.DevMode, p.cfg, p.l)
+	if err != nil {
+		return nil, nil, err
+	}
+	confirms, err := qm.enableConfirms()
+	if err != nil {
+		qm.Close()
+		return nil, nil, err
+	}
+	atomic.StoreInt32(&p.connected, 1)
+	return qm, confirms, nil
+}
+
+// reconnect blocks until a connection to rabbitmq is re-established, or the
+// publisher is closed in which case a nil manager is returned
+func (p *Publisher) reconnect() (*Manager, chan amqp.Confirmation) {
+	atomic.StoreInt32(&p.connected, 0)
+	delay := minRestartDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-p.ctx.Done():
+			return nil, nil
+		}
+		qm, confirms, err := p.connect()
+		if err == nil {
+			p.l.Warnw("successfully re-established queue connection",
+				"queue", p.queue.String(),
+				"pending", p.Pending())
+			return qm, confirms
+		}
+		p.l.Errorw("failed to re-establish queue connection",
+			"queue", p.queue.String(),
+			"error", err.Error(),
+			"retry_in", delay.String())
+		if delay *= 2; delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// run delivers messages from the outbox one at a time, reconnecting
+// whenever the connection to rabbitmq is lost
+func (p *Publisher) run(qm *Manager, confirms chan amqp.Confirmation) {
+	defer close(p.done)
+	var pending *outboxMessage
+	for {
+		if qm == nil {
+			if qm, confirms = p.reconnect(); qm == nil {
+				p.discard(pending)
+				return
+			}
+		}
+		if pending == nil {
+			select {
+			case pending = <-p.outbox:
+			case msg := <-qm.ErrCh:
+				p.connectionLost(qm, msg)
+				qm = nil
+				continue
+			case <-p.closing:
+				// stop once the outbox has been flushed
+				select {
+				case pending = <-p.outbox:
+				default:
+					qm.Close()
+					return
+				}
+			case <-p.ctx.Done():
+				qm.Close()
+				p.discard(nil)
+				return
+			}
+		}
+		switch err := p.deliver(qm, confirms, pending); err {
+		case nil, ErrPublishRejected:
+			pending.result <- err
+			pending = nil
+		case ErrPublisherClosed:
+			qm.Close()
+			p.discard(pending)
+			return
+		default:
+			// keep hold of the message so it is retried once reconnected
+			p.connectionLost(qm, err)
+			qm = nil
+		}
+	}
+}
+
+// deliver publishes a single message and waits for rabbitmq to confirm it
+func (p *Publisher) deliver(qm *Manager, confirms chan amqp.Confirmation, msg *outboxMessage) error {
+	if err := qm.publish(msg.body, msg.id, msg.requestID); err != nil {
+		return err
+	}
+	select {
+	case confirm, ok := <-confirms:
+		if !ok {
+			return errConnectionLost
+		}
+		if !confirm.Ack {
+			p.l.Errorw("message rejected by rabbitmq", "queue", p.queue.String())
+			return ErrPublishRejected
+		}
+		return nil
+	case amqpErr := <-qm.ErrCh:
+		if amqpErr == nil {
+			return errConnectionLost
+		}
+		return amqpErr
+	case <-p.ctx.Done():
+		return ErrPublisherClosed
+	}
+}
+
+// connectionLost logs a connection failure and releases the connection
+func (p *Publisher) connectionLost(qm *Manager, reason error) {
+	atomic.StoreInt32(&p.connected, 0)
+	msg := errConnectionLost.Error()
+	if amqpErr, ok := reason.(*amqp.Error); ok && amqpErr != nil {
+		msg = amqpErr.Error()
+	} else if !ok && reason != nil {
+		msg = reason.Error()
+	}
+	p.l.Errorw(
+		"a protocol connection error stopping rabbitmq was received",
+		"queue", p.queue.String(),
+		"error", msg,
+		"pending", p.Pending())
+	qm.Close()
+}
+
+// discard fails all messages which were not delivered before the publisher closed
+func (p *Publisher) discard(pending *outboxMessage) {
+	if pending != nil {
+		pending.result <- ErrPublisherClosed
+	}
+	for {
+		select {
+		case msg := <-p.outbox:
+			msg.result <- ErrPublisherClosed
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/config/v2"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPublisher(t *testing.T) {
+	cfg, err := config.LoadConfig(testCfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zaptest.NewLogger(t).Sugar()
+	p, err := NewPublisher(EthPaymentConfirmationQueue, testRabbitAddress, cfg, logger, PublisherOptions{DevMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Connected() {
+		t.Fatal("publisher should be connected")
+	}
+	// test a successful publish, which must be confirmed by rabbitmq
+	if err := p.PublishMessage(EthPaymentConfirmation{
+		UserName:      "testuser",
+		PaymentNumber: 22,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// test a bad publish
+	if err := p.PublishMessage(map[string]interface{}{
+		"foo": make(chan int),
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// test a publish after close
+	if err := p.PublishMessage(EthPaymentConfirmation{
+		UserName:      "testuser",
+		PaymentNumber: 23,
+	}); err != ErrPublisherClosed {
+		t.Fatalf("expected %v, got %v", ErrPublisherClosed, err)
+	}
+}
+
+func TestPublisher_CloseFlushesOutbox(t *testing.T) {
+	cfg, err := config.LoadConfig(testCfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zaptest.NewLogger(t).Sugar()
+	p, err := NewPublisher(Queue("test-publisher-close-queue"), testRabbitAddress, cfg, logger, PublisherOptions{DevMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// buffer messages without waiting for them to be confirmed
+	var results []<-chan error
+	for i := 0; i < 10; i++ {
+		result, err := p.send("", "", []byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Fatalf("expected message to be delivered, got %v", err)
+		}
+	}
+	if _, err := p.send("", "", []byte("hello")); err != ErrPublisherClosed {
+		t.Fatalf("expected %v, got %v", ErrPublisherClosed, err)
+	}
+}
+
+func TestPublisher_Failure(t *testing.T) {
+	cfg, err := config.LoadConfig(testCfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zaptest.NewLogger(t).Sugar()
+	if _, err := NewPublisher(EthPaymentConfirmationQueue, "notarealprotocol://notarealurl", cfg, logger, PublisherOptions{DevMode: true}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestPublisher_Outbox(t *testing.T) {
+	// a publisher which never delivers messages, as if rabbitmq were down
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Publisher{
+		l:      zaptest.NewLogger(t).Sugar(),
+		opts:   PublisherOptions{OutboxSize: 1, ConfirmTimeout: time.Millisecond * 10},
+		outbox: make(chan *outboxMessage, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if err := p.PublishMessage("hello"); err != ErrPublishPending {
+		t.Fatalf("expected %v, got %v", ErrPublishPending, err)
+	}
+	if p.Pending() != 1 {
+		t.Fatalf("expected 1 pending message, got %v", p.Pending())
+	}
+	if err := p.PublishMessage("world"); err != ErrOutboxFull {
+		t.Fatalf("expected %v, got %v", ErrOutboxFull, err)
+	}
+	// messages left in the outbox are failed once closed
+	msg := <-p.outbox
+	p.outbox <- msg
+	cancel()
+	p.discard(nil)
+	if err := <-msg.result; err != ErrPublisherClosed {
+		t.Fatalf("expected %v, got %v", ErrPublisherClosed, err)
+	}
+	if p.Pending() != 0 {
+		t.Fatalf("expected 0 pending messages, got %v", p.Pending())
+	}
+}
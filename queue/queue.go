@@ -78,7 +78,7 @@ func (qm *Manager) openChannel() error {
 	}
 	qm.l.Info("channel opened")
 	qm.channel = ch
-	return qm.channel.Qos(10, 0, false)
+	return qm.channel.Qos(defaultPrefetch, 0, false)
 }
 
 // DeclareQueue is used to declare a queue for which messages will be sent to
@@ -123,6 +123,13 @@ func (qm *Manager) ConsumeMessages(ctx context.Context, wg *sync.WaitGroup, db *
 	if err != nil {
 		return err
 	}
+	// fallback to the default pool size if one was not configured
+	if qm.pool == nil {
+		qm.pool = newWorkerPool(defaultPrefetch)
+	}
+	reportCtx, stopReporting := context.WithCancel(ctx)
+	defer stopReporting()
+	go qm.reportPoolUtilization(reportCtx)
 
 	// check the queue name
 	switch qm.QueueName {
@@ -136,6 +143,8 @@ func (qm *Manager) ConsumeMessages(ctx context.Context, wg *sync.WaitGroup, db *
 		return qm.ProcessIPNSEntryCreationRequests(ctx, wg, msgs)
 	case IpfsClusterPinQueue:
 		return qm.ProcessIPFSClusterPins(ctx, wg, msgs)
+	case IpfsBeamQueue:
+		return qm.ProcessIPFSBeams(ctx, wg, msgs)
 	default:
 		return errors.New("invalid queue name")
 	}
@@ -147,26 +156,62 @@ func (qm *Manager) PublishMessage(body interface{}) error {
 	if err != nil {
 		return err
 	}
-	if err = qm.channel.Publish(
+	return qm.publish(bodyMarshaled, "", "")
+}
+
+// publish is used to send an already marshaled message to the queue. If set,
+// the message id allows consumers to recognize redelivered messages, and the
+// request id lets consumers log which api request the message came from
+func (qm *Manager) publish(body []byte, messageID, requestID string) error {
+	var headers amqp.Table
+	if requestID != "" {
+		headers = amqp.Table{RequestIDHeader: requestID}
+	}
+	return qm.channel.Publish(
 		"",                    // exchange - this is left empty, and becomes the default exchange
 		qm.QueueName.String(), // routing key
 		false,                 // mandatory
 		false,                 // immediate
 		amqp.Publishing{
+			Headers:      headers,
 			DeliveryMode: amqp.Persistent, // messages will persist through crashes, etc..
 			ContentType:  "text/plain",
-			Body:         bodyMarshaled,
+			MessageId:    messageID,
+			Body:         body,
 		},
-	); err != nil {
-		return err
+	)
+}
+
+// deliveryLogger returns a logger tagged with the request id of the delivery, if it has one
+func (qm *Manager) deliveryLogger(d amqp.Delivery) *zap.SugaredLogger {
+	if id := requestID(d); id != "" {
+		return qm.l.With("request-id", id)
 	}
-	return nil
+	return qm.l
+}
+
+// requestID returns the id of the api request a delivery was published for
+func requestID(d amqp.Delivery) string {
+	id, _ := d.Headers[RequestIDHeader].(string)
+	return id
+}
+
+// enableConfirms puts the channel into confirm mode, returning
+// the channel on which publisher confirmations are received
+func (qm *Manager) enableConfirms() (chan amqp.Confirmation, error) {
+	if err := qm.channel.Confirm(false); err != nil {
+		return nil, err
+	}
+	// we only ever have a single unconfirmed message in flight
+	return qm.channel.NotifyPublish(make(chan amqp.Confirmation, 1)), nil
 }
 
 // RegisterConnectionClosure is used to register a channel which we may receive
 // connection level errors. This covers all channel, and connection errors.
+// The channel is buffered so that closing a connection never blocks on a
+// receiver that has already given up on it.
 func (qm *Manager) RegisterConnectionClosure() {
-	qm.ErrCh = qm.connection.NotifyClose(make(chan *amqp.Error))
+	qm.ErrCh = qm.connection.NotifyClose(make(chan *amqp.Error, 1))
 }
 
 // Close is used to close our queue resources
@@ -136,6 +136,7 @@ func TestQueue_RefundCredits(t *testing.T) {
 	type args struct {
 		username string
 		callType string
+		cid      string
 		cost     float64
 	}
 	tests := []struct {
@@ -143,13 +144,13 @@ func TestQueue_RefundCredits(t *testing.T) {
 		args    args
 		wantErr bool
 	}{
-		{"HasCost", args{"testuser", "ipfs-pin", 1}, false},
-		{"NoCost", args{"testuser", "ipfs-pin", 0}, false},
-		{"RefundFail", args{"userdoesnotexist", "ipfs-pin", 10}, true},
+		{"HasCost", args{"testuser", "ipfs-pin", testCID, 1}, false},
+		{"NoCost", args{"testuser", "ipfs-pin", testCID, 0}, false},
+		{"RefundFail", args{"userdoesnotexist", "ipfs-pin", testCID, 10}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := qmConsumer.refundCredits(tt.args.username, tt.args.callType, tt.args.cost); (err != nil) != tt.wantErr {
+			if err := qmConsumer.refundCredits(tt.args.username, tt.args.callType, tt.args.cid, tt.args.cost); (err != nil) != tt.wantErr {
 				t.Fatal(err)
 			}
 		})
@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/config/v2"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// minRestartDelay is the initial delay before restarting a consumer
+	minRestartDelay = time.Second
+	// maxRestartDelay caps the delay between consecutive restarts of a consumer
+	maxRestartDelay = time.Minute
+)
+
+// SupervisorOptions is used to configure a Supervisor
+type SupervisorOptions struct {
+	// Queues are the queues to run consumers for
+	Queues []Queue
+	// Pools optionally configures the worker pool of each consumer
+	Pools map[Queue]PoolOptions
+	// DevMode toggles dev mode for all consumers
+	DevMode bool
+}
+
+// Supervisor runs several queue consumers within a single process, sharing
+// one database connection pool. Consumers that lose their connection to
+// rabbitmq are restarted individually, without affecting the others.
+type Supervisor struct {
+	cfg  *config.TemporalConfig
+	db   *gorm.DB
+	l    *zap.SugaredLogger
+	opts SupervisorOptions
+}
+
+// NewSupervisor is used to instantiate a consumer supervisor
+func NewSupervisor(cfg *config.TemporalConfig, db *gorm.DB, logger *zap.SugaredLogger, opts SupervisorOptions) (*Supervisor, error) {
+	if len(opts.Queues) == 0 {
+		return nil, errors.New("no queues to supervise")
+	}
+	seen := make(map[Queue]bool)
+	for _, q := range opts.Queues {
+		if seen[q] {
+			return nil, fmt.Errorf("queue %s specified more than once", q)
+		}
+		seen[q] = true
+	}
+	return &Supervisor{
+		cfg:  cfg,
+		db:   db,
+		l:    logger.Named("supervisor"),
+		opts: opts,
+	}, nil
+}
+
+// Run starts all consumers and blocks until they have exited. Consumers exit
+// when the given context is cancelled, or when any consumer encounters an
+// error it can not recover from, in which case the remaining consumers are
+// shut down and the error is returned. Run only returns once all in-flight
+// messages have finished processing.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		// tracks in-flight messages across all consumers
+		msgWg = &sync.WaitGroup{}
+		// tracks the consumers themselves
+		consumerWg sync.WaitGroup
+		errOnce    sync.Once
+		runErr     error
+	)
+	for _, q := range s.opts.Queues {
+		consumerWg.Add(1)
+		go func(q Queue) {
+			defer consumerWg.Done()
+			if err := s.supervise(ctx, q, msgWg); err != nil {
+				errOnce.Do(func() {
+					runErr = err
+					s.l.Errorw("consumer failed, shutting down supervisor",
+						"queue", q.String(),
+						"error", err.Error())
+					cancel()
+				})
+			}
+		}(q)
+	}
+	s.l.Infow("supervisor started", "queues", s.opts.Queues)
+	consumerWg.Wait()
+	s.l.Info("consumers stopped, waiting for in-flight messages")
+	msgWg.Wait()
+	s.l.Info("supervisor stopped")
+	return runErr
+}
+
+// supervise runs a consumer for a single queue, restarting it
+// whenever a protocol connection error is encountered
+func (s *Supervisor) supervise(ctx context.Context, q Queue, wg *sync.WaitGroup) error {
+	var (
+		l        = s.l.With("queue", q.String())
+		delay    = minRestartDelay
+		restarts int
+	)
+	for {
+		qm, err := New(q, s.cfg.RabbitMQ.URL, false, s.opts.DevMode, s.cfg, s.l)
+		if err == nil {
+			err = s.consume(ctx, qm, wg)
+		}
+		switch {
+		case err == nil:
+			// graceful exit, aka the context was cancelled
+			return nil
+		case err.Error() == ErrReconnect:
+			// the connection dropped while consuming, so reset the backoff
+			delay = minRestartDelay
+		case qm == nil:
+			// failed to connect to rabbitmq, retry with backoff
+			l.Warnw("failed to connect consumer", "error", err.Error())
+		default:
+			return err
+		}
+		restarts++
+		l.Warnw("restarting consumer", "restarts", restarts, "delay", delay.String())
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+		if delay *= 2; delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// consume configures the consumers worker pool and processes messages until
+// the consumer exits
+func (s *Supervisor) consume(ctx context.Context, qm *Manager, wg *sync.WaitGroup) error {
+	if opts, ok := s.opts.Pools[qm.QueueName]; ok {
+		if err := qm.SetPoolOptions(opts); err != nil {
+			qm.Close()
+			return err
+		}
+	}
+	wg.Add(1)
+	err := qm.ConsumeMessages(ctx, wg, s.db, s.cfg)
+	if err != nil && err.Error() != ErrReconnect {
+		// consumers only release the wait group when they stop processing
+		// messages, so release it ourselves for setup failures
+		wg.Done()
+		qm.Close()
+	}
+	return err
+}
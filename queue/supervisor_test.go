@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/config/v2"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestNewSupervisor(t *testing.T) {
+	logger := zaptest.NewLogger(t).Sugar()
+	tests := []struct {
+		name    string
+		queues  []Queue
+		wantErr bool
+	}{
+		{"NoQueues", nil, true},
+		{"Duplicate", []Queue{IpfsPinQueue, IpfsPinQueue}, true},
+		{"Valid", []Queue{IpfsPinQueue, EmailSendQueue}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSupervisor(&config.TemporalConfig{}, nil, logger, SupervisorOptions{Queues: tt.queues})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSupervisor() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSupervisor_Run(t *testing.T) {
+	cfg, err := config.LoadConfig(testCfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSupervisor(cfg, db, zaptest.NewLogger(t).Sugar(), SupervisorOptions{
+		Queues:  []Queue{IpfsClusterPinQueue, EmailSendQueue},
+		Pools:   map[Queue]PoolOptions{EmailSendQueue: {Prefetch: 5, Workers: 2}},
+		DevMode: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := s.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
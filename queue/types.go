@@ -12,6 +12,10 @@ import (
 
 // Various variables and types used by our queue package
 
+// RequestIDHeader is the amqp header carrying the id of
+// the api request a message was published for
+const RequestIDHeader = "x-request-id"
+
 // Queue is a typed string used to declare the various queue names
 type Queue string
 
@@ -27,6 +31,8 @@ var (
 	IpfsPinQueue Queue = "ipfs-pin-queue"
 	// IpfsClusterPinQueue is a queue used for ipfs cluster pins
 	IpfsClusterPinQueue Queue = "ipfs-cluster-add-queue"
+	// IpfsBeamQueue is a queue used to beam content between ipfs networks
+	IpfsBeamQueue Queue = "ipfs-beam-queue"
 	// EmailSendQueue is a queue used to handle sending email messages
 	EmailSendQueue Queue = "email-send-queue"
 	// IpnsEntryQueue is a queue used to handle ipns entry creation
@@ -74,6 +80,7 @@ type Manager struct {
 	l            *zap.SugaredLogger
 	db           *gorm.DB
 	cfg          *config.TemporalConfig
+	pool         *workerPool
 	ErrCh        chan *amqp.Error
 	QueueName    Queue
 	ExchangeName string
@@ -114,6 +121,32 @@ type IPFSClusterPin struct {
 	Size             int64   `json:"size"`
 	CreditCost       float64 `json:"credit_cost"`
 	FileName         string  `json:"file_name,omitempty"`
+	// PinRequestID is the pinning service api request the pin was made
+	// through, whose status is updated as the pin is processed
+	PinRequestID string `json:"pin_request_id,omitempty"`
+}
+
+// IPFSBeam is a queue message used to beam content from one network to another
+type IPFSBeam struct {
+	// JobID is the beam job whose progress is updated as the content is beamed
+	JobID              string  `json:"job_id"`
+	CID                string  `json:"cid"`
+	SourceNetwork      string  `json:"source_network"`
+	DestinationNetwork string  `json:"destination_network"`
+	UserName           string  `json:"user_name"`
+	HoldTimeInMonths   int64   `json:"hold_time_in_months"`
+	Size               int64   `json:"size"`
+	CreditCost         float64 `json:"credit_cost"`
+	// Encrypted beams are of content encrypted by the api, which
+	// is recorded as an encrypted upload under FileName
+	Encrypted bool   `json:"encrypted,omitempty"`
+	FileName  string `json:"file_name,omitempty"`
+	// Crypted beams encrypt the content before it is beamed, or decrypt it
+	// when Decrypt is set. The copy is beamed in place of the content. The
+	// passphrase, like the jwt of the user, is stored as the secret of the
+	// job rather than in the message
+	Crypted bool `json:"crypted,omitempty"`
+	Decrypt bool `json:"decrypt,omitempty"`
 }
 
 // IPNSUpdate is our message for the ipns update queue
@@ -0,0 +1,6 @@
+// Package refunds lets users withdraw unused credits back to the payment they
+// were bought with. Card payments are refunded through stripe straight away,
+// while crypto payouts are queued until an administrator approves and sends
+// them. Credits are withdrawn through the ledger when a refund is requested,
+// and returned should it be denied or fail.
+package refunds
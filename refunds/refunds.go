@@ -0,0 +1,479 @@
+package refunds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/billing"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/pricing"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// reconcileInterval is how often stripe refunds which were
+	// not confirmed by stripe are sent again
+	reconcileInterval = time.Minute * 10
+	// reconcileAfter is how long a stripe refund is pending before it is
+	// sent again, so that refunds still being requested are left alone
+	reconcileAfter = time.Minute * 5
+)
+
+// Method is how a refund is paid out
+type Method string
+
+const (
+	// Stripe refunds are returned to the card of a stripe payment
+	Stripe Method = "stripe"
+	// Crypto refunds are paid out to an address in the currency of a crypto payment
+	Crypto Method = "crypto"
+)
+
+// Status is the state of a refund request
+type Status string
+
+const (
+	// Pending refunds are waiting for an administrator to review them, or
+	// for stripe to confirm them
+	Pending Status = "pending"
+	// Approved refunds are waiting to be paid out
+	Approved Status = "approved"
+	// Completed refunds have been paid out
+	Completed Status = "completed"
+	// Denied refunds were rejected by an administrator, returning the credits
+	Denied Status = "denied"
+	// Failed refunds could not be paid out, returning the credits
+	Failed Status = "failed"
+)
+
+var (
+	// ErrNotFound is returned when a refund request does not exist
+	ErrNotFound = errors.New("refund request not found")
+	// ErrInvalidAmount is returned when requesting a non-positive refund
+	ErrInvalidAmount = errors.New("refund amount must be greater than zero")
+	// ErrNotRefundable is returned when refunding more than is left of a payment
+	ErrNotRefundable = errors.New("refund exceeds the amount left to refund for this payment")
+	// ErrInvalidStatus is returned when reviewing a refund which is not in the expected state
+	ErrInvalidStatus = errors.New("refund request is not in a state which allows this action")
+	// ErrNotReviewable is returned when reviewing a stripe refund, which is issued
+	// as soon as it is requested
+	ErrNotReviewable = errors.New("only crypto refunds are reviewed by an administrator")
+)
+
+// Request is a request to refund credits to the payment they were bought with
+type Request struct {
+	gorm.Model
+	UserName string `gorm:"type:varchar(255);index" json:"user_name"`
+	Method   Method `gorm:"type:varchar(32)" json:"method"`
+	// Payment is the refunded payment, the payment intent id for
+	// stripe payments, or the payment number for crypto payments
+	Payment string `gorm:"type:varchar(255);index" json:"payment"`
+	// Amount is the number of credits refunded
+	Amount float64 `json:"amount"`
+	Status Status  `gorm:"type:varchar(32);index" json:"status"`
+	Reason string  `gorm:"type:text" json:"reason"`
+	// StripeRefundID is the id of the stripe refund, once issued
+	StripeRefundID string `gorm:"type:varchar(255)" json:"stripe_refund_id,omitempty"`
+	// PayoutType is the currency crypto refunds are paid in, ie eth
+	PayoutType    string `gorm:"type:varchar(32)" json:"payout_type,omitempty"`
+	PayoutAddress string `gorm:"type:varchar(255)" json:"payout_address,omitempty"`
+	// PayoutAmount is the amount of the payout currency to send, set on approval
+	PayoutAmount float64 `json:"payout_amount,omitempty"`
+	// PriceQuoteID is the price quote the payout amount was calculated from
+	PriceQuoteID uint       `json:"price_quote_id,omitempty"`
+	PayoutTxHash string     `gorm:"type:varchar(255)" json:"payout_tx_hash,omitempty"`
+	ReviewedBy   string     `gorm:"type:varchar(255)" json:"reviewed_by,omitempty"`
+	ReviewNote   string     `gorm:"type:text" json:"review_note,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// TableName returns the table used to store refund requests
+func (Request) TableName() string {
+	return "refund_requests"
+}
+
+// StripeRefunder reserves refunds against stripe payments within a
+// transaction, and issues them, returning the id of the refund
+type StripeRefunder interface {
+	Reserve(tx *gorm.DB, paymentIntentID, username string, amountCents int64) error
+	Refund(paymentIntentID, username, idempotencyKey string, amountCents int64) (string, error)
+}
+
+// Quoter returns the usd value of a single unit of the given payment type
+type Quoter func(paymentType string) (*pricing.Quote, error)
+
+// Manager is used to request and review refunds
+type Manager struct {
+	db     *gorm.DB
+	l      *zap.SugaredLogger
+	stripe StripeRefunder
+	quote  Quoter
+	now    func() time.Time
+}
+
+// NewManager is used to instantiate our refund manager
+func NewManager(db *gorm.DB, logger *zap.SugaredLogger, stripe StripeRefunder, quoter Quoter) *Manager {
+	return &Manager{
+		db:     db,
+		l:      logger.Named("refunds"),
+		stripe: stripe,
+		quote:  quoter,
+		now:    time.Now,
+	}
+}
+
+// Find returns a refund request
+func (m *Manager) Find(id uint) (*Request, error) {
+	var req Request
+	if err := m.db.First(&req, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+// History returns the refund requests of a user, newest first
+func (m *Manager) History(username string) *gorm.DB {
+	return m.db.Model(&Request{}).Where("user_name = ?", username).Order("id desc")
+}
+
+// Queue returns the crypto payouts waiting for an administrator, oldest first
+func (m *Manager) Queue() *gorm.DB {
+	return m.db.Model(&Request{}).
+		Where("method = ? AND status IN (?)", Crypto, []Status{Pending, Approved}).
+		Order("id asc")
+}
+
+// RequestStripe refunds credits bought with a stripe payment to the card it
+// was made with. The request is recorded as pending along with the credits
+// it takes, before the refund is issued, so that refunds which stripe does not
+// confirm, or which were never sent, are found and sent again by Reconcile
+func (m *Manager) RequestStripe(username, paymentIntentID string, amount float64, reason string) (*Request, error) {
+	cents := int64(math.Round(amount * 100))
+	if cents <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	req := &Request{
+		UserName: username,
+		Method:   Stripe,
+		Payment:  paymentIntentID,
+		Amount:   float64(cents) / 100,
+		Status:   Pending,
+		Reason:   reason,
+	}
+	if err := m.transaction(func(tx *gorm.DB) error {
+		if err := m.stripe.Reserve(tx, paymentIntentID, username, cents); err != nil {
+			return err
+		}
+		return m.withdraw(tx, req)
+	}); err != nil {
+		if err == billing.ErrNotRefundable {
+			return nil, ErrNotRefundable
+		}
+		return nil, err
+	}
+	return m.issue(req)
+}
+
+// Reconcile sends stripe refunds again which have been pending for longer
+// than reconcileAfter, returning the number of refunds settled. Refunds are
+// sent with the same idempotency key, so those which stripe already issued
+// are not issued twice
+func (m *Manager) Reconcile() (int, error) {
+	var pending []Request
+	if err := m.db.Where("method = ? AND status = ? AND created_at < ?", Stripe, Pending, m.now().Add(-reconcileAfter)).
+		Order("id asc").
+		Find(&pending).Error; err != nil {
+		return 0, err
+	}
+	var settled int
+	for i := range pending {
+		req, err := m.issue(&pending[i])
+		if err != nil {
+			m.l.Warnw("failed to reconcile stripe refund", "refund", pending[i].ID, "error", err.Error())
+			continue
+		}
+		if req.Status != Pending {
+			settled++
+		}
+	}
+	return settled, nil
+}
+
+// Run reconciles stripe refunds, until the context is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.Reconcile(); err != nil {
+			m.l.Errorw("failed to reconcile stripe refunds", "error", err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// issue sends a pending stripe refund to stripe. The request is completed
+// once stripe issues the refund, or failed, returning the credits, if stripe
+// declines it. Refunds which stripe does not confirm are left pending
+func (m *Manager) issue(req *Request) (*Request, error) {
+	// the refund request identifies the refund to stripe, so that
+	// it is issued at most once however often it is sent
+	refundID, err := m.stripe.Refund(req.Payment, req.UserName, jobID(req), int64(math.Round(req.Amount*100)))
+	if err == billing.ErrRefundPending {
+		// the credits stay withdrawn until stripe settles the refund
+		m.l.Warnw("stripe refund not confirmed", "user", req.UserName, "refund", req.ID)
+		return req, nil
+	}
+	if err != nil {
+		m.l.Warnw("stripe refund failed", "user", req.UserName, "refund", req.ID, "error", err.Error())
+		if _, rerr := m.settle(req.ID, func(tx *gorm.DB, req *Request) error {
+			return m.restore(tx, req, Failed, "Refund Failed", "Your refund could not be issued to your card.")
+		}); rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+	return m.settle(req.ID, func(tx *gorm.DB, req *Request) error {
+		req.Status = Completed
+		req.StripeRefundID = refundID
+		if err := tx.Save(req).Error; err != nil {
+			return err
+		}
+		return m.notify(tx, req, "Refund Issued", fmt.Sprintf(
+			"A refund of $%.2f has been issued to the card used for your payment. It may take 5-10 days to appear on your statement.",
+			req.Amount,
+		))
+	})
+}
+
+// settle changes a pending stripe refund, locking it while doing so
+func (m *Manager) settle(id uint, fn func(tx *gorm.DB, req *Request) error) (*Request, error) {
+	var req Request
+	if err := m.transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&req, id).Error; err != nil {
+			return err
+		}
+		if req.Method != Stripe || req.Status != Pending {
+			return ErrInvalidStatus
+		}
+		return fn(tx, &req)
+	}); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// RequestPayout queues a refund of credits bought with a crypto payment, to
+// be paid out to the given address in the same currency once approved
+func (m *Manager) RequestPayout(username string, paymentNumber int64, address string, amount float64, reason string) (*Request, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	req := &Request{
+		UserName:      username,
+		Method:        Crypto,
+		Payment:       strconv.FormatInt(paymentNumber, 10),
+		Amount:        amount,
+		Status:        Pending,
+		Reason:        reason,
+		PayoutAddress: address,
+	}
+	if err := m.transaction(func(tx *gorm.DB) error {
+		payment, err := models.NewPaymentManager(tx).FindPaymentByNumber(username, paymentNumber)
+		if err != nil {
+			return err
+		}
+		if !payment.Confirmed {
+			return ErrNotRefundable
+		}
+		req.PayoutType = payment.Type
+		// withdrawing locks the user, so that their concurrent
+		// requests are counted towards the payment below
+		if err := m.withdraw(tx, req); err != nil {
+			return err
+		}
+		// only refunds which have not been denied or failed count towards the payment
+		var refunded []float64
+		if err := tx.Model(&Request{}).
+			Where("user_name = ? AND method = ? AND payment = ?", username, Crypto, req.Payment).
+			Where("status NOT IN (?)", []Status{Denied, Failed}).
+			Pluck("amount", &refunded).Error; err != nil {
+			return err
+		}
+		var total float64
+		for _, r := range refunded {
+			total += r
+		}
+		if total > payment.USDValue {
+			return ErrNotRefundable
+		}
+		return m.notify(tx, req, "Refund Requested", fmt.Sprintf(
+			"Your request to refund %v credits to %s has been received, and is waiting for review.",
+			req.Amount, html.EscapeString(req.PayoutAddress),
+		))
+	}); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Approve accepts a crypto payout, calculating the amount to send at the current price
+func (m *Manager) Approve(id uint, admin, note string) (*Request, error) {
+	return m.review(id, []Status{Pending}, func(tx *gorm.DB, req *Request) error {
+		if req.Method != Crypto {
+			return ErrNotReviewable
+		}
+		price, err := m.quote(req.PayoutType)
+		if err != nil {
+			return err
+		}
+		// cryptocurrencies we accept are divisible to 8 decimals
+		req.PayoutAmount = math.Floor(req.Amount/price.USD*1e8) / 1e8
+		req.PriceQuoteID = price.ID
+		req.Status = Approved
+		m.reviewed(req, admin, note)
+		if err := tx.Save(req).Error; err != nil {
+			return err
+		}
+		return m.notify(tx, req, "Refund Approved", fmt.Sprintf(
+			"Your refund of %v credits has been approved, and %v %s will be sent to %s shortly.",
+			req.Amount, req.PayoutAmount, req.PayoutType, html.EscapeString(req.PayoutAddress),
+		))
+	})
+}
+
+// Paid records the transaction an approved crypto payout was sent in
+func (m *Manager) Paid(id uint, admin, txHash string) (*Request, error) {
+	return m.review(id, []Status{Approved}, func(tx *gorm.DB, req *Request) error {
+		if req.Method != Crypto {
+			return ErrNotReviewable
+		}
+		req.Status = Completed
+		req.PayoutTxHash = txHash
+		m.reviewed(req, admin, req.ReviewNote)
+		if err := tx.Save(req).Error; err != nil {
+			return err
+		}
+		return m.notify(tx, req, "Refund Sent", fmt.Sprintf(
+			"Your refund of %v %s has been sent to %s in transaction %s.",
+			req.PayoutAmount, req.PayoutType, html.EscapeString(req.PayoutAddress), html.EscapeString(txHash),
+		))
+	})
+}
+
+// Deny rejects a crypto payout which has not been paid out, returning the
+// credits to the user. Stripe refunds are issued as soon as they are
+// requested, so can not be denied
+func (m *Manager) Deny(id uint, admin, note string) (*Request, error) {
+	return m.review(id, []Status{Pending, Approved}, func(tx *gorm.DB, req *Request) error {
+		if req.Method != Crypto {
+			return ErrNotReviewable
+		}
+		m.reviewed(req, admin, note)
+		return m.restore(tx, req, Denied, "Refund Denied", "Your refund request has been denied: "+html.EscapeString(note))
+	})
+}
+
+// review changes a refund request in one of the expected states, locking it while doing so
+func (m *Manager) review(id uint, from []Status, fn func(tx *gorm.DB, req *Request) error) (*Request, error) {
+	var req Request
+	if err := m.transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&req, id).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+		for _, status := range from {
+			if req.Status == status {
+				return fn(tx, &req)
+			}
+		}
+		return ErrInvalidStatus
+	}); err != nil {
+		return nil, err
+	}
+	m.l.Infow("refund reviewed", "refund", req.ID, "user", req.UserName, "status", req.Status, "admin", req.ReviewedBy)
+	return &req, nil
+}
+
+func (m *Manager) reviewed(req *Request, admin, note string) {
+	now := m.now()
+	req.ReviewedBy = admin
+	req.ReviewNote = note
+	req.ReviewedAt = &now
+}
+
+// withdraw records a refund request, taking the credits from the user
+func (m *Manager) withdraw(tx *gorm.DB, req *Request) error {
+	if err := tx.Create(req).Error; err != nil {
+		return err
+	}
+	_, err := ledger.NewManager(tx).Withdraw(req.UserName, req.Amount, ledger.Meta{
+		Reason: fmt.Sprintf("%s refund of payment %s", req.Method, req.Payment),
+		JobID:  jobID(req),
+	})
+	return err
+}
+
+// restore closes a refund request that will not be paid out, returning the credits to the user
+func (m *Manager) restore(tx *gorm.DB, req *Request, status Status, subject, content string) error {
+	req.Status = status
+	if err := tx.Save(req).Error; err != nil {
+		return err
+	}
+	if _, err := ledger.NewManager(tx).Credit(req.UserName, ledger.Refund, req.Amount, ledger.Meta{
+		Reason: fmt.Sprintf("%s refund %s", req.Method, status),
+		JobID:  jobID(req),
+	}); err != nil {
+		return err
+	}
+	return m.notify(tx, req, subject, content+fmt.Sprintf(" %v credits have been returned to your account.", req.Amount))
+}
+
+// notify queues an email to the user, sent once the transaction commits
+func (m *Manager) notify(tx *gorm.DB, req *Request, subject, content string) error {
+	user, err := models.NewUserManager(tx).FindByUserName(req.UserName)
+	if err != nil {
+		return err
+	}
+	_, err = queue.Enqueue(tx, queue.EmailSendQueue, queue.EmailSend{
+		Subject:     "TEMPORAL " + subject,
+		Content:     content,
+		ContentType: "text/html",
+		UserNames:   []string{req.UserName},
+		Emails:      []string{user.EmailAddress},
+	})
+	return err
+}
+
+func (m *Manager) transaction(fn func(tx *gorm.DB) error) error {
+	tx := m.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// jobID links ledger entries to the refund request they were made for
+func jobID(req *Request) string {
+	return fmt.Sprintf("refund-%v", req.ID)
+}
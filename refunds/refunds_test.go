@@ -0,0 +1,281 @@
+package refunds
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/billing"
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/pricing"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap/zaptest"
+)
+
+const testUser = "testuser"
+
+// fakeStripe issues refunds without contacting stripe
+type fakeStripe struct {
+	reserveErr error
+	err        error
+}
+
+func (f *fakeStripe) Reserve(tx *gorm.DB, paymentIntentID, username string, amountCents int64) error {
+	return f.reserveErr
+}
+
+func (f *fakeStripe) Refund(paymentIntentID, username, idempotencyKey string, amountCents int64) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return "re_" + uuid.New().String(), nil
+}
+
+func fakeQuoter(paymentType string) (*pricing.Quote, error) {
+	return &pricing.Quote{Model: gorm.Model{ID: 1}, Coin: paymentType, USD: 200}, nil
+}
+
+func TestManager_RequestStripe(t *testing.T) {
+	db := loadDatabase(t)
+	stripe := &fakeStripe{}
+	m := NewManager(db, zaptest.NewLogger(t).Sugar(), stripe, fakeQuoter)
+	um := models.NewUserManager(db)
+	errDeclined := errors.New("card declined")
+	tests := []struct {
+		name       string
+		amount     float64
+		reserveErr error
+		stripeErr  error
+		wantErr    error
+		wantStatus Status
+		// wantCharge is the expected change in credits
+		wantCharge float64
+	}{
+		{"Refunded", 1.5, nil, nil, nil, Completed, 1.5},
+		{"NotRefundable", 1.5, billing.ErrNotRefundable, nil, ErrNotRefundable, "", 0},
+		{"Declined", 1.5, nil, errDeclined, errDeclined, Failed, 0},
+		// unconfirmed refunds keep the credits until they are reconciled
+		{"Unconfirmed", 1.5, nil, billing.ErrRefundPending, nil, Pending, 1.5},
+		{"ZeroAmount", 0.001, nil, nil, ErrInvalidAmount, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripe.reserveErr, stripe.err = tt.reserveErr, tt.stripeErr
+			start := credits(t, um)
+			pi := "pi_" + uuid.New().String()
+			defer db.Unscoped().Where("payment = ?", pi).Delete(&Request{})
+			req, err := m.RequestStripe(testUser, pi, tt.amount, "test refund")
+			if err != tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			assertCharged(t, um, start, tt.wantCharge)
+			if tt.wantStatus == "" {
+				return
+			}
+			if req == nil {
+				var failed Request
+				if err := db.Where("payment = ?", pi).First(&failed).Error; err != nil {
+					t.Fatal(err)
+				}
+				req = &failed
+			}
+			if req.Status != tt.wantStatus {
+				t.Fatalf("expected status %s, got %s", tt.wantStatus, req.Status)
+			}
+		})
+	}
+}
+
+func TestManager_ReviewStripe(t *testing.T) {
+	db := loadDatabase(t)
+	m := NewManager(db, zaptest.NewLogger(t).Sugar(), &fakeStripe{}, fakeQuoter)
+	// stripe refunds are pending while they are being issued, which
+	// must not be denied, or the user would be refunded twice
+	req := &Request{UserName: testUser, Method: Stripe, Payment: "pi_" + uuid.New().String(), Amount: 1, Status: Pending}
+	if err := db.Create(req).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(req)
+	if _, err := m.Deny(req.ID, "admin", "no"); err != ErrNotReviewable {
+		t.Fatalf("expected %v, got %v", ErrNotReviewable, err)
+	}
+	if _, err := m.Paid(req.ID, "admin", "0xhash"); err != ErrNotReviewable {
+		t.Fatalf("expected %v, got %v", ErrNotReviewable, err)
+	}
+	var queued int
+	if err := m.Queue().Where("id = ?", req.ID).Count(&queued).Error; err != nil {
+		t.Fatal(err)
+	}
+	if queued != 0 {
+		t.Fatal("stripe refunds should not be queued for review")
+	}
+}
+
+func TestManager_Reconcile(t *testing.T) {
+	db := loadDatabase(t)
+	stripe := &fakeStripe{err: billing.ErrRefundPending}
+	m := NewManager(db, zaptest.NewLogger(t).Sugar(), stripe, fakeQuoter)
+	// only refunds pending for a while are sent again
+	stuck := &Request{UserName: testUser, Method: Stripe, Payment: "pi_" + uuid.New().String(), Amount: 1, Status: Pending}
+	if err := db.Create(stuck).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(stuck)
+	if err := db.Model(stuck).UpdateColumn("created_at", time.Now().Add(-reconcileAfter*2)).Error; err != nil {
+		t.Fatal(err)
+	}
+	recent := &Request{UserName: testUser, Method: Stripe, Payment: "pi_" + uuid.New().String(), Amount: 1, Status: Pending}
+	if err := db.Create(recent).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(recent)
+
+	// refunds stripe still does not confirm stay pending
+	if settled, err := m.Reconcile(); err != nil {
+		t.Fatal(err)
+	} else if settled != 0 {
+		t.Fatalf("expected 0 settled refunds, got %v", settled)
+	}
+	stripe.err = nil
+	if _, err := m.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		req  *Request
+		want Status
+	}{{stuck, Completed}, {recent, Pending}} {
+		found, err := m.Find(tt.req.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Status != tt.want {
+			t.Fatalf("expected refund %v to be %s, got %s", tt.req.ID, tt.want, found.Status)
+		}
+	}
+}
+
+func TestManager_RequestPayout(t *testing.T) {
+	db := loadDatabase(t)
+	m := NewManager(db, zaptest.NewLogger(t).Sugar(), &fakeStripe{}, fakeQuoter)
+	um := models.NewUserManager(db)
+	payment := createPayment(t, db, 10)
+	defer db.Unscoped().Delete(payment)
+	defer db.Unscoped().Where("user_name = ? AND payment = ?", testUser, strconv.FormatInt(payment.Number, 10)).Delete(&Request{})
+
+	// refunds are limited to the value of the payment
+	start := credits(t, um)
+	if _, err := m.RequestPayout(testUser, payment.Number, "0xabc", 11, "too much"); err != ErrNotRefundable {
+		t.Fatalf("expected %v, got %v", ErrNotRefundable, err)
+	}
+	assertCharged(t, um, start, 0)
+
+	// approved payouts are paid at the current price
+	req, err := m.RequestPayout(testUser, payment.Number, "0xabc", 6, "test payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCharged(t, um, start, 6)
+	if req, err = m.Approve(req.ID, "admin", "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != Approved || req.PayoutAmount != 0.03 || req.PriceQuoteID != 1 {
+		t.Fatalf("unexpected approval %+v", req)
+	}
+	if req, err = m.Paid(req.ID, "admin", "0xhash"); err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != Completed || req.PayoutTxHash != "0xhash" {
+		t.Fatalf("unexpected payout %+v", req)
+	}
+	if _, err := m.Deny(req.ID, "admin", "too late"); err != ErrInvalidStatus {
+		t.Fatalf("expected %v, got %v", ErrInvalidStatus, err)
+	}
+
+	// only what is left of the payment can be refunded
+	if _, err := m.RequestPayout(testUser, payment.Number, "0xabc", 5, "too much"); err != ErrNotRefundable {
+		t.Fatalf("expected %v, got %v", ErrNotRefundable, err)
+	}
+	// denied payouts return the credits
+	start = credits(t, um)
+	req, err = m.RequestPayout(testUser, payment.Number, "0xabc", 4, "test payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, err = m.Deny(req.ID, "admin", "not eligible"); err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != Denied || req.ReviewedBy != "admin" {
+		t.Fatalf("unexpected denial %+v", req)
+	}
+	assertCharged(t, um, start, 0)
+	if _, err := m.Paid(req.ID, "admin", "0xhash"); err != ErrInvalidStatus {
+		t.Fatalf("expected %v, got %v", ErrInvalidStatus, err)
+	}
+	// every change is recorded in the ledger
+	var entries []ledger.Entry
+	if err := db.Where("job_id = ?", jobID(req)).Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 ledger entries, got %v", len(entries))
+	}
+}
+
+func createPayment(t *testing.T, db *gorm.DB, usdValue float64) *models.Payment {
+	number := time.Now().UnixNano()
+	payment, err := models.NewPaymentManager(db).NewPayment(
+		number,
+		"0xdeposit",
+		"0x"+uuid.New().String(),
+		usdValue,
+		usdValue/200,
+		"ethereum",
+		"eth",
+		testUser,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(payment).Update("confirmed", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	return payment
+}
+
+func credits(t *testing.T, um *models.UserManager) float64 {
+	credits, err := um.GetCreditsForUser(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credits
+}
+
+// assertCharged checks the users credits changed by the given charge
+func assertCharged(t *testing.T, um *models.UserManager, start, charge float64) {
+	t.Helper()
+	if diff := start - credits(t, um); math.Abs(diff-charge) > 0.001 {
+		t.Fatalf("expected to be charged %v, charged %v", charge, diff)
+	}
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(&Request{}, &ledger.Entry{}, &queue.OutboxMessage{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}
@@ -0,0 +1,5 @@
+// Package settings provides Temporal configuration that is not covered by
+// config.TemporalConfig. Settings are read from the same configuration file
+// as the rest of Temporal's configuration, so a single file can be used to
+// configure every service.
+package settings
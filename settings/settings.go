@@ -0,0 +1,117 @@
+package settings
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+const (
+	// DefaultPrefetch is the number of unacknowledged messages a consumer
+	// may hold when no prefetch is configured for its queue
+	DefaultPrefetch = 10
+)
+
+// Settings contains configuration that extends config.TemporalConfig
+type Settings struct {
+	Queue    Queue    `json:"queue,omitempty"`
+	Stripe   Stripe   `json:"stripe,omitempty"`
+	Pricing  Pricing  `json:"pricing,omitempty"`
+	Pinning  Pinning  `json:"pinning,omitempty"`
+	Payments Payments `json:"payments,omitempty"`
+}
+
+// Queue contains queue consumer configuration
+type Queue struct {
+	// Consumers is the set of consumers started by `temporal queue all`,
+	// for example ["pin", "cluster", "email-send"]. All consumers are
+	// started when left empty.
+	Consumers []string `json:"consumers,omitempty"`
+	// Pools configures the worker pool of a consumer, keyed by queue name,
+	// for example "ipfs-pin-queue"
+	Pools map[string]Pool `json:"pools,omitempty"`
+}
+
+// Stripe contains stripe configuration not covered by config.Stripe. It is read
+// from the same "stripe" object as the api keys
+type Stripe struct {
+	// WebhookSecret is the signing secret of the stripe webhook endpoint,
+	// used to verify that events were sent by stripe
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+	// APIURL overrides the url of the stripe api, which is useful
+	// for testing against a local stripe-mock server
+	APIURL string `json:"api_url,omitempty"`
+}
+
+// Pricing configures the sources used to price cryptocurrency payments
+type Pricing struct {
+	// Sources are the price sources to query, any of "cmc" and "coingecko".
+	// All sources are used when left empty.
+	Sources []string `json:"sources,omitempty"`
+	// Static sets fixed usd prices by payment type, for example
+	// {"rtc": 0.125}. Static prices are used alongside the other sources.
+	Static map[string]float64 `json:"static,omitempty"`
+	// MaxDeviation is the fraction a source may differ from the median
+	// price before it is rejected, for example 0.1 for 10%
+	MaxDeviation float64 `json:"max_deviation,omitempty"`
+}
+
+// Pinning configures the ipfs pinning service api
+type Pinning struct {
+	// Delegates are the multiaddrs of the ipfs nodes content is pinned
+	// to, which clients connect to when providing content for a pin, for
+	// example ["/dns4/ipfs.example.com/tcp/4001/p2p/Qm..."]
+	Delegates []string `json:"delegates,omitempty"`
+}
+
+// Payments configures how crypto payments are checked on chain
+type Payments struct {
+	// EthereumURL is the json-rpc endpoint of the ethereum node used to
+	// check eth and rtc payments. Ethereum payments are not checked when
+	// left empty.
+	EthereumURL string `json:"ethereum_url,omitempty"`
+	// PaymentContract is the address of the contract eth and rtc payments
+	// are sent to. Transactions to any other address are rejected.
+	PaymentContract string `json:"payment_contract,omitempty"`
+	// Confirmations sets the confirmations a payment needs by blockchain,
+	// for example {"ethereum": 12, "bitcoin-cash": 6, "dash": 6}
+	Confirmations map[string]int `json:"confirmations,omitempty"`
+}
+
+// Pool configures how many messages a single queue consumer processes at once
+type Pool struct {
+	// Prefetch is the maximum number of unacknowledged messages
+	// rabbitmq will deliver to the consumer
+	Prefetch int `json:"prefetch,omitempty"`
+	// Workers is the maximum number of messages processed concurrently.
+	// Once all workers are busy the consumer stops taking deliveries
+	// until a worker frees up.
+	Workers int `json:"workers,omitempty"`
+}
+
+// Load is used to read settings from the configuration file at the given path.
+// Keys which are not part of Settings are ignored.
+func Load(path string) (*Settings, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Settings
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Pool returns the pool configuration for the given queue, filling in defaults
+// for any values which have not been set. If no workers are configured, the
+// pool is sized to match the prefetch count.
+func (q Queue) Pool(name string) Pool {
+	p := q.Pools[name]
+	if p.Prefetch <= 0 {
+		p.Prefetch = DefaultPrefetch
+	}
+	if p.Workers <= 0 {
+		p.Workers = p.Prefetch
+	}
+	return p
+}
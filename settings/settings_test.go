@@ -0,0 +1,61 @@
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{
+		"log_dir": "/var/log/temporal/",
+		"queue": {"pools": {"ipfs-pin-queue": {"prefetch": 20, "workers": 5}}},
+		"stripe": {"secret_key": "sk_test", "webhook_secret": "whsec_test"},
+		"pricing": {"sources": ["coingecko"], "static": {"rtc": 0.125}}
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Queue.Pool("ipfs-pin-queue"); p.Prefetch != 20 || p.Workers != 5 {
+		t.Fatalf("bad pool configuration %+v", p)
+	}
+	if s.Stripe.WebhookSecret != "whsec_test" {
+		t.Fatalf("bad stripe configuration %+v", s.Stripe)
+	}
+	if len(s.Pricing.Sources) != 1 || s.Pricing.Static["rtc"] != 0.125 {
+		t.Fatalf("bad pricing configuration %+v", s.Pricing)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestQueue_Pool(t *testing.T) {
+	tests := []struct {
+		name  string
+		pools map[string]Pool
+		want  Pool
+	}{
+		{"NotConfigured", nil, Pool{DefaultPrefetch, DefaultPrefetch}},
+		{"PrefetchOnly", map[string]Pool{"q": {Prefetch: 4}}, Pool{4, 4}},
+		{"WorkersOnly", map[string]Pool{"q": {Workers: 2}}, Pool{DefaultPrefetch, 2}},
+		{"Both", map[string]Pool{"q": {Prefetch: 50, Workers: 25}}, Pool{50, 25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Queue{Pools: tt.pools}).Pool("q"); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+// Package subscription implements fixed price monthly plans. A plan grants
+// a storage quota along with ipns and pubsub allowances, enforced through the
+// usage limits of the database package, in place of pay-as-you-go pricing.
+// Plans are paid for with credits, topped up from a saved payment method when
+// the user runs short, so every charge is recorded in the credit ledger.
+package subscription
@@ -0,0 +1,80 @@
+package subscription
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrPlanNotFound is returned when a plan does not exist, or has been retired
+	ErrPlanNotFound = errors.New("subscription plan not found")
+	// ErrInvalidPlan is returned when creating a plan with missing or negative values
+	ErrInvalidPlan = errors.New("plan requires a name and a positive price")
+)
+
+// Plan is a fixed price monthly subscription
+type Plan struct {
+	gorm.Model
+	Name        string `gorm:"type:varchar(255);unique_index" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+	// MonthlyPrice is the price of a month of the plan, in credits
+	MonthlyPrice float64 `json:"monthly_price"`
+	// StorageBytes is the amount of data subscribers may store
+	StorageBytes uint64 `json:"storage_bytes"`
+	// IPNSRecords is the number of ipns records subscribers may publish each month
+	IPNSRecords int64 `json:"ipns_records"`
+	// PubSubMessages is the number of pubsub messages subscribers may send each month
+	PubSubMessages int64 `json:"pubsub_messages"`
+	// Keys is the number of keys subscribers may create
+	Keys int64 `json:"keys"`
+	// Retired plans can no longer be subscribed to, but existing
+	// subscriptions to them continue to renew
+	Retired bool `json:"retired"`
+}
+
+// TableName returns the table used to store subscription plans
+func (Plan) TableName() string {
+	return "subscription_plans"
+}
+
+// CreatePlan is used to add a new plan
+func (m *Manager) CreatePlan(plan *Plan) error {
+	if plan.Name == "" || plan.MonthlyPrice <= 0 {
+		return ErrInvalidPlan
+	}
+	return m.db.Create(plan).Error
+}
+
+// RetirePlan stops new subscriptions to a plan
+func (m *Manager) RetirePlan(name string) error {
+	result := m.db.Model(&Plan{}).Where("name = ?", name).Update("retired", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPlanNotFound
+	}
+	return nil
+}
+
+// Plans returns the plans which can be subscribed to, cheapest first
+func (m *Manager) Plans() ([]Plan, error) {
+	var plans []Plan
+	if err := m.db.Where("retired = ?", false).Order("monthly_price asc").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// FindPlan returns the plan with the given name, unless it has been retired
+func (m *Manager) FindPlan(name string) (*Plan, error) {
+	var plan Plan
+	if err := m.db.Where("name = ? AND retired = ?", name, false).First(&plan).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
@@ -0,0 +1,590 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultInterval is how often subscriptions are checked for renewal
+	DefaultInterval = time.Minute * 10
+	// DefaultRetryInterval is how long to wait before retrying a failed renewal
+	DefaultRetryInterval = time.Hour * 24
+	// DefaultMaxFailedRenewals is the number of consecutive failed renewals
+	// after which a subscription is cancelled, and the user downgraded
+	DefaultMaxFailedRenewals = 3
+	// minTopUpCents is the smallest amount charged to a saved payment
+	// method, as stripe rejects payments below 50 cents
+	minTopUpCents = 50
+	// callType is recorded on ledger entries for subscription charges
+	callType = "subscription"
+)
+
+// Status is the state of a subscription
+type Status string
+
+const (
+	// Active subscriptions are paid up
+	Active Status = "active"
+	// PastDue subscriptions failed to renew, and are being retried. The
+	// plan remains in effect until renewal has failed too many times
+	PastDue Status = "past_due"
+	// Canceled subscriptions have ended, and the user has been downgraded
+	Canceled Status = "canceled"
+)
+
+var (
+	// ErrNotSubscribed is returned when a user does not have a subscription
+	ErrNotSubscribed = errors.New("user does not have a subscription")
+	// ErrAlreadySubscribed is returned when subscribing a user with a subscription
+	ErrAlreadySubscribed = errors.New("user already has a subscription, change plans instead")
+	// ErrSamePlan is returned when changing to the plan a user is already on
+	ErrSamePlan = errors.New("user is already subscribed to this plan")
+	// ErrPastDue is returned when changing the plan of a subscription that failed to renew
+	ErrPastDue = errors.New("subscription renewal is overdue, please add credits or a payment method")
+	// ErrQuotaExceeded is returned when a user stores more data than a plan allows
+	ErrQuotaExceeded = errors.New("stored data exceeds the storage quota of the plan")
+
+	// errSkip aborts a renewal which is no longer due
+	errSkip = errors.New("renewal not due")
+)
+
+// TopUp purchases credits for a user without them being present, using
+// a saved payment method. It is implemented by billing.Stripe
+type TopUp interface {
+	TopUp(username string, amountCents int64) error
+}
+
+// Subscription is the plan a user is subscribed to
+type Subscription struct {
+	gorm.Model
+	UserName string `gorm:"type:varchar(255);unique_index" json:"user_name"`
+	PlanID   uint   `json:"plan_id"`
+	Status   Status `gorm:"type:varchar(32);index" json:"status"`
+	// PeriodStart and PeriodEnd are the bounds of the month paid for
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `gorm:"index" json:"period_end"`
+	// CancelAtPeriodEnd stops the subscription from renewing
+	CancelAtPeriodEnd bool `json:"cancel_at_period_end"`
+	// FailedRenewals is the number of consecutive failed renewals
+	FailedRenewals int `json:"failed_renewals"`
+	// RetryAt is when a failed renewal is next attempted
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+	// PreviousTier is the usage tier restored when the subscription ends
+	PreviousTier models.DataUsageTier `gorm:"type:varchar(255)" json:"-"`
+}
+
+// TableName returns the table used to store subscriptions
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
+
+// Options is used to configure subscription renewals
+type Options struct {
+	// Interval is how often subscriptions are checked for renewal
+	Interval time.Duration
+	// RetryInterval is how long to wait before retrying a failed renewal
+	RetryInterval time.Duration
+	// MaxFailedRenewals is the number of failed renewals before downgrading
+	MaxFailedRenewals int
+}
+
+// Manager is used to manage plans and subscriptions
+type Manager struct {
+	db    *gorm.DB
+	l     *zap.SugaredLogger
+	topUp TopUp
+	opts  Options
+	now   func() time.Time
+}
+
+// NewManager is used to instantiate our subscription manager. If topUp
+// is nil, subscriptions are paid for with existing credits only
+func NewManager(db *gorm.DB, logger *zap.SugaredLogger, topUp TopUp, opts Options) *Manager {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	if opts.MaxFailedRenewals <= 0 {
+		opts.MaxFailedRenewals = DefaultMaxFailedRenewals
+	}
+	return &Manager{
+		db:    db,
+		l:     logger.Named("subscriptions"),
+		topUp: topUp,
+		opts:  opts,
+		now:   time.Now,
+	}
+}
+
+// Find returns the subscription of a user, including ended subscriptions
+func (m *Manager) Find(username string) (*Subscription, error) {
+	var sub Subscription
+	if err := m.db.Where("user_name = ?", username).First(&sub).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotSubscribed
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Covers returns whether a user has a subscription in effect, in which case
+// storage within their quota is paid for by the plan
+func (m *Manager) Covers(username string) (bool, error) {
+	var count int
+	if err := m.db.Model(&Subscription{}).
+		Where("user_name = ? AND status <> ?", username, Canceled).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CoveredMonths returns how many of the next holdTimeInMonths months of storage
+// are paid for by the subscription of a user. A month is covered when it starts
+// before the end of the paid period, so storage held beyond it is charged for
+func (m *Manager) CoveredMonths(username string, holdTimeInMonths int64) (int64, error) {
+	var sub Subscription
+	err := m.db.Where("user_name = ? AND status <> ?", username, Canceled).First(&sub).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	now := m.now()
+	var covered int64
+	for covered < holdTimeInMonths && now.AddDate(0, int(covered), 0).Before(sub.PeriodEnd) {
+		covered++
+	}
+	return covered, nil
+}
+
+// Subscribe charges a user for the first month of a plan, and applies its limits
+func (m *Manager) Subscribe(username, planName string) (*Subscription, error) {
+	plan, err := m.FindPlan(planName)
+	if err != nil {
+		return nil, err
+	}
+	var sub *Subscription
+	err = m.charge(username, func(tx *gorm.DB) (float64, string, error) {
+		existing, err := lockSubscription(tx, username)
+		switch {
+		case gorm.IsRecordNotFoundError(err):
+			existing = &Subscription{UserName: username}
+		case err != nil:
+			return 0, "", err
+		case existing.Status != Canceled:
+			return 0, "", ErrAlreadySubscribed
+		}
+		usage, err := models.NewUsageManager(tx).FindByUserName(username)
+		if err != nil {
+			return 0, "", err
+		}
+		if usage.CurrentDataUsedBytes > plan.StorageBytes {
+			return 0, "", ErrQuotaExceeded
+		}
+		now := m.now()
+		existing.PlanID = plan.ID
+		existing.Status = Active
+		existing.PeriodStart = now
+		existing.PeriodEnd = now.AddDate(0, 1, 0)
+		existing.CancelAtPeriodEnd = false
+		existing.FailedRenewals = 0
+		existing.RetryAt = nil
+		existing.PreviousTier = usage.Tier
+		if err := tx.Save(existing).Error; err != nil {
+			return 0, "", err
+		}
+		if err := applyPlan(tx, username, plan, true); err != nil {
+			return 0, "", err
+		}
+		sub = existing
+		return plan.MonthlyPrice, fmt.Sprintf("%s plan subscription", plan.Name), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.l.Infow("user subscribed", "user", username, "plan", plan.Name)
+	return sub, nil
+}
+
+// ChangePlan moves a user to a different plan for the rest of their current
+// period. They are charged the prorated difference when upgrading, and
+// credited it when downgrading
+func (m *Manager) ChangePlan(username, planName string) (*Subscription, error) {
+	plan, err := m.FindPlan(planName)
+	if err != nil {
+		return nil, err
+	}
+	var sub *Subscription
+	err = m.charge(username, func(tx *gorm.DB) (float64, string, error) {
+		existing, err := lockSubscription(tx, username)
+		switch {
+		case gorm.IsRecordNotFoundError(err):
+			return 0, "", ErrNotSubscribed
+		case err != nil:
+			return 0, "", err
+		case existing.Status == Canceled:
+			return 0, "", ErrNotSubscribed
+		case existing.Status == PastDue:
+			return 0, "", ErrPastDue
+		case existing.PlanID == plan.ID:
+			return 0, "", ErrSamePlan
+		}
+		var current Plan
+		if err := tx.Unscoped().First(&current, existing.PlanID).Error; err != nil {
+			return 0, "", err
+		}
+		usage, err := models.NewUsageManager(tx).FindByUserName(username)
+		if err != nil {
+			return 0, "", err
+		}
+		if usage.CurrentDataUsedBytes > plan.StorageBytes {
+			return 0, "", ErrQuotaExceeded
+		}
+		existing.PlanID = plan.ID
+		if err := tx.Save(existing).Error; err != nil {
+			return 0, "", err
+		}
+		if err := applyPlan(tx, username, plan, false); err != nil {
+			return 0, "", err
+		}
+		sub = existing
+		// price the rest of the period at the difference between the plans
+		diff := (plan.MonthlyPrice - current.MonthlyPrice) * m.remaining(existing)
+		diff = math.Round(diff*100) / 100
+		reason := fmt.Sprintf("prorated change from %s plan to %s plan", current.Name, plan.Name)
+		if diff < 0 {
+			if _, err := ledger.NewManager(tx).Credit(username, ledger.Refund, -diff, ledger.Meta{
+				Reason:   reason,
+				CallType: callType,
+			}); err != nil {
+				return 0, "", err
+			}
+			return 0, "", nil
+		}
+		return diff, reason, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.l.Infow("subscription plan changed", "user", username, "plan", plan.Name)
+	return sub, nil
+}
+
+// Cancel stops a subscription from renewing. The plan remains
+// in effect until the end of the current period
+func (m *Manager) Cancel(username string) error {
+	result := m.db.Model(&Subscription{}).
+		Where("user_name = ? AND status <> ?", username, Canceled).
+		Update("cancel_at_period_end", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotSubscribed
+	}
+	return nil
+}
+
+// SetTier moves a user to a data usage tier. Subscribers moved to the paid
+// tier are given the limits of their plan, rather than those of the tier
+func (m *Manager) SetTier(username string, tier models.DataUsageTier) error {
+	return m.transaction(func(tx *gorm.DB) error {
+		if err := models.NewUsageManager(tx).UpdateTier(username, tier); err != nil {
+			return err
+		}
+		if tier != models.Paid {
+			return nil
+		}
+		sub, err := lockSubscription(tx, username)
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if sub.Status == Canceled {
+			return nil
+		}
+		var plan Plan
+		if err := tx.Unscoped().First(&plan, sub.PlanID).Error; err != nil {
+			return err
+		}
+		return applyPlan(tx, username, &plan, false)
+	})
+}
+
+// Run renews subscriptions as they become due, until the context is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.RenewDue(); err != nil {
+			m.l.Errorw("failed to renew subscriptions", "error", err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RenewDue renews, or ends, every subscription whose period has ended,
+// returning the number of subscriptions processed. Subscriptions are locked
+// while being renewed, so several renewers may run against the same database
+func (m *Manager) RenewDue() (int, error) {
+	now := m.now()
+	var ids []uint
+	if err := m.db.Model(&Subscription{}).
+		Where("status <> ? AND period_end <= ? AND (retry_at IS NULL OR retry_at <= ?)", Canceled, now, now).
+		Order("period_end asc").
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	var processed int
+	for _, id := range ids {
+		if err := m.renew(id); err != nil {
+			if err == errSkip {
+				continue
+			}
+			m.l.Errorw("failed to renew subscription", "subscription", id, "error", err.Error())
+			continue
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// renew charges a subscription for its next period, recording a failed
+// renewal if the user can not pay for it
+func (m *Manager) renew(id uint) error {
+	var sub Subscription
+	if err := m.db.First(&sub, id).Error; err != nil {
+		return err
+	}
+	var ended bool
+	err := m.charge(sub.UserName, func(tx *gorm.DB) (float64, string, error) {
+		locked, err := m.lockDue(tx, id)
+		if err != nil {
+			return 0, "", err
+		}
+		if locked.CancelAtPeriodEnd {
+			ended = true
+			return 0, "", m.end(tx, locked, "Your subscription has ended as requested.")
+		}
+		var plan Plan
+		if err := tx.Unscoped().First(&plan, locked.PlanID).Error; err != nil {
+			return 0, "", err
+		}
+		// a subscription that was past due starts its new period
+		// once paid for, rather than when the old period ended
+		start := locked.PeriodEnd
+		if locked.Status == PastDue {
+			start = m.now()
+		}
+		locked.Status = Active
+		locked.PeriodStart = start
+		locked.PeriodEnd = start.AddDate(0, 1, 0)
+		locked.FailedRenewals = 0
+		locked.RetryAt = nil
+		if err := tx.Save(locked).Error; err != nil {
+			return 0, "", err
+		}
+		// the plan may have changed since it was last applied
+		if err := applyPlan(tx, locked.UserName, &plan, true); err != nil {
+			return 0, "", err
+		}
+		return plan.MonthlyPrice, fmt.Sprintf("%s plan renewal", plan.Name), nil
+	})
+	if err == ledger.ErrInsufficientCredits {
+		return m.renewalFailed(id)
+	}
+	if err == nil && !ended {
+		m.l.Infow("subscription renewed", "user", sub.UserName)
+	}
+	return err
+}
+
+// renewalFailed schedules a retry of a renewal the user could not pay
+// for, downgrading them once too many renewals have failed
+func (m *Manager) renewalFailed(id uint) error {
+	return m.transaction(func(tx *gorm.DB) error {
+		sub, err := m.lockDue(tx, id)
+		if err != nil {
+			return err
+		}
+		sub.FailedRenewals++
+		m.l.Warnw("subscription renewal failed", "user", sub.UserName, "attempts", sub.FailedRenewals)
+		if sub.FailedRenewals >= m.opts.MaxFailedRenewals {
+			return m.end(tx, sub, "Your subscription could not be renewed due to insufficient credits, and your account has been downgraded.")
+		}
+		retryAt := m.now().Add(m.opts.RetryInterval)
+		sub.Status = PastDue
+		sub.RetryAt = &retryAt
+		if err := tx.Save(sub).Error; err != nil {
+			return err
+		}
+		return m.notify(tx, sub.UserName, "TEMPORAL Subscription Renewal Failed", fmt.Sprintf(
+			"Your subscription could not be renewed due to insufficient credits. Please add credits or a payment method before %s to keep your plan.",
+			retryAt.Format("January 2, 2006"),
+		))
+	})
+}
+
+// end cancels a subscription, restoring the tier the user had before subscribing
+func (m *Manager) end(tx *gorm.DB, sub *Subscription, reason string) error {
+	sub.Status = Canceled
+	sub.RetryAt = nil
+	if err := tx.Save(sub).Error; err != nil {
+		return err
+	}
+	tier := sub.PreviousTier
+	if tier == "" {
+		tier = models.Free
+	}
+	if err := models.NewUsageManager(tx).UpdateTier(sub.UserName, tier); err != nil {
+		return err
+	}
+	m.l.Infow("subscription ended", "user", sub.UserName, "tier", tier)
+	return m.notify(tx, sub.UserName, "TEMPORAL Subscription Ended", reason)
+}
+
+// notify queues an email to a user, sent once the transaction commits
+func (m *Manager) notify(tx *gorm.DB, username, subject, content string) error {
+	user, err := models.NewUserManager(tx).FindByUserName(username)
+	if err != nil {
+		return err
+	}
+	_, err = queue.Enqueue(tx, queue.EmailSendQueue, queue.EmailSend{
+		Subject:     subject,
+		Content:     content,
+		ContentType: "text/html",
+		UserNames:   []string{username},
+		Emails:      []string{user.EmailAddress},
+	})
+	return err
+}
+
+// charge runs fn, then debits the amount it returns within the same
+// transaction. If the user does not have enough credits, they are topped
+// up from their saved payment method and the charge is retried once
+func (m *Manager) charge(username string, fn func(tx *gorm.DB) (float64, string, error)) error {
+	var amount float64
+	attempt := func() error {
+		return m.transaction(func(tx *gorm.DB) error {
+			var (
+				reason string
+				err    error
+			)
+			amount, reason, err = fn(tx)
+			if err != nil || amount <= 0 {
+				return err
+			}
+			_, err = ledger.NewManager(tx).Debit(username, amount, ledger.Meta{
+				Reason:   reason,
+				CallType: callType,
+			})
+			return err
+		})
+	}
+	err := attempt()
+	if err != ledger.ErrInsufficientCredits || m.topUp == nil {
+		return err
+	}
+	balance, err := models.NewUserManager(m.db).GetCreditsForUser(username)
+	if err != nil {
+		return err
+	}
+	cents := int64(math.Ceil((amount - balance) * 100))
+	if cents < minTopUpCents {
+		cents = minTopUpCents
+	}
+	if err := m.topUp.TopUp(username, cents); err != nil {
+		m.l.Warnw("failed to top up credits", "user", username, "amount_cents", cents, "error", err.Error())
+		return ledger.ErrInsufficientCredits
+	}
+	return attempt()
+}
+
+// remaining returns the fraction of the current period which has not yet elapsed
+func (m *Manager) remaining(sub *Subscription) float64 {
+	total := sub.PeriodEnd.Sub(sub.PeriodStart)
+	left := sub.PeriodEnd.Sub(m.now())
+	if total <= 0 || left <= 0 {
+		return 0
+	}
+	if left > total {
+		return 1
+	}
+	return float64(left) / float64(total)
+}
+
+// lockDue locks a subscription which is due for renewal, skipping
+// subscriptions being renewed elsewhere
+func (m *Manager) lockDue(tx *gorm.DB, id uint) (*Subscription, error) {
+	var sub Subscription
+	err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").First(&sub, id).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, errSkip
+	} else if err != nil {
+		return nil, err
+	}
+	now := m.now()
+	if sub.Status == Canceled || sub.PeriodEnd.After(now) || (sub.RetryAt != nil && sub.RetryAt.After(now)) {
+		return nil, errSkip
+	}
+	return &sub, nil
+}
+
+func (m *Manager) transaction(fn func(tx *gorm.DB) error) error {
+	tx := m.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// lockSubscription fetches the subscription of a user, locking its row until the transaction completes
+func lockSubscription(tx *gorm.DB, username string) (*Subscription, error) {
+	var sub Subscription
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("user_name = ?", username).
+		First(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// applyPlan sets the usage limits of a user to the allowances of a plan,
+// optionally resetting the monthly ipns and pubsub counters
+func applyPlan(tx *gorm.DB, username string, plan *Plan, resetCounters bool) error {
+	updates := map[string]interface{}{
+		"Tier":                  models.Paid,
+		"MonthlyDataLimitBytes": plan.StorageBytes,
+		"IPNSRecordsAllowed":    plan.IPNSRecords,
+		"PubSubMessagesAllowed": plan.PubSubMessages,
+		"KeysAllowed":           plan.Keys,
+	}
+	if resetCounters {
+		updates["IPNSRecordsPublished"] = 0
+		updates["PubSubMessagesSent"] = 0
+	}
+	return tx.Model(&models.Usage{}).Where("user_name = ?", username).Updates(updates).Error
+}
@@ -0,0 +1,317 @@
+package subscription
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/Temporal/ledger"
+	"github.com/RTradeLtd/Temporal/queue"
+	"github.com/RTradeLtd/config/v2"
+	"github.com/RTradeLtd/database/v2"
+	"github.com/RTradeLtd/database/v2/models"
+	"github.com/c2h5oh/datasize"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap/zaptest"
+)
+
+const testUser = "testuser"
+
+// fakeTopUp grants credits through the ledger, as a successful
+// off session payment would
+type fakeTopUp struct {
+	db    *gorm.DB
+	err   error
+	calls int
+}
+
+func (f *fakeTopUp) TopUp(username string, amountCents int64) error {
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	_, err := ledger.NewManager(f.db).Credit(username, ledger.Purchase, float64(amountCents)/100, ledger.Meta{
+		Reason: "test top up",
+	})
+	return err
+}
+
+func TestManager(t *testing.T) {
+	db := loadDatabase(t)
+	m := NewManager(db, zaptest.NewLogger(t).Sugar(), nil, Options{})
+	basic, pro := createPlans(t, m)
+	cleanup := resetSubscription(t, db)
+	defer cleanup()
+	um := models.NewUserManager(db)
+
+	// subscribing charges the first month, and applies the plan limits
+	start := credits(t, um)
+	sub, err := m.Subscribe(testUser, basic.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Status != Active || sub.PlanID != basic.ID {
+		t.Fatalf("unexpected subscription %+v", sub)
+	}
+	assertCharged(t, um, start, basic.MonthlyPrice)
+	usage, err := models.NewUsageManager(db).FindByUserName(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Tier != models.Paid || usage.MonthlyDataLimitBytes != basic.StorageBytes || usage.IPNSRecordsAllowed != basic.IPNSRecords {
+		t.Fatalf("plan limits not applied %+v", usage)
+	}
+	if covered, err := m.Covers(testUser); err != nil {
+		t.Fatal(err)
+	} else if !covered {
+		t.Fatal("user should be covered by their subscription")
+	}
+	// only storage within the paid period is covered
+	if months, err := m.CoveredMonths(testUser, 12); err != nil {
+		t.Fatal(err)
+	} else if months != 1 {
+		t.Fatalf("expected 1 covered month, got %v", months)
+	}
+	// subscribers moved to the paid tier keep the limits of their plan
+	if err := m.SetTier(testUser, models.Paid); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err = models.NewUsageManager(db).FindByUserName(testUser); err != nil {
+		t.Fatal(err)
+	}
+	if usage.MonthlyDataLimitBytes != basic.StorageBytes || usage.KeysAllowed != basic.Keys {
+		t.Fatalf("plan limits not kept %+v", usage)
+	}
+
+	tests := []struct {
+		name    string
+		plan    string
+		wantErr error
+		// wantCharge is the expected charge, negative for credits
+		wantCharge float64
+	}{
+		{"SamePlan", basic.Name, ErrSamePlan, 0},
+		{"UnknownPlan", "unknown-plan", ErrPlanNotFound, 0},
+		{"Upgrade", pro.Name, nil, pro.MonthlyPrice - basic.MonthlyPrice},
+		{"Downgrade", basic.Name, nil, basic.MonthlyPrice - pro.MonthlyPrice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := credits(t, um)
+			if _, err := m.ChangePlan(testUser, tt.plan); err != tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			assertCharged(t, um, before, tt.wantCharge)
+		})
+	}
+	if _, err := m.Subscribe(testUser, pro.Name); err != ErrAlreadySubscribed {
+		t.Fatalf("expected %v, got %v", ErrAlreadySubscribed, err)
+	}
+
+	// subscriptions renew at the end of their period
+	sub, err = m.Find(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return sub.PeriodEnd.Add(time.Minute) }
+	before := credits(t, um)
+	if processed, err := m.RenewDue(); err != nil {
+		t.Fatal(err)
+	} else if processed < 1 {
+		t.Fatal("subscription should have been renewed")
+	}
+	assertCharged(t, um, before, basic.MonthlyPrice)
+	renewed, err := m.Find(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !renewed.PeriodStart.Equal(sub.PeriodEnd) {
+		t.Fatalf("expected period to start at %v, got %v", sub.PeriodEnd, renewed.PeriodStart)
+	}
+
+	// cancelled subscriptions end at the end of their period
+	if err := m.Cancel(testUser); err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return renewed.PeriodEnd.Add(time.Minute) }
+	before = credits(t, um)
+	if _, err := m.RenewDue(); err != nil {
+		t.Fatal(err)
+	}
+	assertCharged(t, um, before, 0)
+	ended, err := m.Find(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ended.Status != Canceled {
+		t.Fatalf("expected status %s, got %s", Canceled, ended.Status)
+	}
+	if err := m.Cancel(testUser); err != ErrNotSubscribed {
+		t.Fatalf("expected %v, got %v", ErrNotSubscribed, err)
+	}
+}
+
+func TestManager_RenewalFailure(t *testing.T) {
+	db := loadDatabase(t)
+	topUp := &fakeTopUp{db: db, err: errors.New("card declined")}
+	m := NewManager(db, zaptest.NewLogger(t).Sugar(), topUp, Options{MaxFailedRenewals: 2})
+	basic, _ := createPlans(t, m)
+	cleanup := resetSubscription(t, db)
+	defer cleanup()
+	sub, err := m.Subscribe(testUser, basic.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// price the plan beyond what the user can afford
+	if err := db.Model(basic).Update("monthly_price", math.MaxInt32*1000.0).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := sub.PeriodEnd.Add(time.Minute)
+	m.now = func() time.Time { return now }
+	if _, err := m.RenewDue(); err != nil {
+		t.Fatal(err)
+	}
+	if topUp.calls != 1 {
+		t.Fatalf("expected 1 top up attempt, got %v", topUp.calls)
+	}
+	pastDue, err := m.Find(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pastDue.Status != PastDue || pastDue.FailedRenewals != 1 || pastDue.RetryAt == nil {
+		t.Fatalf("unexpected subscription %+v", pastDue)
+	}
+	// the plan remains in effect while past due
+	if covered, err := m.Covers(testUser); err != nil {
+		t.Fatal(err)
+	} else if !covered {
+		t.Fatal("user should be covered while past due")
+	}
+	// renewals are not retried before the retry time
+	if _, err := m.RenewDue(); err != nil {
+		t.Fatal(err)
+	}
+	if topUp.calls != 1 {
+		t.Fatal("renewal retried too early")
+	}
+	// the user is downgraded once too many renewals fail
+	now = pastDue.RetryAt.Add(time.Minute)
+	if _, err := m.RenewDue(); err != nil {
+		t.Fatal(err)
+	}
+	ended, err := m.Find(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ended.Status != Canceled {
+		t.Fatalf("expected status %s, got %s", Canceled, ended.Status)
+	}
+	usage, err := models.NewUsageManager(db).FindByUserName(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Tier != sub.PreviousTier {
+		t.Fatalf("expected tier %s, got %s", sub.PreviousTier, usage.Tier)
+	}
+}
+
+func TestManager_TopUp(t *testing.T) {
+	db := loadDatabase(t)
+	topUp := &fakeTopUp{db: db}
+	m := NewManager(db, zaptest.NewLogger(t).Sugar(), topUp, Options{})
+	basic, _ := createPlans(t, m)
+	cleanup := resetSubscription(t, db)
+	defer cleanup()
+	balance := credits(t, models.NewUserManager(db))
+	// price the plan just beyond the users balance
+	if err := db.Model(basic).Update("monthly_price", balance+1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Subscribe(testUser, basic.Name); err != nil {
+		t.Fatal(err)
+	}
+	if topUp.calls != 1 {
+		t.Fatalf("expected 1 top up, got %v", topUp.calls)
+	}
+}
+
+func createPlans(t *testing.T, m *Manager) (*Plan, *Plan) {
+	id := uuid.New().String()
+	basic := &Plan{
+		Name:           "basic-" + id,
+		MonthlyPrice:   5,
+		StorageBytes:   datasize.TB.Bytes(),
+		IPNSRecords:    100,
+		PubSubMessages: 1000,
+		Keys:           10,
+	}
+	pro := &Plan{
+		Name:           "pro-" + id,
+		MonthlyPrice:   20,
+		StorageBytes:   datasize.TB.Bytes() * 10,
+		IPNSRecords:    1000,
+		PubSubMessages: 10000,
+		Keys:           100,
+	}
+	for _, plan := range []*Plan{basic, pro} {
+		if err := m.CreatePlan(plan); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.CreatePlan(&Plan{Name: "free-" + id}); err != ErrInvalidPlan {
+		t.Fatalf("expected %v, got %v", ErrInvalidPlan, err)
+	}
+	return basic, pro
+}
+
+// resetSubscription removes any subscription of the test user, returning
+// a function which restores their usage tier
+func resetSubscription(t *testing.T, db *gorm.DB) func() {
+	usage, err := models.NewUsageManager(db).FindByUserName(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unscoped().Where("user_name = ?", testUser).Delete(&Subscription{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		db.Unscoped().Where("user_name = ?", testUser).Delete(&Subscription{})
+		models.NewUsageManager(db).UpdateTier(testUser, usage.Tier)
+	}
+}
+
+func credits(t *testing.T, um *models.UserManager) float64 {
+	credits, err := um.GetCreditsForUser(testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credits
+}
+
+// assertCharged checks the user was charged the given amount, within a cent
+// to allow for the time that passes while prorating
+func assertCharged(t *testing.T, um *models.UserManager, before, want float64) {
+	t.Helper()
+	if charged := before - credits(t, um); math.Abs(charged-want) > 0.01 {
+		t.Fatalf("expected a charge of %v, got %v", want, charged)
+	}
+}
+
+func loadDatabase(t *testing.T) *gorm.DB {
+	cfg, err := config.LoadConfig("../testenv/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbm, err := database.New(cfg, database.Options{SSLModeDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbm.DB.AutoMigrate(
+		&Plan{}, &Subscription{}, &ledger.Entry{}, &queue.OutboxMessage{},
+	).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dbm.DB
+}